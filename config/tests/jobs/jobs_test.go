@@ -654,7 +654,7 @@ func TestValidPresets(t *testing.T) {
 	}
 
 	for _, presubmit := range c.AllPresubmits(nil) {
-		if presubmit.Spec != nil && !presubmit.Decorate {
+		if presubmit.Spec != nil && !presubmit.ShouldDecorate() {
 			if err := checkKubekinsPresets(presubmit.Name, presubmit.Spec, presubmit.Labels, validLabels); err != nil {
 				t.Errorf("Error in presubmit %q: %v", presubmit.Name, err)
 			}
@@ -662,7 +662,7 @@ func TestValidPresets(t *testing.T) {
 	}
 
 	for _, postsubmit := range c.AllPostsubmits(nil) {
-		if postsubmit.Spec != nil && !postsubmit.Decorate {
+		if postsubmit.Spec != nil && !postsubmit.ShouldDecorate() {
 			if err := checkKubekinsPresets(postsubmit.Name, postsubmit.Spec, postsubmit.Labels, validLabels); err != nil {
 				t.Errorf("Error in postsubmit %q: %v", postsubmit.Name, err)
 			}
@@ -670,7 +670,7 @@ func TestValidPresets(t *testing.T) {
 	}
 
 	for _, periodic := range c.AllPeriodics() {
-		if periodic.Spec != nil && !periodic.Decorate {
+		if periodic.Spec != nil && !periodic.ShouldDecorate() {
 			if err := checkKubekinsPresets(periodic.Name, periodic.Spec, periodic.Labels, validLabels); err != nil {
 				t.Errorf("Error in periodic %q: %v", periodic.Name, err)
 			}
@@ -881,7 +881,7 @@ func checkScenarioArgs(jobName, imageName string, args []string) error {
 // TestValidScenarioArgs makes sure all scenario args in job configs are valid
 func TestValidScenarioArgs(t *testing.T) {
 	for _, job := range c.AllPresubmits(nil) {
-		if job.Spec != nil && !job.Decorate {
+		if job.Spec != nil && !job.ShouldDecorate() {
 			if err := checkScenarioArgs(job.Name, job.Spec.Containers[0].Image, job.Spec.Containers[0].Args); err != nil {
 				t.Errorf("Invalid Scenario Args : %s", err)
 			}
@@ -889,7 +889,7 @@ func TestValidScenarioArgs(t *testing.T) {
 	}
 
 	for _, job := range c.AllPostsubmits(nil) {
-		if job.Spec != nil && !job.Decorate {
+		if job.Spec != nil && !job.ShouldDecorate() {
 			if err := checkScenarioArgs(job.Name, job.Spec.Containers[0].Image, job.Spec.Containers[0].Args); err != nil {
 				t.Errorf("Invalid Scenario Args : %s", err)
 			}
@@ -897,7 +897,7 @@ func TestValidScenarioArgs(t *testing.T) {
 	}
 
 	for _, job := range c.AllPeriodics() {
-		if job.Spec != nil && !job.Decorate {
+		if job.Spec != nil && !job.ShouldDecorate() {
 			if err := checkScenarioArgs(job.Name, job.Spec.Containers[0].Image, job.Spec.Containers[0].Args); err != nil {
 				t.Errorf("Invalid Scenario Args : %s", err)
 			}
@@ -59,6 +59,9 @@ const (
 	AbortedState ProwJobState = "aborted"
 	// ErrorState means the job could not schedule (bad config, perhaps).
 	ErrorState ProwJobState = "error"
+	// WaitingForApprovalState means the job has been created but will not
+	// be scheduled until one of its approvers approves it.
+	WaitingForApprovalState ProwJobState = "waiting-for-approval"
 )
 
 // ProwJobAgent specifies the controller (such as plank or jenkins-agent) that runs the job.
@@ -105,6 +108,10 @@ type ProwJobSpec struct {
 	// to run the job, only applicable for that
 	// specific agent
 	Cluster string `json:"cluster,omitempty"`
+	// Clusters are the build clusters that the job may run in. Plank
+	// selects one of them when it starts the job and records it in
+	// Cluster. Only applicable for the kubernetes agent.
+	Clusters []EligibleCluster `json:"clusters,omitempty"`
 	// Namespace defines where to create pods/resources.
 	Namespace string `json:"namespace,omitempty"`
 	// Job is the name of the job
@@ -128,11 +135,24 @@ type ProwJobSpec struct {
 	// MaxConcurrency restricts the total number of instances
 	// of this job that can run in parallel at once
 	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// Priority orders triggered ProwJobs waiting to be started,
+	// higher priorities first. 0 implies the default priority
+	// configured for the job type.
+	Priority int `json:"priority,omitempty"`
 	// ErrorOnEviction indicates that the ProwJob should be completed and given
 	// the ErrorState status if the pod that is executing the job is evicted.
 	// If this field is unspecified or false, a new pod will be created to replace
 	// the evicted one.
 	ErrorOnEviction bool `json:"error_on_eviction,omitempty"`
+	// Retry is the policy for retrying the job in a new ProwJob when
+	// it fails for reasons unrelated to the code under test.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+	// Approvers are the GitHub logins of the users that may approve
+	// the job. A job with approvers is created waiting for approval.
+	Approvers []string `json:"approvers,omitempty"`
+	// ReporterConfig configures the reports of the job that are
+	// not sent to the source of its code, e.g. to Slack or webhooks.
+	ReporterConfig *ReporterConfig `json:"reporter_config,omitempty"`
 
 	// PodSpec provides the basis for running the test under
 	// a Kubernetes agent
@@ -146,6 +166,82 @@ type ProwJobSpec struct {
 	// DecorationConfig holds configuration options for
 	// decorating PodSpecs that users provide
 	DecorationConfig *DecorationConfig `json:"decoration_config,omitempty"`
+
+	// RunAfterSuccess are the jobs that will be triggered
+	// once this job has completed successfully
+	RunAfterSuccess []ProwJobSpec `json:"run_after_success,omitempty"`
+}
+
+// RetryReason is a class of failure that may warrant a retry.
+type RetryReason string
+
+// Various failure classes a job may be retried for.
+const (
+	// RetryOnEviction retries jobs whose pod was evicted.
+	RetryOnEviction RetryReason = "eviction"
+	// RetryOnPodPendingTimeout retries jobs whose pod was stuck in
+	// pending for longer than the pod pending timeout.
+	RetryOnPodPendingTimeout RetryReason = "pod_pending_timeout"
+	// RetryOnCloneFailure retries decorated jobs whose refs could
+	// not be cloned, as reported by the initupload container.
+	RetryOnCloneFailure RetryReason = "clone_failure"
+)
+
+// RetryPolicy configures automatic retries of a job.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts at running
+	// the job, including the first one.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// On lists the failure classes that warrant a retry.
+	// If empty, all failure classes are retried.
+	On []RetryReason `json:"on,omitempty"`
+}
+
+// ShouldRetry determines if a new attempt should be made after the
+// attempt that was preceded by the given number of retries failed
+// for the given reason.
+func (r *RetryPolicy) ShouldRetry(reason RetryReason, retries int) bool {
+	if r == nil || retries+1 >= r.MaxAttempts {
+		return false
+	}
+	if len(r.On) == 0 {
+		return true
+	}
+	for _, on := range r.On {
+		if on == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// ReporterConfig configures the reporters that are set up per job.
+type ReporterConfig struct {
+	Slack    *SlackReporterConfig    `json:"slack,omitempty"`
+	Webhooks []WebhookReporterConfig `json:"webhooks,omitempty"`
+}
+
+// SlackReporterConfig configures the messages that are sent to Slack
+// about a job.
+type SlackReporterConfig struct {
+	// Channel is the Slack channel that the messages are sent to.
+	Channel string `json:"channel"`
+	// JobStatesToReport are the states of the job that are reported.
+	// If empty, the failure and error states are reported.
+	JobStatesToReport []ProwJobState `json:"job_states_to_report,omitempty"`
+	// ReportTemplate is a Go template for the text of the messages,
+	// executed on the ProwJob. If empty, a summary of the job is sent.
+	ReportTemplate string `json:"report_template,omitempty"`
+}
+
+// WebhookReporterConfig configures an HTTP endpoint that the state
+// changes of a job are POSTed to.
+type WebhookReporterConfig struct {
+	// URL is the endpoint that the payloads are POSTed to.
+	URL string `json:"url"`
+	// JobStatesToReport are the states of the job that are reported.
+	// If empty, every state is reported.
+	JobStatesToReport []ProwJobState `json:"job_states_to_report,omitempty"`
 }
 
 // DecorationConfig specifies how to augment pods.
@@ -401,6 +497,14 @@ type ProwJobStatus struct {
 	// PrevReportStates stores the previous reported prowjob state per reporter
 	// So crier won't make duplicated report attempt
 	PrevReportStates map[string]ProwJobState `json:"prev_report_states,omitempty"`
+
+	// Retries is the number of attempts at running the job that
+	// preceded this one.
+	Retries int `json:"retries,omitempty"`
+	// PrevAttempt is the name of the ProwJob that this ProwJob retries.
+	PrevAttempt string `json:"prev_attempt,omitempty"`
+	// NextAttempt is the name of the ProwJob that retries this ProwJob.
+	NextAttempt string `json:"next_attempt,omitempty"`
 }
 
 // Complete returns true if the prow job has finished
@@ -415,6 +519,15 @@ func (j *ProwJob) SetComplete() {
 	*j.Status.CompletionTime = metav1.Now()
 }
 
+// EligibleCluster is a build cluster that a ProwJob may run in.
+type EligibleCluster struct {
+	// Name is the alias of the build cluster.
+	Name string `json:"name"`
+	// Weight is the relative share of ProwJobs that the cluster gets
+	// when the eligible clusters are equally loaded. Defaults to 1.
+	Weight int `json:"weight,omitempty"`
+}
+
 // ClusterAlias specifies the key in the clusters map to use.
 //
 // This allows scheduling a prow job somewhere aside from the default build cluster.
@@ -255,3 +255,56 @@ func TestRefsToString(t *testing.T) {
 		}
 	}
 }
+
+func TestShouldRetry(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		policy   *RetryPolicy
+		reason   RetryReason
+		retries  int
+		expected bool
+	}{
+		{
+			name:     "no policy means no retries",
+			reason:   RetryOnEviction,
+			expected: false,
+		},
+		{
+			name:     "single attempt means no retries",
+			policy:   &RetryPolicy{MaxAttempts: 1},
+			reason:   RetryOnEviction,
+			expected: false,
+		},
+		{
+			name:     "all reasons are retried by default",
+			policy:   &RetryPolicy{MaxAttempts: 2},
+			reason:   RetryOnCloneFailure,
+			expected: true,
+		},
+		{
+			name:     "listed reason is retried",
+			policy:   &RetryPolicy{MaxAttempts: 2, On: []RetryReason{RetryOnPodPendingTimeout}},
+			reason:   RetryOnPodPendingTimeout,
+			expected: true,
+		},
+		{
+			name:     "unlisted reason is not retried",
+			policy:   &RetryPolicy{MaxAttempts: 2, On: []RetryReason{RetryOnPodPendingTimeout}},
+			reason:   RetryOnEviction,
+			expected: false,
+		},
+		{
+			name:     "exhausted attempts are not retried",
+			policy:   &RetryPolicy{MaxAttempts: 3},
+			reason:   RetryOnEviction,
+			retries:  2,
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		if actual := tc.policy.ShouldRetry(tc.reason, tc.retries); actual != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.name, tc.expected, actual)
+		}
+	}
+}
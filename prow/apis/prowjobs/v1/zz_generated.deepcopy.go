@@ -67,6 +67,22 @@ func (in *DecorationConfig) DeepCopy() *DecorationConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EligibleCluster) DeepCopyInto(out *EligibleCluster) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EligibleCluster.
+func (in *EligibleCluster) DeepCopy() *EligibleCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(EligibleCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GCSConfiguration) DeepCopyInto(out *GCSConfiguration) {
 	*out = *in
@@ -147,6 +163,11 @@ func (in *ProwJobList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProwJobSpec) DeepCopyInto(out *ProwJobSpec) {
 	*out = *in
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]EligibleCluster, len(*in))
+		copy(*out, *in)
+	}
 	if in.Refs != nil {
 		in, out := &in.Refs, &out.Refs
 		*out = new(Refs)
@@ -174,6 +195,28 @@ func (in *ProwJobSpec) DeepCopyInto(out *ProwJobSpec) {
 		*out = new(DecorationConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Retry != nil {
+		in, out := &in.Retry, &out.Retry
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Approvers != nil {
+		in, out := &in.Approvers, &out.Approvers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReporterConfig != nil {
+		in, out := &in.ReporterConfig, &out.ReporterConfig
+		*out = new(ReporterConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RunAfterSuccess != nil {
+		in, out := &in.RunAfterSuccess, &out.RunAfterSuccess
+		*out = make([]ProwJobSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -252,6 +295,76 @@ func (in *Refs) DeepCopy() *Refs {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReporterConfig) DeepCopyInto(out *ReporterConfig) {
+	*out = *in
+	if in.Slack != nil {
+		in, out := &in.Slack, &out.Slack
+		*out = new(SlackReporterConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Webhooks != nil {
+		in, out := &in.Webhooks, &out.Webhooks
+		*out = make([]WebhookReporterConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReporterConfig.
+func (in *ReporterConfig) DeepCopy() *ReporterConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ReporterConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.On != nil {
+		in, out := &in.On, &out.On
+		*out = make([]RetryReason, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SlackReporterConfig) DeepCopyInto(out *SlackReporterConfig) {
+	*out = *in
+	if in.JobStatesToReport != nil {
+		in, out := &in.JobStatesToReport, &out.JobStatesToReport
+		*out = make([]ProwJobState, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SlackReporterConfig.
+func (in *SlackReporterConfig) DeepCopy() *SlackReporterConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SlackReporterConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UtilityImages) DeepCopyInto(out *UtilityImages) {
 	*out = *in
@@ -267,3 +380,24 @@ func (in *UtilityImages) DeepCopy() *UtilityImages {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookReporterConfig) DeepCopyInto(out *WebhookReporterConfig) {
+	*out = *in
+	if in.JobStatesToReport != nil {
+		in, out := &in.JobStatesToReport, &out.JobStatesToReport
+		*out = make([]ProwJobState, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookReporterConfig.
+func (in *WebhookReporterConfig) DeepCopy() *WebhookReporterConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookReporterConfig)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -259,6 +259,7 @@ type reconciler interface {
 	updateProwJob(pj *prowjobv1.ProwJob) (*prowjobv1.ProwJob, error)
 	now() metav1.Time
 	buildID(prowjobv1.ProwJob) (string, string, error)
+	allowCancellations() bool
 }
 
 func (c *controller) getProwJob(name string) (*prowjobv1.ProwJob, error) {
@@ -297,6 +298,12 @@ func (c *controller) now() metav1.Time {
 	return metav1.Now()
 }
 
+// allowCancellations shares the setting of plank, which stops the pods of
+// aborted prowjobs the same way.
+func (c *controller) allowCancellations() bool {
+	return c.config().Plank.AllowCancellations
+}
+
 func (c *controller) buildID(pj prowjobv1.ProwJob) (string, string, error) {
 	id, err := pjutil.GetBuildID(pj.Spec.Job, c.totURL)
 	if err != nil {
@@ -372,6 +379,15 @@ func reconcile(c reconciler, key string) error {
 		}
 		return nil
 	case finalState(pj.Status.State):
+		// Stop the build of a prowjob that was aborted while it ran,
+		// like a presubmit for a closed PR, if cancellations are allowed.
+		if pj.Status.State == prowjobv1.AbortedState && haveBuild && !buildFinished(b) && c.allowCancellations() {
+			logrus.Infof("Delete builds/%s of aborted prowjob", key)
+			if err = c.deleteBuild(ctx, namespace, name); err != nil {
+				return fmt.Errorf("delete build: %v", err)
+			}
+			return nil
+		}
 		logrus.Infof("Observed finished %s", key)
 		return nil
 	case wantBuild && pj.Spec.BuildSpec == nil:
@@ -416,6 +432,12 @@ func reconcile(c reconciler, key string) error {
 	return nil
 }
 
+// buildFinished returns true if the build has already finished
+func buildFinished(b *buildv1alpha1.Build) bool {
+	state, _ := prowJobStatus(b.Status)
+	return finalState(state)
+}
+
 // finalState returns true if the prowjob has already finished
 func finalState(status prowjobv1.ProwJobState) bool {
 	switch status {
@@ -47,9 +47,10 @@ const (
 )
 
 type fakeReconciler struct {
-	jobs   map[string]prowjobv1.ProwJob
-	builds map[string]buildv1alpha1.Build
-	nows   metav1.Time
+	jobs          map[string]prowjobv1.ProwJob
+	builds        map[string]buildv1alpha1.Build
+	nows          metav1.Time
+	cancellations bool
 }
 
 func (r *fakeReconciler) now() metav1.Time {
@@ -60,6 +61,10 @@ func (r *fakeReconciler) now() metav1.Time {
 const fakePJCtx = "prow-context"
 const fakePJNS = "prow-job"
 
+func (r *fakeReconciler) allowCancellations() bool {
+	return r.cancellations
+}
+
 func (r *fakeReconciler) getProwJob(name string) (*prowjobv1.ProwJob, error) {
 	if name == errorGetProwJob {
 		return nil, errors.New("injected get prowjob error")
@@ -231,6 +236,7 @@ func TestReconcile(t *testing.T) {
 		observedBuild *buildv1alpha1.Build
 		expectedJob   func(prowjobv1.ProwJob, buildv1alpha1.Build) prowjobv1.ProwJob
 		expectedBuild func(prowjobv1.ProwJob, buildv1alpha1.Build) buildv1alpha1.Build
+		cancellations bool
 		err           bool
 	}{
 		{
@@ -300,6 +306,92 @@ func TestReconcile(t *testing.T) {
 			},
 			expectedJob: noJobChange,
 		},
+		{
+			name: "delete running build of aborted prowjob",
+			observedJob: &prowjobv1.ProwJob{
+				Spec: prowjobv1.ProwJobSpec{
+					Agent:     prowjobv1.KnativeBuildAgent,
+					BuildSpec: &buildSpec,
+				},
+				Status: prowjobv1.ProwJobStatus{
+					State: prowjobv1.AbortedState,
+				},
+			},
+			observedBuild: func() *buildv1alpha1.Build {
+				pj := prowjobv1.ProwJob{}
+				pj.Spec.Type = prowjobv1.PeriodicJob
+				pj.Spec.Agent = prowjobv1.KnativeBuildAgent
+				pj.Spec.BuildSpec = &buildSpec
+				pj.Status.BuildID = randomBuildID
+				b, err := makeBuild(pj)
+				if err != nil {
+					panic(err)
+				}
+				b.Status.StartTime = now
+				return b
+			}(),
+			cancellations: true,
+			expectedJob:   noJobChange,
+		},
+		{
+			name: "keep running build of aborted prowjob when cancellations are not allowed",
+			observedJob: &prowjobv1.ProwJob{
+				Spec: prowjobv1.ProwJobSpec{
+					Agent:     prowjobv1.KnativeBuildAgent,
+					BuildSpec: &buildSpec,
+				},
+				Status: prowjobv1.ProwJobStatus{
+					State: prowjobv1.AbortedState,
+				},
+			},
+			observedBuild: func() *buildv1alpha1.Build {
+				pj := prowjobv1.ProwJob{}
+				pj.Spec.Type = prowjobv1.PeriodicJob
+				pj.Spec.Agent = prowjobv1.KnativeBuildAgent
+				pj.Spec.BuildSpec = &buildSpec
+				pj.Status.BuildID = randomBuildID
+				b, err := makeBuild(pj)
+				if err != nil {
+					panic(err)
+				}
+				b.Status.StartTime = now
+				return b
+			}(),
+			expectedJob:   noJobChange,
+			expectedBuild: noBuildChange,
+		},
+		{
+			name: "keep finished build of aborted prowjob",
+			observedJob: &prowjobv1.ProwJob{
+				Spec: prowjobv1.ProwJobSpec{
+					Agent:     prowjobv1.KnativeBuildAgent,
+					BuildSpec: &buildSpec,
+				},
+				Status: prowjobv1.ProwJobStatus{
+					State: prowjobv1.AbortedState,
+				},
+			},
+			observedBuild: func() *buildv1alpha1.Build {
+				pj := prowjobv1.ProwJob{}
+				pj.Spec.Type = prowjobv1.PeriodicJob
+				pj.Spec.Agent = prowjobv1.KnativeBuildAgent
+				pj.Spec.BuildSpec = &buildSpec
+				pj.Status.BuildID = randomBuildID
+				b, err := makeBuild(pj)
+				if err != nil {
+					panic(err)
+				}
+				b.Status.SetCondition(&duckv1alpha1.Condition{
+					Type:   buildv1alpha1.BuildSucceeded,
+					Status: corev1.ConditionFalse,
+				})
+				b.Status.CompletionTime = now
+				b.Status.StartTime = now
+				return b
+			}(),
+			expectedJob:   noJobChange,
+			expectedBuild: noBuildChange,
+		},
 		{
 			name: "delete build after deleting prowjob",
 			observedBuild: func() *buildv1alpha1.Build {
@@ -702,9 +794,10 @@ func TestReconcile(t *testing.T) {
 			bk := toKey(tc.context, tc.namespace, name)
 			jk := toKey(fakePJCtx, fakePJNS, name)
 			r := &fakeReconciler{
-				jobs:   map[string]prowjobv1.ProwJob{},
-				builds: map[string]buildv1alpha1.Build{},
-				nows:   now,
+				jobs:          map[string]prowjobv1.ProwJob{},
+				builds:        map[string]buildv1alpha1.Build{},
+				nows:          now,
+				cancellations: tc.cancellations,
 			}
 			if j := tc.observedJob; j != nil {
 				j.Name = name
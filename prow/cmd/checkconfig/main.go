@@ -48,6 +48,7 @@ import (
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/plugins"
 	"k8s.io/test-infra/prow/plugins/lgtm"
+	"sigs.k8s.io/yaml"
 )
 
 type options struct {
@@ -57,6 +58,8 @@ type options struct {
 
 	warnings flagutil.Strings
 	strict   bool
+
+	printJob string
 }
 
 func reportWarning(strict bool, errs errorutil.Aggregate) {
@@ -123,6 +126,7 @@ func gatherOptions() options {
 	flag.StringVar(&o.pluginConfig, "plugin-config", "", "Path to plugin config file.")
 	flag.Var(&o.warnings, "warnings", "Comma-delimited list of warnings to validate.")
 	flag.BoolVar(&o.strict, "strict", false, "If set, consider all warnings as errors.")
+	flag.StringVar(&o.printJob, "print-job", "", "If set, print the jobs with this name as they are resolved from templates and defaults.")
 	flag.Parse()
 	return o
 }
@@ -148,6 +152,14 @@ func main() {
 	}
 	cfg := configAgent.Config()
 
+	if o.printJob != "" {
+		out, err := resolvedJobs(cfg.JobConfig, o.printJob)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error printing job.")
+		}
+		fmt.Print(string(out))
+	}
+
 	pluginAgent := plugins.ConfigAgent{}
 	var pcfg *plugins.Configuration
 	if o.pluginConfig != "" {
@@ -202,6 +214,41 @@ func main() {
 	}
 }
 
+// resolvedJobs returns the YAML of the jobs with the given name, keyed by
+// their type, after templates, matrices and defaults have been applied.
+func resolvedJobs(c config.JobConfig, name string) ([]byte, error) {
+	resolved := config.JobConfig{}
+	for repo, jobs := range c.Presubmits {
+		for _, job := range jobs {
+			if job.Name == name {
+				if resolved.Presubmits == nil {
+					resolved.Presubmits = map[string][]config.Presubmit{}
+				}
+				resolved.Presubmits[repo] = append(resolved.Presubmits[repo], job)
+			}
+		}
+	}
+	for repo, jobs := range c.Postsubmits {
+		for _, job := range jobs {
+			if job.Name == name {
+				if resolved.Postsubmits == nil {
+					resolved.Postsubmits = map[string][]config.Postsubmit{}
+				}
+				resolved.Postsubmits[repo] = append(resolved.Postsubmits[repo], job)
+			}
+		}
+	}
+	for _, job := range c.Periodics {
+		if job.Name == name {
+			resolved.Periodics = append(resolved.Periodics, job)
+		}
+	}
+	if len(resolved.Presubmits) == 0 && len(resolved.Postsubmits) == 0 && len(resolved.Periodics) == 0 {
+		return nil, fmt.Errorf("no job named %q", name)
+	}
+	return yaml.Marshal(resolved)
+}
+
 func validateURLs(c config.ProwConfig) error {
 	var validationErrs []error
 
@@ -528,19 +575,19 @@ func ensureValidConfiguration(plugin, label, verb string, tideSubSet, tideSuperS
 func validateDecoratedJobs(cfg *config.Config) error {
 	var nonDecoratedJobs []string
 	for _, presubmit := range cfg.AllPresubmits([]string{}) {
-		if presubmit.Agent == string(v1.KubernetesAgent) && !presubmit.Decorate {
+		if presubmit.Agent == string(v1.KubernetesAgent) && !presubmit.ShouldDecorate() {
 			nonDecoratedJobs = append(nonDecoratedJobs, presubmit.Name)
 		}
 	}
 
 	for _, postsubmit := range cfg.AllPostsubmits([]string{}) {
-		if postsubmit.Agent == string(v1.KubernetesAgent) && !postsubmit.Decorate {
+		if postsubmit.Agent == string(v1.KubernetesAgent) && !postsubmit.ShouldDecorate() {
 			nonDecoratedJobs = append(nonDecoratedJobs, postsubmit.Name)
 		}
 	}
 
 	for _, periodic := range cfg.AllPeriodics() {
-		if periodic.Agent == string(v1.KubernetesAgent) && !periodic.Decorate {
+		if periodic.Agent == string(v1.KubernetesAgent) && !periodic.ShouldDecorate() {
 			nonDecoratedJobs = append(nonDecoratedJobs, periodic.Name)
 		}
 	}
@@ -22,6 +22,8 @@ import (
 
 	"k8s.io/apimachinery/pkg/util/diff"
 	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
 )
 
 func TestEnsureValidConfiguration(t *testing.T) {
@@ -357,3 +359,41 @@ func TestOrgRepoUnion(t *testing.T) {
 		})
 	}
 }
+
+func TestResolvedJobs(t *testing.T) {
+	c := config.JobConfig{
+		Presubmits: map[string][]config.Presubmit{
+			"org/repo":  {{JobBase: config.JobBase{Name: "unit"}}, {JobBase: config.JobBase{Name: "e2e"}}},
+			"org/other": {{JobBase: config.JobBase{Name: "unit"}}},
+		},
+		Periodics: []config.Periodic{{JobBase: config.JobBase{Name: "ci-unit"}}},
+	}
+
+	out, err := resolvedJobs(c, "unit")
+	if err != nil {
+		t.Fatalf("expected no error but got one: %v", err)
+	}
+	expected := `presubmits:
+  org/other:
+  - agent: ""
+    always_run: false
+    context: ""
+    name: unit
+    rerun_command: ""
+    trigger: ""
+  org/repo:
+  - agent: ""
+    always_run: false
+    context: ""
+    name: unit
+    rerun_command: ""
+    trigger: ""
+`
+	if string(out) != expected {
+		t.Errorf("printed jobs differ from expected: %s", diff.StringDiff(expected, string(out)))
+	}
+
+	if _, err := resolvedJobs(c, "missing"); err == nil {
+		t.Error("expected an error for a missing job but got none")
+	}
+}
@@ -62,6 +62,34 @@ func TestOptions(t *testing.T) {
 				configPath: "foo",
 			},
 		},
+		{
+			name: "slack",
+			args: []string{"--slack-workers=2", "--slack-token-file=/etc/slack/token", "--config-path=foo"},
+			expected: &options{
+				slackWorkers:   2,
+				slackTokenFile: "/etc/slack/token",
+				gerritProjects: gerritclient.ProjectsFlag{},
+				configPath:     "foo",
+			},
+		},
+		{
+			name: "slack missing --slack-token-file, reject",
+			args: []string{"--slack-workers=2", "--config-path=foo"},
+		},
+		{
+			name: "webhook",
+			args: []string{"--webhook-workers=3", "--webhook-hmac-secret-file=/etc/webhook/hmac", "--config-path=foo"},
+			expected: &options{
+				webhookWorkers:        3,
+				webhookHmacSecretFile: "/etc/webhook/hmac",
+				gerritProjects:        gerritclient.ProjectsFlag{},
+				configPath:            "foo",
+			},
+		},
+		{
+			name: "webhook missing --webhook-hmac-secret-file, reject",
+			args: []string{"--webhook-workers=3", "--config-path=foo"},
+		},
 	}
 
 	for _, tc := range cases {
@@ -388,6 +388,10 @@ func prodOnlyMain(cfg config.Getter, o options, mux *http.ServeMux) *http.ServeM
 		mux.Handle("/github-login", goa.HandleLogin(oauthClient))
 		// Handles redirect from GitHub OAuth server.
 		mux.Handle("/github-login/redirect", goa.HandleRedirect(oauthClient, githuboauth.NewGitHubClientGetter()))
+		// Handles approvals of ProwJobs by logged in users.
+		mux.Handle("/approve", handleApproval(prowJobClient, func(r *http.Request) (string, error) {
+			return goa.GetLogin(r, githuboauth.NewGitHubClientGetter())
+		}))
 	}
 
 	// optionally inject http->https redirect handler when behind loadbalancer
@@ -1029,6 +1033,100 @@ func handleRerun(prowJobClient prowv1.ProwJobInterface) http.HandlerFunc {
 	}
 }
 
+// sameOrigin reports whether a request was sent from a page served by deck
+// itself, according to its Origin header or, for browsers that do not send
+// one, its Referer header. Requests that change state are only authenticated
+// by the session cookie, which the browser also sends along with requests
+// that other sites forge.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return false
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+// handleApproval approves or denies a ProwJob that is waiting for approval
+// on behalf of the GitHub user that is logged in, recording who did so and
+// when in annotations on the ProwJob.
+func handleApproval(prowJobClient prowv1.ProwJobInterface, getLogin func(*http.Request) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "request must be a POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if !sameOrigin(r) {
+			http.Error(w, "request must come from a page of deck", http.StatusForbidden)
+			return
+		}
+		name := r.URL.Query().Get("prowjob")
+		if name == "" {
+			http.Error(w, "request did not provide the 'prowjob' query parameter", http.StatusBadRequest)
+			return
+		}
+		action := r.URL.Query().Get("action")
+		if action != "approve" && action != "deny" {
+			http.Error(w, "the 'action' query parameter must be 'approve' or 'deny'", http.StatusBadRequest)
+			return
+		}
+		login, err := getLogin(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("GitHub login required: %v", err), http.StatusUnauthorized)
+			return
+		}
+		pj, err := prowJobClient.Get(name, metav1.GetOptions{})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ProwJob not found: %v", err), http.StatusNotFound)
+			logrus.WithError(err).Warning("ProwJob not found.")
+			return
+		}
+		if pj.Status.State != prowapi.WaitingForApprovalState {
+			http.Error(w, fmt.Sprintf("ProwJob is %s, not waiting for approval", pj.Status.State), http.StatusConflict)
+			return
+		}
+		var approver bool
+		for _, a := range pj.Spec.Approvers {
+			if strings.EqualFold(a, login) {
+				approver = true
+				break
+			}
+		}
+		if !approver {
+			http.Error(w, fmt.Sprintf("%s is not an approver of %s", login, pj.Spec.Job), http.StatusForbidden)
+			return
+		}
+
+		if pj.ObjectMeta.Annotations == nil {
+			pj.ObjectMeta.Annotations = map[string]string{}
+		}
+		pj.ObjectMeta.Annotations[kube.ApprovalTimeAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		if action == "approve" {
+			pj.ObjectMeta.Annotations[kube.ApprovedByAnnotation] = login
+			pj.Status.State = prowapi.TriggeredState
+			pj.Status.Description = fmt.Sprintf("Approved by %s.", login)
+		} else {
+			pj.ObjectMeta.Annotations[kube.DeniedByAnnotation] = login
+			pj.SetComplete()
+			pj.Status.State = prowapi.AbortedState
+			pj.Status.Description = fmt.Sprintf("Denied by %s.", login)
+		}
+		if _, err := prowJobClient.Update(pj); err != nil {
+			http.Error(w, fmt.Sprintf("Error updating ProwJob: %v", err), http.StatusInternalServerError)
+			logrus.WithError(err).Error("Error updating ProwJob.")
+			return
+		}
+		logrus.WithFields(logrus.Fields{"prowjob": name, "job": pj.Spec.Job, "user": login, "action": action}).Info("ProwJob approval handled.")
+		fmt.Fprint(w, pj.Status.Description)
+	}
+}
+
 func handleConfig(cfg config.Getter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// TODO: add the ability to query for portions of the config?
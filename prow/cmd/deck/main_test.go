@@ -42,6 +42,7 @@ import (
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/client/clientset/versioned/fake"
 	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/pluginhelp"
 	"k8s.io/test-infra/prow/tide"
 	"k8s.io/test-infra/prow/tide/history"
@@ -249,6 +250,152 @@ func TestRerun(t *testing.T) {
 	}
 }
 
+func TestHandleApproval(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		action         string
+		login          string
+		origin         string
+		state          prowapi.ProwJobState
+		expectedCode   int
+		expectedState  prowapi.ProwJobState
+		expectedAuthor string
+	}{
+		{
+			name:           "approver approves",
+			method:         http.MethodPost,
+			action:         "approve",
+			login:          "Approver",
+			state:          prowapi.WaitingForApprovalState,
+			expectedCode:   http.StatusOK,
+			expectedState:  prowapi.TriggeredState,
+			expectedAuthor: kube.ApprovedByAnnotation,
+		},
+		{
+			name:           "approver denies",
+			method:         http.MethodPost,
+			action:         "deny",
+			login:          "approver",
+			state:          prowapi.WaitingForApprovalState,
+			expectedCode:   http.StatusOK,
+			expectedState:  prowapi.AbortedState,
+			expectedAuthor: kube.DeniedByAnnotation,
+		},
+		{
+			name:          "other users are forbidden",
+			method:        http.MethodPost,
+			action:        "approve",
+			login:         "someone",
+			state:         prowapi.WaitingForApprovalState,
+			expectedCode:  http.StatusForbidden,
+			expectedState: prowapi.WaitingForApprovalState,
+		},
+		{
+			name:          "users that are not logged in are unauthorized",
+			method:        http.MethodPost,
+			action:        "approve",
+			state:         prowapi.WaitingForApprovalState,
+			expectedCode:  http.StatusUnauthorized,
+			expectedState: prowapi.WaitingForApprovalState,
+		},
+		{
+			name:          "jobs that are not waiting cannot be approved",
+			method:        http.MethodPost,
+			action:        "approve",
+			login:         "approver",
+			state:         prowapi.PendingState,
+			expectedCode:  http.StatusConflict,
+			expectedState: prowapi.PendingState,
+		},
+		{
+			name:          "GET is not allowed",
+			method:        http.MethodGet,
+			action:        "approve",
+			login:         "approver",
+			state:         prowapi.WaitingForApprovalState,
+			expectedCode:  http.StatusMethodNotAllowed,
+			expectedState: prowapi.WaitingForApprovalState,
+		},
+		{
+			name:          "unknown action is rejected",
+			method:        http.MethodPost,
+			action:        "maybe",
+			login:         "approver",
+			state:         prowapi.WaitingForApprovalState,
+			expectedCode:  http.StatusBadRequest,
+			expectedState: prowapi.WaitingForApprovalState,
+		},
+		{
+			name:          "requests from other sites are forbidden",
+			method:        http.MethodPost,
+			action:        "approve",
+			login:         "approver",
+			origin:        "https://evil.example.com",
+			state:         prowapi.WaitingForApprovalState,
+			expectedCode:  http.StatusForbidden,
+			expectedState: prowapi.WaitingForApprovalState,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeProwJobClient := fake.NewSimpleClientset(&prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "wowsuch",
+					Namespace: "prowjobs",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Job:       "deploy-staging",
+					Type:      prowapi.PostsubmitJob,
+					Approvers: []string{"approver"},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: tc.state,
+				},
+			})
+			pjClient := fakeProwJobClient.ProwV1().ProwJobs("prowjobs")
+			getLogin := func(*http.Request) (string, error) {
+				if tc.login == "" {
+					return "", errors.New("not logged in")
+				}
+				return tc.login, nil
+			}
+			req, err := http.NewRequest(tc.method, "/approve?prowjob=wowsuch&action="+tc.action, nil)
+			if err != nil {
+				t.Fatalf("Error making request: %v", err)
+			}
+			req.Host = "prow.example.com"
+			origin := tc.origin
+			if origin == "" {
+				origin = "https://prow.example.com"
+			}
+			req.Header.Set("Origin", origin)
+			rr := httptest.NewRecorder()
+			handleApproval(pjClient, getLogin).ServeHTTP(rr, req)
+			if rr.Code != tc.expectedCode {
+				t.Errorf("Expected status code %d, got %d: %s", tc.expectedCode, rr.Code, rr.Body.String())
+			}
+
+			pj, err := pjClient.Get("wowsuch", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Error getting ProwJob: %v", err)
+			}
+			if pj.Status.State != tc.expectedState {
+				t.Errorf("Expected state %s, got %s", tc.expectedState, pj.Status.State)
+			}
+			if tc.expectedAuthor != "" {
+				if author := pj.ObjectMeta.Annotations[tc.expectedAuthor]; author != tc.login {
+					t.Errorf("Expected annotation %s to be %q, got %q", tc.expectedAuthor, tc.login, author)
+				}
+				if pj.ObjectMeta.Annotations[kube.ApprovalTimeAnnotation] == "" {
+					t.Errorf("Expected annotation %s to be set", kube.ApprovalTimeAnnotation)
+				}
+			}
+		})
+	}
+}
+
 func TestTide(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		pools := []tide.Pool{
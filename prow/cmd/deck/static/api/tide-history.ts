@@ -10,4 +10,10 @@ export interface Record {
   baseSHA?: string;
   target?: Pull[];
   err?: string;
+  queue?: QueuedBatch[];
+}
+
+export interface QueuedBatch {
+  pulls: Pull[];
+  state: string;
 }
@@ -10,6 +10,8 @@ export interface TideQuery {
   missingLabels?: string[];
   milestone?: string;
   reviewApprovedRequired?: boolean;
+  ownersApprovalRequired?: boolean;
+  requiredApprovals?: number;
 }
 
 export interface PullRequest extends BasePullRequest {
@@ -30,7 +32,7 @@ export interface PullRequest extends BasePullRequest {
   };
 }
 
-export type Action = "WAIT" | "TRIGGER" | "TRIGGER_BATCH" | "MERGE" | "MERGE_BATCH" | "BLOCKED";
+export type Action = "WAIT" | "TRIGGER" | "TRIGGER_BATCH" | "MERGE" | "MERGE_BATCH" | "BISECT" | "BLOCKED" | "FROZEN" | "PAUSED" | "REVERT";
 
 export interface Blocker {
   Number: number;
@@ -38,20 +40,35 @@ export interface Blocker {
   URL: string;
 }
 
+export interface Freeze {
+  Name: string;
+  Until: string;
+}
+
+export interface SpeculativeBatch {
+  PRs: PullRequest[];
+  State: "success" | "pending" | "failure" | "missing";
+}
+
 export interface TidePool {
   Org: string;
   Repo: string;
   Branch: string;
+  BaseSHA?: string;
 
   SuccessPRs: PullRequest[];
   PendingPRs: PullRequest[];
   MissingPRs: PullRequest[];
+  // Maps PR numbers to their position in the merge queue of the pool.
+  Positions?: {[num: number]: number};
 
   BatchPending: PullRequest[];
+  SpeculativeQueue?: SpeculativeBatch[];
 
   Action: Action;
   Target: PullRequest[];
   Blockers: Blocker[];
+  Freezes?: Freeze[];
 }
 
 export interface TideData {
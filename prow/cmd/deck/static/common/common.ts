@@ -56,6 +56,9 @@ export namespace cell {
       case "triggered":
         displayIcon = "schedule";
         break;
+      case "waiting-for-approval":
+        displayIcon = "pan_tool";
+        break;
       case "pending":
         displayIcon = "watch_later";
         break;
@@ -87,6 +90,8 @@ export namespace cell {
         return "succeeded";
       case "failure":
         return "failed";
+      case "waiting-for-approval":
+        return "waiting for approval";
       default:
         return s;
     }
@@ -461,6 +461,12 @@ function redraw(fz: FuzzySearch): void {
     fz.setDict(Object.keys(opts.jobs));
     redrawOptions(fz, opts);
 
+    // Map ProwJob names to job names to show which job triggered a child job.
+    const jobNames = new Map<string, string>();
+    for (const build of allBuilds) {
+        jobNames.set(build.prow_job, build.job);
+    }
+
     let lastKey = '';
     const jobCountMap = new Map() as Map<JobState, number>;
     const jobHistogram = new JobHistogram();
@@ -520,6 +526,8 @@ function redraw(fz: FuzzySearch): void {
             c.classList.add("icon-cell");
             c.appendChild(logIcon);
             r.appendChild(c);
+        } else if (build.state === "waiting-for-approval") {
+            r.appendChild(createApprovalCell(build.prow_job));
         } else {
             r.appendChild(cell.text(""));
         }
@@ -571,11 +579,12 @@ function redraw(fz: FuzzySearch): void {
         } else {
             r.appendChild(cell.text(''));
         }
-        if (build.url === "") {
-            r.appendChild(cell.text(build.job));
-        } else {
-            r.appendChild(cell.link(build.job, build.url));
+        const jobCell = build.url === "" ? cell.text(build.job) : cell.link(build.job, build.url);
+        if (build.parent_job) {
+            const parent = jobNames.get(build.parent_job) || build.parent_job;
+            jobCell.appendChild(icon.create("subdirectory_arrow_right", `Triggered after ${parent} succeeded`));
         }
+        r.appendChild(jobCell);
 
         r.appendChild(cell.time(i.toString(), moment.unix(Number(build.started))));
         r.appendChild(cell.text(build.duration));
@@ -605,6 +614,29 @@ function createRerunCell(modal: HTMLElement, rerunElement: HTMLElement, prowjob:
     return c;
 }
 
+function createApprovalCell(prowjob: string): HTMLTableDataCellElement {
+    const c = document.createElement("td");
+    c.classList.add("icon-cell");
+    const actions: Array<[string, string, string]> = [
+        ["approve", "thumb_up", "Approve this job"],
+        ["deny", "thumb_down", "Deny this job"],
+    ];
+    for (const [action, iconName, tip] of actions) {
+        const i = icon.create(iconName, tip);
+        i.onclick = async () => {
+            const toast = document.getElementById("toast") as SnackbarElement<HTMLDivElement>;
+            const resp = await fetch(`/approve?prowjob=${prowjob}&action=${action}`,
+                {credentials: "same-origin", method: "POST"});
+            toast.MaterialSnackbar.showSnackbar({message: await resp.text()});
+            if (resp.ok) {
+                c.innerHTML = "";
+            }
+        };
+        c.appendChild(i);
+    }
+    return c;
+}
+
 // copyToClipboard is from https://stackoverflow.com/a/33928558
 // Copies a string to the clipboard. Must be called from within an
 // event handler such as click. May return false if it failed, but
@@ -700,6 +732,8 @@ function stateToAdj(state: JobState): string {
             return "succeeded";
         case "failure":
             return "failed";
+        case "waiting-for-approval":
+            return "waiting for approval";
         default:
             return state;
     }
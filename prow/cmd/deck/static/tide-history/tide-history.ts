@@ -273,6 +273,7 @@ function redrawRecords(recs: FilteredRecord[]): void {
     }
     r.appendChild(cell.text(rec.action));
     r.appendChild(targetCell(rec));
+    r.appendChild(queueCell(rec));
     r.appendChild(cell.time(nextID(), moment(rec.time)));
     r.appendChild(cell.text(rec.err || ""));
     records.appendChild(r);
@@ -303,6 +304,23 @@ function targetCell(rec: FilteredRecord): HTMLTableDataCellElement {
   }
 }
 
+function queueCell(rec: FilteredRecord): HTMLTableDataCellElement {
+  const td = document.createElement("td");
+  if (!rec.queue) {
+    return td;
+  }
+  // List the candidate batches of the speculative queue on separate lines.
+  td.style.whiteSpace = "pre";
+  for (const batch of rec.queue) {
+    const state = document.createElement("span");
+    state.classList.add("state", batch.state);
+    state.appendChild(document.createTextNode(batch.state));
+    td.appendChild(state);
+    td.appendChild(document.createTextNode(" " + batch.pulls.map((pr) => `#${pr.number}`).join(" ") + "\n"));
+  }
+  return td;
+}
+
 let idCounter = 0;
 function nextID(): string {
   idCounter++;
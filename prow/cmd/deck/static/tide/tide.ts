@@ -198,6 +198,13 @@ function redrawQueries(): void {
                 "approved by GitHub review",
             ));
         }
+        // approvals from OWNERS required
+        if (tideQuery.ownersApprovalRequired) {
+            li.appendChild(document.createTextNode("and must be approved by an approver of every changed directory "));
+        }
+        if (tideQuery.requiredApprovals) {
+            li.appendChild(document.createTextNode(`and must be approved by ${tideQuery.requiredApprovals} OWNERS `));
+        }
 
         // actually add the entry
         queries.appendChild(li);
@@ -248,8 +255,9 @@ function createRepoCell(pool: TidePool): HTMLTableDataCellElement {
 function createActionCell(pool: TidePool): HTMLTableDataCellElement {
     const targeted = pool.Target && pool.Target.length;
     const blocked = pool.Blockers && pool.Blockers.length;
+    const frozen = pool.Freezes && pool.Freezes.length;
     let action = pool.Action.replace("_", " ");
-    if (targeted || blocked) {
+    if (targeted || blocked || frozen) {
         action += ": ";
     }
     const c = document.createElement("td");
@@ -258,6 +266,9 @@ function createActionCell(pool: TidePool): HTMLTableDataCellElement {
     if (blocked) {
         c.classList.add("blocked");
         addBlockersToElem(c, pool);
+    } else if (frozen) {
+        c.classList.add("blocked");
+        addFreezesToElem(c, pool);
     } else if (targeted) {
         addPRsToElem(c, pool, pool.Target);
     }
@@ -272,33 +283,49 @@ function createPRCell(pool: TidePool, prs: PullRequest[]): HTMLTableDataCellElem
 
 function createBatchCell(pool: TidePool): HTMLTableDataCellElement {
     const td = document.createElement('td');
-    if (pool.BatchPending) {
-        const numbers = pool.BatchPending.map((p) => String(p.Number));
-        const batchRef = `${pool.Branch},${numbers.join(',')}`;
-        const encodedRepo = encodeURIComponent(`${pool.Org}/${pool.Repo}`);
-        const href = `/?repo=${encodedRepo}&type=batch&pull=${encodeURIComponent(batchRef)}`;
-        const link = document.createElement('a');
-        link.href = href;
-        for (let i = 0; i < pool.BatchPending.length; i++) {
-            const pr = pool.BatchPending[i];
-            const text = document.createElement('span');
-            text.appendChild(document.createTextNode("#" + String(pr.Number)));
-            text.id = `pr-${pool.Org}-${pool.Repo}-${pr.Number}-${nextID()}`;
-            if (pr.Title) {
-                const tip = tooltip.forElem(text.id, document.createTextNode(pr.Title));
-                text.appendChild(tip);
-            }
-            link.appendChild(text);
-            // Add a space after each PR number except the last.
-            if (i + 1 < pool.BatchPending.length) {
-                link.appendChild(document.createTextNode(" "));
-            }
+    if (pool.SpeculativeQueue && pool.SpeculativeQueue.length) {
+        // Show every candidate batch of the speculative queue on its own line.
+        td.style.whiteSpace = "pre";
+        for (const batch of pool.SpeculativeQueue) {
+            const state = document.createElement('span');
+            state.classList.add("state", batch.State);
+            state.appendChild(document.createTextNode(batch.State + " "));
+            td.appendChild(state);
+            td.appendChild(createBatchLink(pool, batch.PRs));
+            td.appendChild(document.createTextNode("\n"));
         }
-        td.appendChild(link);
+    } else if (pool.BatchPending) {
+        td.appendChild(createBatchLink(pool, pool.BatchPending));
     }
     return td;
 }
 
+// createBatchLink creates a link to the batch jobs testing the given PRs.
+function createBatchLink(pool: TidePool, prs: PullRequest[]): HTMLAnchorElement {
+    const numbers = prs.map((p) => String(p.Number));
+    const batchRef = `${pool.Branch},${numbers.join(',')}`;
+    const encodedRepo = encodeURIComponent(`${pool.Org}/${pool.Repo}`);
+    const href = `/?repo=${encodedRepo}&type=batch&pull=${encodeURIComponent(batchRef)}`;
+    const link = document.createElement('a');
+    link.href = href;
+    for (let i = 0; i < prs.length; i++) {
+        const pr = prs[i];
+        const text = document.createElement('span');
+        text.appendChild(document.createTextNode("#" + String(pr.Number)));
+        text.id = `pr-${pool.Org}-${pool.Repo}-${pr.Number}-${nextID()}`;
+        if (pr.Title) {
+            const tip = tooltip.forElem(text.id, document.createTextNode(pr.Title));
+            text.appendChild(tip);
+        }
+        link.appendChild(text);
+        // Add a space after each PR number except the last.
+        if (i + 1 < prs.length) {
+            link.appendChild(document.createTextNode(" "));
+        }
+    }
+    return link;
+}
+
 // addPRsToElem adds a space separated list of PR numbers that link to the corresponding PR on github.
 function addPRsToElem(elem: HTMLElement, pool: TidePool, prs?: PullRequest[]): void {
     if (prs) {
@@ -307,8 +334,13 @@ function addPRsToElem(elem: HTMLElement, pool: TidePool, prs?: PullRequest[]): v
             a.href = `https://github.com/${pool.Org}/${pool.Repo}/pull/${prs[i].Number}`;
             a.appendChild(document.createTextNode("#" + prs[i].Number));
             a.id = `pr-${pool.Org}-${pool.Repo}-${prs[i].Number}-${nextID()}`;
-            if (prs[i].Title) {
-                const tip = tooltip.forElem(a.id, document.createTextNode(prs[i].Title));
+            let tipText = prs[i].Title || "";
+            const position = pool.Positions ? pool.Positions[prs[i].Number] : undefined;
+            if (position) {
+                tipText += ` (position ${position} in the merge queue)`;
+            }
+            if (tipText) {
+                const tip = tooltip.forElem(a.id, document.createTextNode(tipText));
                 a.appendChild(tip);
             }
             elem.appendChild(a);
@@ -342,6 +374,16 @@ function addBlockersToElem(elem: HTMLElement, pool: TidePool): void {
     }
 }
 
+// addFreezesToElem adds a comma separated list of the merge freezes that are
+// blocking merge and when they end.
+function addFreezesToElem(elem: HTMLElement, pool: TidePool): void {
+    if (!pool.Freezes) {
+        return;
+    }
+    const freezes = pool.Freezes.map((f) => `${f.Name} (until ${new Date(f.Until).toLocaleString()})`);
+    elem.appendChild(document.createTextNode(freezes.join(", ")));
+}
+
 let idCounter = 0;
 function nextID(): string {
     idCounter++;
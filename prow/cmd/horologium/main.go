@@ -17,13 +17,18 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"cloud.google.com/go/storage"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -32,6 +37,8 @@ import (
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/cron"
 	"k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/git"
+	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/pjutil"
 )
@@ -42,6 +49,8 @@ type options struct {
 
 	kubernetes flagutil.ExperimentalKubernetesOptions
 	dryRun     flagutil.Bool
+
+	gcsCredentialsFile string
 }
 
 // TODO(fejta): require setting this explicitly
@@ -54,6 +63,7 @@ func gatherOptions(fs *flag.FlagSet, args ...string) options {
 
 	// TODO(fejta): switch dryRun to be a bool, defaulting to true after March 15, 2019.
 	fs.Var(&o.dryRun, "dry-run", "Whether or not to make mutating API calls to Kubernetes.")
+	fs.StringVar(&o.gcsCredentialsFile, "gcs-credentials-file", "", "Path to the GCS credentials used to watch the GCS objects of periodics. Watches anonymously if unset.")
 	o.kubernetes.AddFlags(fs)
 
 	fs.Parse(args)
@@ -103,12 +113,39 @@ func main() {
 	cr := cron.New()
 	cr.Start()
 
-	for now := range time.Tick(1 * time.Minute) {
-		start := time.Now()
-		if err := sync(prowJobClient, configAgent.Config(), cr, now); err != nil {
-			logrus.WithError(err).Error("Error syncing periodic jobs.")
+	gcsOption := option.WithoutAuthentication()
+	if o.gcsCredentialsFile != "" {
+		gcsOption = option.WithCredentialsFile(o.gcsCredentialsFile)
+	}
+	gcsClient, err := storage.NewClient(context.Background(), gcsOption)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting GCS client.")
+	}
+	gitClient, err := git.NewClient()
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting git client.")
+	}
+	defer gitClient.Clean()
+	rw := newInputWatcher(gcsClient, gitClient)
+
+	// Shutdown gracefully on SIGTERM or SIGINT, so that the git client
+	// cleans up its clones.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			start := time.Now()
+			if err := sync(prowJobClient, configAgent.Config(), cr, rw, now); err != nil {
+				logrus.WithError(err).Error("Error syncing periodic jobs.")
+			}
+			logrus.Infof("Sync time: %v", time.Since(start))
+		case <-sig:
+			logrus.Info("Horologium is shutting down...")
+			return
 		}
-		logrus.Infof("Sync time: %v", time.Since(start))
 	}
 }
 
@@ -122,7 +159,7 @@ type cronClient interface {
 	QueuedJobs() []string
 }
 
-func sync(prowJobClient prowJobClient, cfg *config.Config, cr cronClient, now time.Time) error {
+func sync(prowJobClient prowJobClient, cfg *config.Config, cr cronClient, rw revisionWatcher, now time.Time) error {
 	jobs, err := prowJobClient.List(metav1.ListOptions{LabelSelector: labels.Everything().String()})
 	if err != nil {
 		return fmt.Errorf("error listing prow jobs: %v", err)
@@ -140,13 +177,42 @@ func sync(prowJobClient prowJobClient, cfg *config.Config, cr cronClient, now ti
 
 	var errs []error
 	for _, p := range cfg.Periodics {
+		// Plank triggers these once their parent succeeds.
+		if p.RunsAfterParent() {
+			continue
+		}
 		j, previousFound := latestJobs[p.Name]
 		logger := logrus.WithFields(logrus.Fields{
 			"job":            p.Name,
 			"previous-found": previousFound,
 		})
 
-		if p.Cron == "" {
+		if p.Watch != nil {
+			if previousFound && !j.Complete() {
+				continue
+			}
+			revision, polled, err := rw.Revision(p, now)
+			if err != nil {
+				logger.WithError(err).WithField("input", p.Watch.Input()).Warning("Error polling watched input.")
+				continue
+			}
+			if !polled {
+				continue
+			}
+			shouldTrigger := j.ObjectMeta.Annotations[kube.WatchedRevisionAnnotation] != revision
+			logger = logger.WithFields(logrus.Fields{"should-trigger": shouldTrigger, "revision": revision})
+			if !previousFound || shouldTrigger {
+				spec := pjutil.PeriodicSpec(p)
+				if p.Watch.Git != nil {
+					recordGitRevision(&spec, p.Watch.Git, revision)
+				}
+				prowJob := pjutil.NewProwJobWithAnnotation(spec, p.Labels, map[string]string{kube.WatchedRevisionAnnotation: revision})
+				logger.WithFields(pjutil.ProwJobFields(&prowJob)).Info("Triggering new run of watched periodic.")
+				if _, err := prowJobClient.Create(&prowJob); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		} else if p.Cron == "" {
 			shouldTrigger := j.Complete() && now.Sub(j.Status.StartTime.Time) > p.GetInterval()
 			logger = logger.WithField("should-trigger", shouldTrigger)
 			if !previousFound || shouldTrigger {
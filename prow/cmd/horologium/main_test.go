@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"flag"
 	"reflect"
 	"testing"
@@ -31,6 +32,7 @@ import (
 	"k8s.io/test-infra/prow/client/clientset/versioned/fake"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/kube"
 )
 
 type fakeCron struct {
@@ -56,6 +58,16 @@ func (fc *fakeCron) QueuedJobs() []string {
 	return res
 }
 
+type fakeWatcher struct {
+	revision string
+	polled   bool
+	err      error
+}
+
+func (fw *fakeWatcher) Revision(p config.Periodic, now time.Time) (string, bool, error) {
+	return fw.revision, fw.polled, fw.err
+}
+
 // Assumes there is one periodic job called "p" with an interval of one minute.
 func TestSync(t *testing.T) {
 	testcases := []struct {
@@ -142,7 +154,7 @@ func TestSync(t *testing.T) {
 		}
 		fakeProwJobClient := fake.NewSimpleClientset(jobs...)
 		fc := &fakeCron{}
-		if err := sync(fakeProwJobClient.ProwV1().ProwJobs(cfg.ProwJobNamespace), &cfg, fc, now); err != nil {
+		if err := sync(fakeProwJobClient.ProwV1().ProwJobs(cfg.ProwJobNamespace), &cfg, fc, &fakeWatcher{}, now); err != nil {
 			t.Fatalf("For case %s, didn't expect error: %v", tc.testName, err)
 		}
 
@@ -159,6 +171,37 @@ func TestSync(t *testing.T) {
 	}
 }
 
+// Test that periodics that run after another one succeeds are not scheduled.
+func TestSyncRunAfterSuccess(t *testing.T) {
+	cfg := config.Config{
+		ProwConfig: config.ProwConfig{
+			ProwJobNamespace: "prowjobs",
+		},
+	}
+	if err := cfg.SetPeriodics([]config.Periodic{
+		{JobBase: config.JobBase{Name: "parent", RunAfterSuccess: []string{"child"}}},
+		{JobBase: config.JobBase{Name: "child"}},
+	}); err != nil {
+		t.Fatalf("Failed to set periodics: %v", err)
+	}
+	cfg.Periodics[0].SetInterval(time.Minute)
+
+	fakeProwJobClient := fake.NewSimpleClientset()
+	if err := sync(fakeProwJobClient.ProwV1().ProwJobs(cfg.ProwJobNamespace), &cfg, &fakeCron{}, &fakeWatcher{}, time.Now()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var created []string
+	for _, action := range fakeProwJobClient.Fake.Actions() {
+		if create, ok := action.(clienttesting.CreateActionImpl); ok {
+			created = append(created, create.GetObject().(*prowapi.ProwJob).Spec.Job)
+		}
+	}
+	if len(created) != 1 || created[0] != "parent" {
+		t.Errorf("Expected only the parent to be triggered, got %v.", created)
+	}
+}
+
 // Test sync periodic job scheduled by cron.
 func TestSyncCron(t *testing.T) {
 	testcases := []struct {
@@ -224,7 +267,7 @@ func TestSyncCron(t *testing.T) {
 		}
 		fakeProwJobClient := fake.NewSimpleClientset(jobs...)
 		fc := &fakeCron{}
-		if err := sync(fakeProwJobClient.ProwV1().ProwJobs(cfg.ProwJobNamespace), &cfg, fc, now); err != nil {
+		if err := sync(fakeProwJobClient.ProwV1().ProwJobs(cfg.ProwJobNamespace), &cfg, fc, &fakeWatcher{}, now); err != nil {
 			t.Fatalf("For case %s, didn't expect error: %v", tc.testName, err)
 		}
 
@@ -241,6 +284,148 @@ func TestSyncCron(t *testing.T) {
 	}
 }
 
+// Test sync periodic job triggered by a watched input.
+func TestSyncWatch(t *testing.T) {
+	testcases := []struct {
+		testName         string
+		jobName          string
+		jobComplete      bool
+		previousRevision string
+		watcher          fakeWatcher
+		shouldStart      bool
+	}{
+		{
+			testName:    "no job",
+			watcher:     fakeWatcher{revision: "abc", polled: true},
+			shouldStart: true,
+		},
+		{
+			testName:         "input changed",
+			jobName:          "j",
+			jobComplete:      true,
+			previousRevision: "abc",
+			watcher:          fakeWatcher{revision: "def", polled: true},
+			shouldStart:      true,
+		},
+		{
+			testName:         "input unchanged",
+			jobName:          "j",
+			jobComplete:      true,
+			previousRevision: "abc",
+			watcher:          fakeWatcher{revision: "abc", polled: true},
+			shouldStart:      false,
+		},
+		{
+			testName:         "input changed while job still running",
+			jobName:          "j",
+			jobComplete:      false,
+			previousRevision: "abc",
+			watcher:          fakeWatcher{revision: "def", polled: true},
+			shouldStart:      false,
+		},
+		{
+			testName:         "input not polled yet",
+			jobName:          "j",
+			jobComplete:      true,
+			previousRevision: "abc",
+			watcher:          fakeWatcher{},
+			shouldStart:      false,
+		},
+		{
+			testName:         "error polling input",
+			jobName:          "j",
+			jobComplete:      true,
+			previousRevision: "abc",
+			watcher:          fakeWatcher{polled: true, err: errors.New("injected")},
+			shouldStart:      false,
+		},
+	}
+	for _, tc := range testcases {
+		cfg := config.Config{
+			ProwConfig: config.ProwConfig{
+				ProwJobNamespace: "prowjobs",
+			},
+			JobConfig: config.JobConfig{
+				Periodics: []config.Periodic{{
+					JobBase: config.JobBase{Name: "j"},
+					Watch:   &config.PeriodicWatch{Git: &config.GitWatch{Org: "org", Repo: "repo", Branch: "master"}},
+				}},
+			},
+		}
+
+		var jobs []runtime.Object
+		now := time.Now()
+		if tc.jobName != "" {
+			job := &prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "with-watch",
+					Namespace:   "prowjobs",
+					Annotations: map[string]string{kube.WatchedRevisionAnnotation: tc.previousRevision},
+				},
+				Spec: prowapi.ProwJobSpec{
+					Type: prowapi.PeriodicJob,
+					Job:  tc.jobName,
+				},
+				Status: prowapi.ProwJobStatus{
+					StartTime: metav1.NewTime(now.Add(-time.Hour)),
+				},
+			}
+			complete := metav1.NewTime(now.Add(-time.Millisecond))
+			if tc.jobComplete {
+				job.Status.CompletionTime = &complete
+			}
+			jobs = append(jobs, job)
+		}
+		fakeProwJobClient := fake.NewSimpleClientset(jobs...)
+		fc := &fakeCron{}
+		if err := sync(fakeProwJobClient.ProwV1().ProwJobs(cfg.ProwJobNamespace), &cfg, fc, &tc.watcher, now); err != nil {
+			t.Fatalf("For case %s, didn't expect error: %v", tc.testName, err)
+		}
+
+		var created *prowapi.ProwJob
+		for _, action := range fakeProwJobClient.Fake.Actions() {
+			switch action := action.(type) {
+			case clienttesting.CreateActionImpl:
+				created = action.GetObject().(*prowapi.ProwJob)
+			}
+		}
+		if tc.shouldStart != (created != nil) {
+			t.Errorf("For case %s, did the wrong thing.", tc.testName)
+			continue
+		}
+		if created == nil {
+			continue
+		}
+		if revision := created.ObjectMeta.Annotations[kube.WatchedRevisionAnnotation]; revision != tc.watcher.revision {
+			t.Errorf("For case %s, expected revision %q to be recorded, got %q", tc.testName, tc.watcher.revision, revision)
+		}
+		expectedRefs := []prowapi.Refs{{Org: "org", Repo: "repo", BaseRef: "master", BaseSHA: tc.watcher.revision}}
+		if !reflect.DeepEqual(created.Spec.ExtraRefs, expectedRefs) {
+			t.Errorf("For case %s, expected extra refs %v, got %v", tc.testName, expectedRefs, created.Spec.ExtraRefs)
+		}
+	}
+}
+
+func TestRecordGitRevision(t *testing.T) {
+	watch := &config.GitWatch{Org: "org", Repo: "repo", Branch: "master"}
+	configured := []prowapi.Refs{
+		{Org: "other", Repo: "repo", BaseRef: "master"},
+		{Org: "org", Repo: "repo", BaseRef: "master"},
+	}
+	spec := prowapi.ProwJobSpec{ExtraRefs: configured}
+	recordGitRevision(&spec, watch, "abc")
+	expected := []prowapi.Refs{
+		{Org: "other", Repo: "repo", BaseRef: "master"},
+		{Org: "org", Repo: "repo", BaseRef: "master", BaseSHA: "abc"},
+	}
+	if !reflect.DeepEqual(spec.ExtraRefs, expected) {
+		t.Errorf("expected extra refs %v, got %v", expected, spec.ExtraRefs)
+	}
+	if configured[1].BaseSHA != "" {
+		t.Error("expected the configured extra refs to be left unmodified")
+	}
+}
+
 func TestFlags(t *testing.T) {
 	cases := []struct {
 		name     string
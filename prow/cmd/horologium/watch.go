@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git"
+)
+
+type revisionWatcher interface {
+	// Revision returns the current revision of the input watched by the
+	// periodic and whether it was polled, as inputs are only polled once
+	// per poll interval.
+	Revision(p config.Periodic, now time.Time) (string, bool, error)
+}
+
+// inputWatcher polls the generations of GCS objects and the heads of git
+// branches watched by periodics.
+type inputWatcher struct {
+	gcs *storage.Client
+	git *git.Client
+
+	// lastPolled maps periodic names to the last time their input was polled.
+	lastPolled map[string]time.Time
+}
+
+func newInputWatcher(gcs *storage.Client, git *git.Client) *inputWatcher {
+	return &inputWatcher{gcs: gcs, git: git, lastPolled: map[string]time.Time{}}
+}
+
+func (w *inputWatcher) Revision(p config.Periodic, now time.Time) (string, bool, error) {
+	if last, ok := w.lastPolled[p.Name]; ok && now.Sub(last) < p.Watch.GetPollInterval() {
+		return "", false, nil
+	}
+	w.lastPolled[p.Name] = now
+
+	if p.Watch.Git != nil {
+		revision, err := w.gitRevision(p.Watch.Git)
+		return revision, true, err
+	}
+	revision, err := w.gcsRevision(p.Watch)
+	return revision, true, err
+}
+
+func (w *inputWatcher) gcsRevision(watch *config.PeriodicWatch) (string, error) {
+	bucket, object := watch.GCSObject()
+	attrs, err := w.gcs.Bucket(bucket).Object(object).Attrs(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("error getting attributes of %s: %v", watch.GCS, err)
+	}
+	return strconv.FormatInt(attrs.Generation, 10), nil
+}
+
+func (w *inputWatcher) gitRevision(watch *config.GitWatch) (string, error) {
+	repo, err := w.git.Clone(watch.Org + "/" + watch.Repo)
+	if err != nil {
+		return "", fmt.Errorf("error cloning %s/%s: %v", watch.Org, watch.Repo, err)
+	}
+	defer repo.Clean()
+	sha, err := repo.RevParse("origin/" + watch.Branch)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sha), nil
+}
+
+// recordGitRevision pins the refs of the watched repo in the extra refs of
+// the spec to the revision that triggered the job, adding them if the job
+// does not clone the repo already.
+func recordGitRevision(spec *prowapi.ProwJobSpec, watch *config.GitWatch, sha string) {
+	// The extra refs are shared with the job config.
+	spec.ExtraRefs = append([]prowapi.Refs(nil), spec.ExtraRefs...)
+	for i, refs := range spec.ExtraRefs {
+		if refs.Org == watch.Org && refs.Repo == watch.Repo && refs.BaseRef == watch.Branch {
+			spec.ExtraRefs[i].BaseSHA = sha
+			return
+		}
+	}
+	spec.ExtraRefs = append(spec.ExtraRefs, prowapi.Refs{
+		Org:     watch.Org,
+		Repo:    watch.Repo,
+		BaseRef: watch.Branch,
+		BaseSHA: sha,
+	})
+}
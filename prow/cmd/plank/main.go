@@ -27,10 +27,15 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/test-infra/prow/pjutil"
 
 	"k8s.io/test-infra/pkg/flagutil"
+	prowjobset "k8s.io/test-infra/prow/client/clientset/versioned"
+	prowjobinformer "k8s.io/test-infra/prow/client/informers/externalversions"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/config/secret"
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
@@ -40,6 +45,15 @@ import (
 	"k8s.io/test-infra/prow/plank"
 )
 
+const (
+	// resync is how often the informers resync ProwJobs and pods, which
+	// catches pods that are pending for longer than the timeout.
+	resync = time.Minute
+	// healthCheckTimeout is how long the health check of a build cluster
+	// waits for the API server to respond.
+	healthCheckTimeout = 10 * time.Second
+)
+
 type options struct {
 	totURL string
 
@@ -142,7 +156,51 @@ func main() {
 		}
 	}
 
-	c, err := plank.NewController(kubeClient, pkcs, githubClient, nil, cfg, o.totURL, o.selector, o.skipReport)
+	// The informers read ProwJobs and pods from the clusters that the
+	// clients above change them in. In dry-run mode they only read.
+	clusterConfigs, err := kube.LoadClusterConfigs("", o.buildCluster)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error loading cluster configs.")
+	}
+	infraConfig := clusterConfigs[kube.InClusterContext]
+	prowJobClientset, err := prowjobset.NewForConfig(&infraConfig)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting prowjob clientset.")
+	}
+	pjInformer := prowjobinformer.NewSharedInformerFactoryWithOptions(prowJobClientset, resync,
+		prowjobinformer.WithNamespace(cfg().ProwJobNamespace),
+		prowjobinformer.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = o.selector
+		}),
+	).Prow().V1().ProwJobs()
+	podInformers := map[string]cache.SharedIndexInformer{}
+	healthChecks := map[string]plank.ClusterHealthCheck{}
+	for alias := range pkcs {
+		clusterConfig, ok := clusterConfigs[alias]
+		if !ok {
+			logrus.Fatalf("No config for build cluster %q.", alias)
+		}
+		client, err := kubernetes.NewForConfig(&clusterConfig)
+		if err != nil {
+			logrus.WithError(err).Fatalf("Error getting kube client for build cluster %q.", alias)
+		}
+		podInformers[alias] = plank.NewPodInformer(client.CoreV1().Pods(cfg().PodNamespace), o.selector, resync)
+
+		// Unreachable clusters should fail their health check instead of
+		// hanging it.
+		healthConfig := clusterConfig
+		healthConfig.Timeout = healthCheckTimeout
+		healthClient, err := kubernetes.NewForConfig(&healthConfig)
+		if err != nil {
+			logrus.WithError(err).Fatalf("Error getting health check client for build cluster %q.", alias)
+		}
+		healthChecks[alias] = func() error {
+			_, err := healthClient.Discovery().ServerVersion()
+			return err
+		}
+	}
+
+	c, err := plank.NewController(kubeClient, pkcs, pjInformer, podInformers, healthChecks, githubClient, nil, cfg, o.totURL, o.skipReport)
 	if err != nil {
 		logrus.WithError(err).Fatal("Error creating plank controller.")
 	}
@@ -157,22 +215,16 @@ func main() {
 	// gather metrics for the jobs handled by plank.
 	go gather(c)
 
-	tick := time.Tick(30 * time.Second)
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
-
-	for {
-		select {
-		case <-tick:
-			start := time.Now()
-			if err := c.Sync(); err != nil {
-				logrus.WithError(err).Error("Error syncing.")
-			}
-			logrus.WithField("duration", fmt.Sprintf("%v", time.Since(start))).Info("Synced")
-		case <-sig:
-			logrus.Info("Plank is shutting down...")
-			return
-		}
+	stop := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		logrus.Info("Plank is shutting down...")
+		close(stop)
+	}()
+	if err := c.Run(stop); err != nil {
+		logrus.WithError(err).Fatal("Error running plank controller.")
 	}
 }
 
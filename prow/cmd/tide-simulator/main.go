@@ -0,0 +1,229 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/config/secret"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/git"
+	"k8s.io/test-infra/prow/tide"
+)
+
+type options struct {
+	configPath    string
+	jobConfigPath string
+
+	snapshot string
+	prowJobs string
+
+	github prowflagutil.GitHubOptions
+}
+
+func (o *options) Validate() error {
+	if o.configPath == "" {
+		return errors.New("required flag --config-path was unset")
+	}
+	if o.snapshot == "" {
+		return o.github.Validate(true)
+	}
+	return nil
+}
+
+func gatherOptions() options {
+	o := options{}
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&o.configPath, "config-path", "", "Path to config.yaml.")
+	fs.StringVar(&o.jobConfigPath, "job-config-path", "", "Path to prow job configs.")
+	fs.StringVar(&o.snapshot, "snapshot", "", "Path or URL of a snapshot of the Tide pools, e.g. https://prow.k8s.io/tide.js. Open PRs are queried from GitHub if unset.")
+	fs.StringVar(&o.prowJobs, "prowjobs", "", "Path or URL of the ProwJobs as served by Deck, e.g. https://prow.k8s.io/prowjobs.js. PRs are treated as untested if unset.")
+	o.github.AddFlagsWithoutDefaultGitHubTokenPath(fs)
+	fs.Parse(os.Args[1:])
+	return o
+}
+
+// read reads a local file or fetches a URL.
+func read(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+	resp, err := http.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", source, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// stripVar turns the "var name = {...};" form that Deck serves when a
+// "var" query parameter is given back into JSON.
+func stripVar(raw []byte) []byte {
+	s := strings.TrimSpace(string(raw))
+	if strings.HasPrefix(s, "var ") {
+		s = strings.TrimSuffix(s[strings.Index(s, "=")+1:], ";")
+	}
+	return []byte(s)
+}
+
+// parseSnapshot parses the pools served by Tide itself as well as the
+// payload of Deck's /tide.js.
+func parseSnapshot(raw []byte) ([]tide.Pool, error) {
+	raw = stripVar(raw)
+	var pools []tide.Pool
+	if strings.HasPrefix(string(raw), "[") {
+		if err := json.Unmarshal(raw, &pools); err != nil {
+			return nil, err
+		}
+		return pools, nil
+	}
+	var deck struct {
+		Pools []tide.Pool
+	}
+	if err := json.Unmarshal(raw, &deck); err != nil {
+		return nil, err
+	}
+	return deck.Pools, nil
+}
+
+// parseProwJobs parses the payload of Deck's /prowjobs.js.
+func parseProwJobs(raw []byte) ([]prowapi.ProwJob, error) {
+	var list struct {
+		Items []prowapi.ProwJob `json:"items"`
+	}
+	if err := json.Unmarshal(stripVar(raw), &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func main() {
+	o := gatherOptions()
+	if err := o.Validate(); err != nil {
+		logrus.Fatalf("Invalid options: %v", err)
+	}
+	logger := logrus.WithField("component", "tide-simulator")
+
+	configAgent := &config.Agent{}
+	if err := configAgent.Start(o.configPath, o.jobConfigPath); err != nil {
+		logrus.WithError(err).Fatal("Error loading config.")
+	}
+	cfg := configAgent.Config
+
+	var pjs []prowapi.ProwJob
+	if o.prowJobs != "" {
+		raw, err := read(o.prowJobs)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error reading ProwJobs.")
+		}
+		if pjs, err = parseProwJobs(raw); err != nil {
+			logrus.WithError(err).Fatal("Error parsing ProwJobs.")
+		}
+	} else {
+		logrus.Warning("No ProwJobs given, all PRs are treated as untested.")
+	}
+
+	var prs []tide.SimulatedPR
+	var pools []tide.Pool
+	if o.snapshot != "" {
+		raw, err := read(o.snapshot)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error reading snapshot.")
+		}
+		snapshot, err := parseSnapshot(raw)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error parsing snapshot.")
+		}
+		prs, pools, err = tide.SimulateSnapshot(cfg, snapshot, pjs, logger)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error simulating Tide.")
+		}
+	} else {
+		secretAgent := &secret.Agent{}
+		var gitClient *git.Client
+		if o.github.TokenPath != "" {
+			if err := secretAgent.Start([]string{o.github.TokenPath}); err != nil {
+				logrus.WithError(err).Fatal("Error starting secrets agent.")
+			}
+			// The git client is only needed for repos with in-repo config.
+			var err error
+			if gitClient, err = o.github.GitClient(secretAgent, true); err != nil {
+				logrus.WithError(err).Fatal("Error getting Git client.")
+			}
+			defer gitClient.Clean()
+		}
+		githubClient, err := o.github.GitHubClient(secretAgent, true)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error getting GitHub client.")
+		}
+		prs, pools, err = tide.SimulateGitHub(cfg, githubClient, gitClient, pjs, logger)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error simulating Tide.")
+		}
+	}
+
+	if err := printSimulation(os.Stdout, prs, pools); err != nil {
+		logrus.WithError(err).Fatal("Error printing the simulation.")
+	}
+}
+
+// printSimulation writes the action of every pool and the decision for every PR.
+func printSimulation(out io.Writer, prs []tide.SimulatedPR, pools []tide.Pool) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "POOL\tACTION\tTARGETS\tERROR")
+	for _, pool := range pools {
+		var targets []string
+		for _, pr := range pool.Target {
+			targets = append(targets, fmt.Sprintf("#%d", pr.Number))
+		}
+		fmt.Fprintf(w, "%s/%s:%s\t%s\t%s\t%s\n", pool.Org, pool.Repo, pool.Branch, pool.Action, strings.Join(targets, ","), pool.Error)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "PR\tBRANCH\tDECISION\tSTATUS")
+	for _, pr := range prs {
+		fmt.Fprintf(w, "%s/%s#%d\t%s\t%s\t%s\n", pr.Org, pr.Repo, pr.Number, pr.Branch, decision(pr), pr.Description)
+	}
+	return w.Flush()
+}
+
+// decision summarizes what Tide does with a PR.
+func decision(pr tide.SimulatedPR) string {
+	switch {
+	case !pr.InPool:
+		return "not in pool"
+	case pr.Target:
+		return string(pr.Action)
+	default:
+		return fmt.Sprintf("in pool (%s)", pr.Action)
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSnapshot(t *testing.T) {
+	testCases := []struct {
+		name string
+		raw  string
+	}{
+		{
+			name: "pools served by tide",
+			raw:  `[{"Org": "o", "Repo": "r", "Branch": "master", "BaseSHA": "base"}]`,
+		},
+		{
+			name: "tide.js served by deck",
+			raw:  `{"Queries": [], "Pools": [{"Org": "o", "Repo": "r", "Branch": "master", "BaseSHA": "base"}]}`,
+		},
+		{
+			name: "tide.js served by deck as a variable",
+			raw:  `var tideData = {"Queries": [], "Pools": [{"Org": "o", "Repo": "r", "Branch": "master", "BaseSHA": "base"}]};`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pools, err := parseSnapshot([]byte(tc.raw))
+			if err != nil {
+				t.Fatalf("Unexpected error parsing the snapshot: %v", err)
+			}
+			if len(pools) != 1 || pools[0].Org != "o" || pools[0].BaseSHA != "base" {
+				t.Errorf("Wrong pools: %+v", pools)
+			}
+		})
+	}
+}
+
+func TestParseProwJobs(t *testing.T) {
+	pjs, err := parseProwJobs([]byte(`var allBuilds = {"items": [{"spec": {"job": "pull-test"}}]};`))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing ProwJobs: %v", err)
+	}
+	if len(pjs) != 1 || pjs[0].Spec.Job != "pull-test" {
+		t.Errorf("Wrong ProwJobs: %+v", pjs)
+	}
+}
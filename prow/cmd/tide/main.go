@@ -33,6 +33,7 @@ import (
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/config/secret"
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	gerritclient "k8s.io/test-infra/prow/gerrit/client"
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/metrics"
 	"k8s.io/test-infra/prow/pjutil"
@@ -69,6 +70,10 @@ type options struct {
 	// a) the gcs credentials can write to this bucket
 	// b) the default acls do not expose any private info
 	statusURI string
+
+	// gerritCookiefilePath is the path to the git http.cookiefile used to
+	// authenticate with the Gerrit instances of the Gerrit queries.
+	gerritCookiefilePath string
 }
 
 func (o *options) Validate() error {
@@ -99,6 +104,7 @@ func gatherOptions() options {
 	fs.StringVar(&o.gcsCredentialsFile, "gcs-credentials-file", "", "File where Google Cloud authentication credentials are stored. Required for GCS writes.")
 	fs.StringVar(&o.historyURI, "history-uri", "", "The /local/path or gs://path/to/object to store tide action history. GCS writes will use the default object ACL for the bucket")
 	fs.StringVar(&o.statusURI, "status-path", "", "The /local/path or gs://path/to/object to store status controller state. GCS writes will use the default object ACL for the bucket.")
+	fs.StringVar(&o.gerritCookiefilePath, "gerrit-cookiefile", "", "Path to git http.cookiefile to submit Gerrit changes with, leave empty for anonymous.")
 
 	fs.Parse(os.Args[1:])
 	return o
@@ -166,7 +172,24 @@ func main() {
 		logrus.WithError(err).Fatal("Error getting Kubernetes client.")
 	}
 
-	c, err := tide.NewController(githubSync, githubStatus, kubeClient, cfg, gitClient, o.maxRecordsPerPool, opener, o.historyURI, o.statusURI, nil)
+	var gerritClient *gerritclient.Client
+	if queries := cfg().Tide.GerritQueries; len(queries) > 0 {
+		if o.dryRun {
+			logrus.Warning("Ignoring the Gerrit queries, Gerrit changes are not submitted in dry-run mode.")
+		} else {
+			instances := make(map[string][]string)
+			for _, query := range queries {
+				instances[query.Instance] = append(instances[query.Instance], query.Projects...)
+			}
+			gerritClient, err = gerritclient.NewClient(instances)
+			if err != nil {
+				logrus.WithError(err).Fatal("Error getting Gerrit client.")
+			}
+			gerritClient.Start(o.gerritCookiefilePath)
+		}
+	}
+
+	c, err := tide.NewController(githubSync, githubStatus, gerritClient, kubeClient, cfg, gitClient, o.maxRecordsPerPool, opener, o.historyURI, o.statusURI, nil)
 	if err != nil {
 		logrus.WithError(err).Fatal("Error creating Tide controller.")
 	}
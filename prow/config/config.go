@@ -31,6 +31,7 @@ import (
 	"text/template"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/sirupsen/logrus"
 	cron "gopkg.in/robfig/cron.v2"
 	v1 "k8s.io/api/core/v1"
@@ -42,6 +43,7 @@ import (
 	buildapi "github.com/knative/build/pkg/apis/build/v1alpha1"
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config/org"
+	"k8s.io/test-infra/prow/gitattributes"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/pod-utils/decorate"
@@ -52,12 +54,23 @@ import (
 type Config struct {
 	JobConfig
 	ProwConfig
+
+	// ProwYAMLGetter is used to retrieve the .prow.yaml of a repo when
+	// InRepoConfig is enabled. Defaults to cloning the repo with the
+	// provided git client.
+	ProwYAMLGetter ProwYAMLGetter `json:"-"`
+	// prowYAMLCache holds the .prow.yaml files that were read, by repo,
+	// base SHA and head SHAs. It is nil unless the config was loaded
+	// from files, and empty again when the config is reloaded.
+	prowYAMLCache *lru.Cache
 }
 
 // JobConfig is config for all prow jobs
 type JobConfig struct {
 	// Presets apply to all job types.
 	Presets []Preset `json:"presets,omitempty"`
+	// JobTemplates maps template names to the templates that jobs can extend.
+	JobTemplates map[string]JobTemplate `json:"job_templates,omitempty"`
 	// Full repo name (such as "kubernetes/kubernetes") -> list of jobs.
 	Presubmits  map[string][]Presubmit  `json:"presubmits,omitempty"`
 	Postsubmits map[string][]Postsubmit `json:"postsubmits,omitempty"`
@@ -76,6 +89,12 @@ type ProwConfig struct {
 	Orgs             map[string]org.Config `json:"orgs,omitempty"`
 	Gerrit           Gerrit                `json:"gerrit,omitempty"`
 	GitHubReporter   GitHubReporter        `json:"github_reporter,omitempty"`
+	// WebhookReporter configures the webhooks that crier reports the
+	// ProwJobs of orgs and repos to.
+	WebhookReporter WebhookReporter `json:"webhook_reporter,omitempty"`
+	// InRepoConfig allows repos to version their Presubmits and Postsubmits
+	// in a .prow.yaml at the root of the repository.
+	InRepoConfig InRepoConfig `json:"in_repo_config,omitempty"`
 
 	// TODO: Move this out of the main config.
 	JenkinsOperators []JenkinsOperator `json:"jenkins_operators,omitempty"`
@@ -182,7 +201,9 @@ type Controller struct {
 	MaxGoroutines int `json:"max_goroutines,omitempty"`
 
 	// AllowCancellations enables aborting presubmit jobs for commits that
-	// have been superseded by newer commits in GitHub pull requests.
+	// have been superseded by newer commits in GitHub pull requests, and
+	// aborting presubmit jobs of pull requests that were closed or updated.
+	// The setting of plank also applies to knative-build jobs.
 	AllowCancellations bool `json:"allow_cancellations,omitempty"`
 }
 
@@ -205,6 +226,54 @@ type Plank struct {
 	// JobURLPrefixConfig is the host and path prefix under which job details
 	// will be viewable. Use `org/repo`, `org` or `*`as key and an url as value
 	JobURLPrefixConfig map[string]string `json:"job_url_prefix_config,omitempty"`
+	// DefaultPriorities are the priorities of ProwJobs that do not set one,
+	// per job type. Triggered ProwJobs with a higher priority are started
+	// first. Defaults to presubmit: 400, postsubmit: 300, batch: 200 and
+	// periodic: 100.
+	DefaultPriorities map[prowapi.ProwJobType]int `json:"default_priorities,omitempty"`
+	// Quotas is the maximum number of ProwJobs that may be pending at once
+	// for an org or repo. Use `org/repo` or `org` as key; 0 implies no limit.
+	Quotas map[string]int `json:"quotas,omitempty"`
+	// BuildClusters describes build clusters, by alias, to the selection
+	// of a cluster for jobs that may run in several.
+	BuildClusters map[string]BuildCluster `json:"build_clusters,omitempty"`
+}
+
+// BuildCluster describes a build cluster to the selection of a cluster for
+// jobs that may run in several.
+type BuildCluster struct {
+	// MaxActivePods is the number of pods that may be pending or running
+	// in the cluster before no more jobs are scheduled to it. 0 implies no
+	// limit.
+	MaxActivePods int `json:"max_active_pods,omitempty"`
+	// NodeLabels lists the values of the labels of the nodes in the
+	// cluster. Jobs whose pods select nodes by labels are only scheduled
+	// to clusters with nodes for all the selected values. Clusters without
+	// node labels are assumed to have nodes for any selector.
+	NodeLabels map[string][]string `json:"node_labels,omitempty"`
+}
+
+// Accepts determines whether the nodes of a build cluster can run pods
+// with a node selector.
+func (b BuildCluster) Accepts(nodeSelector map[string]string) bool {
+	if len(b.NodeLabels) == 0 {
+		return true
+	}
+	for key, value := range nodeSelector {
+		if !sets.NewString(b.NodeLabels[key]...).Has(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPriority returns the priority of a ProwJob, falling back to the
+// default priority for its type.
+func (p Plank) GetPriority(spec prowapi.ProwJobSpec) int {
+	if spec.Priority != 0 {
+		return spec.Priority
+	}
+	return p.DefaultPriorities[spec.Type]
 }
 
 func (p Plank) GetJobURLPrefix(refs *prowapi.Refs) string {
@@ -256,6 +325,23 @@ type GitHubReporter struct {
 	JobTypesToReport []prowapi.ProwJobType `json:"job_types_to_report,omitempty"`
 }
 
+// WebhookReporter holds the config of the webhooks that ProwJobs are
+// reported to in addition to the webhooks configured on their jobs.
+type WebhookReporter struct {
+	// Webhooks maps "org" or "org/repo" to the webhooks that the ProwJobs
+	// for its repos are reported to. The narrowest match wins.
+	Webhooks map[string][]prowapi.WebhookReporterConfig `json:"webhooks,omitempty"`
+}
+
+// WebhooksFor returns the webhooks that the ProwJobs for a repo are
+// reported to.
+func (w *WebhookReporter) WebhooksFor(org, repo string) []prowapi.WebhookReporterConfig {
+	if webhooks, ok := w.Webhooks[fmt.Sprintf("%s/%s", org, repo)]; ok {
+		return webhooks
+	}
+	return w.Webhooks[org]
+}
+
 // Sinker is config for the sinker controller.
 type Sinker struct {
 	// ResyncPeriodString compiles into ResyncPeriod at load time.
@@ -391,6 +477,9 @@ func Load(prowConfig, jobConfig string) (c *Config, err error) {
 	if err := c.validateJobConfig(); err != nil {
 		return nil, err
 	}
+	if c.prowYAMLCache, err = lru.New(prowYAMLCacheSize); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
@@ -555,6 +644,7 @@ func ReadFileMaybeGZIP(path string) ([]byte, error) {
 //	- Postsubmits
 // 	- Periodics
 //	- PodPresets
+//	- JobTemplates
 func (c *Config) mergeJobConfig(jc JobConfig) error {
 	// Merge everything
 	// *** Presets ***
@@ -572,6 +662,17 @@ func (c *Config) mergeJobConfig(jc JobConfig) error {
 		}
 	}
 
+	// *** JobTemplates ***
+	if c.JobTemplates == nil {
+		c.JobTemplates = make(map[string]JobTemplate)
+	}
+	for name, template := range jc.JobTemplates {
+		if _, ok := c.JobTemplates[name]; ok {
+			return fmt.Errorf("duplicated job template: %s", name)
+		}
+		c.JobTemplates[name] = template
+	}
+
 	// *** Periodics ***
 	c.Periodics = append(c.Periodics, jc.Periodics...)
 
@@ -595,25 +696,50 @@ func (c *Config) mergeJobConfig(jc JobConfig) error {
 }
 
 func setPresubmitDecorationDefaults(c *Config, ps *Presubmit) {
-	if ps.Decorate {
+	if ps.ShouldDecorate() {
 		ps.DecorationConfig = ps.DecorationConfig.ApplyDefault(c.Plank.DefaultDecorationConfig)
 	}
 }
 
 func setPostsubmitDecorationDefaults(c *Config, ps *Postsubmit) {
-	if ps.Decorate {
+	if ps.ShouldDecorate() {
 		ps.DecorationConfig = ps.DecorationConfig.ApplyDefault(c.Plank.DefaultDecorationConfig)
 	}
 }
 
 func setPeriodicDecorationDefaults(c *Config, ps *Periodic) {
-	if ps.Decorate {
+	if ps.ShouldDecorate() {
 		ps.DecorationConfig = ps.DecorationConfig.ApplyDefault(c.Plank.DefaultDecorationConfig)
 	}
 }
 
 // finalizeJobConfig mutates and fixes entries for jobspecs
 func (c *Config) finalizeJobConfig() error {
+	// Merge templates and expand matrices first, so that every expanded job
+	// is defaulted.
+	if err := c.applyJobTemplates(); err != nil {
+		return err
+	}
+	for repo, vs := range c.Presubmits {
+		expanded, err := expandPresubmitMatrices(vs)
+		if err != nil {
+			return fmt.Errorf("invalid presubmits for %s: %v", repo, err)
+		}
+		c.Presubmits[repo] = expanded
+	}
+	for repo, js := range c.Postsubmits {
+		expanded, err := expandPostsubmitMatrices(js)
+		if err != nil {
+			return fmt.Errorf("invalid postsubmits for %s: %v", repo, err)
+		}
+		c.Postsubmits[repo] = expanded
+	}
+	periodics, err := expandPeriodicMatrices(c.Periodics)
+	if err != nil {
+		return fmt.Errorf("invalid periodics: %v", err)
+	}
+	c.Periodics = periodics
+
 	if c.decorationRequested() {
 		if c.Plank.DefaultDecorationConfig == nil {
 			return errors.New("no default decoration config provided for plank")
@@ -679,6 +805,21 @@ func (c *Config) finalizeJobConfig() error {
 		}
 	}
 
+	// Resolve the jobs to trigger once a job succeeds now that they are final.
+	for repo, vs := range c.Presubmits {
+		if err := resolvePresubmitRunAfterSuccess(vs); err != nil {
+			return fmt.Errorf("invalid presubmits for %s: %v", repo, err)
+		}
+	}
+	for repo, js := range c.Postsubmits {
+		if err := resolvePostsubmitRunAfterSuccess(js); err != nil {
+			return fmt.Errorf("invalid postsubmits for %s: %v", repo, err)
+		}
+	}
+	if err := resolvePeriodicRunAfterSuccess(c.Periodics); err != nil {
+		return fmt.Errorf("invalid periodics: %v", err)
+	}
+
 	return nil
 }
 
@@ -705,9 +846,27 @@ func validateJobBase(v JobBase, jobType prowapi.ProwJobType, podNamespace string
 	if v.MaxConcurrency < 0 {
 		return fmt.Errorf("max_concurrency: %d must be a non-negative number", v.MaxConcurrency)
 	}
+	if v.Priority < 0 {
+		return fmt.Errorf("priority: %d must be a non-negative number", v.Priority)
+	}
 	if err := validateAgent(v, podNamespace); err != nil {
 		return err
 	}
+	if err := validateClusters(v); err != nil {
+		return fmt.Errorf("clusters: %v", err)
+	}
+	if len(v.RunAfterSuccess) > 0 && v.Agent != string(prowapi.KubernetesAgent) {
+		return fmt.Errorf("run_after_success: only supported for the %s agent", prowapi.KubernetesAgent)
+	}
+	if len(v.Approvers) > 0 && jobType == prowapi.PresubmitJob {
+		return errors.New("approvers: only supported for postsubmits and periodics")
+	}
+	if err := validateRetryPolicy(v.Retry, v.Agent); err != nil {
+		return fmt.Errorf("retry: %v", err)
+	}
+	if err := validateReporterConfig(v.ReporterConfig); err != nil {
+		return fmt.Errorf("reporter_config: %v", err)
+	}
 	if err := validatePodSpec(jobType, v.Spec); err != nil {
 		return err
 	}
@@ -787,7 +946,18 @@ func (c *Config) validateJobConfig() error {
 	// Set the interval on the periodic jobs. It doesn't make sense to do this
 	// for child jobs.
 	for j, p := range c.Periodics {
-		if p.Cron != "" && p.Interval != "" {
+		if p.RunsAfterParent() {
+			if p.Watch != nil || p.Cron != "" || p.Interval != "" {
+				return fmt.Errorf("periodic %s runs after another job succeeds and cannot set watch, cron or interval", p.Name)
+			}
+		} else if p.Watch != nil {
+			if p.Cron != "" || p.Interval != "" {
+				return fmt.Errorf("watch cannot be set with cron or interval in periodic %s", p.Name)
+			}
+			if err := parsePeriodicWatch(p.Watch); err != nil {
+				return fmt.Errorf("invalid watch in periodic %s: %v", p.Name, err)
+			}
+		} else if p.Cron != "" && p.Interval != "" {
 			return fmt.Errorf("cron and interval cannot be both set in periodic %s", p.Name)
 		} else if p.Cron == "" && p.Interval == "" {
 			return fmt.Errorf("cron and interval cannot be both empty in periodic %s", p.Name)
@@ -807,6 +977,36 @@ func (c *Config) validateJobConfig() error {
 	return nil
 }
 
+// parsePeriodicWatch validates the watched input of a periodic and sets
+// its poll interval and GCS object.
+func parsePeriodicWatch(w *PeriodicWatch) error {
+	if (w.GCS == "") == (w.Git == nil) {
+		return errors.New("exactly one of gcs and git must be set")
+	}
+	if w.GCS != "" {
+		if !strings.HasPrefix(w.GCS, "gs://") {
+			return fmt.Errorf("gcs %q must start with gs://", w.GCS)
+		}
+		parts := strings.SplitN(strings.TrimPrefix(w.GCS, "gs://"), "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("gcs %q must be of the form gs://bucket/object", w.GCS)
+		}
+		w.gcsBucket, w.gcsObject = parts[0], parts[1]
+	}
+	if w.Git != nil && (w.Git.Org == "" || w.Git.Repo == "" || w.Git.Branch == "") {
+		return errors.New("git must set org, repo and branch")
+	}
+	w.pollInterval = 5 * time.Minute
+	if w.PollInterval != "" {
+		d, err := time.ParseDuration(w.PollInterval)
+		if err != nil {
+			return fmt.Errorf("cannot parse poll_interval: %v", err)
+		}
+		w.pollInterval = d
+	}
+	return nil
+}
+
 func parseProwConfig(c *Config) error {
 	if err := ValidateController(&c.Plank.Controller); err != nil {
 		return fmt.Errorf("validating plank config: %v", err)
@@ -822,6 +1022,35 @@ func parseProwConfig(c *Config) error {
 		c.Plank.PodPendingTimeout = podPendingTimeout
 	}
 
+	if c.Plank.DefaultPriorities == nil {
+		c.Plank.DefaultPriorities = map[prowapi.ProwJobType]int{}
+	}
+	for jobType, priority := range map[prowapi.ProwJobType]int{
+		prowapi.PresubmitJob:  400,
+		prowapi.PostsubmitJob: 300,
+		prowapi.BatchJob:      200,
+		prowapi.PeriodicJob:   100,
+	} {
+		if _, set := c.Plank.DefaultPriorities[jobType]; !set {
+			c.Plank.DefaultPriorities[jobType] = priority
+		}
+	}
+	for jobType, priority := range c.Plank.DefaultPriorities {
+		if priority < 0 {
+			return fmt.Errorf("plank.default_priorities: priority %d for %s must be a non-negative number", priority, jobType)
+		}
+	}
+	for orgRepo, quota := range c.Plank.Quotas {
+		if quota < 0 {
+			return fmt.Errorf("plank.quotas: quota %d for %s must be a non-negative number", quota, orgRepo)
+		}
+	}
+	for alias, cluster := range c.Plank.BuildClusters {
+		if cluster.MaxActivePods < 0 {
+			return fmt.Errorf("plank.build_clusters: max_active_pods %d for %s must be a non-negative number", cluster.MaxActivePods, alias)
+		}
+	}
+
 	if c.Gerrit.TickIntervalString == "" {
 		c.Gerrit.TickInterval = time.Minute
 	} else {
@@ -849,6 +1078,12 @@ func parseProwConfig(c *Config) error {
 		}
 	}
 
+	for key, webhooks := range c.WebhookReporter.Webhooks {
+		if err := validateWebhooks(webhooks); err != nil {
+			return fmt.Errorf("invalid webhook_reporter.webhooks for %s: %v", key, err)
+		}
+	}
+
 	for i := range c.JenkinsOperators {
 		if err := ValidateController(&c.JenkinsOperators[i].Controller); err != nil {
 			return fmt.Errorf("validating jenkins_operators config: %v", err)
@@ -997,12 +1232,56 @@ func parseProwConfig(c *Config) error {
 		}
 	}
 
+	for name, tmpl := range c.Tide.MergeTemplate {
+		if err := tmpl.parse(); err != nil {
+			return fmt.Errorf("merge commit template for %s is invalid: %v", name, err)
+		}
+		c.Tide.MergeTemplate[name] = tmpl
+	}
+
+	for name, limit := range c.Tide.BatchSizeLimitMap {
+		if limit < -1 {
+			return fmt.Errorf("batch size limit %d for %s is invalid, it needs to be at least -1", limit, name)
+		}
+	}
+
+	for i, priority := range c.Tide.Priority {
+		if len(priority.Labels) == 0 {
+			return fmt.Errorf("tide priority (index %d) is invalid: it needs to list at least one label", i)
+		}
+	}
+	for i, query := range c.Tide.Queries {
+		for j, priority := range query.Priority {
+			if len(priority.Labels) == 0 {
+				return fmt.Errorf("tide priority (index %d) of query (index %d) is invalid: it needs to list at least one label", j, i)
+			}
+		}
+	}
+
+	for i := range c.Tide.MergeFreezes {
+		if err := c.Tide.MergeFreezes[i].parse(); err != nil {
+			return fmt.Errorf("tide merge freeze (index %d) is invalid: %v", i, err)
+		}
+	}
+
+	for name, depth := range c.Tide.SpeculativeQueue {
+		if depth < 2 {
+			return fmt.Errorf("speculative queue depth %d for %s is invalid, it needs to be at least 2", depth, name)
+		}
+	}
+
 	for i, tq := range c.Tide.Queries {
 		if err := tq.Validate(); err != nil {
 			return fmt.Errorf("tide query (index %d) is invalid: %v", i, err)
 		}
 	}
 
+	for i, tgq := range c.Tide.GerritQueries {
+		if err := tgq.Validate(); err != nil {
+			return fmt.Errorf("tide gerrit query (index %d) is invalid: %v", i, err)
+		}
+	}
+
 	if c.ProwJobNamespace == "" {
 		c.ProwJobNamespace = "default"
 	}
@@ -1049,7 +1328,7 @@ func parseProwConfig(c *Config) error {
 func (c *JobConfig) decorationRequested() bool {
 	for _, vs := range c.Presubmits {
 		for i := range vs {
-			if vs[i].Decorate {
+			if vs[i].ShouldDecorate() {
 				return true
 			}
 		}
@@ -1057,14 +1336,14 @@ func (c *JobConfig) decorationRequested() bool {
 
 	for _, js := range c.Postsubmits {
 		for i := range js {
-			if js[i].Decorate {
+			if js[i].ShouldDecorate() {
 				return true
 			}
 		}
 	}
 
 	for i := range c.Periodics {
-		if c.Periodics[i].Decorate {
+		if c.Periodics[i].ShouldDecorate() {
 			return true
 		}
 	}
@@ -1072,6 +1351,86 @@ func (c *JobConfig) decorationRequested() bool {
 	return false
 }
 
+var validRetryReasons = sets.NewString(
+	string(prowapi.RetryOnEviction),
+	string(prowapi.RetryOnPodPendingTimeout),
+	string(prowapi.RetryOnCloneFailure),
+)
+
+func validateRetryPolicy(retry *prowapi.RetryPolicy, agent string) error {
+	if retry == nil {
+		return nil
+	}
+	if agent != string(prowapi.KubernetesAgent) {
+		return fmt.Errorf("only supported for the %s agent", prowapi.KubernetesAgent)
+	}
+	if retry.MaxAttempts < 1 {
+		return fmt.Errorf("max_attempts: %d must be a positive number", retry.MaxAttempts)
+	}
+	for _, reason := range retry.On {
+		if !validRetryReasons.Has(string(reason)) {
+			return fmt.Errorf("on: unknown reason %q, must be one of %v", reason, validRetryReasons.List())
+		}
+	}
+	return nil
+}
+
+var validJobStates = sets.NewString(
+	string(prowapi.TriggeredState),
+	string(prowapi.PendingState),
+	string(prowapi.SuccessState),
+	string(prowapi.FailureState),
+	string(prowapi.AbortedState),
+	string(prowapi.ErrorState),
+	string(prowapi.WaitingForApprovalState),
+)
+
+func validateJobStates(states []prowapi.ProwJobState) error {
+	for _, state := range states {
+		if !validJobStates.Has(string(state)) {
+			return fmt.Errorf("job_states_to_report: unknown state %q, must be one of %v", state, validJobStates.List())
+		}
+	}
+	return nil
+}
+
+func validateReporterConfig(reporterConfig *prowapi.ReporterConfig) error {
+	if reporterConfig == nil {
+		return nil
+	}
+	if slack := reporterConfig.Slack; slack != nil {
+		if slack.Channel == "" {
+			return errors.New("slack: channel must be set")
+		}
+		if err := validateJobStates(slack.JobStatesToReport); err != nil {
+			return fmt.Errorf("slack: %v", err)
+		}
+		if _, err := template.New("report").Parse(slack.ReportTemplate); err != nil {
+			return fmt.Errorf("slack: report_template: %v", err)
+		}
+	}
+	if err := validateWebhooks(reporterConfig.Webhooks); err != nil {
+		return fmt.Errorf("webhooks: %v", err)
+	}
+	return nil
+}
+
+func validateWebhooks(webhooks []prowapi.WebhookReporterConfig) error {
+	for _, webhook := range webhooks {
+		u, err := url.Parse(webhook.URL)
+		if err != nil {
+			return fmt.Errorf("url: %v", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url: %q must be an absolute http or https URL", webhook.URL)
+		}
+		if err := validateJobStates(webhook.JobStatesToReport); err != nil {
+			return fmt.Errorf("%s: %v", webhook.URL, err)
+		}
+	}
+	return nil
+}
+
 func validateLabels(labels map[string]string) error {
 	for label, value := range labels {
 		for _, prowLabel := range decorate.Labels() {
@@ -1089,6 +1448,33 @@ func validateLabels(labels map[string]string) error {
 	return nil
 }
 
+// validateClusters validates the build clusters that a job may run in.
+func validateClusters(v JobBase) error {
+	if len(v.Clusters) == 0 {
+		return nil
+	}
+	if v.Agent != string(prowapi.KubernetesAgent) {
+		return fmt.Errorf("only supported for the %s agent", prowapi.KubernetesAgent)
+	}
+	if v.Cluster != "" {
+		return errors.New("mutually exclusive with cluster")
+	}
+	names := sets.NewString()
+	for _, cluster := range v.Clusters {
+		if cluster.Name == "" {
+			return errors.New("every cluster needs a name")
+		}
+		if names.Has(cluster.Name) {
+			return fmt.Errorf("cluster %q is listed more than once", cluster.Name)
+		}
+		names.Insert(cluster.Name)
+		if cluster.Weight < 0 {
+			return fmt.Errorf("weight %d of cluster %q must be a non-negative number", cluster.Weight, cluster.Name)
+		}
+	}
+	return nil
+}
+
 func validateAgent(v JobBase, podNamespace string) error {
 	k := string(prowapi.KubernetesAgent)
 	b := string(prowapi.KnativeBuildAgent)
@@ -1201,8 +1587,8 @@ func validatePodSpec(jobType prowapi.ProwJobType, spec *v1.PodSpec) error {
 }
 
 func validateTriggering(job Presubmit) error {
-	if job.AlwaysRun && job.RunIfChanged != "" {
-		return fmt.Errorf("job %s is set to always run but also declares run_if_changed targets, which are mutually exclusive", job.Name)
+	if job.AlwaysRun && job.RegexpChangeMatcher.CouldRun() {
+		return fmt.Errorf("job %s is set to always run but also declares run_if_changed, skip_if_only_changed, include_changes or exclude_changes targets, which are mutually exclusive", job.Name)
 	}
 
 	if !job.SkipReport && job.Context == "" {
@@ -1258,7 +1644,7 @@ func (c *ProwConfig) defaultJobBase(base *JobBase) {
 		s := c.PodNamespace
 		base.Namespace = &s
 	}
-	if base.Cluster == "" {
+	if base.Cluster == "" && len(base.Clusters) == 0 {
 		base.Cluster = kube.DefaultClusterAlias
 	}
 }
@@ -1341,6 +1727,24 @@ func setBrancherRegexes(br Brancher) (Brancher, error) {
 	return br, nil
 }
 
+func setTaggerRegexes(t Tagger) (Tagger, error) {
+	if len(t.Tags) > 0 {
+		re, err := regexp.Compile(strings.Join(t.Tags, `|`))
+		if err != nil {
+			return t, fmt.Errorf("could not compile tag regex: %v", err)
+		}
+		t.reTags = re
+	}
+	if len(t.Releases) > 0 {
+		re, err := regexp.Compile(strings.Join(t.Releases, `|`))
+		if err != nil {
+			return t, fmt.Errorf("could not compile release regex: %v", err)
+		}
+		t.reReleases = re
+	}
+	return t, nil
+}
+
 func setChangeRegexes(cm RegexpChangeMatcher) (RegexpChangeMatcher, error) {
 	if cm.RunIfChanged != "" {
 		re, err := regexp.Compile(cm.RunIfChanged)
@@ -1349,6 +1753,32 @@ func setChangeRegexes(cm RegexpChangeMatcher) (RegexpChangeMatcher, error) {
 		}
 		cm.reChanges = re
 	}
+	if cm.SkipIfOnlyChanged != "" {
+		if cm.RunIfChanged != "" {
+			return cm, errors.New("run_if_changed and skip_if_only_changed are mutually exclusive")
+		}
+		re, err := regexp.Compile(cm.SkipIfOnlyChanged)
+		if err != nil {
+			return cm, fmt.Errorf("could not compile skip_if_only_changed regex: %v", err)
+		}
+		cm.reSkipChanges = re
+	}
+	cm.includeChanges = nil
+	for _, glob := range cm.IncludeChanges {
+		pattern, err := gitattributes.ParsePattern(glob)
+		if err != nil {
+			return cm, fmt.Errorf("could not parse include_changes glob: %v", err)
+		}
+		cm.includeChanges = append(cm.includeChanges, pattern)
+	}
+	cm.excludeChanges = nil
+	for _, glob := range cm.ExcludeChanges {
+		pattern, err := gitattributes.ParsePattern(glob)
+		if err != nil {
+			return cm, fmt.Errorf("could not parse exclude_changes glob: %v", err)
+		}
+		cm.excludeChanges = append(cm.excludeChanges, pattern)
+	}
 	return cm, nil
 }
 
@@ -1361,6 +1791,11 @@ func SetPostsubmitRegexes(ps []Postsubmit) error {
 			return fmt.Errorf("could not set branch regexes for %s: %v", j.Name, err)
 		}
 		ps[i].Brancher = b
+		t, err := setTaggerRegexes(j.Tagger)
+		if err != nil {
+			return fmt.Errorf("could not set tag regexes for %s: %v", j.Name, err)
+		}
+		ps[i].Tagger = t
 		c, err := setChangeRegexes(j.RegexpChangeMatcher)
 		if err != nil {
 			return fmt.Errorf("could not set change regexes for %s: %v", j.Name, err)
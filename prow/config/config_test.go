@@ -841,6 +841,248 @@ func TestValidateLabels(t *testing.T) {
 	}
 }
 
+func TestValidateRetryPolicy(t *testing.T) {
+	cases := []struct {
+		name  string
+		retry *prowjobv1.RetryPolicy
+		agent string
+		pass  bool
+	}{
+		{
+			name:  "no policy",
+			agent: string(prowjobv1.JenkinsAgent),
+			pass:  true,
+		},
+		{
+			name:  "happy case",
+			retry: &prowjobv1.RetryPolicy{MaxAttempts: 3, On: []prowjobv1.RetryReason{prowjobv1.RetryOnEviction, prowjobv1.RetryOnCloneFailure}},
+			agent: string(prowjobv1.KubernetesAgent),
+			pass:  true,
+		},
+		{
+			name:  "reject other agents",
+			retry: &prowjobv1.RetryPolicy{MaxAttempts: 3},
+			agent: string(prowjobv1.JenkinsAgent),
+		},
+		{
+			name:  "reject no attempts",
+			retry: &prowjobv1.RetryPolicy{},
+			agent: string(prowjobv1.KubernetesAgent),
+		},
+		{
+			name:  "reject unknown reason",
+			retry: &prowjobv1.RetryPolicy{MaxAttempts: 3, On: []prowjobv1.RetryReason{"bad-luck"}},
+			agent: string(prowjobv1.KubernetesAgent),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			switch err := validateRetryPolicy(tc.retry, tc.agent); {
+			case err == nil && !tc.pass:
+				t.Error("validation failed to raise an error")
+			case err != nil && tc.pass:
+				t.Errorf("validation should have passed, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateReporterConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *prowjobv1.ReporterConfig
+		pass   bool
+	}{
+		{
+			name: "no config",
+			pass: true,
+		},
+		{
+			name: "happy case",
+			config: &prowjobv1.ReporterConfig{Slack: &prowjobv1.SlackReporterConfig{
+				Channel:           "team-alerts",
+				JobStatesToReport: []prowjobv1.ProwJobState{prowjobv1.FailureState, prowjobv1.AbortedState},
+				ReportTemplate:    "Job {{.Spec.Job}} ended with {{.Status.State}}",
+			}},
+			pass: true,
+		},
+		{
+			name:   "reject no channel",
+			config: &prowjobv1.ReporterConfig{Slack: &prowjobv1.SlackReporterConfig{}},
+		},
+		{
+			name: "reject unknown state",
+			config: &prowjobv1.ReporterConfig{Slack: &prowjobv1.SlackReporterConfig{
+				Channel:           "team-alerts",
+				JobStatesToReport: []prowjobv1.ProwJobState{"flaky"},
+			}},
+		},
+		{
+			name: "reject invalid template",
+			config: &prowjobv1.ReporterConfig{Slack: &prowjobv1.SlackReporterConfig{
+				Channel:        "team-alerts",
+				ReportTemplate: "Job {{.Spec.Job",
+			}},
+		},
+		{
+			name: "webhooks",
+			config: &prowjobv1.ReporterConfig{Webhooks: []prowjobv1.WebhookReporterConfig{
+				{URL: "https://alerts.example.com/prow"},
+				{URL: "http://incidents.svc:8080/hook", JobStatesToReport: []prowjobv1.ProwJobState{prowjobv1.ErrorState}},
+			}},
+			pass: true,
+		},
+		{
+			name: "reject relative webhook url",
+			config: &prowjobv1.ReporterConfig{Webhooks: []prowjobv1.WebhookReporterConfig{
+				{URL: "/prow"},
+			}},
+		},
+		{
+			name: "reject webhook url with other scheme",
+			config: &prowjobv1.ReporterConfig{Webhooks: []prowjobv1.WebhookReporterConfig{
+				{URL: "ftp://alerts.example.com/prow"},
+			}},
+		},
+		{
+			name: "reject unknown webhook state",
+			config: &prowjobv1.ReporterConfig{Webhooks: []prowjobv1.WebhookReporterConfig{
+				{URL: "https://alerts.example.com/prow", JobStatesToReport: []prowjobv1.ProwJobState{"flaky"}},
+			}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			switch err := validateReporterConfig(tc.config); {
+			case err == nil && !tc.pass:
+				t.Error("validation failed to raise an error")
+			case err != nil && tc.pass:
+				t.Errorf("validation should have passed, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestWebhooksFor(t *testing.T) {
+	org := []prowjobv1.WebhookReporterConfig{{URL: "https://org.example.com"}}
+	repo := []prowjobv1.WebhookReporterConfig{{URL: "https://repo.example.com"}}
+	w := WebhookReporter{Webhooks: map[string][]prowjobv1.WebhookReporterConfig{
+		"o":      org,
+		"o/repo": repo,
+	}}
+	testCases := []struct {
+		org, repo string
+		expected  []prowjobv1.WebhookReporterConfig
+	}{
+		{org: "o", repo: "repo", expected: repo},
+		{org: "o", repo: "other", expected: org},
+		{org: "other", repo: "repo"},
+	}
+	for _, tc := range testCases {
+		if actual := w.WebhooksFor(tc.org, tc.repo); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s/%s: expected webhooks %v, got %v", tc.org, tc.repo, tc.expected, actual)
+		}
+	}
+}
+
+func TestValidateClusters(t *testing.T) {
+	k := string(prowjobv1.KubernetesAgent)
+	cases := []struct {
+		name string
+		base JobBase
+		pass bool
+	}{
+		{
+			name: "no clusters",
+			base: JobBase{Agent: string(prowjobv1.JenkinsAgent)},
+			pass: true,
+		},
+		{
+			name: "happy case",
+			base: JobBase{Agent: k, Clusters: []prowjobv1.EligibleCluster{{Name: "a"}, {Name: "b", Weight: 2}}},
+			pass: true,
+		},
+		{
+			name: "reject other agents",
+			base: JobBase{Agent: string(prowjobv1.JenkinsAgent), Clusters: []prowjobv1.EligibleCluster{{Name: "a"}}},
+		},
+		{
+			name: "reject cluster and clusters",
+			base: JobBase{Agent: k, Cluster: "a", Clusters: []prowjobv1.EligibleCluster{{Name: "a"}}},
+		},
+		{
+			name: "reject clusters without a name",
+			base: JobBase{Agent: k, Clusters: []prowjobv1.EligibleCluster{{Weight: 1}}},
+		},
+		{
+			name: "reject duplicate clusters",
+			base: JobBase{Agent: k, Clusters: []prowjobv1.EligibleCluster{{Name: "a"}, {Name: "a"}}},
+		},
+		{
+			name: "reject negative weights",
+			base: JobBase{Agent: k, Clusters: []prowjobv1.EligibleCluster{{Name: "a", Weight: -1}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			switch err := validateClusters(tc.base); {
+			case err == nil && !tc.pass:
+				t.Error("validation failed to raise an error")
+			case err != nil && tc.pass:
+				t.Errorf("validation should have passed, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildClusterAccepts(t *testing.T) {
+	gpus := BuildCluster{NodeLabels: map[string][]string{"accelerator": {"k80", "p100"}}}
+	cases := []struct {
+		name         string
+		cluster      BuildCluster
+		nodeSelector map[string]string
+		expected     bool
+	}{
+		{
+			name:         "cluster without node labels accepts any selector",
+			nodeSelector: map[string]string{"accelerator": "k80"},
+			expected:     true,
+		},
+		{
+			name:     "pods without a selector are accepted",
+			cluster:  gpus,
+			expected: true,
+		},
+		{
+			name:         "listed value is accepted",
+			cluster:      gpus,
+			nodeSelector: map[string]string{"accelerator": "p100"},
+			expected:     true,
+		},
+		{
+			name:         "unlisted value is rejected",
+			cluster:      gpus,
+			nodeSelector: map[string]string{"accelerator": "v100"},
+		},
+		{
+			name:         "unlisted label is rejected",
+			cluster:      gpus,
+			nodeSelector: map[string]string{"accelerator": "k80", "pool": "highmem"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.cluster.Accepts(tc.nodeSelector); actual != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, actual)
+			}
+		})
+	}
+}
+
 func TestValidateJobBase(t *testing.T) {
 	ka := string(prowjobv1.KubernetesAgent)
 	ba := string(prowjobv1.KnativeBuildAgent)
@@ -957,6 +1199,17 @@ func TestValidateJobBase(t *testing.T) {
 			},
 			pass: true,
 		},
+		{
+			name: "approvers on a presubmit",
+			base: JobBase{
+				Name:      "name",
+				Agent:     ka,
+				Spec:      &goodSpec,
+				Namespace: &ns,
+				Approvers: []string{"someone"},
+			},
+			pass: false,
+		},
 	}
 
 	for _, tc := range cases {
@@ -971,6 +1224,76 @@ func TestValidateJobBase(t *testing.T) {
 	}
 }
 
+func TestParsePeriodicWatch(t *testing.T) {
+	cases := []struct {
+		name           string
+		watch          PeriodicWatch
+		expectErr      bool
+		expectBucket   string
+		expectObject   string
+		expectInterval time.Duration
+	}{
+		{
+			name:           "gcs object",
+			watch:          PeriodicWatch{GCS: "gs://bucket/path/to/object"},
+			expectBucket:   "bucket",
+			expectObject:   "path/to/object",
+			expectInterval: 5 * time.Minute,
+		},
+		{
+			name:           "git branch with poll interval",
+			watch:          PeriodicWatch{Git: &GitWatch{Org: "org", Repo: "repo", Branch: "master"}, PollInterval: "1m"},
+			expectInterval: time.Minute,
+		},
+		{
+			name:      "neither gcs nor git",
+			watch:     PeriodicWatch{},
+			expectErr: true,
+		},
+		{
+			name:      "both gcs and git",
+			watch:     PeriodicWatch{GCS: "gs://bucket/object", Git: &GitWatch{Org: "org", Repo: "repo", Branch: "master"}},
+			expectErr: true,
+		},
+		{
+			name:      "gcs without object",
+			watch:     PeriodicWatch{GCS: "gs://bucket"},
+			expectErr: true,
+		},
+		{
+			name:      "git without branch",
+			watch:     PeriodicWatch{Git: &GitWatch{Org: "org", Repo: "repo"}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid poll interval",
+			watch:     PeriodicWatch{GCS: "gs://bucket/object", PollInterval: "often"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := parsePeriodicWatch(&tc.watch)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got one: %v", err)
+			}
+			if bucket, object := tc.watch.GCSObject(); bucket != tc.expectBucket || object != tc.expectObject {
+				t.Errorf("expected GCS object %s/%s, got %s/%s", tc.expectBucket, tc.expectObject, bucket, object)
+			}
+			if interval := tc.watch.GetPollInterval(); interval != tc.expectInterval {
+				t.Errorf("expected poll interval %v, got %v", tc.expectInterval, interval)
+			}
+		})
+	}
+}
+
 // integration test for fake config loading
 func TestValidConfigLoading(t *testing.T) {
 	var testCases = []struct {
@@ -1077,6 +1400,46 @@ periodics:
 - interval: 10m
   agent: kubernetes
   name: foo
+  spec:
+    containers:
+    - image: alpine`,
+			},
+			expectError: true,
+		},
+		{
+			name:       "periodic that runs after another one needs no schedule",
+			prowConfig: ``,
+			jobConfigs: []string{
+				`
+periodics:
+- interval: 10m
+  name: foo
+  run_after_success:
+  - bar
+  spec:
+    containers:
+    - image: alpine
+- name: bar
+  spec:
+    containers:
+    - image: alpine`,
+			},
+		},
+		{
+			name:       "reject schedule of periodic that runs after another one",
+			prowConfig: ``,
+			jobConfigs: []string{
+				`
+periodics:
+- interval: 10m
+  name: foo
+  run_after_success:
+  - bar
+  spec:
+    containers:
+    - image: alpine
+- interval: 10m
+  name: bar
   spec:
     containers:
     - image: alpine`,
@@ -2021,3 +2384,54 @@ func TestValidateComponentConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestSetChangeRegexes(t *testing.T) {
+	testCases := []struct {
+		name        string
+		cm          RegexpChangeMatcher
+		expectedErr bool
+	}{
+		{
+			name: "valid filters",
+			cm: RegexpChangeMatcher{
+				SkipIfOnlyChanged: `\.md$`,
+				IncludeChanges:    []string{"prow/**"},
+				ExcludeChanges:    []string{"*.md"},
+			},
+		},
+		{
+			name: "run_if_changed and skip_if_only_changed are mutually exclusive",
+			cm: RegexpChangeMatcher{
+				RunIfChanged:      "^prow/",
+				SkipIfOnlyChanged: `\.md$`,
+			},
+			expectedErr: true,
+		},
+		{
+			name: "invalid skip_if_only_changed",
+			cm: RegexpChangeMatcher{
+				SkipIfOnlyChanged: "(",
+			},
+			expectedErr: true,
+		},
+		{
+			name: "invalid glob",
+			cm: RegexpChangeMatcher{
+				ExcludeChanges: []string{"docs/"},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := setChangeRegexes(tc.cm)
+			if err == nil && tc.expectedErr {
+				t.Error("expected an error but got none")
+			}
+			if err != nil && !tc.expectedErr {
+				t.Errorf("expected no error but got one: %v", err)
+			}
+		})
+	}
+}
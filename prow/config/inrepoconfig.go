@@ -0,0 +1,376 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/git"
+)
+
+const (
+	// inRepoConfigFileName is the name of the file that holds job
+	// definitions inside of a repository.
+	inRepoConfigFileName = ".prow.yaml"
+
+	// prowYAMLCacheSize is the number of .prow.yaml files that are kept
+	// in memory, to avoid cloning a repo every time its jobs are needed.
+	prowYAMLCacheSize = 1000
+)
+
+// InRepoConfig to enable configuration inside the source code of a repository
+type InRepoConfig struct {
+	// Enabled describes whether InRepoConfig is enabled for a given repository.
+	// This can be set globally, per org or per repo using '*', 'org' or
+	// 'org/repo' as key. The narrowest match always takes precedence.
+	Enabled map[string]*bool `json:"enabled,omitempty"`
+}
+
+// InRepoConfigEnabled returns whether InRepoConfig is enabled for a given
+// "org/repo" identifier.
+func (c *Config) InRepoConfigEnabled(identifier string) bool {
+	if c.InRepoConfig.Enabled[identifier] != nil {
+		return *c.InRepoConfig.Enabled[identifier]
+	}
+	identifierSlashSplit := strings.Split(identifier, "/")
+	if len(identifierSlashSplit) == 2 && c.InRepoConfig.Enabled[identifierSlashSplit[0]] != nil {
+		return *c.InRepoConfig.Enabled[identifierSlashSplit[0]]
+	}
+	if c.InRepoConfig.Enabled["*"] != nil {
+		return *c.InRepoConfig.Enabled["*"]
+	}
+	return false
+}
+
+// ProwYAML represents the content of a .prow.yaml file
+// used to version Presubmits and Postsubmits inside the tested repo.
+type ProwYAML struct {
+	Presubmits  []Presubmit  `json:"presubmits"`
+	Postsubmits []Postsubmit `json:"postsubmits"`
+}
+
+// RefGetter is used to retrieve a Git Reference. Its purpose is
+// to be able to defer calling out to GitHub in the context of
+// inrepoconfig to make sure its only done when we actually need
+// to have that info.
+type RefGetter = func() (string, error)
+
+// ProwYAMLGetter is used to retrieve a ProwYAML. Tests should provide
+// their own implementation and set that on the Config.
+type ProwYAMLGetter func(c *Config, gc *git.Client, identifier, baseSHA string, headSHAs ...string) (*ProwYAML, error)
+
+// Verify defaultProwYAMLGetter is a ProwYAMLGetter
+var _ ProwYAMLGetter = defaultProwYAMLGetter
+
+// defaultProwYAMLGetter clones the repository, checks out the base SHA,
+// merges all head SHAs into it and reads the .prow.yaml from the result.
+// A repository without a .prow.yaml yields an empty ProwYAML.
+func defaultProwYAMLGetter(
+	c *Config,
+	gc *git.Client,
+	identifier string,
+	baseSHA string,
+	headSHAs ...string) (*ProwYAML, error) {
+
+	log := logrus.WithField("repo", identifier)
+	if gc == nil {
+		log.Error("defaultProwYAMLGetter was called with a nil git client")
+		return nil, fmt.Errorf("gitClient is nil")
+	}
+
+	identifierSlashSplit := strings.Split(identifier, "/")
+	if len(identifierSlashSplit) != 2 {
+		return nil, fmt.Errorf("didn't get two but %d segments when splitting repo identifier %q", len(identifierSlashSplit), identifier)
+	}
+	repo, err := gc.Clone(identifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone repo for %q: %v", identifier, err)
+	}
+	defer func() {
+		if err := repo.Clean(); err != nil {
+			log.WithError(err).Error("Failed to clean up repo.")
+		}
+	}()
+
+	if err := repo.Config("user.name", "prow"); err != nil {
+		return nil, err
+	}
+	if err := repo.Config("user.email", "prow@localhost"); err != nil {
+		return nil, err
+	}
+	if err := repo.Config("commit.gpgsign", "false"); err != nil {
+		return nil, err
+	}
+
+	if err := repo.Checkout(baseSHA); err != nil {
+		return nil, fmt.Errorf("failed to check out base SHA %q: %v", baseSHA, err)
+	}
+	for _, headSHA := range headSHAs {
+		if ok, err := repo.Merge(headSHA); err != nil {
+			return nil, fmt.Errorf("failed to merge %q: %v", headSHA, err)
+		} else if !ok {
+			return nil, fmt.Errorf("merging %q resulted in a merge conflict", headSHA)
+		}
+	}
+
+	prowYAMLFilePath := filepath.Join(repo.Dir, inRepoConfigFileName)
+	if _, err := os.Stat(prowYAMLFilePath); err != nil {
+		if os.IsNotExist(err) {
+			log.WithField("file", inRepoConfigFileName).Debug("File does not exist.")
+			return &ProwYAML{}, nil
+		}
+		return nil, fmt.Errorf("failed to check if file %q exists: %v", inRepoConfigFileName, err)
+	}
+
+	bytes, err := ioutil.ReadFile(prowYAMLFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %v", inRepoConfigFileName, err)
+	}
+
+	prowYAML := &ProwYAML{}
+	if err := yaml.UnmarshalStrict(bytes, prowYAML); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %q: %v", inRepoConfigFileName, err)
+	}
+
+	if err := defaultAndValidateProwYAML(c, prowYAML, identifier); err != nil {
+		return nil, err
+	}
+
+	return prowYAML, nil
+}
+
+// defaultAndValidateProwYAML applies the same defaulting and validation to
+// the jobs from a .prow.yaml that config.Load applies to the central config.
+func defaultAndValidateProwYAML(c *Config, p *ProwYAML, identifier string) error {
+	templates, err := resolveTemplates(c.JobTemplates)
+	if err != nil {
+		return err
+	}
+	if err := applyPresubmitTemplates(p.Presubmits, templates); err != nil {
+		return fmt.Errorf("invalid %s for %s: %v", inRepoConfigFileName, identifier, err)
+	}
+	if err := applyPostsubmitTemplates(p.Postsubmits, templates); err != nil {
+		return fmt.Errorf("invalid %s for %s: %v", inRepoConfigFileName, identifier, err)
+	}
+	presubmits, err := expandPresubmitMatrices(p.Presubmits)
+	if err != nil {
+		return fmt.Errorf("invalid %s for %s: %v", inRepoConfigFileName, identifier, err)
+	}
+	p.Presubmits = presubmits
+	postsubmits, err := expandPostsubmitMatrices(p.Postsubmits)
+	if err != nil {
+		return fmt.Errorf("invalid %s for %s: %v", inRepoConfigFileName, identifier, err)
+	}
+	p.Postsubmits = postsubmits
+
+	for i := range p.Presubmits {
+		p.Presubmits[i].SourcePath = inRepoConfigFileName
+		setPresubmitDecorationDefaults(c, &p.Presubmits[i])
+	}
+	for i := range p.Postsubmits {
+		p.Postsubmits[i].SourcePath = inRepoConfigFileName
+		setPostsubmitDecorationDefaults(c, &p.Postsubmits[i])
+	}
+
+	c.defaultPresubmitFields(p.Presubmits)
+	if err := SetPresubmitRegexes(p.Presubmits); err != nil {
+		return fmt.Errorf("failed to set presubmit regexes: %v", err)
+	}
+	c.defaultPostsubmitFields(p.Postsubmits)
+	if err := SetPostsubmitRegexes(p.Postsubmits); err != nil {
+		return fmt.Errorf("failed to set postsubmit regexes: %v", err)
+	}
+
+	var errs []string
+	for _, ps := range p.Presubmits {
+		if err := resolvePresets(ps.Name, ps.Labels, ps.Spec, ps.BuildSpec, c.Presets); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err := validateInRepoJobBase(ps.JobBase, prowapi.PresubmitJob, c.PodNamespace); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid presubmit job %s: %v", ps.Name, err))
+			continue
+		}
+		if err := validateTriggering(ps); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, ps := range p.Postsubmits {
+		if err := resolvePresets(ps.Name, ps.Labels, ps.Spec, ps.BuildSpec, c.Presets); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err := validateInRepoJobBase(ps.JobBase, prowapi.PostsubmitJob, c.PodNamespace); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid postsubmit job %s: %v", ps.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid %s for %s: %s", inRepoConfigFileName, identifier, strings.Join(errs, ", "))
+	}
+
+	if err := resolvePresubmitRunAfterSuccess(p.Presubmits); err != nil {
+		return fmt.Errorf("invalid %s for %s: %v", inRepoConfigFileName, identifier, err)
+	}
+	if err := resolvePostsubmitRunAfterSuccess(p.Postsubmits); err != nil {
+		return fmt.Errorf("invalid %s for %s: %v", inRepoConfigFileName, identifier, err)
+	}
+
+	return nil
+}
+
+// validateInRepoJobBase validates a job from a .prow.yaml. In addition to
+// the checks for the central config, only the kubernetes agent is allowed,
+// as it is the only agent whose jobs are fully described by the job config.
+func validateInRepoJobBase(v JobBase, jobType prowapi.ProwJobType, podNamespace string) error {
+	if v.Agent != string(prowapi.KubernetesAgent) {
+		return fmt.Errorf("agent must be %s for jobs in %s (found %q)", prowapi.KubernetesAgent, inRepoConfigFileName, v.Agent)
+	}
+	return validateJobBase(v, jobType, podNamespace)
+}
+
+// GetPresubmits will return all presubmits for the given identifier. This includes
+// Presubmits that are versioned inside the tested repo, if the inrepoconfig feature
+// is enabled. Consumers that pass in a RefGetter implementation that does a call to
+// GitHub and who also need the result of that GitHub call just keep a pointer to its
+// result, but must nilcheck that pointer before accessing it.
+//
+// Callers must only pass headSHAGetters for pull requests that are trusted; the
+// .prow.yaml at an untrusted head could otherwise be used to inject arbitrary jobs.
+func (c *Config) GetPresubmits(gc *git.Client, identifier string, baseSHAGetter RefGetter, headSHAGetters ...RefGetter) ([]Presubmit, error) {
+	if !c.InRepoConfigEnabled(identifier) {
+		return c.Presubmits[identifier], nil
+	}
+
+	baseSHA, headSHAs, err := getSHAs(baseSHAGetter, headSHAGetters)
+	if err != nil {
+		return nil, err
+	}
+	prowYAML, err := c.getProwYAML(gc, identifier, baseSHA, headSHAs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergePresubmits(identifier, c.Presubmits[identifier], prowYAML.Presubmits)
+}
+
+// GetPostsubmits will return all postsubmits for the given identifier. This includes
+// Postsubmits that are versioned inside the tested repo at the given base, if the
+// inrepoconfig feature is enabled.
+func (c *Config) GetPostsubmits(gc *git.Client, identifier string, baseSHAGetter RefGetter) ([]Postsubmit, error) {
+	if !c.InRepoConfigEnabled(identifier) {
+		return c.Postsubmits[identifier], nil
+	}
+
+	baseSHA, _, err := getSHAs(baseSHAGetter, nil)
+	if err != nil {
+		return nil, err
+	}
+	prowYAML, err := c.getProwYAML(gc, identifier, baseSHA)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergePostsubmits(identifier, c.Postsubmits[identifier], prowYAML.Postsubmits)
+}
+
+// getProwYAML returns the .prow.yaml of a repo at the base SHA with the head
+// SHAs merged into it. The result only depends on the SHAs and the config,
+// so it is cached until the config is reloaded. Errors are not cached, as
+// they may be transient.
+func (c *Config) getProwYAML(gc *git.Client, identifier, baseSHA string, headSHAs ...string) (*ProwYAML, error) {
+	key := strings.Join(append([]string{identifier, baseSHA}, headSHAs...), ",")
+	if c.prowYAMLCache != nil {
+		if cached, ok := c.prowYAMLCache.Get(key); ok {
+			return cached.(*ProwYAML), nil
+		}
+	}
+	prowYAMLGetter := c.ProwYAMLGetter
+	if prowYAMLGetter == nil {
+		prowYAMLGetter = defaultProwYAMLGetter
+	}
+	prowYAML, err := prowYAMLGetter(c, gc, identifier, baseSHA, headSHAs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %v", inRepoConfigFileName, err)
+	}
+	if c.prowYAMLCache != nil {
+		c.prowYAMLCache.Add(key, prowYAML)
+	}
+	return prowYAML, nil
+}
+
+func getSHAs(baseSHAGetter RefGetter, headSHAGetters []RefGetter) (string, []string, error) {
+	baseSHA, err := baseSHAGetter()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get baseSHA: %v", err)
+	}
+	var headSHAs []string
+	for _, headSHAGetter := range headSHAGetters {
+		headSHA, err := headSHAGetter()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get headRef: %v", err)
+		}
+		headSHAs = append(headSHAs, headSHA)
+	}
+	return baseSHA, headSHAs, nil
+}
+
+// mergePresubmits joins the centrally configured presubmits with the ones
+// from the repo, refusing to let the repo shadow a central job by name.
+func mergePresubmits(identifier string, static, inRepo []Presubmit) ([]Presubmit, error) {
+	names := sets.NewString()
+	for _, ps := range static {
+		names.Insert(ps.Name)
+	}
+	var res []Presubmit
+	res = append(res, static...)
+	for _, ps := range inRepo {
+		if names.Has(ps.Name) {
+			return nil, fmt.Errorf("presubmit %s in %s of %s duplicates a job in the central config", ps.Name, inRepoConfigFileName, identifier)
+		}
+		names.Insert(ps.Name)
+		res = append(res, ps)
+	}
+	return res, nil
+}
+
+// mergePostsubmits joins the centrally configured postsubmits with the ones
+// from the repo, refusing to let the repo shadow a central job by name.
+func mergePostsubmits(identifier string, static, inRepo []Postsubmit) ([]Postsubmit, error) {
+	names := sets.NewString()
+	for _, ps := range static {
+		names.Insert(ps.Name)
+	}
+	var res []Postsubmit
+	res = append(res, static...)
+	for _, ps := range inRepo {
+		if names.Has(ps.Name) {
+			return nil, fmt.Errorf("postsubmit %s in %s of %s duplicates a job in the central config", ps.Name, inRepoConfigFileName, identifier)
+		}
+		names.Insert(ps.Name)
+		res = append(res, ps)
+	}
+	return res, nil
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	lru "github.com/hashicorp/golang-lru"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/git"
+	"k8s.io/test-infra/prow/git/localgit"
+)
+
+func TestInRepoConfigEnabled(t *testing.T) {
+	yes, no := true, false
+	testCases := []struct {
+		name     string
+		enabled  map[string]*bool
+		expected bool
+	}{
+		{
+			name:     "unset means disabled",
+			expected: false,
+		},
+		{
+			name:     "enabled globally",
+			enabled:  map[string]*bool{"*": &yes},
+			expected: true,
+		},
+		{
+			name:     "enabled for org",
+			enabled:  map[string]*bool{"org": &yes},
+			expected: true,
+		},
+		{
+			name:     "enabled for repo",
+			enabled:  map[string]*bool{"org/repo": &yes},
+			expected: true,
+		},
+		{
+			name:     "enabled for other repo",
+			enabled:  map[string]*bool{"org/other": &yes},
+			expected: false,
+		},
+		{
+			name:     "repo disable beats org enable",
+			enabled:  map[string]*bool{"org": &yes, "org/repo": &no},
+			expected: false,
+		},
+		{
+			name:     "org enable beats global disable",
+			enabled:  map[string]*bool{"*": &no, "org": &yes},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		c := &Config{ProwConfig: ProwConfig{InRepoConfig: InRepoConfig{Enabled: tc.enabled}}}
+		if actual := c.InRepoConfigEnabled("org/repo"); actual != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestDefaultProwYAMLGetter(t *testing.T) {
+	const org, repo = "org", "repo"
+	prowYAML := []byte(`presubmits:
+- name: in-repo-job
+  always_run: true
+  spec:
+    containers:
+    - image: alpine
+      command: ["true"]
+`)
+
+	testCases := []struct {
+		name       string
+		baseFiles  map[string][]byte
+		headFiles  map[string][]byte
+		expectErr  bool
+		expectJobs sets.String
+	}{
+		{
+			name:       "no .prow.yaml means no jobs",
+			expectJobs: sets.NewString(),
+		},
+		{
+			name:       ".prow.yaml on base is read",
+			baseFiles:  map[string][]byte{".prow.yaml": prowYAML},
+			expectJobs: sets.NewString("in-repo-job"),
+		},
+		{
+			name:       ".prow.yaml on head is merged into base",
+			headFiles:  map[string][]byte{".prow.yaml": prowYAML},
+			expectJobs: sets.NewString("in-repo-job"),
+		},
+		{
+			name:      "unknown fields are rejected",
+			baseFiles: map[string][]byte{".prow.yaml": []byte("presubmitz: []")},
+			expectErr: true,
+		},
+		{
+			name: "jobs for other agents are rejected",
+			baseFiles: map[string][]byte{".prow.yaml": []byte(`presubmits:
+- name: jenkins-job
+  agent: jenkins
+  always_run: true
+`)},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lg, gc, err := localgit.New()
+			if err != nil {
+				t.Fatalf("Making local git repo: %v", err)
+			}
+			defer func() {
+				if err := lg.Clean(); err != nil {
+					t.Errorf("Error cleaning LocalGit: %v", err)
+				}
+				if err := gc.Clean(); err != nil {
+					t.Errorf("Error cleaning Client: %v", err)
+				}
+			}()
+			if err := lg.MakeFakeRepo(org, repo); err != nil {
+				t.Fatalf("Making fake repo: %v", err)
+			}
+			if len(tc.baseFiles) > 0 {
+				if err := lg.AddCommit(org, repo, tc.baseFiles); err != nil {
+					t.Fatalf("Adding base commit: %v", err)
+				}
+			}
+			baseSHA, err := lg.RevParse(org, repo, "HEAD")
+			if err != nil {
+				t.Fatalf("Getting base SHA: %v", err)
+			}
+			var headSHAs []string
+			if len(tc.headFiles) > 0 {
+				if err := lg.CheckoutNewBranch(org, repo, "pull"); err != nil {
+					t.Fatalf("Creating head branch: %v", err)
+				}
+				if err := lg.AddCommit(org, repo, tc.headFiles); err != nil {
+					t.Fatalf("Adding head commit: %v", err)
+				}
+				headSHA, err := lg.RevParse(org, repo, "HEAD")
+				if err != nil {
+					t.Fatalf("Getting head SHA: %v", err)
+				}
+				headSHAs = append(headSHAs, headSHA)
+			}
+
+			c := &Config{ProwConfig: ProwConfig{PodNamespace: "default"}}
+			p, err := defaultProwYAMLGetter(c, gc, org+"/"+repo, baseSHA, headSHAs...)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got one: %v", err)
+			}
+			jobs := sets.NewString()
+			for _, ps := range p.Presubmits {
+				jobs.Insert(ps.Name)
+				if ps.Context != ps.Name {
+					t.Errorf("expected context of %s to be defaulted, got %q", ps.Name, ps.Context)
+				}
+			}
+			if !jobs.Equal(tc.expectJobs) {
+				t.Errorf("expected jobs %v, got %v", tc.expectJobs.List(), jobs.List())
+			}
+		})
+	}
+}
+
+func TestGetPresubmitsInRepo(t *testing.T) {
+	enabled := true
+	testCases := []struct {
+		name       string
+		inRepo     []Presubmit
+		expectErr  bool
+		expectJobs sets.String
+	}{
+		{
+			name:       "central and in-repo jobs are merged",
+			inRepo:     []Presubmit{{JobBase: JobBase{Name: "in-repo"}}},
+			expectJobs: sets.NewString("central", "in-repo"),
+		},
+		{
+			name:      "in-repo job may not shadow a central job",
+			inRepo:    []Presubmit{{JobBase: JobBase{Name: "central"}}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		c := &Config{
+			JobConfig: JobConfig{
+				Presubmits: map[string][]Presubmit{"org/repo": {{JobBase: JobBase{Name: "central"}}}},
+			},
+			ProwConfig: ProwConfig{
+				InRepoConfig: InRepoConfig{Enabled: map[string]*bool{"*": &enabled}},
+			},
+			ProwYAMLGetter: func(_ *Config, _ *git.Client, _, _ string, _ ...string) (*ProwYAML, error) {
+				return &ProwYAML{Presubmits: tc.inRepo}, nil
+			},
+		}
+		sha := func() (string, error) { return "sha", nil }
+		presubmits, err := c.GetPresubmits(nil, "org/repo", sha, sha)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected an error but got none", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected no error but got one: %v", tc.name, err)
+			continue
+		}
+		jobs := sets.NewString()
+		for _, ps := range presubmits {
+			jobs.Insert(ps.Name)
+		}
+		if !jobs.Equal(tc.expectJobs) {
+			t.Errorf("%s: expected jobs %v, got %v", tc.name, tc.expectJobs.List(), jobs.List())
+		}
+	}
+}
+
+func TestGetProwYAMLCached(t *testing.T) {
+	cache, err := lru.New(prowYAMLCacheSize)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	var calls int
+	c := &Config{
+		ProwYAMLGetter: func(_ *Config, _ *git.Client, _, _ string, _ ...string) (*ProwYAML, error) {
+			calls++
+			return &ProwYAML{}, nil
+		},
+		prowYAMLCache: cache,
+	}
+	for _, headSHAs := range [][]string{{"head"}, {"head"}, {"other-head"}, {"head", "other-head"}, {"other-head"}} {
+		if _, err := c.getProwYAML(nil, "org/repo", "base", headSHAs...); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected the .prow.yaml to be read for 3 distinct sets of SHAs, got %d reads.", calls)
+	}
+}
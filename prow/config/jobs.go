@@ -22,6 +22,7 @@ import (
 	"time"
 
 	buildv1alpha1 "github.com/knative/build/pkg/apis/build/v1alpha1"
+	"k8s.io/test-infra/prow/gitattributes"
 	"k8s.io/test-infra/prow/github"
 
 	v1 "k8s.io/api/core/v1"
@@ -84,11 +85,18 @@ type JobBase struct {
 	Labels map[string]string `json:"labels,omitempty"`
 	// MaximumConcurrency of this job, 0 implies no limit.
 	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// Priority of this job when queueing for execution. Higher priority jobs
+	// are started first; 0 implies the default priority for the job type.
+	Priority int `json:"priority,omitempty"`
 	// Agent that will take care of running this job.
 	Agent string `json:"agent"`
 	// Cluster is the alias of the cluster to run this job in.
 	// (Default: kube.DefaultClusterAlias)
 	Cluster string `json:"cluster,omitempty"`
+	// Clusters are the build clusters that the job may run in, for plank
+	// to select one of when it starts the job. Mutually exclusive with
+	// Cluster.
+	Clusters []prowapi.EligibleCluster `json:"clusters,omitempty"`
 	// Namespace is the namespace in which pods schedule.
 	//   nil: results in config.PodNamespace (aka pod default)
 	//   empty: results in config.ProwJobNamespace (aka same as prowjob)
@@ -98,6 +106,28 @@ type JobBase struct {
 	// If this field is unspecified or false, a new pod will be created to replace
 	// the evicted one.
 	ErrorOnEviction bool `json:"error_on_eviction,omitempty"`
+	// Retry is the policy for retrying the job when it fails for
+	// reasons unrelated to the code under test.
+	Retry *prowapi.RetryPolicy `json:"retry,omitempty"`
+	// RunAfterSuccess is a list of names of jobs of the same type and repo
+	// that will be triggered once this job has completed successfully.
+	RunAfterSuccess []string `json:"run_after_success,omitempty"`
+	// Matrix maps environment variable names to lists of values. A job with
+	// a matrix is expanded into one job per combination of values when the
+	// config is loaded, with the values suffixed to its name and context and
+	// set as environment variables in every container of its pod spec.
+	Matrix map[string][]string `json:"matrix,omitempty"`
+	// Extends is the name of a job template whose labels, pod spec and
+	// decoration config are merged into this job when the config is loaded.
+	// Fields set on the job take precedence over the ones of the template.
+	Extends string `json:"extends,omitempty"`
+	// Approvers are the GitHub logins of the users that may approve the
+	// job in Deck. A postsubmit or periodic with approvers is created
+	// waiting for approval and only started once approved.
+	Approvers []string `json:"approvers,omitempty"`
+	// ReporterConfig configures the reports of the job that crier sends
+	// to places other than the source of its code, e.g. to Slack.
+	ReporterConfig *prowapi.ReporterConfig `json:"reporter_config,omitempty"`
 	// SourcePath contains the path where this job is defined
 	SourcePath string `json:"-"`
 	// Spec is the Kubernetes pod spec used if Agent is kubernetes.
@@ -136,7 +166,8 @@ type Presubmit struct {
 	Reporter
 
 	// We'll set these when we load it.
-	re *regexp.Regexp // from Trigger.
+	re              *regexp.Regexp // from Trigger.
+	runAfterSuccess []Presubmit    // from RunAfterSuccess.
 }
 
 // Postsubmit runs on push events.
@@ -147,8 +178,14 @@ type Postsubmit struct {
 
 	Brancher
 
+	Tagger
+
 	// TODO(krzyzacy): Move existing `Report` into `Skip_Report` once this is deployed
 	Reporter
+
+	// We'll set these when we load it.
+	runAfterSuccess []Postsubmit // from RunAfterSuccess.
+	runsAfterParent bool         // from the RunAfterSuccess of other jobs.
 }
 
 // Periodic runs on a timer.
@@ -159,10 +196,56 @@ type Periodic struct {
 	Interval string `json:"interval"`
 	// Cron representation of job trigger time
 	Cron string `json:"cron"`
+	// Watch triggers the job when a watched input changes instead
+	// of on an interval or cron schedule.
+	Watch *PeriodicWatch `json:"watch,omitempty"`
 	// Tags for config entries
 	Tags []string `json:"tags,omitempty"`
 
-	interval time.Duration
+	interval        time.Duration
+	runAfterSuccess []Periodic // from RunAfterSuccess.
+	runsAfterParent bool       // from the RunAfterSuccess of other jobs.
+}
+
+// PeriodicWatch configures the input that triggers a periodic when it
+// changes. Exactly one of GCS and Git must be set.
+type PeriodicWatch struct {
+	// GCS is the gs://bucket/path of an object whose generation is watched.
+	GCS string `json:"gcs,omitempty"`
+	// Git is the branch of a repo whose head commit is watched.
+	Git *GitWatch `json:"git,omitempty"`
+	// PollInterval is how often the input is checked for changes.
+	// Defaults to 5m.
+	PollInterval string `json:"poll_interval,omitempty"`
+
+	pollInterval time.Duration
+	gcsBucket    string
+	gcsObject    string
+}
+
+// GitWatch identifies the branch of a repo that a periodic watches.
+type GitWatch struct {
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+}
+
+// GetPollInterval returns how often the watched input is checked for changes.
+func (w *PeriodicWatch) GetPollInterval() time.Duration {
+	return w.pollInterval
+}
+
+// GCSObject returns the bucket and name of the watched GCS object.
+func (w *PeriodicWatch) GCSObject() (string, string) {
+	return w.gcsBucket, w.gcsObject
+}
+
+// Input returns a description of the watched input.
+func (w *PeriodicWatch) Input() string {
+	if w.Git != nil {
+		return fmt.Sprintf("%s/%s@%s", w.Git.Org, w.Git.Repo, w.Git.Branch)
+	}
+	return w.GCS
 }
 
 // SetInterval updates interval, the frequency duration it runs.
@@ -175,6 +258,18 @@ func (p *Periodic) GetInterval() time.Duration {
 	return p.interval
 }
 
+// RunAfterSuccessJobs returns the jobs that are triggered once this job
+// has completed successfully.
+func (p *Periodic) RunAfterSuccessJobs() []Periodic {
+	return p.runAfterSuccess
+}
+
+// RunsAfterParent returns true if the job is listed in the run_after_success
+// of another job, in which case it only runs once that job succeeds.
+func (p *Periodic) RunsAfterParent() bool {
+	return p.runsAfterParent
+}
+
 // Brancher is for shared code between jobs that only run against certain
 // branches. An empty brancher runs against all branches.
 type Brancher struct {
@@ -188,12 +283,39 @@ type Brancher struct {
 	reSkip *regexp.Regexp
 }
 
+// Tagger is for postsubmits that run against tags. An empty tagger does
+// not distinguish tags from branches.
+type Tagger struct {
+	// Only run when tags matching these regexps are pushed.
+	Tags []string `json:"tags,omitempty"`
+	// Only run when a GitHub release is published for tags matching these regexps.
+	Releases []string `json:"releases,omitempty"`
+
+	// We'll set these when we load it.
+	reTags     *regexp.Regexp
+	reReleases *regexp.Regexp
+}
+
 // RegexpChangeMatcher is for code shared between jobs that run only when certain files are changed.
 type RegexpChangeMatcher struct {
 	// RunIfChanged defines a regex used to select which subset of file changes should trigger this job.
 	// If any file in the changeset matches this regex, the job will be triggered
-	RunIfChanged string         `json:"run_if_changed,omitempty"`
-	reChanges    *regexp.Regexp // from RunIfChanged
+	RunIfChanged string `json:"run_if_changed,omitempty"`
+	// SkipIfOnlyChanged defines a regex used to select which subset of file changes should not trigger
+	// this job. If all files in the changeset match this regex, the job will be skipped.
+	SkipIfOnlyChanged string `json:"skip_if_only_changed,omitempty"`
+	// IncludeChanges defines globs, with the same syntax as .gitattributes patterns, used to select
+	// which subset of file changes should trigger this job.
+	IncludeChanges []string `json:"include_changes,omitempty"`
+	// ExcludeChanges defines globs, with the same syntax as .gitattributes patterns, of file changes
+	// that are ignored when determining whether to trigger this job. If no other filter is set, any
+	// change that is not excluded will trigger the job.
+	ExcludeChanges []string `json:"exclude_changes,omitempty"`
+
+	reChanges      *regexp.Regexp          // from RunIfChanged
+	reSkipChanges  *regexp.Regexp          // from SkipIfOnlyChanged
+	includeChanges []gitattributes.Pattern // from IncludeChanges
+	excludeChanges []gitattributes.Pattern // from ExcludeChanges
 }
 
 type Reporter struct {
@@ -250,9 +372,25 @@ func (br Brancher) Intersects(other Brancher) bool {
 	return other.Intersects(br)
 }
 
+// RunsAgainstTags returns true if either tags or releases are set.
+func (t Tagger) RunsAgainstTags() bool {
+	return len(t.Tags) != 0 || len(t.Releases) != 0
+}
+
+// ShouldRunForTag returns true if the pushed tag matches the tags.
+func (t Tagger) ShouldRunForTag(tag string) bool {
+	return len(t.Tags) != 0 && t.reTags.MatchString(tag)
+}
+
+// ShouldRunForRelease returns true if the tag of a published release
+// matches the releases.
+func (t Tagger) ShouldRunForRelease(tag string) bool {
+	return len(t.Releases) != 0 && t.reReleases.MatchString(tag)
+}
+
 // CouldRun determines if its possible for a set of changes to trigger this condition
 func (cm RegexpChangeMatcher) CouldRun() bool {
-	return cm.RunIfChanged != ""
+	return cm.RunIfChanged != "" || cm.SkipIfOnlyChanged != "" || len(cm.IncludeChanges) != 0 || len(cm.ExcludeChanges) != 0
 }
 
 // ShouldRun determines if we can know for certain that the job should run. We can either
@@ -269,10 +407,34 @@ func (cm RegexpChangeMatcher) ShouldRun(changes ChangedFilesProvider) (determine
 	return false, false, nil
 }
 
-// RunsAgainstChanges returns true if any of the changed input paths match the run_if_changed regex.
+// RunsAgainstChanges returns true if any of the changed input paths that are not excluded
+// match the run_if_changed regex or the included globs, or do not match the
+// skip_if_only_changed regex.
 func (cm RegexpChangeMatcher) RunsAgainstChanges(changes []string) bool {
+	onlyExcludes := cm.RunIfChanged == "" && cm.SkipIfOnlyChanged == "" && len(cm.IncludeChanges) == 0
 	for _, change := range changes {
-		if cm.reChanges.MatchString(change) {
+		if matchesAnyPattern(cm.excludeChanges, change) {
+			continue
+		}
+		if onlyExcludes {
+			return true
+		}
+		if cm.RunIfChanged != "" && cm.reChanges.MatchString(change) {
+			return true
+		}
+		if cm.SkipIfOnlyChanged != "" && !cm.reSkipChanges.MatchString(change) {
+			return true
+		}
+		if matchesAnyPattern(cm.includeChanges, change) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyPattern(patterns []gitattributes.Pattern, path string) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(path) {
 			return true
 		}
 	}
@@ -280,11 +442,41 @@ func (cm RegexpChangeMatcher) RunsAgainstChanges(changes []string) bool {
 }
 
 // CouldRun determines if the postsubmit could run against a specific
-// base ref
+// base ref. Postsubmits that run against tags only run against branches
+// if they explicitly list them.
 func (ps Postsubmit) CouldRun(baseRef string) bool {
+	if ps.Tagger.RunsAgainstTags() && ps.Brancher.RunsAgainstAllBranch() {
+		return false
+	}
 	return ps.Brancher.ShouldRun(baseRef)
 }
 
+// CouldRunForTag determines if the postsubmit could run against a specific
+// tag, either because it was pushed or because a release was published for it.
+func (ps Postsubmit) CouldRunForTag(tag string) bool {
+	if !ps.Tagger.RunsAgainstTags() {
+		// Postsubmits without tag rules treat tags like branches.
+		return ps.Brancher.ShouldRun(tag)
+	}
+	return ps.Tagger.ShouldRunForTag(tag) || ps.Tagger.ShouldRunForRelease(tag)
+}
+
+// ShouldRunForTag determines if the postsubmit should run in response to
+// a tag being pushed. Postsubmits without tag rules treat the tag like a
+// branch for backwards compatibility.
+func (ps Postsubmit) ShouldRunForTag(tag string, changes ChangedFilesProvider) (bool, error) {
+	if !ps.Tagger.RunsAgainstTags() {
+		return ps.ShouldRun(tag, changes)
+	}
+	return ps.Tagger.ShouldRunForTag(tag), nil
+}
+
+// ShouldRunForRelease determines if the postsubmit should run in response
+// to a GitHub release being published for a tag.
+func (ps Postsubmit) ShouldRunForRelease(tag string) bool {
+	return ps.Tagger.ShouldRunForRelease(tag)
+}
+
 // ShouldRun determines if the postsubmit should run in response to a
 // set of changes. This is evaluated lazily, if necessary.
 func (ps Postsubmit) ShouldRun(baseRef string, changes ChangedFilesProvider) (bool, error) {
@@ -300,6 +492,18 @@ func (ps Postsubmit) ShouldRun(baseRef string, changes ChangedFilesProvider) (bo
 	return true, nil
 }
 
+// RunAfterSuccessJobs returns the jobs that are triggered once this
+// postsubmit has completed successfully.
+func (ps Postsubmit) RunAfterSuccessJobs() []Postsubmit {
+	return ps.runAfterSuccess
+}
+
+// RunsAfterParent returns true if the job is listed in the run_after_success
+// of another job, in which case it only runs once that job succeeds.
+func (ps Postsubmit) RunsAfterParent() bool {
+	return ps.runsAfterParent
+}
+
 // CouldRun determines if the presubmit could run against a specific
 // base ref
 func (ps Presubmit) CouldRun(baseRef string) bool {
@@ -327,6 +531,12 @@ func (ps Presubmit) ShouldRun(baseRef string, changes ChangedFilesProvider, forc
 	return defaults, nil
 }
 
+// RunAfterSuccessJobs returns the jobs that are triggered once this
+// presubmit has completed successfully.
+func (ps Presubmit) RunAfterSuccessJobs() []Presubmit {
+	return ps.runAfterSuccess
+}
+
 // TriggersConditionally determines if the presubmit triggers conditionally (if it may or may not trigger).
 func (ps Presubmit) TriggersConditionally() bool {
 	return ps.NeedsExplicitTrigger() || ps.RegexpChangeMatcher.CouldRun()
@@ -378,8 +588,9 @@ func NewGitHubDeferredChangedFilesProvider(client githubClient, org, repo string
 
 // UtilityConfig holds decoration metadata, such as how to clone and additional containers/etc
 type UtilityConfig struct {
-	// Decorate determines if we decorate the PodSpec or not
-	Decorate bool `json:"decorate,omitempty"`
+	// Decorate determines if we decorate the PodSpec or not. It is unset
+	// unless the job or its template sets it.
+	Decorate *bool `json:"decorate,omitempty"`
 
 	// PathAlias is the location under <root-dir>/src
 	// where the repository under test is cloned. If this
@@ -403,6 +614,11 @@ type UtilityConfig struct {
 	DecorationConfig *prowapi.DecorationConfig `json:"decoration_config,omitempty"`
 }
 
+// ShouldDecorate returns true if the PodSpec is decorated.
+func (u UtilityConfig) ShouldDecorate() bool {
+	return u.Decorate != nil && *u.Decorate
+}
+
 // RetestPresubmits returns all presubmits that should be run given a /retest command.
 // This is the set of all presubmits intersected with ((alwaysRun + runContexts) - skipContexts)
 func (c *JobConfig) RetestPresubmits(fullRepoName string, skipContexts, runContexts sets.String) []Presubmit {
@@ -412,7 +628,7 @@ func (c *JobConfig) RetestPresubmits(fullRepoName string, skipContexts, runConte
 			if skipContexts.Has(job.Context) {
 				continue
 			}
-			if job.AlwaysRun || job.RunIfChanged != "" || runContexts.Has(job.Context) {
+			if job.AlwaysRun || job.RegexpChangeMatcher.CouldRun() || runContexts.Has(job.Context) {
 				result = append(result, job)
 			}
 		}
@@ -446,7 +662,8 @@ func (c *JobConfig) SetPresubmits(jobs map[string][]Presubmit) error {
 	return nil
 }
 
-// SetPostsubmits updates c.Postsubmits to jobs, after compiling and validating their regexes.
+// SetPostsubmits updates c.Postsubmits to jobs, after compiling and validating their regexes
+// and resolving the jobs they run after success.
 func (c *JobConfig) SetPostsubmits(jobs map[string][]Postsubmit) error {
 	nj := map[string][]Postsubmit{}
 	for k, v := range jobs {
@@ -455,11 +672,25 @@ func (c *JobConfig) SetPostsubmits(jobs map[string][]Postsubmit) error {
 		if err := SetPostsubmitRegexes(nj[k]); err != nil {
 			return err
 		}
+		if err := resolvePostsubmitRunAfterSuccess(nj[k]); err != nil {
+			return err
+		}
 	}
 	c.Postsubmits = nj
 	return nil
 }
 
+// SetPeriodics updates c.Periodics to jobs, after resolving the jobs they run after success.
+func (c *JobConfig) SetPeriodics(jobs []Periodic) error {
+	nj := make([]Periodic, len(jobs))
+	copy(nj, jobs)
+	if err := resolvePeriodicRunAfterSuccess(nj); err != nil {
+		return err
+	}
+	c.Periodics = nj
+	return nil
+}
+
 // AllPresubmits returns all prow presubmit jobs in repos.
 // if repos is empty, return all presubmits.
 func (c *JobConfig) AllPresubmits(repos []string) []Presubmit {
@@ -524,5 +755,8 @@ func ClearCompiledRegexes(presubmits []Presubmit) {
 		presubmits[i].Brancher.re = nil
 		presubmits[i].Brancher.reSkip = nil
 		presubmits[i].RegexpChangeMatcher.reChanges = nil
+		presubmits[i].RegexpChangeMatcher.reSkipChanges = nil
+		presubmits[i].RegexpChangeMatcher.includeChanges = nil
+		presubmits[i].RegexpChangeMatcher.excludeChanges = nil
 	}
 }
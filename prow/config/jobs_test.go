@@ -833,6 +833,84 @@ func TestPresubmitShouldRun(t *testing.T) {
 			fileChanges: []string{"file"},
 			expectedRun: true,
 		},
+		{
+			name: "job with skip_if_only_changed matching all changes should not run",
+			job: Presubmit{
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					SkipIfOnlyChanged: `\.md$`,
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"README.md", "docs/guide.md"},
+			expectedRun: false,
+		},
+		{
+			name: "job with skip_if_only_changed not matching some change should run",
+			job: Presubmit{
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					SkipIfOnlyChanged: `\.md$`,
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"README.md", "main.go"},
+			expectedRun: true,
+		},
+		{
+			name: "job with include_changes matching a change should run",
+			job: Presubmit{
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					IncludeChanges: []string{"prow/**", "*.bzl"},
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"README.md", "prow/cmd/hook/main.go"},
+			expectedRun: true,
+		},
+		{
+			name: "job with include_changes not matching any change should not run",
+			job: Presubmit{
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					IncludeChanges: []string{"prow/**", "*.bzl"},
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"README.md", "config/jobs.yaml"},
+			expectedRun: false,
+		},
+		{
+			name: "job with only exclude_changes matching all changes should not run",
+			job: Presubmit{
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					ExcludeChanges: []string{"docs/**", "*.md"},
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"README.md", "docs/images/logo.png"},
+			expectedRun: false,
+		},
+		{
+			name: "job with only exclude_changes and another change should run",
+			job: Presubmit{
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					ExcludeChanges: []string{"docs/**", "*.md"},
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"README.md", "main.go"},
+			expectedRun: true,
+		},
+		{
+			name: "job with run_if_changed only matching excluded changes should not run",
+			job: Presubmit{
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					RunIfChanged:   "^prow/",
+					ExcludeChanges: []string{"*.md"},
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"prow/README.md"},
+			expectedRun: false,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -947,6 +1025,29 @@ func TestPostsubmitShouldRun(t *testing.T) {
 			fileChanges: []string{"file"},
 			expectedRun: true,
 		},
+		{
+			name: "job running only on tags won't run on branches",
+			job: Postsubmit{
+				Tagger: Tagger{
+					Tags: []string{"^v.*"},
+				},
+			},
+			ref:         "master",
+			expectedRun: false,
+		},
+		{
+			name: "job running on tags and branches will run on its branches",
+			job: Postsubmit{
+				Brancher: Brancher{
+					Branches: []string{"master"},
+				},
+				Tagger: Tagger{
+					Releases: []string{"^v.*"},
+				},
+			},
+			ref:         "master",
+			expectedRun: true,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -970,3 +1071,79 @@ func TestPostsubmitShouldRun(t *testing.T) {
 		})
 	}
 }
+
+func TestPostsubmitShouldRunForTag(t *testing.T) {
+	var testCases = []struct {
+		name               string
+		job                Postsubmit
+		tag                string
+		expectedTagRun     bool
+		expectedReleaseRun bool
+	}{
+		{
+			name:           "job without tag rules treats tags as branches",
+			job:            Postsubmit{},
+			tag:            "v1.0.0",
+			expectedTagRun: true,
+		},
+		{
+			name: "job without tag rules skipping the tag won't run",
+			job: Postsubmit{
+				Brancher: Brancher{
+					SkipBranches: []string{"^v.*"},
+				},
+			},
+			tag:            "v1.0.0",
+			expectedTagRun: false,
+		},
+		{
+			name: "job with matching tags runs for pushed tags",
+			job: Postsubmit{
+				Tagger: Tagger{
+					Tags: []string{"^v.*"},
+				},
+			},
+			tag:            "v1.0.0",
+			expectedTagRun: true,
+		},
+		{
+			name: "job with other tags won't run",
+			job: Postsubmit{
+				Tagger: Tagger{
+					Tags:     []string{"^v.*"},
+					Releases: []string{"^v.*"},
+				},
+			},
+			tag: "nightly",
+		},
+		{
+			name: "job with matching releases runs only for releases",
+			job: Postsubmit{
+				Tagger: Tagger{
+					Releases: []string{"^v.*"},
+				},
+			},
+			tag:                "v1.0.0",
+			expectedReleaseRun: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			jobs := []Postsubmit{testCase.job}
+			if err := SetPostsubmitRegexes(jobs); err != nil {
+				t.Fatalf("failed to set postsubmit regexes: %v", err)
+			}
+			tagRun, err := jobs[0].ShouldRunForTag(testCase.tag, func() ([]string, error) { return nil, nil })
+			if err != nil {
+				t.Fatalf("expected no error but got one: %v", err)
+			}
+			if tagRun != testCase.expectedTagRun {
+				t.Errorf("expected job to run for pushed tag: %v, got %v", testCase.expectedTagRun, tagRun)
+			}
+			if releaseRun := jobs[0].ShouldRunForRelease(testCase.tag); releaseRun != testCase.expectedReleaseRun {
+				t.Errorf("expected job to run for release: %v, got %v", testCase.expectedReleaseRun, releaseRun)
+			}
+		})
+	}
+}
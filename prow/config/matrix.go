@@ -0,0 +1,177 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+var matrixKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// matrixCombination is one entry of a matrix, with the values ordered by
+// the sorted matrix keys.
+type matrixCombination struct {
+	keys, values []string
+}
+
+// suffix returns the suffix of the names and contexts of the job expanded
+// for the combination.
+func (mc matrixCombination) suffix() string {
+	return strings.Join(mc.values, "-")
+}
+
+// matrixCombinations returns every combination of the values of a matrix in
+// a stable order.
+func matrixCombinations(matrix map[string][]string) ([]matrixCombination, error) {
+	var keys []string
+	for key, values := range matrix {
+		if !matrixKeyRegex.MatchString(key) {
+			return nil, fmt.Errorf("matrix key %q must match regex %q", key, matrixKeyRegex.String())
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("matrix key %q has no values", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	combinations := []matrixCombination{{}}
+	for _, key := range keys {
+		var next []matrixCombination
+		for _, combination := range combinations {
+			for _, value := range matrix[key] {
+				next = append(next, matrixCombination{
+					keys:   append(append([]string{}, combination.keys...), key),
+					values: append(append([]string{}, combination.values...), value),
+				})
+			}
+		}
+		combinations = next
+	}
+	return combinations, nil
+}
+
+// expandJobBase returns the job base of the job expanded for a combination.
+// The pod spec is copied so that the expanded jobs can be mutated separately.
+// Only kubernetes jobs can be expanded, as the values are passed as env vars
+// of the containers of their pod spec. The agent is not defaulted yet, so an
+// empty agent means kubernetes.
+func expandJobBase(base JobBase, mc matrixCombination) (JobBase, error) {
+	if (base.Agent != "" && base.Agent != string(prowapi.KubernetesAgent)) || base.Spec == nil {
+		return base, fmt.Errorf("matrix requires the %s agent and a pod spec", prowapi.KubernetesAgent)
+	}
+	base.Name = fmt.Sprintf("%s-%s", base.Name, mc.suffix())
+	base.Matrix = nil
+	base.Spec = base.Spec.DeepCopy()
+	for i := range base.Spec.Containers {
+		container := &base.Spec.Containers[i]
+		for j, key := range mc.keys {
+			for _, env := range container.Env {
+				if env.Name == key {
+					return base, fmt.Errorf("matrix key %s duplicates an env var in the pod spec", key)
+				}
+			}
+			container.Env = append(container.Env, v1.EnvVar{Name: key, Value: mc.values[j]})
+		}
+	}
+	return base, nil
+}
+
+// expandPresubmitMatrices replaces every presubmit with a matrix by the
+// presubmits it expands into.
+func expandPresubmitMatrices(js []Presubmit) ([]Presubmit, error) {
+	var expanded []Presubmit
+	for _, j := range js {
+		if len(j.Matrix) == 0 {
+			expanded = append(expanded, j)
+			continue
+		}
+		combinations, err := matrixCombinations(j.Matrix)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %v", j.Name, err)
+		}
+		for _, mc := range combinations {
+			job := j
+			if job.JobBase, err = expandJobBase(j.JobBase, mc); err != nil {
+				return nil, fmt.Errorf("job %s: %v", j.Name, err)
+			}
+			if job.Context != "" {
+				job.Context = fmt.Sprintf("%s-%s", job.Context, mc.suffix())
+			}
+			expanded = append(expanded, job)
+		}
+	}
+	return expanded, nil
+}
+
+// expandPostsubmitMatrices replaces every postsubmit with a matrix by the
+// postsubmits it expands into.
+func expandPostsubmitMatrices(js []Postsubmit) ([]Postsubmit, error) {
+	var expanded []Postsubmit
+	for _, j := range js {
+		if len(j.Matrix) == 0 {
+			expanded = append(expanded, j)
+			continue
+		}
+		combinations, err := matrixCombinations(j.Matrix)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %v", j.Name, err)
+		}
+		for _, mc := range combinations {
+			job := j
+			if job.JobBase, err = expandJobBase(j.JobBase, mc); err != nil {
+				return nil, fmt.Errorf("job %s: %v", j.Name, err)
+			}
+			if job.Context != "" {
+				job.Context = fmt.Sprintf("%s-%s", job.Context, mc.suffix())
+			}
+			expanded = append(expanded, job)
+		}
+	}
+	return expanded, nil
+}
+
+// expandPeriodicMatrices replaces every periodic with a matrix by the
+// periodics it expands into.
+func expandPeriodicMatrices(js []Periodic) ([]Periodic, error) {
+	var expanded []Periodic
+	for _, j := range js {
+		if len(j.Matrix) == 0 {
+			expanded = append(expanded, j)
+			continue
+		}
+		combinations, err := matrixCombinations(j.Matrix)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %v", j.Name, err)
+		}
+		for _, mc := range combinations {
+			job := j
+			if job.JobBase, err = expandJobBase(j.JobBase, mc); err != nil {
+				return nil, fmt.Errorf("job %s: %v", j.Name, err)
+			}
+			expanded = append(expanded, job)
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+func TestExpandPresubmitMatrices(t *testing.T) {
+	testCases := []struct {
+		name      string
+		jobs      []Presubmit
+		expectErr bool
+		// expected maps the expanded job names to their contexts and env
+		expected map[string]expandedJob
+	}{
+		{
+			name: "jobs without a matrix are kept",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit"}, Reporter: Reporter{Context: "unit"}},
+			},
+			expected: map[string]expandedJob{
+				"unit": {context: "unit"},
+			},
+		},
+		{
+			name: "every combination is expanded",
+			jobs: []Presubmit{
+				{
+					JobBase: JobBase{
+						Name: "e2e",
+						Matrix: map[string][]string{
+							"PROVIDER":           {"gce", "aws"},
+							"KUBERNETES_VERSION": {"1.13", "1.14"},
+						},
+						Spec: &v1.PodSpec{Containers: []v1.Container{{Image: "e2e"}}},
+					},
+					Reporter: Reporter{Context: "ci/e2e"},
+				},
+			},
+			expected: map[string]expandedJob{
+				"e2e-1.13-gce": {context: "ci/e2e-1.13-gce", env: map[string]string{"KUBERNETES_VERSION": "1.13", "PROVIDER": "gce"}},
+				"e2e-1.13-aws": {context: "ci/e2e-1.13-aws", env: map[string]string{"KUBERNETES_VERSION": "1.13", "PROVIDER": "aws"}},
+				"e2e-1.14-gce": {context: "ci/e2e-1.14-gce", env: map[string]string{"KUBERNETES_VERSION": "1.14", "PROVIDER": "gce"}},
+				"e2e-1.14-aws": {context: "ci/e2e-1.14-aws", env: map[string]string{"KUBERNETES_VERSION": "1.14", "PROVIDER": "aws"}},
+			},
+		},
+		{
+			name: "empty context is left for defaulting",
+			jobs: []Presubmit{
+				{JobBase: JobBase{
+					Name:   "unit",
+					Matrix: map[string][]string{"GO_VERSION": {"1.12"}},
+					Spec:   &v1.PodSpec{Containers: []v1.Container{{Image: "unit"}}},
+				}},
+			},
+			expected: map[string]expandedJob{
+				"unit-1.12": {env: map[string]string{"GO_VERSION": "1.12"}},
+			},
+		},
+		{
+			name: "invalid key is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit", Matrix: map[string][]string{"GO-VERSION": {"1.12"}}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "key without values is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit", Matrix: map[string][]string{"GO_VERSION": {}}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "job without a pod spec is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit", Matrix: map[string][]string{"GO_VERSION": {"1.12"}}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "jenkins job is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{
+					Name:   "unit",
+					Agent:  string(prowapi.JenkinsAgent),
+					Matrix: map[string][]string{"GO_VERSION": {"1.12"}},
+					Spec:   &v1.PodSpec{Containers: []v1.Container{{Image: "unit"}}},
+				}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "knative-build job is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{
+					Name:   "unit",
+					Agent:  string(prowapi.KnativeBuildAgent),
+					Matrix: map[string][]string{"GO_VERSION": {"1.12"}},
+				}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "key duplicating an env var is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{
+					Name:   "unit",
+					Matrix: map[string][]string{"GO_VERSION": {"1.12"}},
+					Spec:   &v1.PodSpec{Containers: []v1.Container{{Env: []v1.EnvVar{{Name: "GO_VERSION", Value: "1.11"}}}}},
+				}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expanded, err := expandPresubmitMatrices(tc.jobs)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got one: %v", err)
+			}
+			actual := map[string]expandedJob{}
+			for _, job := range expanded {
+				if job.Matrix != nil {
+					t.Errorf("job %s: expected the matrix to be cleared", job.Name)
+				}
+				actual[job.Name] = expandedJobFor(job.JobBase, job.Context)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected expanded jobs %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+type expandedJob struct {
+	context string
+	env     map[string]string
+}
+
+func expandedJobFor(base JobBase, context string) expandedJob {
+	job := expandedJob{context: context}
+	if base.Spec == nil {
+		return job
+	}
+	for _, container := range base.Spec.Containers {
+		for _, env := range container.Env {
+			if job.env == nil {
+				job.env = map[string]string{}
+			}
+			job.env[env.Name] = env.Value
+		}
+	}
+	return job
+}
+
+func TestFinalizeJobConfigExpandsMatrices(t *testing.T) {
+	c := &Config{
+		JobConfig: JobConfig{
+			Presubmits: map[string][]Presubmit{
+				"org/repo": {{JobBase: JobBase{
+					Name:   "e2e",
+					Matrix: map[string][]string{"PROVIDER": {"gce", "aws"}},
+					Spec:   &v1.PodSpec{Containers: []v1.Container{{Image: "e2e"}}},
+				}}},
+			},
+			Periodics: []Periodic{
+				{JobBase: JobBase{
+					Name:   "ci-e2e",
+					Matrix: map[string][]string{"PROVIDER": {"gce"}},
+					Spec:   &v1.PodSpec{Containers: []v1.Container{{Image: "e2e"}}},
+				}},
+			},
+		},
+	}
+	if err := c.finalizeJobConfig(); err != nil {
+		t.Fatalf("expected no error but got one: %v", err)
+	}
+	var presubmits []string
+	for _, job := range c.Presubmits["org/repo"] {
+		presubmits = append(presubmits, job.Name)
+		if job.Context != job.Name {
+			t.Errorf("job %s: expected the context to default to the expanded name, got %s", job.Name, job.Context)
+		}
+		if job.RerunCommand != DefaultRerunCommandFor(job.Name) {
+			t.Errorf("job %s: expected the rerun command to default to the expanded name, got %s", job.Name, job.RerunCommand)
+		}
+	}
+	if expected := []string{"e2e-gce", "e2e-aws"}; !reflect.DeepEqual(presubmits, expected) {
+		t.Errorf("expected presubmits %v, got %v", expected, presubmits)
+	}
+	if len(c.Periodics) != 1 || c.Periodics[0].Name != "ci-e2e-gce" {
+		t.Errorf("expected the periodic to be expanded, got %v", c.Periodics)
+	}
+}
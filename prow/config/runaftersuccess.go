@@ -0,0 +1,164 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateRunAfterSuccess ensures that every job referenced in a
+// run_after_success list exists and that the references do not form
+// a cycle. The graph maps job names to the names of their children.
+func validateRunAfterSuccess(graph map[string][]string) error {
+	for parent, children := range graph {
+		for _, child := range children {
+			if _, exists := graph[child]; !exists {
+				return fmt.Errorf("job %s: run_after_success references unknown job %s", parent, child)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("run_after_success forms a cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, child := range graph[name] {
+			if err := visit(child, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for name := range graph {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveRunAfterSuccess validates the run_after_success references between
+// jobs of the same type and repo and calls setChildren with the indices of
+// the jobs that are triggered once the job at index i succeeds. Children are
+// resolved before their parents, so that the copy of a child that a parent
+// holds carries the child's own children.
+func resolveRunAfterSuccess(bases []JobBase, setChildren func(i int, children []int)) error {
+	graph := map[string][]string{}
+	indices := map[string][]int{}
+	for i, j := range bases {
+		graph[j.Name] = append(graph[j.Name], j.RunAfterSuccess...)
+		indices[j.Name] = append(indices[j.Name], i)
+	}
+	if err := validateRunAfterSuccess(graph); err != nil {
+		return err
+	}
+
+	resolved := make([]bool, len(bases))
+	var resolve func(i int)
+	resolve = func(i int) {
+		if resolved[i] {
+			return
+		}
+		var children []int
+		for _, child := range bases[i].RunAfterSuccess {
+			for _, c := range indices[child] {
+				resolve(c)
+				children = append(children, c)
+			}
+		}
+		setChildren(i, children)
+		resolved[i] = true
+	}
+	for i := range bases {
+		resolve(i)
+	}
+	return nil
+}
+
+// resolvePresubmitRunAfterSuccess resolves the run_after_success references
+// between the presubmits of a single repo. Presubmits that are triggered
+// after another one succeeds may not run on their own.
+func resolvePresubmitRunAfterSuccess(js []Presubmit) error {
+	bases := make([]JobBase, len(js))
+	for i := range js {
+		bases[i] = js[i].JobBase
+	}
+	err := resolveRunAfterSuccess(bases, func(i int, children []int) {
+		js[i].runAfterSuccess = nil
+		for _, c := range children {
+			js[i].runAfterSuccess = append(js[i].runAfterSuccess, js[c])
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, j := range js {
+		for _, child := range j.runAfterSuccess {
+			if !child.NeedsExplicitTrigger() {
+				return fmt.Errorf("job %s: run_after_success job %s may not set always_run or run_if_changed", j.Name, child.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// resolvePostsubmitRunAfterSuccess resolves the run_after_success references
+// between the postsubmits of a single repo. Postsubmits that are triggered
+// after another one succeeds are marked so that pushes do not trigger them.
+func resolvePostsubmitRunAfterSuccess(js []Postsubmit) error {
+	bases := make([]JobBase, len(js))
+	for i := range js {
+		bases[i] = js[i].JobBase
+	}
+	return resolveRunAfterSuccess(bases, func(i int, children []int) {
+		js[i].runAfterSuccess = nil
+		for _, c := range children {
+			js[c].runsAfterParent = true
+			js[i].runAfterSuccess = append(js[i].runAfterSuccess, js[c])
+		}
+	})
+}
+
+// resolvePeriodicRunAfterSuccess resolves the run_after_success references
+// between periodics. Periodics that are triggered after another one succeeds
+// are marked so that they are not scheduled on their own.
+func resolvePeriodicRunAfterSuccess(js []Periodic) error {
+	bases := make([]JobBase, len(js))
+	for i := range js {
+		bases[i] = js[i].JobBase
+	}
+	return resolveRunAfterSuccess(bases, func(i int, children []int) {
+		js[i].runAfterSuccess = nil
+		for _, c := range children {
+			js[c].runsAfterParent = true
+			js[i].runAfterSuccess = append(js[i].runAfterSuccess, js[c])
+		}
+	})
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+func TestResolvePresubmitRunAfterSuccess(t *testing.T) {
+	testCases := []struct {
+		name      string
+		jobs      []Presubmit
+		expectErr bool
+		// expected maps a job name to the names of the jobs it triggers
+		expected map[string][]string
+	}{
+		{
+			name: "no dependencies",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit"}, AlwaysRun: true},
+				{JobBase: JobBase{Name: "e2e"}, AlwaysRun: true},
+			},
+			expected: map[string][]string{},
+		},
+		{
+			name: "chain is resolved",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit", RunAfterSuccess: []string{"integration"}}, AlwaysRun: true},
+				{JobBase: JobBase{Name: "integration", RunAfterSuccess: []string{"e2e"}}},
+				{JobBase: JobBase{Name: "e2e"}},
+			},
+			expected: map[string][]string{
+				"unit":        {"integration"},
+				"integration": {"e2e"},
+			},
+		},
+		{
+			name: "unknown job is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit", RunAfterSuccess: []string{"missing"}}, AlwaysRun: true},
+			},
+			expectErr: true,
+		},
+		{
+			name: "self reference is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit", RunAfterSuccess: []string{"unit"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "cycle is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "a", RunAfterSuccess: []string{"b"}}},
+				{JobBase: JobBase{Name: "b", RunAfterSuccess: []string{"c"}}},
+				{JobBase: JobBase{Name: "c", RunAfterSuccess: []string{"a"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "always_run child is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit", RunAfterSuccess: []string{"e2e"}}, AlwaysRun: true},
+				{JobBase: JobBase{Name: "e2e"}, AlwaysRun: true},
+			},
+			expectErr: true,
+		},
+		{
+			name: "run_if_changed child is rejected",
+			jobs: []Presubmit{
+				{JobBase: JobBase{Name: "unit", RunAfterSuccess: []string{"e2e"}}, AlwaysRun: true},
+				{JobBase: JobBase{Name: "e2e"}, RegexpChangeMatcher: RegexpChangeMatcher{RunIfChanged: "foo"}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := resolvePresubmitRunAfterSuccess(tc.jobs)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got one: %v", err)
+			}
+			for _, job := range tc.jobs {
+				var actual []string
+				for _, child := range job.RunAfterSuccessJobs() {
+					actual = append(actual, child.Name)
+				}
+				expected := tc.expected[job.Name]
+				if len(actual) != len(expected) {
+					t.Errorf("job %s: expected next jobs %v, got %v", job.Name, expected, actual)
+					continue
+				}
+				for i := range expected {
+					if actual[i] != expected[i] {
+						t.Errorf("job %s: expected next jobs %v, got %v", job.Name, expected, actual)
+						break
+					}
+				}
+			}
+			// Grandchildren must be resolved on the copies held by parents.
+			for _, job := range tc.jobs {
+				for _, child := range job.RunAfterSuccessJobs() {
+					if len(child.RunAfterSuccessJobs()) != len(tc.expected[child.Name]) {
+						t.Errorf("job %s: child %s was not resolved", job.Name, child.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidateJobBaseRunAfterSuccess(t *testing.T) {
+	base := JobBase{
+		Name:            "jenkins-job",
+		Agent:           "jenkins",
+		RunAfterSuccess: []string{"other"},
+	}
+	if err := validateJobBase(base, prowapi.PresubmitJob, "default"); err == nil {
+		t.Error("expected run_after_success on a jenkins job to be rejected")
+	}
+}
+
+func TestRunsAfterParent(t *testing.T) {
+	postsubmits := []Postsubmit{
+		{JobBase: JobBase{Name: "unit", RunAfterSuccess: []string{"integration"}}},
+		{JobBase: JobBase{Name: "integration", RunAfterSuccess: []string{"e2e"}}},
+		{JobBase: JobBase{Name: "e2e"}},
+		{JobBase: JobBase{Name: "lint"}},
+	}
+	if err := resolvePostsubmitRunAfterSuccess(postsubmits); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]bool{"unit": false, "integration": true, "e2e": true, "lint": false}
+	for _, j := range postsubmits {
+		if actual := j.RunsAfterParent(); actual != expected[j.Name] {
+			t.Errorf("expected postsubmit %s to run after its parent: %t, got %t", j.Name, expected[j.Name], actual)
+		}
+	}
+	if children := postsubmits[0].RunAfterSuccessJobs(); len(children) != 1 || !children[0].RunsAfterParent() {
+		t.Errorf("expected the child of unit to run after its parent, got %+v", children)
+	}
+
+	periodics := []Periodic{
+		{JobBase: JobBase{Name: "unit", RunAfterSuccess: []string{"e2e"}}},
+		{JobBase: JobBase{Name: "e2e"}},
+	}
+	if err := resolvePeriodicRunAfterSuccess(periodics); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if periodics[0].RunsAfterParent() || !periodics[1].RunsAfterParent() {
+		t.Errorf("expected only periodic e2e to run after its parent, got unit: %t, e2e: %t", periodics[0].RunsAfterParent(), periodics[1].RunsAfterParent())
+	}
+}
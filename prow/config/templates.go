@@ -0,0 +1,284 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// JobTemplate holds the parts of a job that are shared between the jobs
+// that extend it. Fields set on a job take precedence over the ones of its
+// template, and pod specs and decoration configs are merged field by field.
+type JobTemplate struct {
+	// Extends is the name of the template this template builds upon.
+	Extends string `json:"extends,omitempty"`
+	// Labels are added to the labels of the jobs.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Spec is merged into the Kubernetes pod spec of the jobs.
+	Spec *v1.PodSpec `json:"spec,omitempty"`
+
+	UtilityConfig
+}
+
+// resolveTemplates merges every template with the templates it extends, so
+// that each template holds all the fields that it passes on to jobs.
+func resolveTemplates(templates map[string]JobTemplate) (map[string]JobTemplate, error) {
+	resolved := map[string]JobTemplate{}
+	resolving := map[string]bool{}
+	var resolve func(name string, path []string) (JobTemplate, error)
+	resolve = func(name string, path []string) (JobTemplate, error) {
+		if template, ok := resolved[name]; ok {
+			return template, nil
+		}
+		template, ok := templates[name]
+		if !ok {
+			return JobTemplate{}, fmt.Errorf("unknown job template %s", name)
+		}
+		if resolving[name] {
+			return JobTemplate{}, fmt.Errorf("job templates extend each other in a cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+		if template.Extends != "" {
+			resolving[name] = true
+			parent, err := resolve(template.Extends, append(path, name))
+			if err != nil {
+				return JobTemplate{}, err
+			}
+			resolving[name] = false
+			template.Labels = mergeLabels(template.Labels, parent.Labels)
+			template.Spec = mergePodSpec(template.Spec, parent.Spec)
+			template.UtilityConfig = mergeUtilityConfig(template.UtilityConfig, parent.UtilityConfig)
+			template.Extends = ""
+		}
+		resolved[name] = template
+		return template, nil
+	}
+	for name := range templates {
+		if _, err := resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// applyJobTemplates merges the job templates into the jobs extending them.
+func (c *JobConfig) applyJobTemplates() error {
+	templates, err := resolveTemplates(c.JobTemplates)
+	if err != nil {
+		return err
+	}
+	for repo, js := range c.Presubmits {
+		if err := applyPresubmitTemplates(js, templates); err != nil {
+			return fmt.Errorf("invalid presubmits for %s: %v", repo, err)
+		}
+	}
+	for repo, js := range c.Postsubmits {
+		if err := applyPostsubmitTemplates(js, templates); err != nil {
+			return fmt.Errorf("invalid postsubmits for %s: %v", repo, err)
+		}
+	}
+	if err := applyPeriodicTemplates(c.Periodics, templates); err != nil {
+		return fmt.Errorf("invalid periodics: %v", err)
+	}
+	return nil
+}
+
+// applyTemplate merges the template a job extends into the job.
+func applyTemplate(base JobBase, templates map[string]JobTemplate) (JobBase, error) {
+	if base.Extends == "" {
+		return base, nil
+	}
+	template, ok := templates[base.Extends]
+	if !ok {
+		return base, fmt.Errorf("extends unknown job template %s", base.Extends)
+	}
+	base.Labels = mergeLabels(base.Labels, template.Labels)
+	base.Spec = mergePodSpec(base.Spec, template.Spec)
+	base.UtilityConfig = mergeUtilityConfig(base.UtilityConfig, template.UtilityConfig)
+	return base, nil
+}
+
+// applyPresubmitTemplates merges the templates into the presubmits extending them.
+func applyPresubmitTemplates(js []Presubmit, templates map[string]JobTemplate) error {
+	for i := range js {
+		base, err := applyTemplate(js[i].JobBase, templates)
+		if err != nil {
+			return fmt.Errorf("job %s: %v", js[i].Name, err)
+		}
+		js[i].JobBase = base
+	}
+	return nil
+}
+
+// applyPostsubmitTemplates merges the templates into the postsubmits extending them.
+func applyPostsubmitTemplates(js []Postsubmit, templates map[string]JobTemplate) error {
+	for i := range js {
+		base, err := applyTemplate(js[i].JobBase, templates)
+		if err != nil {
+			return fmt.Errorf("job %s: %v", js[i].Name, err)
+		}
+		js[i].JobBase = base
+	}
+	return nil
+}
+
+// applyPeriodicTemplates merges the templates into the periodics extending them.
+func applyPeriodicTemplates(js []Periodic, templates map[string]JobTemplate) error {
+	for i := range js {
+		base, err := applyTemplate(js[i].JobBase, templates)
+		if err != nil {
+			return fmt.Errorf("job %s: %v", js[i].Name, err)
+		}
+		js[i].JobBase = base
+	}
+	return nil
+}
+
+// mergeLabels returns the labels with the default labels added.
+func mergeLabels(labels, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return labels
+	}
+	merged := map[string]string{}
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+// mergeUtilityConfig returns the utility config with the unset fields taken
+// from the defaults. The decoration configs are merged field by field, unless
+// decoration is turned off explicitly.
+func mergeUtilityConfig(uc, def UtilityConfig) UtilityConfig {
+	decorationConfig := uc.DecorationConfig
+	if uc.Decorate == nil || *uc.Decorate {
+		decorationConfig = decorationConfig.ApplyDefault(def.DecorationConfig)
+	}
+	defaultZeroFields(reflect.ValueOf(&uc).Elem(), reflect.ValueOf(def))
+	uc.SkipSubmodules = uc.SkipSubmodules || def.SkipSubmodules
+	uc.DecorationConfig = decorationConfig
+	return uc
+}
+
+// mergePodSpec returns a copy of the pod spec with the defaults merged in.
+// Containers are merged by position and volumes by name; other fields are
+// taken from the defaults if they are unset.
+func mergePodSpec(spec, def *v1.PodSpec) *v1.PodSpec {
+	if def == nil {
+		return spec
+	}
+	if spec == nil {
+		return def.DeepCopy()
+	}
+	merged := spec.DeepCopy()
+	def = def.DeepCopy()
+	for i := range def.Containers {
+		if i < len(merged.Containers) {
+			mergeContainer(&merged.Containers[i], def.Containers[i])
+		} else {
+			merged.Containers = append(merged.Containers, def.Containers[i])
+		}
+	}
+	for _, volume := range def.Volumes {
+		if !hasVolume(merged.Volumes, volume.Name) {
+			merged.Volumes = append(merged.Volumes, volume)
+		}
+	}
+	merged.NodeSelector = mergeLabels(merged.NodeSelector, def.NodeSelector)
+	defaultZeroFields(reflect.ValueOf(merged).Elem(), reflect.ValueOf(*def))
+	return merged
+}
+
+func hasVolume(volumes []v1.Volume, name string) bool {
+	for _, volume := range volumes {
+		if volume.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeContainer merges the default container into the container. Env vars
+// and volume mounts are merged by name and resources by resource name; other
+// fields are taken from the default if they are unset.
+func mergeContainer(container *v1.Container, def v1.Container) {
+	var env []v1.EnvVar
+	for _, e := range def.Env {
+		var overridden bool
+		for _, e2 := range container.Env {
+			if e.Name == e2.Name {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			env = append(env, e)
+		}
+	}
+	container.Env = append(env, container.Env...)
+
+	for _, vm := range def.VolumeMounts {
+		var overridden bool
+		for _, vm2 := range container.VolumeMounts {
+			if vm.Name == vm2.Name {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			container.VolumeMounts = append(container.VolumeMounts, vm)
+		}
+	}
+
+	container.Resources.Requests = mergeResourceList(container.Resources.Requests, def.Resources.Requests)
+	container.Resources.Limits = mergeResourceList(container.Resources.Limits, def.Resources.Limits)
+	defaultZeroFields(reflect.ValueOf(container).Elem(), reflect.ValueOf(def))
+}
+
+func mergeResourceList(resources, def v1.ResourceList) v1.ResourceList {
+	if len(def) == 0 {
+		return resources
+	}
+	merged := v1.ResourceList{}
+	for name, quantity := range def {
+		merged[name] = quantity
+	}
+	for name, quantity := range resources {
+		merged[name] = quantity
+	}
+	return merged
+}
+
+// defaultZeroFields sets every field of the struct that has its zero value
+// to the value of the field in the default struct.
+func defaultZeroFields(v, def reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		if reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			field.Set(def.Field(i))
+		}
+	}
+}
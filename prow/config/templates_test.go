@@ -0,0 +1,257 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/diff"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+func TestResolveTemplates(t *testing.T) {
+	decorate := true
+	testCases := []struct {
+		name      string
+		templates map[string]JobTemplate
+		expectErr bool
+		expected  map[string]JobTemplate
+	}{
+		{
+			name: "templates without parents are kept",
+			templates: map[string]JobTemplate{
+				"base": {Labels: map[string]string{"a": "1"}},
+			},
+			expected: map[string]JobTemplate{
+				"base": {Labels: map[string]string{"a": "1"}},
+			},
+		},
+		{
+			name: "chain is merged with children taking precedence",
+			templates: map[string]JobTemplate{
+				"base":  {Labels: map[string]string{"a": "1", "b": "1"}, UtilityConfig: UtilityConfig{Decorate: &decorate, PathAlias: "k8s.io/base"}},
+				"mid":   {Extends: "base", Labels: map[string]string{"b": "2"}},
+				"child": {Extends: "mid", UtilityConfig: UtilityConfig{PathAlias: "k8s.io/child"}},
+			},
+			expected: map[string]JobTemplate{
+				"base":  {Labels: map[string]string{"a": "1", "b": "1"}, UtilityConfig: UtilityConfig{Decorate: &decorate, PathAlias: "k8s.io/base"}},
+				"mid":   {Labels: map[string]string{"a": "1", "b": "2"}, UtilityConfig: UtilityConfig{Decorate: &decorate, PathAlias: "k8s.io/base"}},
+				"child": {Labels: map[string]string{"a": "1", "b": "2"}, UtilityConfig: UtilityConfig{Decorate: &decorate, PathAlias: "k8s.io/child"}},
+			},
+		},
+		{
+			name: "unknown parent is rejected",
+			templates: map[string]JobTemplate{
+				"child": {Extends: "missing"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "cycle is rejected",
+			templates: map[string]JobTemplate{
+				"a": {Extends: "b"},
+				"b": {Extends: "a"},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := resolveTemplates(tc.templates)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got one: %v", err)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("resolved templates differ from expected: %s", diff.ObjectReflectDiff(tc.expected, actual))
+			}
+		})
+	}
+}
+
+func TestApplyTemplate(t *testing.T) {
+	decorate := true
+	skipCloning := true
+	templates := map[string]JobTemplate{
+		"e2e": {
+			Labels: map[string]string{"preset-service-account": "true"},
+			Spec: &v1.PodSpec{
+				NodeSelector: map[string]string{"pool": "e2e"},
+				Containers: []v1.Container{{
+					Image:   "gcr.io/k8s-testimages/kubekins-e2e:latest",
+					Command: []string{"runner.sh"},
+					Env:     []v1.EnvVar{{Name: "PROVIDER", Value: "gce"}, {Name: "REGION", Value: "us-central1"}},
+					Resources: v1.ResourceRequirements{
+						Requests: v1.ResourceList{
+							v1.ResourceCPU:    resource.MustParse("2"),
+							v1.ResourceMemory: resource.MustParse("4Gi"),
+						},
+					},
+				}},
+				Volumes: []v1.Volume{{Name: "cache"}},
+			},
+			UtilityConfig: UtilityConfig{
+				Decorate: &decorate,
+				DecorationConfig: &prowapi.DecorationConfig{
+					SkipCloning: &skipCloning,
+				},
+			},
+		},
+	}
+
+	base := JobBase{
+		Name:    "pull-e2e",
+		Extends: "e2e",
+		Labels:  map[string]string{"team": "sig-testing"},
+		Spec: &v1.PodSpec{
+			Containers: []v1.Container{{
+				Args: []string{"--test"},
+				Env:  []v1.EnvVar{{Name: "PROVIDER", Value: "aws"}},
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")},
+				},
+			}},
+		},
+		UtilityConfig: UtilityConfig{
+			DecorationConfig: &prowapi.DecorationConfig{
+				GCSCredentialsSecret: "service-account",
+			},
+		},
+	}
+	expected := JobBase{
+		Name:    "pull-e2e",
+		Extends: "e2e",
+		Labels:  map[string]string{"team": "sig-testing", "preset-service-account": "true"},
+		Spec: &v1.PodSpec{
+			NodeSelector: map[string]string{"pool": "e2e"},
+			Containers: []v1.Container{{
+				Image:   "gcr.io/k8s-testimages/kubekins-e2e:latest",
+				Command: []string{"runner.sh"},
+				Args:    []string{"--test"},
+				Env:     []v1.EnvVar{{Name: "REGION", Value: "us-central1"}, {Name: "PROVIDER", Value: "aws"}},
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						v1.ResourceCPU:    resource.MustParse("4"),
+						v1.ResourceMemory: resource.MustParse("4Gi"),
+					},
+				},
+			}},
+			Volumes: []v1.Volume{{Name: "cache"}},
+		},
+		UtilityConfig: UtilityConfig{
+			Decorate: &decorate,
+			DecorationConfig: &prowapi.DecorationConfig{
+				SkipCloning:          &skipCloning,
+				GCSCredentialsSecret: "service-account",
+			},
+		},
+	}
+
+	actual, err := applyTemplate(base, templates)
+	if err != nil {
+		t.Fatalf("expected no error but got one: %v", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("job differs from expected: %s", diff.ObjectReflectDiff(expected, actual))
+	}
+	if len(templates["e2e"].Spec.Containers[0].Env) != 2 {
+		t.Error("expected the template to be left unmodified")
+	}
+
+	if _, err := applyTemplate(JobBase{Name: "bad", Extends: "missing"}, templates); err == nil {
+		t.Error("expected an unknown template to be rejected")
+	}
+}
+
+func TestApplyTemplateDecoration(t *testing.T) {
+	decorate, dontDecorate := true, false
+	templates := map[string]JobTemplate{
+		"decorated": {
+			UtilityConfig: UtilityConfig{
+				Decorate:         &decorate,
+				DecorationConfig: &prowapi.DecorationConfig{GCSCredentialsSecret: "service-account"},
+			},
+		},
+	}
+	testCases := []struct {
+		name     string
+		decorate *bool
+		expected UtilityConfig
+	}{
+		{
+			name: "job that leaves decoration unset inherits it",
+			expected: UtilityConfig{
+				Decorate:         &decorate,
+				DecorationConfig: &prowapi.DecorationConfig{GCSCredentialsSecret: "service-account"},
+			},
+		},
+		{
+			name:     "job can opt out of decoration",
+			decorate: &dontDecorate,
+			expected: UtilityConfig{Decorate: &dontDecorate},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			base := JobBase{Name: "unit", Extends: "decorated", UtilityConfig: UtilityConfig{Decorate: tc.decorate}}
+			actual, err := applyTemplate(base, templates)
+			if err != nil {
+				t.Fatalf("expected no error but got one: %v", err)
+			}
+			if !reflect.DeepEqual(actual.UtilityConfig, tc.expected) {
+				t.Errorf("utility config differs from expected: %s", diff.ObjectReflectDiff(tc.expected, actual.UtilityConfig))
+			}
+			if actual.ShouldDecorate() != tc.expected.ShouldDecorate() {
+				t.Errorf("expected ShouldDecorate to return %t, got %t", tc.expected.ShouldDecorate(), actual.ShouldDecorate())
+			}
+		})
+	}
+}
+
+func TestFinalizeJobConfigAppliesTemplates(t *testing.T) {
+	c := &Config{
+		JobConfig: JobConfig{
+			JobTemplates: map[string]JobTemplate{
+				"unit": {Spec: &v1.PodSpec{Containers: []v1.Container{{Image: "golang"}}}},
+			},
+			Presubmits: map[string][]Presubmit{
+				"org/repo": {{JobBase: JobBase{Name: "unit", Extends: "unit", Matrix: map[string][]string{"GO": {"1.11", "1.12"}}}}},
+			},
+		},
+	}
+	if err := c.finalizeJobConfig(); err != nil {
+		t.Fatalf("expected no error but got one: %v", err)
+	}
+	if len(c.Presubmits["org/repo"]) != 2 {
+		t.Fatalf("expected the matrix to be expanded, got %v", c.Presubmits["org/repo"])
+	}
+	for _, job := range c.Presubmits["org/repo"] {
+		if job.Spec == nil || len(job.Spec.Containers) != 1 || job.Spec.Containers[0].Image != "golang" {
+			t.Errorf("job %s: expected the template spec to be merged, got %v", job.Name, job.Spec)
+		}
+	}
+}
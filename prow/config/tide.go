@@ -19,11 +19,14 @@ package config
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	cron "gopkg.in/robfig/cron.v2"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/prow/github"
@@ -76,11 +79,44 @@ type Tide struct {
 	// Queries represents a list of GitHub search queries that collectively
 	// specify the set of PRs that meet merge requirements.
 	Queries TideQueries `json:"queries,omitempty"`
-
-	// A key/value pair of an org/repo as the key and merge method to override
-	// the default method of merge. Valid options are squash, rebase, and merge.
+	// GerritQueries represents a list of Gerrit search queries that
+	// collectively specify the set of Gerrit changes that meet submit
+	// requirements.
+	GerritQueries []TideGerritQuery `json:"gerrit_queries,omitempty"`
+
+	// A key/value pair of an org, org/repo or org/repo@branch as the key and
+	// merge method to override the default method of merge. Valid options are
+	// squash, rebase, and merge.
 	MergeType map[string]github.PullRequestMergeType `json:"merge_method,omitempty"`
 
+	// MergeTemplate is a key/value pair of an org, org/repo or org/repo@branch
+	// as the key and the templates of the title and body of the commits that
+	// merge PRs. GitHub's default title and body are used if unset.
+	MergeTemplate map[string]TideMergeCommitTemplate `json:"merge_commit_template,omitempty"`
+
+	// BatchSizeLimitMap is a key/value pair of an org or org/repo as the key
+	// and the maximum number of PRs in a batch as value. Defaults to 5. A value
+	// of 0 removes the limit and -1 disables batch testing.
+	BatchSizeLimitMap map[string]int `json:"batch_size_limit,omitempty"`
+
+	// Priority is an ordered list of sets of labels. PRs that have all labels
+	// of a set are merged and batched before PRs that match a later set or no
+	// set at all. PRs of the same priority are merged oldest first. Queries
+	// may override it for their repos.
+	Priority []TidePriority `json:"priority,omitempty"`
+
+	// SpeculativeQueue enables the speculative merge queue for an org or
+	// org/repo key. The value is the maximum number of PRs in the queue. Tide
+	// then tests every prefix of the queue as a separate batch in parallel and
+	// merges the longest passing one. Values need to be at least 2.
+	SpeculativeQueue map[string]int `json:"speculative_queue,omitempty"`
+
+	// PostMergeVerification enables the verification of merges for an org or
+	// org/repo key. Tide then watches the postsubmits of the commits it merged
+	// and pauses the pools of branches that a merge broke until a later commit
+	// passes them again.
+	PostMergeVerification map[string]TidePostMergeVerification `json:"post_merge_verification,omitempty"`
+
 	// URL for tide status contexts.
 	// We can consider allowing this to be set separately for separate repos, or
 	// allowing it to be a template.
@@ -96,6 +132,11 @@ type Tide struct {
 	// Leave this blank to disable this feature and save 1 API token per sync loop.
 	BlockerLabel string `json:"blocker_label,omitempty"`
 
+	// MergeFreezes lists periods in which Tide does not merge PRs. Pools are
+	// blocked while a freeze that applies to them is active, just like they
+	// are by blocking issues.
+	MergeFreezes []TideMergeFreeze `json:"merge_freezes,omitempty"`
+
 	// SquashLabel is an optional label that is used to identify PRs that should
 	// always be squash merged.
 	// Leave this blank to disable this feature.
@@ -113,21 +154,280 @@ type Tide struct {
 	ContextOptions TideContextPolicyOptions `json:"context_options,omitempty"`
 }
 
-// MergeMethod returns the merge method to use for a repo. The default of merge is
-// returned when not overridden.
-func (t *Tide) MergeMethod(org, repo string) github.PullRequestMergeType {
-	name := org + "/" + repo
+// mergeKeys returns the keys that merge settings are looked up by, from the
+// most to the least specific.
+func mergeKeys(org, repo, branch string) []string {
+	return []string{fmt.Sprintf("%s/%s@%s", org, repo, branch), org + "/" + repo, org}
+}
+
+// MergeMethod returns the merge method to use for a branch. The default of
+// merge is returned when not overridden.
+func (t *Tide) MergeMethod(org, repo, branch string) github.PullRequestMergeType {
+	for _, key := range mergeKeys(org, repo, branch) {
+		if method, ok := t.MergeType[key]; ok {
+			return method
+		}
+	}
+	return github.MergeMerge
+}
+
+// MergeCommitTemplate returns the templates of the merge commits of a branch.
+// The templates are nil when GitHub's default title and body are used.
+func (t *Tide) MergeCommitTemplate(org, repo, branch string) TideMergeCommitTemplate {
+	for _, key := range mergeKeys(org, repo, branch) {
+		if tmpl, ok := t.MergeTemplate[key]; ok {
+			return tmpl
+		}
+	}
+	return TideMergeCommitTemplate{}
+}
+
+// TideMergeCommitTemplate holds the Go templates of the title and body of the
+// commits that merge PRs. They are executed with TideMergeCommitTemplateData.
+type TideMergeCommitTemplate struct {
+	TitleTemplate string `json:"title,omitempty"`
+	BodyTemplate  string `json:"body,omitempty"`
+
+	Title *template.Template `json:"-"`
+	Body  *template.Template `json:"-"`
+}
+
+// TideMergeCommitTemplateData is the data that the templates of merge commits
+// can refer to.
+type TideMergeCommitTemplateData struct {
+	Org    string
+	Repo   string
+	Branch string
+	Number int
+	Title  string
+	Body   string
+	// Author is the login of the author of the PR.
+	Author string
+	// Authors are the logins of the authors of the commits of the PR that
+	// have a GitHub account.
+	Authors []string
+	// Approvers are the logins of the users whose latest review approves the PR.
+	Approvers []string
+	// ReleaseNote is the content of the release-note block of the PR body.
+	ReleaseNote string
+}
+
+// parse compiles the templates and checks that they can be executed.
+func (t *TideMergeCommitTemplate) parse() error {
+	var err error
+	if t.TitleTemplate != "" {
+		if t.Title, err = template.New("title").Parse(t.TitleTemplate); err != nil {
+			return fmt.Errorf("parsing title template: %v", err)
+		}
+		if err := t.Title.Execute(ioutil.Discard, TideMergeCommitTemplateData{}); err != nil {
+			return fmt.Errorf("executing title template: %v", err)
+		}
+	}
+	if t.BodyTemplate != "" {
+		if t.Body, err = template.New("body").Parse(t.BodyTemplate); err != nil {
+			return fmt.Errorf("parsing body template: %v", err)
+		}
+		if err := t.Body.Execute(ioutil.Discard, TideMergeCommitTemplateData{}); err != nil {
+			return fmt.Errorf("executing body template: %v", err)
+		}
+	}
+	return nil
+}
+
+// PriorityFor returns the priority list for the PRs of a repo: the one of the
+// first query for the repo that sets one, or else the global one.
+func (t *Tide) PriorityFor(org, repo string) []TidePriority {
+	for _, query := range t.Queries {
+		if len(query.Priority) > 0 && query.ForRepo(org, repo) {
+			return query.Priority
+		}
+	}
+	return t.Priority
+}
+
+// TidePriority is a set of labels that gives PRs priority when merging.
+type TidePriority struct {
+	// Labels lists the labels a PR needs to have. An entry may list
+	// alternatives separated by "|", of which the PR needs one.
+	Labels []string `json:"labels,omitempty"`
+}
 
-	v, ok := t.MergeType[name]
-	if !ok {
-		if ov, found := t.MergeType[org]; found {
-			return ov
+// Matches determines whether a PR with the given labels has this priority.
+func (tp TidePriority) Matches(labels sets.String) bool {
+	for _, label := range tp.Labels {
+		if !labels.HasAny(strings.Split(label, "|")...) {
+			return false
 		}
+	}
+	return true
+}
+
+// TideMergeFreeze is a period in which Tide does not merge PRs into some
+// branches. A freeze either recurs on a cron schedule and lasts for a
+// duration, or is a single period between a start and an end time.
+type TideMergeFreeze struct {
+	// Name describes the freeze in status contexts and on Deck.
+	Name string `json:"name"`
+
+	// Orgs and Repos (in org/repo form) that the freeze applies to. The freeze
+	// applies to all repos if both are empty.
+	Orgs  []string `json:"orgs,omitempty"`
+	Repos []string `json:"repos,omitempty"`
+	// Branches that the freeze applies to. The freeze applies to all branches
+	// if this is empty.
+	Branches []string `json:"branches,omitempty"`
+
+	// Cron is a cron expression for the start of a recurring freeze, e.g.
+	// "TZ=Europe/Berlin 0 17 * * FRI" for a freeze that starts every Friday
+	// at 17:00 Berlin time.
+	Cron string `json:"cron,omitempty"`
+	// DurationString compiles into Duration at load time.
+	DurationString string `json:"duration,omitempty"`
+	// Duration is how long a recurring freeze lasts, e.g. 64h for a freeze
+	// from Friday 17:00 to Monday 09:00.
+	Duration time.Duration `json:"-"`
+
+	// StartString and EndString compile into Start and End at load time.
+	// They need to be RFC 3339 timestamps.
+	StartString string `json:"start,omitempty"`
+	EndString   string `json:"end,omitempty"`
+	// Start and End delimit a single freeze.
+	Start time.Time `json:"-"`
+	End   time.Time `json:"-"`
+
+	schedule cron.Schedule
+}
 
-		return github.MergeMerge
+// AppliesTo determines whether the freeze applies to a branch of a repo.
+func (f *TideMergeFreeze) AppliesTo(org, repo, branch string) bool {
+	if len(f.Orgs) > 0 || len(f.Repos) > 0 {
+		if !sets.NewString(f.Orgs...).Has(org) && !sets.NewString(f.Repos...).Has(org+"/"+repo) {
+			return false
+		}
 	}
+	return len(f.Branches) == 0 || sets.NewString(f.Branches...).Has(branch)
+}
 
-	return v
+// ActiveUntil determines whether the freeze is active at the given time and,
+// if it is, when it ends.
+func (f *TideMergeFreeze) ActiveUntil(now time.Time) (time.Time, bool) {
+	if f.schedule != nil {
+		// The freeze is active if it started less than its duration ago.
+		start := f.schedule.Next(now.Add(-f.Duration))
+		if start.After(now) {
+			return time.Time{}, false
+		}
+		return start.Add(f.Duration), true
+	}
+	if now.Before(f.Start) || !now.Before(f.End) {
+		return time.Time{}, false
+	}
+	return f.End, true
+}
+
+// parse validates the freeze and compiles its schedule and times.
+func (f *TideMergeFreeze) parse() error {
+	if f.Name == "" {
+		return errors.New("it needs a name")
+	}
+	if f.Cron != "" {
+		if f.StartString != "" || f.EndString != "" {
+			return errors.New("cron cannot be set together with start or end")
+		}
+		schedule, err := cron.Parse(f.Cron)
+		if err != nil {
+			return fmt.Errorf("invalid cron string %s: %v", f.Cron, err)
+		}
+		duration, err := time.ParseDuration(f.DurationString)
+		if err != nil {
+			return fmt.Errorf("cannot parse duration: %v", err)
+		}
+		if duration <= 0 {
+			return errors.New("duration needs to be positive")
+		}
+		f.schedule, f.Duration = schedule, duration
+		return nil
+	}
+	if f.DurationString != "" {
+		return errors.New("duration can only be set together with cron")
+	}
+	if f.StartString == "" || f.EndString == "" {
+		return errors.New("it needs either a cron string or a start and an end")
+	}
+	start, err := time.Parse(time.RFC3339, f.StartString)
+	if err != nil {
+		return fmt.Errorf("cannot parse start: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, f.EndString)
+	if err != nil {
+		return fmt.Errorf("cannot parse end: %v", err)
+	}
+	if !end.After(start) {
+		return errors.New("end needs to be after start")
+	}
+	f.Start, f.End = start, end
+	return nil
+}
+
+// DefaultBatchSizeLimit is the maximum number of PRs in a batch of repos
+// without a batch_size_limit.
+const DefaultBatchSizeLimit = 5
+
+// BatchSizeLimit returns the maximum number of PRs in a batch for a repo. A
+// limit of 0 means there is no limit and -1 that batch testing is disabled.
+func (t *Tide) BatchSizeLimit(org, repo string) int {
+	if limit, ok := t.BatchSizeLimitMap[org+"/"+repo]; ok {
+		return limit
+	}
+	if limit, ok := t.BatchSizeLimitMap[org]; ok {
+		return limit
+	}
+	return DefaultBatchSizeLimit
+}
+
+// SpeculativeQueueDepth returns the maximum number of PRs in the speculative
+// merge queue of a repo, or 0 if the speculative queue is not enabled.
+func (t *Tide) SpeculativeQueueDepth(org, repo string) int {
+	if depth, ok := t.SpeculativeQueue[org+"/"+repo]; ok {
+		return depth
+	}
+	return t.SpeculativeQueue[org]
+}
+
+// TidePostMergeVerification configures which postsubmits verify the commits
+// that Tide merged and what Tide does when one of them fails.
+type TidePostMergeVerification struct {
+	// Jobs lists the names of the postsubmits to watch. All postsubmits of
+	// the branch are watched if this is empty.
+	Jobs []string `json:"jobs,omitempty"`
+	// Revert makes Tide open a PR that reverts a merge whose postsubmits
+	// failed.
+	Revert bool `json:"revert,omitempty"`
+}
+
+// Watches determines whether a postsubmit verifies merges.
+func (v *TidePostMergeVerification) Watches(job string) bool {
+	if len(v.Jobs) == 0 {
+		return true
+	}
+	for _, j := range v.Jobs {
+		if j == job {
+			return true
+		}
+	}
+	return false
+}
+
+// PostMergeVerificationFor returns the post-merge verification settings of a
+// repo, or nil if merges into the repo are not verified.
+func (t *Tide) PostMergeVerificationFor(org, repo string) *TidePostMergeVerification {
+	if v, ok := t.PostMergeVerification[org+"/"+repo]; ok {
+		return &v
+	}
+	if v, ok := t.PostMergeVerification[org]; ok {
+		return &v
+	}
+	return nil
 }
 
 // TideQuery is turned into a GitHub search query. See the docs for details:
@@ -146,6 +446,24 @@ type TideQuery struct {
 	Milestone string `json:"milestone,omitempty"`
 
 	ReviewApprovedRequired bool `json:"reviewApprovedRequired,omitempty"`
+
+	// OwnersApprovalRequired requires every file that a PR changes to be
+	// approved by one of its approvers in the OWNERS files, with a GitHub review.
+	OwnersApprovalRequired bool `json:"ownersApprovalRequired,omitempty"`
+	// RequiredApprovals is the number of distinct approvers of the changed
+	// files in the OWNERS files that have to approve a PR with a GitHub review.
+	RequiredApprovals int `json:"requiredApprovals,omitempty"`
+
+	// Priority overrides the global priority list for the repos of the query.
+	// If several queries for a repo set it, the first one is used.
+	Priority []TidePriority `json:"priority,omitempty"`
+}
+
+// RequiresOwnersApproval indicates if the PRs of the query need approvals from
+// the OWNERS of their changed files. These requirements cannot be expressed
+// in a search query, so Tide checks them after searching.
+func (tq *TideQuery) RequiresOwnersApproval() bool {
+	return tq.OwnersApprovalRequired || tq.RequiredApprovals > 0
 }
 
 // Query returns the corresponding github search string for the tide query.
@@ -181,6 +499,70 @@ func (tq *TideQuery) Query() string {
 	return strings.Join(toks, " ")
 }
 
+// TideGerritQuery is turned into a Gerrit search query. See the docs for details:
+// https://gerrit-review.googlesource.com/Documentation/user-search.html
+type TideGerritQuery struct {
+	// Instance is the URL of the Gerrit instance, e.g.
+	// https://android-review.googlesource.com
+	Instance string   `json:"instance"`
+	Projects []string `json:"projects"`
+
+	ExcludedBranches []string `json:"excludedBranches,omitempty"`
+	IncludedBranches []string `json:"includedBranches,omitempty"`
+
+	// Labels lists the votes that changes need, e.g. "Code-Review=+2" or
+	// "Verified=+1", and MissingLabels the votes they must not have.
+	Labels        []string `json:"labels,omitempty"`
+	MissingLabels []string `json:"missingLabels,omitempty"`
+}
+
+// Query returns the corresponding Gerrit search string for the query.
+func (tgq *TideGerritQuery) Query() string {
+	toks := []string{"status:open"}
+	var projects []string
+	for _, p := range tgq.Projects {
+		projects = append(projects, fmt.Sprintf("project:\"%s\"", p))
+	}
+	if len(projects) > 1 {
+		toks = append(toks, "("+strings.Join(projects, " OR ")+")")
+	} else {
+		toks = append(toks, projects...)
+	}
+	for _, b := range tgq.ExcludedBranches {
+		toks = append(toks, fmt.Sprintf("-branch:\"%s\"", b))
+	}
+	var branches []string
+	for _, b := range tgq.IncludedBranches {
+		branches = append(branches, fmt.Sprintf("branch:\"%s\"", b))
+	}
+	if len(branches) > 1 {
+		toks = append(toks, "("+strings.Join(branches, " OR ")+")")
+	} else {
+		toks = append(toks, branches...)
+	}
+	for _, l := range tgq.Labels {
+		toks = append(toks, fmt.Sprintf("label:%s", l))
+	}
+	for _, l := range tgq.MissingLabels {
+		toks = append(toks, fmt.Sprintf("-label:%s", l))
+	}
+	return strings.Join(toks, " ")
+}
+
+// Validate returns an error if the query has an invalid configuration.
+func (tgq *TideGerritQuery) Validate() error {
+	if tgq.Instance == "" {
+		return errors.New("instance must be set")
+	}
+	if len(tgq.Projects) == 0 {
+		return errors.New("at least one project must be set")
+	}
+	if len(tgq.ExcludedBranches) > 0 && len(tgq.IncludedBranches) > 0 {
+		return errors.New("includedBranches and excludedBranches are mutually exclusive")
+	}
+	return nil
+}
+
 // ForRepo indicates if the tide query applies to the specified repo.
 func (tq TideQuery) ForRepo(org, repo string) bool {
 	fullName := fmt.Sprintf("%s/%s", org, repo)
@@ -375,6 +757,10 @@ func (tq *TideQuery) Validate() error {
 		return err
 	}
 
+	if tq.RequiredApprovals < 0 {
+		return fmt.Errorf("requiredApprovals: %d must not be negative", tq.RequiredApprovals)
+	}
+
 	return nil
 }
 
@@ -20,6 +20,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"k8s.io/apimachinery/pkg/util/diff"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -56,6 +57,61 @@ func TestTideQuery(t *testing.T) {
 	checkTok("review:approved")
 }
 
+func TestTideGerritQuery(t *testing.T) {
+	var testcases = []struct {
+		name     string
+		query    TideGerritQuery
+		expected string
+	}{
+		{
+			name: "single project",
+			query: TideGerritQuery{
+				Instance:         "https://android-review.googlesource.com",
+				Projects:         []string{"platform/build"},
+				ExcludedBranches: []string{"release"},
+				Labels:           []string{"Code-Review=+2", "Verified=+1"},
+				MissingLabels:    []string{"Code-Review=-2"},
+			},
+			expected: `status:open project:"platform/build" -branch:"release" label:Code-Review=+2 label:Verified=+1 -label:Code-Review=-2`,
+		},
+		{
+			name: "several projects and branches",
+			query: TideGerritQuery{
+				Instance:         "https://android-review.googlesource.com",
+				Projects:         []string{"platform/build", "toolchain/llvm"},
+				IncludedBranches: []string{"master", "dev"},
+				Labels:           []string{"Code-Review=+2"},
+			},
+			expected: `status:open (project:"platform/build" OR project:"toolchain/llvm") (branch:"master" OR branch:"dev") label:Code-Review=+2`,
+		},
+	}
+
+	for _, tc := range testcases {
+		if actual := tc.query.Query(); actual != tc.expected {
+			t.Errorf("%s: expected query %q, got %q", tc.name, tc.expected, actual)
+		}
+		if err := tc.query.Validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+	}
+
+	invalid := []TideGerritQuery{
+		{Projects: []string{"platform/build"}},
+		{Instance: "https://android-review.googlesource.com"},
+		{
+			Instance:         "https://android-review.googlesource.com",
+			Projects:         []string{"platform/build"},
+			ExcludedBranches: []string{"release"},
+			IncludedBranches: []string{"master"},
+		},
+	}
+	for i, query := range invalid {
+		if err := query.Validate(); err == nil {
+			t.Errorf("expected invalid query %d to fail validation", i)
+		}
+	}
+}
+
 func TestOrgExceptionsAndRepos(t *testing.T) {
 	queries := TideQueries{
 		{
@@ -107,44 +163,455 @@ func TestMergeMethod(t *testing.T) {
 			"helm/charts":                 github.MergeSquash,
 			"kubernetes-helm":             github.MergeSquash,
 			"kubernetes-helm/chartmuseum": github.MergeMerge,
+			"kubernetes/kops@release":     github.MergeSquash,
+			"kubernetes-helm@master":      github.MergeRebase,
 		},
 	}
 
 	var testcases = []struct {
 		org      string
 		repo     string
+		branch   string
 		expected github.PullRequestMergeType
 	}{
 		{
 			"kubernetes",
 			"kubernetes",
+			"master",
 			github.MergeMerge,
 		},
 		{
 			"kubernetes",
 			"kops",
+			"master",
 			github.MergeRebase,
 		},
+		{
+			"kubernetes",
+			"kops",
+			"release",
+			github.MergeSquash,
+		},
 		{
 			"kubernetes",
 			"charts",
+			"master",
 			github.MergeSquash,
 		},
 		{
 			"kubernetes-helm",
 			"monocular",
+			"master",
 			github.MergeSquash,
 		},
 		{
 			"kubernetes-helm",
 			"chartmuseum",
+			"master",
 			github.MergeMerge,
 		},
 	}
 
 	for _, test := range testcases {
-		if ti.MergeMethod(test.org, test.repo) != test.expected {
-			t.Errorf("Expected merge method %q but got %q for %s/%s", test.expected, ti.MergeMethod(test.org, test.repo), test.org, test.repo)
+		if actual := ti.MergeMethod(test.org, test.repo, test.branch); actual != test.expected {
+			t.Errorf("Expected merge method %q but got %q for %s/%s@%s", test.expected, actual, test.org, test.repo, test.branch)
+		}
+	}
+}
+
+func TestMergeCommitTemplate(t *testing.T) {
+	cfg := &Config{}
+	cfg.Tide.MergeTemplate = map[string]TideMergeCommitTemplate{
+		"o":          {TitleTemplate: "{{.Title}} (#{{.Number}})"},
+		"o/r@master": {BodyTemplate: "{{.ReleaseNote}}\n{{range .Approvers}}Approved-by: {{.}}\n{{end}}"},
+	}
+	if err := parseProwConfig(cfg); err != nil {
+		t.Fatalf("Unexpected error parsing config: %v", err)
+	}
+
+	tmpl := cfg.Tide.MergeCommitTemplate("o", "r", "release")
+	if tmpl.Title == nil || tmpl.Body != nil {
+		t.Errorf("Expected only a title template for the org, got %+v.", tmpl)
+	}
+	tmpl = cfg.Tide.MergeCommitTemplate("o", "r", "master")
+	if tmpl.Title != nil || tmpl.Body == nil {
+		t.Errorf("Expected only a body template for the branch, got %+v.", tmpl)
+	}
+	if tmpl := cfg.Tide.MergeCommitTemplate("other", "r", "master"); tmpl.Title != nil || tmpl.Body != nil {
+		t.Errorf("Expected no templates for another org, got %+v.", tmpl)
+	}
+
+	for name, invalid := range map[string]TideMergeCommitTemplate{
+		"syntax error":  {TitleTemplate: "{{.Title"},
+		"unknown field": {BodyTemplate: "{{.Description}}"},
+	} {
+		cfg := &Config{}
+		cfg.Tide.MergeTemplate = map[string]TideMergeCommitTemplate{"o": invalid}
+		if err := parseProwConfig(cfg); err == nil {
+			t.Errorf("Expected an error for a template with a %s.", name)
+		}
+	}
+}
+
+func TestTidePriorityMatches(t *testing.T) {
+	priority := TidePriority{Labels: []string{"kind/bug|kind/regression", "priority/critical-urgent"}}
+
+	var testcases = []struct {
+		labels   []string
+		expected bool
+	}{
+		{
+			labels:   []string{"kind/bug", "priority/critical-urgent"},
+			expected: true,
+		},
+		{
+			labels:   []string{"kind/regression", "priority/critical-urgent", "lgtm"},
+			expected: true,
+		},
+		{
+			labels:   []string{"kind/bug"},
+			expected: false,
+		},
+		{
+			labels:   []string{"kind/feature", "priority/critical-urgent"},
+			expected: false,
+		},
+	}
+
+	for _, test := range testcases {
+		if actual := priority.Matches(sets.NewString(test.labels...)); actual != test.expected {
+			t.Errorf("Expected priority match to be %t but got %t for labels %v", test.expected, actual, test.labels)
+		}
+	}
+}
+
+func TestTidePriorityFor(t *testing.T) {
+	global := []TidePriority{{Labels: []string{"kind/bug"}}}
+	docs := []TidePriority{{Labels: []string{"kind/documentation"}}}
+	ti := &Tide{
+		Priority: global,
+		Queries: TideQueries{
+			{Repos: []string{"k8s/test-infra"}},
+			{Orgs: []string{"k8s"}, Priority: docs},
+			{Repos: []string{"k8s/website"}, Priority: []TidePriority{{Labels: []string{"lgtm"}}}},
+		},
+	}
+
+	var testcases = []struct {
+		org      string
+		repo     string
+		expected []TidePriority
+	}{
+		{
+			org:      "k8s",
+			repo:     "website",
+			expected: docs,
+		},
+		{
+			org:      "k8s",
+			repo:     "test-infra",
+			expected: docs,
+		},
+		{
+			org:      "other",
+			repo:     "repo",
+			expected: global,
+		},
+	}
+
+	for _, test := range testcases {
+		if actual := ti.PriorityFor(test.org, test.repo); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Expected priority %v for %s/%s but got %v", test.expected, test.org, test.repo, actual)
+		}
+	}
+}
+
+func TestBatchSizeLimit(t *testing.T) {
+	ti := &Tide{
+		BatchSizeLimitMap: map[string]int{
+			"kubernetes":            10,
+			"kubernetes/kubernetes": 0,
+			"kubernetes/website":    -1,
+		},
+	}
+
+	var testcases = []struct {
+		org      string
+		repo     string
+		expected int
+	}{
+		{
+			"kubernetes",
+			"kubernetes",
+			0,
+		},
+		{
+			"kubernetes",
+			"website",
+			-1,
+		},
+		{
+			"kubernetes",
+			"test-infra",
+			10,
+		},
+		{
+			"helm",
+			"charts",
+			DefaultBatchSizeLimit,
+		},
+	}
+
+	for _, test := range testcases {
+		if actual := ti.BatchSizeLimit(test.org, test.repo); actual != test.expected {
+			t.Errorf("Expected batch size limit %d but got %d for %s/%s", test.expected, actual, test.org, test.repo)
+		}
+	}
+}
+
+func TestSpeculativeQueueDepth(t *testing.T) {
+	ti := &Tide{
+		SpeculativeQueue: map[string]int{
+			"kubernetes":            3,
+			"kubernetes/kubernetes": 5,
+		},
+	}
+
+	var testcases = []struct {
+		org      string
+		repo     string
+		expected int
+	}{
+		{
+			"kubernetes",
+			"kubernetes",
+			5,
+		},
+		{
+			"kubernetes",
+			"test-infra",
+			3,
+		},
+		{
+			"helm",
+			"charts",
+			0,
+		},
+	}
+
+	for _, test := range testcases {
+		if actual := ti.SpeculativeQueueDepth(test.org, test.repo); actual != test.expected {
+			t.Errorf("Expected speculative queue depth %d but got %d for %s/%s", test.expected, actual, test.org, test.repo)
+		}
+	}
+}
+
+func TestPostMergeVerificationFor(t *testing.T) {
+	ti := &Tide{
+		PostMergeVerification: map[string]TidePostMergeVerification{
+			"kubernetes":            {},
+			"kubernetes/kubernetes": {Jobs: []string{"ci-kubernetes-build"}, Revert: true},
+		},
+	}
+
+	var testcases = []struct {
+		org      string
+		repo     string
+		expected *TidePostMergeVerification
+	}{
+		{
+			"kubernetes",
+			"kubernetes",
+			&TidePostMergeVerification{Jobs: []string{"ci-kubernetes-build"}, Revert: true},
+		},
+		{
+			"kubernetes",
+			"test-infra",
+			&TidePostMergeVerification{},
+		},
+		{
+			"helm",
+			"charts",
+			nil,
+		},
+	}
+
+	for _, test := range testcases {
+		if actual := ti.PostMergeVerificationFor(test.org, test.repo); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Expected post-merge verification %+v but got %+v for %s/%s", test.expected, actual, test.org, test.repo)
+		}
+	}
+
+	all := TidePostMergeVerification{}
+	if !all.Watches("any-job") {
+		t.Error("Expected verification without jobs to watch all postsubmits")
+	}
+	some := TidePostMergeVerification{Jobs: []string{"build"}}
+	if !some.Watches("build") || some.Watches("test") {
+		t.Error("Expected verification with jobs to only watch those postsubmits")
+	}
+}
+
+func TestTideMergeFreeze(t *testing.T) {
+	weekend := TideMergeFreeze{
+		Name:           "weekend",
+		Repos:          []string{"kubernetes/kubernetes"},
+		Cron:           "0 17 * * FRI",
+		DurationString: "64h",
+	}
+	if err := weekend.parse(); err != nil {
+		t.Fatalf("Unexpected error parsing recurring freeze: %v", err)
+	}
+	release := TideMergeFreeze{
+		Name:        "release",
+		Orgs:        []string{"kubernetes"},
+		Branches:    []string{"master"},
+		StartString: "2019-12-02T00:00:00Z",
+		EndString:   "2019-12-09T00:00:00Z",
+	}
+	if err := release.parse(); err != nil {
+		t.Fatalf("Unexpected error parsing single freeze: %v", err)
+	}
+
+	at := func(value string) time.Time {
+		res, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatalf("Failed to parse time %q: %v", value, err)
+		}
+		return res
+	}
+	var testcases = []struct {
+		name           string
+		freeze         *TideMergeFreeze
+		now            string
+		expectedActive bool
+		expectedUntil  string
+	}{
+		{
+			name:   "before recurring freeze",
+			freeze: &weekend,
+			now:    "2019-12-06T16:59:00Z",
+		},
+		{
+			name:           "start of recurring freeze",
+			freeze:         &weekend,
+			now:            "2019-12-06T17:00:00Z",
+			expectedActive: true,
+			expectedUntil:  "2019-12-09T09:00:00Z",
+		},
+		{
+			name:           "during recurring freeze",
+			freeze:         &weekend,
+			now:            "2019-12-08T12:00:00Z",
+			expectedActive: true,
+			expectedUntil:  "2019-12-09T09:00:00Z",
+		},
+		{
+			name:   "end of recurring freeze",
+			freeze: &weekend,
+			now:    "2019-12-09T09:00:00Z",
+		},
+		{
+			name:   "before single freeze",
+			freeze: &release,
+			now:    "2019-12-01T23:59:00Z",
+		},
+		{
+			name:           "during single freeze",
+			freeze:         &release,
+			now:            "2019-12-05T00:00:00Z",
+			expectedActive: true,
+			expectedUntil:  "2019-12-09T00:00:00Z",
+		},
+		{
+			name:   "end of single freeze",
+			freeze: &release,
+			now:    "2019-12-09T00:00:00Z",
+		},
+	}
+
+	for _, tc := range testcases {
+		until, active := tc.freeze.ActiveUntil(at(tc.now))
+		if active != tc.expectedActive {
+			t.Errorf("%s: expected active to be %t, got %t", tc.name, tc.expectedActive, active)
+		}
+		if active && !until.Equal(at(tc.expectedUntil)) {
+			t.Errorf("%s: expected the freeze to end at %s, got %s", tc.name, tc.expectedUntil, until)
+		}
+	}
+
+	if !weekend.AppliesTo("kubernetes", "kubernetes", "release-1.17") {
+		t.Error("Expected the weekend freeze to apply to all branches of kubernetes/kubernetes")
+	}
+	if weekend.AppliesTo("kubernetes", "test-infra", "master") {
+		t.Error("Expected the weekend freeze not to apply to kubernetes/test-infra")
+	}
+	if !release.AppliesTo("kubernetes", "test-infra", "master") {
+		t.Error("Expected the release freeze to apply to the master branch of kubernetes/test-infra")
+	}
+	if release.AppliesTo("kubernetes", "test-infra", "release-1.17") {
+		t.Error("Expected the release freeze not to apply to release branches")
+	}
+}
+
+func TestTideMergeFreezeParse(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		freeze    TideMergeFreeze
+		expectErr bool
+	}{
+		{
+			name:      "missing name",
+			freeze:    TideMergeFreeze{Cron: "0 17 * * FRI", DurationString: "64h"},
+			expectErr: true,
+		},
+		{
+			name:      "missing schedule",
+			freeze:    TideMergeFreeze{Name: "freeze"},
+			expectErr: true,
+		},
+		{
+			name:      "cron without duration",
+			freeze:    TideMergeFreeze{Name: "freeze", Cron: "0 17 * * FRI"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid cron",
+			freeze:    TideMergeFreeze{Name: "freeze", Cron: "every friday", DurationString: "64h"},
+			expectErr: true,
+		},
+		{
+			name:      "cron with start",
+			freeze:    TideMergeFreeze{Name: "freeze", Cron: "0 17 * * FRI", DurationString: "64h", StartString: "2019-12-02T00:00:00Z"},
+			expectErr: true,
+		},
+		{
+			name:   "cron with time zone",
+			freeze: TideMergeFreeze{Name: "freeze", Cron: "TZ=Europe/Berlin 0 17 * * FRI", DurationString: "64h"},
+		},
+		{
+			name:      "end before start",
+			freeze:    TideMergeFreeze{Name: "freeze", StartString: "2019-12-09T00:00:00Z", EndString: "2019-12-02T00:00:00Z"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid start",
+			freeze:    TideMergeFreeze{Name: "freeze", StartString: "December 2nd", EndString: "2019-12-09T00:00:00Z"},
+			expectErr: true,
+		},
+		{
+			name:   "start and end",
+			freeze: TideMergeFreeze{Name: "freeze", StartString: "2019-12-02T00:00:00Z", EndString: "2019-12-09T00:00:00Z"},
+		},
+	}
+
+	for _, tc := range testcases {
+		err := tc.freeze.parse()
+		if tc.expectErr && err == nil {
+			t.Errorf("%s: expected an error but got none", tc.name)
+		}
+		if !tc.expectErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
 		}
 	}
 }
@@ -694,6 +1161,23 @@ func TestTideQuery_Validate(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "owners approvals query is valid",
+			query: TideQuery{
+				Orgs:                   []string{"kuber"},
+				OwnersApprovalRequired: true,
+				RequiredApprovals:      2,
+			},
+			expectError: false,
+		},
+		{
+			name: "negative required approvals is invalid",
+			query: TideQuery{
+				Orgs:              []string{"kuber"},
+				RequiredApprovals: -1,
+			},
+			expectError: true,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -62,6 +62,7 @@ type Job struct {
 	PodName     string               `json:"pod_name"`
 	Agent       prowapi.ProwJobAgent `json:"agent"`
 	ProwJob     string               `json:"prow_job"`
+	ParentJob   string               `json:"parent_job,omitempty"`
 
 	st time.Time
 	ft time.Time
@@ -215,6 +216,8 @@ func (ja *JobAgent) update() error {
 			ProwJob: j.ObjectMeta.Name,
 			BuildID: buildID,
 
+			ParentJob: j.ObjectMeta.Labels[kube.ParentJobLabel],
+
 			Started:     fmt.Sprintf("%d", j.Status.StartTime.Time.Unix()),
 			State:       string(j.Status.State),
 			Description: j.Status.Description,
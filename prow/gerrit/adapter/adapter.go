@@ -170,7 +170,8 @@ func (c *Controller) Sync() error {
 	return nil
 }
 
-func makeCloneURI(instance, project string) (*url.URL, error) {
+// MakeCloneURI returns the URI to clone a project of a Gerrit instance from.
+func MakeCloneURI(instance, project string) (*url.URL, error) {
 	u, err := url.Parse(instance)
 	if err != nil {
 		return nil, fmt.Errorf("instance %s is not a url: %v", instance, err)
@@ -197,7 +198,9 @@ func listChangedFiles(changeInfo client.ChangeInfo) config.ChangedFilesProvider
 	}
 }
 
-func createRefs(reviewHost string, change client.ChangeInfo, cloneURI *url.URL, baseSHA string) (prowapi.Refs, error) {
+// CreateRefs returns the refs to test the current revision of a change on top
+// of baseSHA.
+func CreateRefs(reviewHost string, change client.ChangeInfo, cloneURI *url.URL, baseSHA string) (prowapi.Refs, error) {
 	rev, ok := change.Revisions[change.CurrentRevision]
 	if !ok {
 		return prowapi.Refs{}, fmt.Errorf("cannot find current revision for change %v", change.ID)
@@ -235,7 +238,7 @@ func createRefs(reviewHost string, change client.ChangeInfo, cloneURI *url.URL,
 func (c *Controller) ProcessChange(instance string, change client.ChangeInfo) error {
 	logger := logrus.WithField("gerrit change", change.Number)
 
-	cloneURI, err := makeCloneURI(instance, change.Project)
+	cloneURI, err := MakeCloneURI(instance, change.Project)
 	if err != nil {
 		return fmt.Errorf("failed to create clone uri: %v", err)
 	}
@@ -247,7 +250,7 @@ func (c *Controller) ProcessChange(instance string, change client.ChangeInfo) er
 
 	triggeredJobs := []string{}
 
-	refs, err := createRefs(instance, change, cloneURI, baseSHA)
+	refs, err := CreateRefs(instance, change, cloneURI, baseSHA)
 	if err != nil {
 		return fmt.Errorf("failed to get refs: %v", err)
 	}
@@ -104,7 +104,7 @@ func TestMakeCloneURI(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			actual, err := makeCloneURI(tc.instance, tc.project)
+			actual, err := MakeCloneURI(tc.instance, tc.project)
 			switch {
 			case err != nil:
 				if !tc.err {
@@ -158,11 +158,11 @@ func TestCreateRefs(t *testing.T) {
 			},
 		},
 	}
-	cloneURI, err := makeCloneURI(reviewHost, change.Project)
+	cloneURI, err := MakeCloneURI(reviewHost, change.Project)
 	if err != nil {
 		t.Errorf("failed to make clone URI: %v", err)
 	}
-	actual, err := createRefs(reviewHost, change, cloneURI, "abcdef")
+	actual, err := CreateRefs(reviewHost, change, cloneURI, "abcdef")
 	if err != nil {
 		t.Errorf("unexpected error creating refs: %v", err)
 	}
@@ -90,6 +90,8 @@ type gerritAccount interface {
 type gerritChange interface {
 	QueryChanges(opt *gerrit.QueryChangeOptions) (*[]gerrit.ChangeInfo, *gerrit.Response, error)
 	SetReview(changeID, revisionID string, input *gerrit.ReviewInput) (*gerrit.ReviewResult, *gerrit.Response, error)
+	GetChange(changeID string, opt *gerrit.ChangeOptions) (*gerrit.ChangeInfo, *gerrit.Response, error)
+	SubmitChange(changeID string, input *gerrit.SubmitInput) (*gerrit.ChangeInfo, *gerrit.Response, error)
 }
 
 type gerritProjects interface {
@@ -222,6 +224,61 @@ func (c *Client) SetReview(instance, id, revision, message string, labels map[st
 	return nil
 }
 
+// Query returns all changes of an instance that match a search query
+func (c *Client) Query(instance, query string, rateLimit int) ([]ChangeInfo, error) {
+	h, ok := c.handlers[instance]
+	if !ok {
+		return nil, fmt.Errorf("not activated gerrit instance: %s", instance)
+	}
+
+	opt := &gerrit.QueryChangeOptions{}
+	opt.Query = []string{query}
+	opt.AdditionalFields = []string{"CURRENT_REVISION", "CURRENT_COMMIT", "CURRENT_FILES"}
+
+	var result []ChangeInfo
+	for {
+		opt.Limit = rateLimit
+		opt.Start = len(result)
+
+		changes, _, err := h.changeService.QueryChanges(opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query gerrit changes: %v", err)
+		}
+		if changes == nil || len(*changes) == 0 {
+			return result, nil
+		}
+		result = append(result, *changes...)
+		// Gerrit marks the last change of a page if there are more changes.
+		if !(*changes)[len(*changes)-1].MoreChanges {
+			return result, nil
+		}
+	}
+}
+
+// Submit submits a change, as long as revision is still its current revision
+func (c *Client) Submit(instance, id, revision string) error {
+	h, ok := c.handlers[instance]
+	if !ok {
+		return fmt.Errorf("not activated gerrit instance: %s", instance)
+	}
+
+	change, _, err := h.changeService.GetChange(id, &gerrit.ChangeOptions{
+		AdditionalFields: []string{"CURRENT_REVISION"},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot get change %s: %v", id, err)
+	}
+	if change.CurrentRevision != revision {
+		return fmt.Errorf("revision %s is no longer the current revision of change %s", revision, id)
+	}
+
+	if _, _, err := h.changeService.SubmitChange(id, &gerrit.SubmitInput{WaitForMerge: true}); err != nil {
+		return fmt.Errorf("cannot submit change %s: %v", id, err)
+	}
+
+	return nil
+}
+
 // GetBranchRevision returns SHA of HEAD of a branch
 func (c *Client) GetBranchRevision(instance, project, branch string) (string, error) {
 	h, ok := c.handlers[instance]
@@ -17,6 +17,7 @@ limitations under the License.
 package client
 
 import (
+	"fmt"
 	"reflect"
 	"sort"
 	"strings"
@@ -27,8 +28,9 @@ import (
 )
 
 type fgc struct {
-	instance string
-	changes  map[string][]gerrit.ChangeInfo
+	instance  string
+	changes   map[string][]gerrit.ChangeInfo
+	submitted []string
 }
 
 func (f *fgc) QueryChanges(opt *gerrit.QueryChangeOptions) (*[]gerrit.ChangeInfo, *gerrit.Response, error) {
@@ -63,6 +65,89 @@ func (f *fgc) SetReview(changeID, revisionID string, input *gerrit.ReviewInput)
 	return nil, nil, nil
 }
 
+func (f *fgc) GetChange(changeID string, opt *gerrit.ChangeOptions) (*gerrit.ChangeInfo, *gerrit.Response, error) {
+	for _, change := range f.changes[f.instance] {
+		if change.ID == changeID {
+			return &change, nil, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("change %s not found", changeID)
+}
+
+func (f *fgc) SubmitChange(changeID string, input *gerrit.SubmitInput) (*gerrit.ChangeInfo, *gerrit.Response, error) {
+	f.submitted = append(f.submitted, changeID)
+	return nil, nil, nil
+}
+
+func TestSubmit(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		instance  string
+		id        string
+		revision  string
+		expectErr bool
+		submitted []string
+	}{
+		{
+			name:      "current revision is submitted",
+			instance:  "foo",
+			id:        "1",
+			revision:  "1-2",
+			submitted: []string{"1"},
+		},
+		{
+			name:      "outdated revision is not submitted",
+			instance:  "foo",
+			id:        "1",
+			revision:  "1-1",
+			expectErr: true,
+		},
+		{
+			name:      "missing change",
+			instance:  "foo",
+			id:        "2",
+			revision:  "2-1",
+			expectErr: true,
+		},
+		{
+			name:      "wrong instance",
+			instance:  "evil",
+			id:        "1",
+			revision:  "1-2",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		changeService := &fgc{
+			instance: "foo",
+			changes: map[string][]gerrit.ChangeInfo{
+				"foo": {{Project: "bar", ID: "1", CurrentRevision: "1-2"}},
+			},
+		}
+		client := &Client{
+			handlers: map[string]*gerritInstanceHandler{
+				"foo": {
+					instance:      "foo",
+					projects:      []string{"bar"},
+					changeService: changeService,
+				},
+			},
+		}
+
+		err := client.Submit(tc.instance, tc.id, tc.revision)
+		if tc.expectErr && err == nil {
+			t.Errorf("tc %s - expected an error but got none", tc.name)
+		}
+		if !tc.expectErr && err != nil {
+			t.Errorf("tc %s - unexpected error: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(changeService.submitted, tc.submitted) {
+			t.Errorf("tc %s - wrong submitted changes: got %v, expect %v", tc.name, changeService.submitted, tc.submitted)
+		}
+	}
+}
+
 func TestQueryChange(t *testing.T) {
 	now := time.Now().UTC()
 	layout := "2006-01-02 15:04:05"
@@ -1358,6 +1358,31 @@ func (c *Client) GetSingleCommit(org, repo, SHA string) (SingleCommit, error) {
 	return commit, err
 }
 
+// CreateCommit creates a commit with the given tree and parents, and returns
+// its SHA. It does not update any refs.
+//
+// See https://developer.github.com/v3/git/commits/#create-a-commit
+func (c *Client) CreateCommit(org, repo, message, tree string, parents []string) (string, error) {
+	c.log("CreateCommit", org, repo, tree, parents)
+	data := struct {
+		Message string   `json:"message"`
+		Tree    string   `json:"tree"`
+		Parents []string `json:"parents"`
+	}{
+		Message: message,
+		Tree:    tree,
+		Parents: parents,
+	}
+	var commit GitCommit
+	_, err := c.request(&request{
+		method:      http.MethodPost,
+		path:        fmt.Sprintf("/repos/%s/%s/git/commits", org, repo),
+		requestBody: &data,
+		exitCodes:   []int{201},
+	}, &commit)
+	return commit.SHA, err
+}
+
 // GetBranches returns all branches in the repo.
 //
 // If onlyProtected is true it will only return repos with protection enabled,
@@ -1907,6 +1932,21 @@ func (c *Client) GetRef(org, repo, ref string) (string, error) {
 	return res.Object["sha"], err
 }
 
+// CreateRef creates a ref, such as "refs/heads/my-branch", that points to
+// the given SHA.
+//
+// See https://developer.github.com/v3/git/refs/#create-a-reference
+func (c *Client) CreateRef(org, repo, ref, sha string) error {
+	c.log("CreateRef", org, repo, ref, sha)
+	_, err := c.request(&request{
+		method:      http.MethodPost,
+		path:        fmt.Sprintf("/repos/%s/%s/git/refs", org, repo),
+		requestBody: map[string]string{"ref": ref, "sha": sha},
+		exitCodes:   []int{201},
+	}, nil)
+	return err
+}
+
 // DeleteRef deletes the given ref
 //
 // See https://developer.github.com/v3/git/refs/#delete-a-reference
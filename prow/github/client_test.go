@@ -342,6 +342,33 @@ func TestGetRef(t *testing.T) {
 	}
 }
 
+func TestCreateRef(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/k8s/kuber/git/refs" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		var ref map[string]string
+		if err := json.Unmarshal(b, &ref); err != nil {
+			t.Errorf("Could not unmarshal request: %v", err)
+		} else if ref["ref"] != "refs/heads/my-feature" || ref["sha"] != "abcde" {
+			t.Errorf("Wrong ref: %v", ref)
+		}
+		http.Error(w, "201 Created", http.StatusCreated)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.CreateRef("k8s", "kuber", "refs/heads/my-feature", "abcde"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
 func TestDeleteRef(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
@@ -359,6 +386,41 @@ func TestDeleteRef(t *testing.T) {
 	}
 }
 
+func TestCreateCommit(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/k8s/kuber/git/commits" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		var commit struct {
+			Message string   `json:"message"`
+			Tree    string   `json:"tree"`
+			Parents []string `json:"parents"`
+		}
+		if err := json.Unmarshal(b, &commit); err != nil {
+			t.Errorf("Could not unmarshal request: %v", err)
+		} else if commit.Message != "Revert" || commit.Tree != "tree" || !reflect.DeepEqual(commit.Parents, []string{"parent"}) {
+			t.Errorf("Wrong commit: %+v", commit)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"sha": "abcde"}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	sha, err := c.CreateCommit("k8s", "kuber", "Revert", "tree", []string{"parent"})
+	if err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	} else if sha != "abcde" {
+		t.Errorf("Wrong SHA: %s", sha)
+	}
+}
+
 func TestGetSingleCommit(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -517,6 +517,51 @@ type StatusEvent struct {
 	GUID string
 }
 
+// ReleaseEventAction enumerates the triggers for this
+// webhook payload type. See also:
+// https://developer.github.com/v3/activity/events/types/#releaseevent
+type ReleaseEventAction string
+
+const (
+	// ReleaseActionPublished means a release was published.
+	ReleaseActionPublished ReleaseEventAction = "published"
+	// ReleaseActionUnpublished means a release was unpublished.
+	ReleaseActionUnpublished ReleaseEventAction = "unpublished"
+	// ReleaseActionCreated means a draft was saved or a release was
+	// published without previously being saved as a draft.
+	ReleaseActionCreated ReleaseEventAction = "created"
+	// ReleaseActionEdited means a release was edited.
+	ReleaseActionEdited ReleaseEventAction = "edited"
+	// ReleaseActionDeleted means a release was deleted.
+	ReleaseActionDeleted ReleaseEventAction = "deleted"
+)
+
+// ReleaseEvent is what GitHub sends us when a release changes.
+//
+// See https://developer.github.com/v3/activity/events/types/#releaseevent
+type ReleaseEvent struct {
+	Action  ReleaseEventAction `json:"action"`
+	Release Release            `json:"release"`
+	Repo    Repo               `json:"repository"`
+	Sender  User               `json:"sender"`
+
+	// GUID is included in the header of the request received by GitHub.
+	GUID string
+}
+
+// Release is a GitHub release of a tag.
+type Release struct {
+	ID              int    `json:"id"`
+	TagName         string `json:"tag_name"`
+	TargetCommitish string `json:"target_commitish"`
+	Name            string `json:"name"`
+	Body            string `json:"body"`
+	Draft           bool   `json:"draft"`
+	Prerelease      bool   `json:"prerelease"`
+	HTMLURL         string `json:"html_url"`
+	Author          User   `json:"author"`
+}
+
 // IssuesSearchResult represents the result of an issues search.
 type IssuesSearchResult struct {
 	Total  int     `json:"total_count,omitempty"`
@@ -549,6 +594,14 @@ func (pe PushEvent) Branch() string {
 	return refs[len(refs)-1]
 }
 
+// Tag returns the name of the pushed tag, if the user pushed a tag.
+func (pe PushEvent) Tag() (string, bool) {
+	if !strings.HasPrefix(pe.Ref, "refs/tags/") {
+		return "", false
+	}
+	return strings.TrimPrefix(pe.Ref, "refs/tags/"), true
+}
+
 // Commit represents general info about a commit.
 type Commit struct {
 	ID       string   `json:"id"`
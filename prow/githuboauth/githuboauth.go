@@ -19,6 +19,7 @@ package githuboauth
 import (
 	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -223,6 +224,28 @@ func (ga *Agent) HandleRedirect(client OAuthClient, getter GitHubClientGetter) h
 	}
 }
 
+// GetLogin returns the GitHub login of the user that sent the request, as
+// authenticated by the access token saved to the cookie on login. It returns
+// an error if the user is not logged in.
+func (ga *Agent) GetLogin(r *http.Request, getter GitHubClientGetter) (string, error) {
+	session, err := ga.gc.CookieStore.Get(r, tokenSession)
+	if err != nil {
+		return "", fmt.Errorf("error getting session: %v", err)
+	}
+	token, ok := session.Values[tokenKey].(*oauth2.Token)
+	if !ok || token.AccessToken == "" {
+		return "", errors.New("not logged in with GitHub")
+	}
+	user, err := getter.GetGitHubClient(token.AccessToken, false).GetUser("")
+	if err != nil {
+		return "", fmt.Errorf("error getting user login: %v", err)
+	}
+	if user.Login == nil {
+		return "", errors.New("GitHub returned no login for the user")
+	}
+	return *user.Login, nil
+}
+
 // Handles server errors.
 func (ga *Agent) serverError(w http.ResponseWriter, action string, err error) {
 	ga.logger.WithError(err).Errorf("Error %s.", action)
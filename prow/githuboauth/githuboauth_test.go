@@ -322,3 +322,30 @@ func TestHandleRedirectWithValidState(t *testing.T) {
 		t.Errorf("Mismatch github login. Got %v, expected %v", loginCookie.Value, mockLogin)
 	}
 }
+
+func TestGetLogin(t *testing.T) {
+	gob.Register(&oauth2.Token{})
+	cookie := sessions.NewCookieStore([]byte("secret-key"))
+	mockConfig := getMockConfig(cookie)
+	mockLogger := logrus.WithField("uni-test", "githuboauth")
+	mockAgent := NewAgent(mockConfig, mockLogger)
+	mockLogin := "foo_name"
+
+	mockRequest := httptest.NewRequest(http.MethodPost, "/mock-action", nil)
+	if _, err := mockAgent.GetLogin(mockRequest, &fakeGetter{mockLogin}); err == nil {
+		t.Error("Expected an error for a request without a session")
+	}
+
+	mockSession, err := sessions.GetRegistry(mockRequest).Get(cookie, tokenSession)
+	if err != nil {
+		t.Fatalf("Error with getting mock session: %v", err)
+	}
+	mockSession.Values[tokenKey] = &oauth2.Token{AccessToken: mockAccessToken}
+	login, err := mockAgent.GetLogin(mockRequest, &fakeGetter{mockLogin})
+	if err != nil {
+		t.Fatalf("Error getting login: %v", err)
+	}
+	if login != mockLogin {
+		t.Errorf("Mismatch github login. Got %v, expected %v", login, mockLogin)
+	}
+}
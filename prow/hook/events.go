@@ -224,6 +224,27 @@ func (s *Server) handlePushEvent(l *logrus.Entry, pe github.PushEvent) {
 	}
 }
 
+func (s *Server) handleReleaseEvent(l *logrus.Entry, re github.ReleaseEvent) {
+	defer s.wg.Done()
+	l = l.WithFields(logrus.Fields{
+		github.OrgLogField:  re.Repo.Owner.Login,
+		github.RepoLogField: re.Repo.Name,
+		"tag":               re.Release.TagName,
+		"url":               re.Release.HTMLURL,
+	})
+	l.Infof("Release %s.", re.Action)
+	for p, h := range s.Plugins.ReleaseEventHandlers(re.Repo.Owner.Login, re.Repo.Name) {
+		s.wg.Add(1)
+		go func(p string, h plugins.ReleaseEventHandler) {
+			defer s.wg.Done()
+			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
+			if err := h(agent, re); err != nil {
+				agent.Logger.WithError(err).Error("Error handling ReleaseEvent.")
+			}
+		}(p, h)
+	}
+}
+
 func (s *Server) handleIssueEvent(l *logrus.Entry, i github.IssueEvent) {
 	defer s.wg.Done()
 	l = l.WithFields(logrus.Fields{
@@ -140,6 +140,15 @@ func (s *Server) demuxEvent(eventType, eventGUID string, payload []byte, h http.
 		srcRepo = pe.Repo.FullName
 		s.wg.Add(1)
 		go s.handlePushEvent(l, pe)
+	case "release":
+		var re github.ReleaseEvent
+		if err := json.Unmarshal(payload, &re); err != nil {
+			return err
+		}
+		re.GUID = eventGUID
+		srcRepo = re.Repo.FullName
+		s.wg.Add(1)
+		go s.handleReleaseEvent(l, re)
 	case "status":
 		var se github.StatusEvent
 		if err := json.Unmarshal(payload, &se); err != nil {
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/bwmarrin/snowflake"
 	"github.com/sirupsen/logrus"
@@ -35,6 +36,10 @@ import (
 	"k8s.io/test-infra/prow/pjutil"
 )
 
+// abortedBuildWindow is how long after a ProwJob was aborted the controller
+// looks for its build to stop it.
+const abortedBuildWindow = time.Hour
+
 type prowJobClient interface {
 	Create(*prowapi.ProwJob) (*prowapi.ProwJob, error)
 	List(opts metav1.ListOptions) (*prowapi.ProwJobList, error)
@@ -190,6 +195,7 @@ func (c *Controller) Sync() error {
 	if err := c.terminateDupes(jenkinsJobs, jbs); err != nil {
 		syncErrs = append(syncErrs, err)
 	}
+	c.abortBuilds(jenkinsJobs, jbs)
 
 	pendingCh, triggeredCh := pjutil.PartitionActive(jenkinsJobs)
 	errCh := make(chan error, len(jenkinsJobs))
@@ -236,12 +242,13 @@ func (c *Controller) SyncMetrics() {
 	kube.GatherProwJobMetrics(c.pjs)
 }
 
-// getJenkinsJobs returns all the Jenkins jobs for all active
-// prowjobs from the provided list. It handles deduplication.
+// getJenkinsJobs returns all the Jenkins jobs for all active and
+// recently aborted prowjobs from the provided list. It handles
+// deduplication.
 func getJenkinsJobs(pjs []prowapi.ProwJob) []string {
 	jenkinsJobs := make(map[string]struct{})
 	for _, pj := range pjs {
-		if pj.Complete() {
+		if pj.Complete() && !recentlyAborted(pj) {
 			continue
 		}
 		jenkinsJobs[pj.Spec.Job] = struct{}{}
@@ -253,6 +260,35 @@ func getJenkinsJobs(pjs []prowapi.ProwJob) []string {
 	return jobs
 }
 
+// recentlyAborted determines whether a prowjob was aborted recently enough
+// that its build may still be running.
+func recentlyAborted(pj prowapi.ProwJob) bool {
+	return pj.Status.State == prowapi.AbortedState && pj.Status.CompletionTime != nil && time.Since(pj.Status.CompletionTime.Time) < abortedBuildWindow
+}
+
+// abortBuilds aborts the running builds of prowjobs that were aborted while
+// their build ran, like presubmits for PRs that were closed or updated, if
+// cancellations are allowed.
+func (c *Controller) abortBuilds(pjs []prowapi.ProwJob, jbs map[string]Build) {
+	if !c.config().AllowCancellations {
+		return
+	}
+	for _, pj := range pjs {
+		if pj.Status.State != prowapi.AbortedState {
+			continue
+		}
+		build, buildExists := jbs[pj.ObjectMeta.Name]
+		// Avoid cancelling enqueued builds, like terminateDupes.
+		if !buildExists || build.IsEnqueued() || !build.IsRunning() {
+			continue
+		}
+		c.log.WithFields(pjutil.ProwJobFields(&pj)).Info("Aborting the build of the aborted prowjob.")
+		if err := c.jc.Abort(pj.Spec.Job, &build); err != nil {
+			c.log.WithError(err).WithFields(pjutil.ProwJobFields(&pj)).Warn("Cannot cancel Jenkins build")
+		}
+	}
+}
+
 // terminateDupes aborts presubmits that have a newer version. It modifies pjs
 // in-place when it aborts.
 func (c *Controller) terminateDupes(pjs []prowapi.ProwJob, jbs map[string]Build) error {
@@ -25,6 +25,7 @@ import (
 	"sync"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -106,6 +107,8 @@ type fjc struct {
 	pjs    []prowapi.ProwJob
 	err    error
 	builds map[string]Build
+	// aborted lists the jobs of the aborted builds.
+	aborted []string
 }
 
 func (f *fjc) Build(pj *prowapi.ProwJob, buildID string) error {
@@ -131,6 +134,7 @@ func (f *fjc) ListBuilds(jobs []string) (map[string]Build, error) {
 func (f *fjc) Abort(job string, build *Build) error {
 	f.Lock()
 	defer f.Unlock()
+	f.aborted = append(f.aborted, job)
 	return nil
 }
 
@@ -829,6 +833,48 @@ func TestMaxConcurrencyWithNewlyTriggeredJobs(t *testing.T) {
 	}
 }
 
+func TestAbortBuilds(t *testing.T) {
+	pj := func(name string, state prowapi.ProwJobState) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       prowapi.ProwJobSpec{Job: name},
+			Status:     prowapi.ProwJobStatus{State: state},
+		}
+	}
+	result := success
+	pjs := []prowapi.ProwJob{
+		pj("running", prowapi.AbortedState),
+		pj("enqueued", prowapi.AbortedState),
+		pj("finished", prowapi.AbortedState),
+		pj("pending", prowapi.PendingState),
+	}
+	jbs := map[string]Build{
+		"running":  {},
+		"enqueued": {enqueued: true},
+		"finished": {Result: &result},
+		"pending":  {},
+	}
+
+	for _, allowCancellations := range []bool{true, false} {
+		ca := newFakeConfigAgent(t, 0, nil)
+		ca.c.JenkinsOperators[0].AllowCancellations = allowCancellations
+		jc := &fjc{}
+		c := Controller{
+			jc:  jc,
+			log: logrus.NewEntry(logrus.StandardLogger()),
+			cfg: ca.Config,
+		}
+		c.abortBuilds(pjs, jbs)
+		var expected []string
+		if allowCancellations {
+			expected = []string{"running"}
+		}
+		if !reflect.DeepEqual(jc.aborted, expected) {
+			t.Errorf("with cancellations allowed %t: expected aborted builds %v, got %v", allowCancellations, expected, jc.aborted)
+		}
+	}
+}
+
 func TestGetJenkinsJobs(t *testing.T) {
 	now := func() *metav1.Time {
 		n := metav1.Now()
@@ -899,6 +945,30 @@ func TestGetJenkinsJobs(t *testing.T) {
 			},
 			expected: []string{"maradona", "coolio"},
 		},
+		{
+			name: "recently aborted",
+			pjs: []prowapi.ProwJob{
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job: "coolio",
+					},
+					Status: prowapi.ProwJobStatus{
+						State:          prowapi.AbortedState,
+						CompletionTime: now(),
+					},
+				},
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job: "maradona",
+					},
+					Status: prowapi.ProwJobStatus{
+						State:          prowapi.AbortedState,
+						CompletionTime: &metav1.Time{Time: time.Now().Add(-2 * abortedBuildWindow)},
+					},
+				},
+			},
+			expected: []string{"coolio"},
+		},
 	}
 
 	for _, test := range tests {
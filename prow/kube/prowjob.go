@@ -47,4 +47,21 @@ const (
 	// PullLabel is added in resources created by prow and
 	// carries the PR number associated with the job, eg 321.
 	PullLabel = "prow.k8s.io/refs.pull"
+	// ParentJobLabel is added to ProwJobs that were triggered by the
+	// successful completion of another ProwJob and carries the name
+	// of that parent ProwJob.
+	ParentJobLabel = "prow.k8s.io/parent-job"
+	// ApprovedByAnnotation is added to ProwJobs that were waiting for
+	// approval and carries the GitHub login of the user that approved them.
+	ApprovedByAnnotation = "prow.k8s.io/approved-by"
+	// DeniedByAnnotation is added to ProwJobs that were waiting for
+	// approval and carries the GitHub login of the user that denied them.
+	DeniedByAnnotation = "prow.k8s.io/denied-by"
+	// ApprovalTimeAnnotation is added to ProwJobs that were waiting for
+	// approval and carries the time they were approved or denied at.
+	ApprovalTimeAnnotation = "prow.k8s.io/approval-time"
+	// WatchedRevisionAnnotation is added to ProwJobs of periodics that are
+	// triggered by changes to a watched input and carries the revision of
+	// the input that triggered them.
+	WatchedRevisionAnnotation = "prow.k8s.io/watched-revision"
 )
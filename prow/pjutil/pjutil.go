@@ -48,6 +48,10 @@ func NewProwJob(spec prowapi.ProwJobSpec, labels map[string]string) prowapi.Prow
 func newProwJob(spec prowapi.ProwJobSpec, extraLabels, extraAnnotations map[string]string) prowapi.ProwJob {
 	labels, annotations := decorate.LabelsAndAnnotationsForSpec(spec, extraLabels, extraAnnotations)
 
+	state := prowapi.TriggeredState
+	if len(spec.Approvers) > 0 {
+		state = prowapi.WaitingForApprovalState
+	}
 	return prowapi.ProwJob{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "prow.k8s.io/v1",
@@ -61,7 +65,7 @@ func newProwJob(spec prowapi.ProwJobSpec, extraLabels, extraAnnotations map[stri
 		Spec: spec,
 		Status: prowapi.ProwJobStatus{
 			StartTime: metav1.Now(),
-			State:     prowapi.TriggeredState,
+			State:     state,
 		},
 	}
 }
@@ -113,6 +117,12 @@ func PresubmitSpec(p config.Presubmit, refs prowapi.Refs) prowapi.ProwJobSpec {
 	pjs.RerunCommand = p.RerunCommand
 	pjs.Refs = completePrimaryRefs(refs, p.JobBase)
 
+	for _, nextP := range p.RunAfterSuccessJobs() {
+		if nextP.CouldRun(refs.BaseRef) {
+			pjs.RunAfterSuccess = append(pjs.RunAfterSuccess, PresubmitSpec(nextP, refs))
+		}
+	}
+
 	return pjs
 }
 
@@ -124,6 +134,13 @@ func PostsubmitSpec(p config.Postsubmit, refs prowapi.Refs) prowapi.ProwJobSpec
 	pjs.Report = !p.SkipReport
 	pjs.Refs = completePrimaryRefs(refs, p.JobBase)
 
+	for _, nextP := range p.RunAfterSuccessJobs() {
+		// The base ref of a postsubmit is either a branch or a tag.
+		if nextP.CouldRun(refs.BaseRef) || nextP.CouldRunForTag(refs.BaseRef) {
+			pjs.RunAfterSuccess = append(pjs.RunAfterSuccess, PostsubmitSpec(nextP, refs))
+		}
+	}
+
 	return pjs
 }
 
@@ -132,6 +149,10 @@ func PeriodicSpec(p config.Periodic) prowapi.ProwJobSpec {
 	pjs := specFromJobBase(p.JobBase)
 	pjs.Type = prowapi.PeriodicJob
 
+	for _, nextP := range p.RunAfterSuccessJobs() {
+		pjs.RunAfterSuccess = append(pjs.RunAfterSuccess, PeriodicSpec(nextP))
+	}
+
 	return pjs
 }
 
@@ -142,6 +163,12 @@ func BatchSpec(p config.Presubmit, refs prowapi.Refs) prowapi.ProwJobSpec {
 	pjs.Context = p.Context
 	pjs.Refs = completePrimaryRefs(refs, p.JobBase)
 
+	for _, nextP := range p.RunAfterSuccessJobs() {
+		if nextP.CouldRun(refs.BaseRef) {
+			pjs.RunAfterSuccess = append(pjs.RunAfterSuccess, BatchSpec(nextP, refs))
+		}
+	}
+
 	return pjs
 }
 
@@ -154,9 +181,14 @@ func specFromJobBase(jb config.JobBase) prowapi.ProwJobSpec {
 		Job:             jb.Name,
 		Agent:           prowapi.ProwJobAgent(jb.Agent),
 		Cluster:         jb.Cluster,
+		Clusters:        jb.Clusters,
 		Namespace:       namespace,
 		MaxConcurrency:  jb.MaxConcurrency,
+		Priority:        jb.Priority,
 		ErrorOnEviction: jb.ErrorOnEviction,
+		Retry:           jb.Retry,
+		Approvers:       jb.Approvers,
+		ReporterConfig:  jb.ReporterConfig,
 
 		ExtraRefs:        jb.ExtraRefs,
 		DecorationConfig: jb.DecorationConfig,
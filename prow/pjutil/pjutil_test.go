@@ -543,6 +543,31 @@ func TestNewProwJob(t *testing.T) {
 	}
 }
 
+func TestNewProwJobState(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		spec     prowapi.ProwJobSpec
+		expected prowapi.ProwJobState
+	}{
+		{
+			name:     "job without approvers is triggered",
+			spec:     prowapi.ProwJobSpec{Job: "job", Type: prowapi.PostsubmitJob},
+			expected: prowapi.TriggeredState,
+		},
+		{
+			name:     "job with approvers waits for approval",
+			spec:     prowapi.ProwJobSpec{Job: "job", Type: prowapi.PostsubmitJob, Approvers: []string{"someone"}},
+			expected: prowapi.WaitingForApprovalState,
+		},
+	}
+
+	for _, testCase := range testCases {
+		if actual := NewProwJob(testCase.spec, nil).Status.State; actual != testCase.expected {
+			t.Errorf("%s: expected state %s, got %s", testCase.name, testCase.expected, actual)
+		}
+	}
+}
+
 func TestNewProwJobWithAnnotations(t *testing.T) {
 	var testCases = []struct {
 		name                string
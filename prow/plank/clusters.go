@@ -0,0 +1,238 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plank
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	coreapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/pjutil"
+)
+
+// clusterHealthCheckPeriod is how often the build clusters are checked.
+const clusterHealthCheckPeriod = 30 * time.Second
+
+var (
+	buildClusterHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "plank_build_cluster_healthy",
+		Help: "Whether plank can reach a build cluster (1) or not (0)",
+	}, []string{
+		// alias of the build cluster
+		"cluster",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(buildClusterHealthy)
+}
+
+// ClusterHealthCheck checks whether a build cluster can be reached.
+type ClusterHealthCheck func() error
+
+// checkClusterHealth runs the health checks of the build clusters. No pods
+// are started in the clusters that fail them until they pass again.
+func (c *Controller) checkClusterHealth() {
+	results := make(map[string]error, len(c.healthChecks))
+	var resultsLock sync.Mutex
+	var wg sync.WaitGroup
+	for alias, check := range c.healthChecks {
+		wg.Add(1)
+		go func(alias string, check ClusterHealthCheck) {
+			defer wg.Done()
+			err := check()
+			resultsLock.Lock()
+			results[alias] = err
+			resultsLock.Unlock()
+		}(alias, check)
+	}
+	wg.Wait()
+
+	c.clusterLock.Lock()
+	defer c.clusterLock.Unlock()
+	unhealthy := map[string]error{}
+	for alias, err := range results {
+		log := c.log.WithField("cluster", alias)
+		if err != nil {
+			if _, wasUnhealthy := c.unhealthyClusters[alias]; !wasUnhealthy {
+				log.WithError(err).Warn("Build cluster is unhealthy, not starting pods in it.")
+			}
+			unhealthy[alias] = err
+			buildClusterHealthy.WithLabelValues(alias).Set(0)
+			continue
+		}
+		if _, wasUnhealthy := c.unhealthyClusters[alias]; wasUnhealthy {
+			log.Info("Build cluster is healthy again.")
+		}
+		buildClusterHealthy.WithLabelValues(alias).Set(1)
+	}
+	c.unhealthyClusters = unhealthy
+}
+
+// selectCluster returns the build cluster to start the pod of a ProwJob in
+// and reserves room for the pod in it. ProwJobs that can run in several
+// clusters go to the one with the least active pods for its weight, among
+// the healthy clusters that have room for more pods and nodes for the node
+// selector of the pod. Ties go to the cluster that is listed first.
+func (c *Controller) selectCluster(pj *prowapi.ProwJob) (string, error) {
+	c.clusterLock.Lock()
+	defer c.clusterLock.Unlock()
+
+	if len(pj.Spec.Clusters) == 0 || pj.Spec.Cluster != "" {
+		alias := pj.ClusterAlias()
+		if err, unhealthy := c.unhealthyClusters[alias]; unhealthy {
+			return "", fmt.Errorf("build cluster %q is unhealthy: %v", alias, err)
+		}
+		c.reservePod(alias, pj.ObjectMeta.Name)
+		return alias, nil
+	}
+
+	var nodeSelector map[string]string
+	if pj.Spec.PodSpec != nil {
+		nodeSelector = pj.Spec.PodSpec.NodeSelector
+	}
+	var selected string
+	var selectedLoad float64
+	var rejections []string
+	for _, cluster := range pj.Spec.Clusters {
+		if _, ok := c.pkcs[cluster.Name]; !ok {
+			rejections = append(rejections, fmt.Sprintf("%s is not a known cluster", cluster.Name))
+			continue
+		}
+		if _, unhealthy := c.unhealthyClusters[cluster.Name]; unhealthy {
+			rejections = append(rejections, fmt.Sprintf("%s is unhealthy", cluster.Name))
+			continue
+		}
+		buildCluster := c.config().Plank.BuildClusters[cluster.Name]
+		if !buildCluster.Accepts(nodeSelector) {
+			rejections = append(rejections, fmt.Sprintf("%s has no nodes for the node selector", cluster.Name))
+			continue
+		}
+		active := c.activePodCount(cluster.Name)
+		if max := buildCluster.MaxActivePods; max > 0 && active >= max {
+			rejections = append(rejections, fmt.Sprintf("%s has %d active pods", cluster.Name, active))
+			continue
+		}
+		weight := cluster.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if load := float64(active) / float64(weight); selected == "" || load < selectedLoad {
+			selected, selectedLoad = cluster.Name, load
+		}
+	}
+	if selected == "" {
+		return "", fmt.Errorf("no eligible build cluster: %s", strings.Join(rejections, ", "))
+	}
+	c.log.WithFields(pjutil.ProwJobFields(pj)).WithField("cluster", selected).Debug("Selected build cluster.")
+	c.reservePod(selected, pj.ObjectMeta.Name)
+	return selected, nil
+}
+
+// reservePod counts a pod that is being created as active in its build
+// cluster until the cache of the cluster has it. The caller must hold the
+// cluster lock.
+func (c *Controller) reservePod(alias, name string) {
+	if c.reservedPods == nil {
+		c.reservedPods = map[string]sets.String{}
+	}
+	if _, ok := c.reservedPods[alias]; !ok {
+		c.reservedPods[alias] = sets.NewString()
+	}
+	c.reservedPods[alias].Insert(name)
+}
+
+// releasePod gives up the room reserved for a pod that could not be created.
+func (c *Controller) releasePod(alias, name string) {
+	c.clusterLock.Lock()
+	defer c.clusterLock.Unlock()
+	c.reservedPods[alias].Delete(name)
+}
+
+// trackPod updates the active pods of a build cluster with a pod that was
+// added to or updated in the cache of the cluster, or deleted from it.
+func (c *Controller) trackPod(alias string, obj interface{}, deleted bool) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.log.WithError(err).Warn("Cannot get key from object meta.")
+		return
+	}
+	_, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		c.log.WithError(err).WithField("key", key).Warn("Invalid object key.")
+		return
+	}
+	pod, isPod := obj.(*coreapi.Pod)
+	active := !deleted && isPod && (pod.Status.Phase == coreapi.PodPending || pod.Status.Phase == coreapi.PodRunning)
+
+	c.clusterLock.Lock()
+	defer c.clusterLock.Unlock()
+	// The cache has caught up with the creation of the pod.
+	c.reservedPods[alias].Delete(name)
+	if c.activePods == nil {
+		c.activePods = map[string]sets.String{}
+	}
+	if _, ok := c.activePods[alias]; !ok {
+		c.activePods[alias] = sets.NewString()
+	}
+	if active {
+		c.activePods[alias].Insert(name)
+	} else {
+		c.activePods[alias].Delete(name)
+	}
+}
+
+// activePodCount counts the pods in a build cluster that are pending or
+// running, including the ones that are being created. The caller must hold
+// the cluster lock.
+func (c *Controller) activePodCount(alias string) int {
+	count := c.activePods[alias].Len()
+	for name := range c.reservedPods[alias] {
+		if !c.activePods[alias].Has(name) {
+			count++
+		}
+	}
+	return count
+}
+
+// scheduledCluster returns the build cluster that the pod of a ProwJob that
+// can run in several clusters was started in, or an empty string if the pod
+// cannot be found. The cluster is recorded in the ProwJob when it starts,
+// but the ProwJob may fail to be updated after the pod was created.
+func (c *Controller) scheduledCluster(pj *prowapi.ProwJob) (string, error) {
+	for _, cluster := range pj.Spec.Clusters {
+		indexer, ok := c.podIndexers[cluster.Name]
+		if !ok {
+			continue
+		}
+		_, exists, err := indexer.GetByKey(objectKey(c.config().PodNamespace, pj.ObjectMeta.Name))
+		if err != nil {
+			return "", fmt.Errorf("error getting pod %s from cluster %q: %v", pj.ObjectMeta.Name, cluster.Name, err)
+		}
+		if exists {
+			return cluster.Name, nil
+		}
+	}
+	return "", nil
+}
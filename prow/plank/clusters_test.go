@@ -0,0 +1,358 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plank
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/kube"
+)
+
+// newClusters creates build clusters with the given number of running pods.
+func newClusters(running map[string]int) map[string]*fkc {
+	clusters := map[string]*fkc{}
+	for alias, num := range running {
+		client := &fkc{}
+		for i := 0; i < num; i++ {
+			client.pods = append(client.pods, kube.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", alias, i)},
+				Status:     v1.PodStatus{Phase: v1.PodRunning},
+			})
+		}
+		clusters[alias] = client
+	}
+	return clusters
+}
+
+func TestSelectCluster(t *testing.T) {
+	testCases := []struct {
+		name          string
+		clusters      []prowapi.EligibleCluster
+		cluster       string
+		nodeSelector  map[string]string
+		running       map[string]int
+		buildClusters map[string]config.BuildCluster
+		unhealthy     []string
+		expected      string
+		expectedErr   bool
+	}{
+		{
+			name:     "job without eligible clusters runs in its cluster",
+			cluster:  "b",
+			running:  map[string]int{"a": 0, "b": 5},
+			expected: "b",
+		},
+		{
+			name:     "job without any cluster runs in the default cluster",
+			running:  map[string]int{kube.DefaultClusterAlias: 0},
+			expected: kube.DefaultClusterAlias,
+		},
+		{
+			name:        "job cannot run in an unhealthy cluster",
+			cluster:     "b",
+			running:     map[string]int{"b": 0},
+			unhealthy:   []string{"b"},
+			expectedErr: true,
+		},
+		{
+			name:     "least loaded cluster is selected",
+			clusters: []prowapi.EligibleCluster{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			running:  map[string]int{"a": 3, "b": 1, "c": 2},
+			expected: "b",
+		},
+		{
+			name:     "ties go to the first cluster",
+			clusters: []prowapi.EligibleCluster{{Name: "b"}, {Name: "a"}},
+			running:  map[string]int{"a": 2, "b": 2},
+			expected: "b",
+		},
+		{
+			name:     "load is relative to the weight",
+			clusters: []prowapi.EligibleCluster{{Name: "a"}, {Name: "b", Weight: 4}},
+			running:  map[string]int{"a": 1, "b": 3},
+			expected: "b",
+		},
+		{
+			name:     "already selected cluster is kept",
+			clusters: []prowapi.EligibleCluster{{Name: "a"}, {Name: "b"}},
+			cluster:  "b",
+			running:  map[string]int{"a": 0, "b": 3},
+			expected: "b",
+		},
+		{
+			name:      "unhealthy clusters are skipped",
+			clusters:  []prowapi.EligibleCluster{{Name: "a"}, {Name: "b"}},
+			running:   map[string]int{"a": 0, "b": 3},
+			unhealthy: []string{"a"},
+			expected:  "b",
+		},
+		{
+			name:     "unknown clusters are skipped",
+			clusters: []prowapi.EligibleCluster{{Name: "unknown"}, {Name: "b"}},
+			running:  map[string]int{"b": 3},
+			expected: "b",
+		},
+		{
+			name:          "full clusters are skipped",
+			clusters:      []prowapi.EligibleCluster{{Name: "a"}, {Name: "b"}},
+			running:       map[string]int{"a": 2, "b": 3},
+			buildClusters: map[string]config.BuildCluster{"a": {MaxActivePods: 2}},
+			expected:      "b",
+		},
+		{
+			name:         "clusters without nodes for the node selector are skipped",
+			clusters:     []prowapi.EligibleCluster{{Name: "a"}, {Name: "b"}},
+			nodeSelector: map[string]string{"cloud.google.com/gke-accelerator": "nvidia-tesla-k80"},
+			running:      map[string]int{"a": 0, "b": 3},
+			buildClusters: map[string]config.BuildCluster{
+				"a": {NodeLabels: map[string][]string{"cloud.google.com/gke-accelerator": {"nvidia-tesla-p100"}}},
+			},
+			expected: "b",
+		},
+		{
+			name:          "no eligible cluster",
+			clusters:      []prowapi.EligibleCluster{{Name: "a"}, {Name: "b"}},
+			running:       map[string]int{"a": 1, "b": 0},
+			buildClusters: map[string]config.BuildCluster{"a": {MaxActivePods: 1}},
+			unhealthy:     []string{"b"},
+			expectedErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ca := newFakeConfigAgent(t, 0)
+			ca.c.Plank.BuildClusters = tc.buildClusters
+			buildClusters := newClusters(tc.running)
+			c := Controller{
+				pkcs:              map[string]kubeClient{},
+				log:               logrus.NewEntry(logrus.StandardLogger()),
+				config:            ca.Config,
+				unhealthyClusters: map[string]error{},
+			}
+			for alias, client := range buildClusters {
+				c.pkcs[alias] = client
+			}
+			for _, alias := range tc.unhealthy {
+				c.unhealthyClusters[alias] = errors.New("unreachable")
+			}
+			setCaches(t, &c, &fkc{}, buildClusters)
+
+			pj := &prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "pj"},
+				Spec: prowapi.ProwJobSpec{
+					Cluster:  tc.cluster,
+					Clusters: tc.clusters,
+					PodSpec:  &v1.PodSpec{NodeSelector: tc.nodeSelector},
+				},
+			}
+			actual, err := c.selectCluster(pj)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("Expected an error, selected cluster %q.", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual != tc.expected {
+				t.Errorf("Expected cluster %q, got %q.", tc.expected, actual)
+			}
+			if !c.reservedPods[actual].Has("pj") {
+				t.Errorf("Expected the pod to be reserved in cluster %q.", actual)
+			}
+		})
+	}
+}
+
+func TestReservedPods(t *testing.T) {
+	buildClusters := newClusters(map[string]int{"a": 1, "b": 2})
+	c := Controller{
+		pkcs:   map[string]kubeClient{"a": buildClusters["a"], "b": buildClusters["b"]},
+		log:    logrus.NewEntry(logrus.StandardLogger()),
+		config: newFakeConfigAgent(t, 0).Config,
+	}
+	setCaches(t, &c, &fkc{}, buildClusters)
+	pj := func(name string) *prowapi.ProwJob {
+		return &prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       prowapi.ProwJobSpec{Clusters: []prowapi.EligibleCluster{{Name: "a"}, {Name: "b"}}},
+		}
+	}
+
+	// Pods that are being created count against their cluster before the
+	// cache has them.
+	for _, name := range []string{"first", "second"} {
+		if actual, err := c.selectCluster(pj(name)); err != nil || actual != "a" {
+			t.Fatalf("Expected %s to go to cluster a, got %q and error %v.", name, actual, err)
+		}
+	}
+	if actual, err := c.selectCluster(pj("third")); err != nil || actual != "b" {
+		t.Fatalf("Expected third to go to cluster b, got %q and error %v.", actual, err)
+	}
+
+	// Pods that could not be created do not count.
+	c.releasePod("a", "first")
+	c.releasePod("a", "second")
+	if actual, err := c.selectCluster(pj("fourth")); err != nil || actual != "a" {
+		t.Fatalf("Expected fourth to go to cluster a, got %q and error %v.", actual, err)
+	}
+
+	// Pods that the cache has are counted by their phase.
+	fourth := &kube.Pod{ObjectMeta: metav1.ObjectMeta{Name: "fourth"}, Status: v1.PodStatus{Phase: v1.PodPending}}
+	c.trackPod("a", fourth, false)
+	if c.reservedPods["a"].Len() != 0 {
+		t.Errorf("Expected no reserved pods in cluster a, got %v.", c.reservedPods["a"].List())
+	}
+	c.clusterLock.Lock()
+	active := c.activePodCount("a")
+	c.clusterLock.Unlock()
+	if active != 2 {
+		t.Errorf("Expected 2 active pods in cluster a, got %d.", active)
+	}
+	fourth = fourth.DeepCopy()
+	fourth.Status.Phase = v1.PodSucceeded
+	c.trackPod("a", fourth, false)
+	c.trackPod("a", cache.DeletedFinalStateUnknown{Key: "a-0"}, true)
+	c.clusterLock.Lock()
+	active = c.activePodCount("a")
+	c.clusterLock.Unlock()
+	if active != 0 {
+		t.Errorf("Expected no active pods in cluster a, got %d.", active)
+	}
+}
+
+func TestCheckClusterHealth(t *testing.T) {
+	var healthy bool
+	c := Controller{
+		log: logrus.NewEntry(logrus.StandardLogger()),
+		healthChecks: map[string]ClusterHealthCheck{
+			"good": func() error { return nil },
+			"flaky": func() error {
+				if healthy {
+					return nil
+				}
+				return errors.New("connection refused")
+			},
+		},
+	}
+
+	c.checkClusterHealth()
+	if _, unhealthy := c.unhealthyClusters["flaky"]; !unhealthy || len(c.unhealthyClusters) != 1 {
+		t.Errorf("Expected only the flaky cluster to be unhealthy, got %v.", c.unhealthyClusters)
+	}
+	healthy = true
+	c.checkClusterHealth()
+	if len(c.unhealthyClusters) != 0 {
+		t.Errorf("Expected all clusters to be healthy, got %v.", c.unhealthyClusters)
+	}
+}
+
+func TestStartInSelectedCluster(t *testing.T) {
+	testCases := []struct {
+		name        string
+		existingPod string
+		expected    string
+		created     bool
+	}{
+		{
+			name:     "pod is started in the least loaded cluster",
+			expected: "b",
+			created:  true,
+		},
+		{
+			name:        "cluster of an existing pod is recorded",
+			existingPod: "a",
+			expected:    "a",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+			defer totServ.Close()
+			fc := &fkc{prowjobs: []prowapi.ProwJob{{
+				ObjectMeta: metav1.ObjectMeta{Name: "pj"},
+				Spec: prowapi.ProwJobSpec{
+					Job:      "job",
+					Type:     prowapi.PeriodicJob,
+					Agent:    prowapi.KubernetesAgent,
+					Clusters: []prowapi.EligibleCluster{{Name: "a"}, {Name: "b"}},
+					PodSpec:  &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{State: prowapi.TriggeredState},
+			}}}
+			buildClusters := newClusters(map[string]int{"a": 2, "b": 1})
+			if tc.existingPod != "" {
+				client := buildClusters[tc.existingPod]
+				client.pods = append(client.pods, kube.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "pj"},
+					Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "test-name"}}},
+				})
+			}
+			c := Controller{
+				kc:          fc,
+				pkcs:        map[string]kubeClient{"a": buildClusters["a"], "b": buildClusters["b"]},
+				log:         logrus.NewEntry(logrus.StandardLogger()),
+				config:      newFakeConfigAgent(t, 0).Config,
+				totURL:      totServ.URL,
+				pendingJobs: make(map[string]int),
+				started:     sets.NewString(),
+				skipReport:  true,
+			}
+			setCaches(t, &c, fc, buildClusters)
+
+			if err := c.syncProwJob("pj"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			pj := fc.prowjobs[0]
+			if pj.Status.State != prowapi.PendingState {
+				t.Errorf("Expected the prowjob to be pending, got %s.", pj.Status.State)
+			}
+			if pj.Spec.Cluster != tc.expected {
+				t.Errorf("Expected the prowjob to run in cluster %q, got %q.", tc.expected, pj.Spec.Cluster)
+			}
+			var created []string
+			for alias, client := range buildClusters {
+				for _, pod := range client.pods {
+					if pod.ObjectMeta.Name == "pj" && alias != tc.existingPod {
+						created = append(created, alias)
+					}
+				}
+			}
+			if tc.created && (len(created) != 1 || created[0] != tc.expected) {
+				t.Errorf("Expected a pod to be created in cluster %q, got pods in %v.", tc.expected, created)
+			}
+			if !tc.created && len(created) != 0 {
+				t.Errorf("Expected no pod to be created, got pods in %v.", created)
+			}
+		})
+	}
+}
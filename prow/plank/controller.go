@@ -17,16 +17,28 @@ limitations under the License.
 package plank
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
+	uuid "github.com/satori/go.uuid"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	coreapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	pjinformers "k8s.io/test-infra/prow/client/informers/externalversions/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
 	reportlib "k8s.io/test-infra/prow/github/report"
@@ -36,14 +48,23 @@ import (
 	"k8s.io/test-infra/prow/pod-utils/decorate"
 )
 
+const (
+	// dupeIndex indexes the presubmits that are not complete by job and
+	// PR, so that the runs of a job for old commits of a PR can be aborted.
+	dupeIndex = "dupe"
+	// maxSyncRetries is the number of times the sync of a ProwJob is
+	// retried after errors before it waits for the next event or resync.
+	maxSyncRetries = 5
+)
+
+// kubeClient changes ProwJobs and pods. ProwJobs and pods are read from
+// the caches of the informers.
 type kubeClient interface {
 	CreateProwJob(prowapi.ProwJob) (prowapi.ProwJob, error)
 	GetProwJob(string) (prowapi.ProwJob, error)
-	ListProwJobs(string) ([]prowapi.ProwJob, error)
 	ReplaceProwJob(string, prowapi.ProwJob) (prowapi.ProwJob, error)
 
 	CreatePod(v1.Pod) (coreapi.Pod, error)
-	ListPods(string) ([]coreapi.Pod, error)
 	DeletePod(string) error
 }
 
@@ -59,10 +80,8 @@ type GitHubClient interface {
 	GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error)
 }
 
-// TODO: Dry this out
-type syncFn func(pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error
-
-// Controller manages ProwJobs.
+// Controller manages ProwJobs. It syncs a ProwJob whenever the ProwJob or
+// its pod changes, reading both from the caches of shared informers.
 type Controller struct {
 	kc     kubeClient
 	pkcs   map[string]kubeClient
@@ -70,24 +89,59 @@ type Controller struct {
 	log    *logrus.Entry
 	config config.Getter
 	totURL string
-	// selector that will be applied on prowjobs and pods.
-	selector string
+
+	// informers fill pjIndexer with the ProwJobs that match the label
+	// selector and podIndexers with the pods of every build cluster.
+	informers   []cache.SharedIndexInformer
+	pjIndexer   cache.Indexer
+	podIndexers map[string]cache.Indexer
+	// queue holds the names of the ProwJobs to sync.
+	queue workqueue.RateLimitingInterface
 
 	lock sync.RWMutex
 	// pendingJobs is a short-lived cache that helps in limiting
 	// the maximum concurrency of jobs.
 	pendingJobs map[string]int
+	// pendingRepos is a short-lived cache that helps in enforcing
+	// the quotas of orgs and repos.
+	pendingRepos map[string]int
+	// generation counts the changes of ProwJobs that can change which
+	// triggered ProwJobs are admitted.
+	generation int
 
-	pjLock sync.RWMutex
-	// shared across the controller and a goroutine that gathers metrics.
-	pjs []prowapi.ProwJob
+	// admission serializes the decisions to start triggered ProwJobs.
+	admission sync.Mutex
+	// started holds the triggered ProwJobs that have been admitted, until
+	// the cache shows that they are not triggered anymore. They count
+	// against the limits like pending ProwJobs.
+	started sets.String
+	// admitted and queued cache the last admission decisions by ProwJob
+	// name. They hold until the generation or the config changes.
+	admitted, queued     sets.String
+	admissionsGeneration int
+	admissionsConfig     *config.Config
+
+	// healthChecks check whether the build clusters can be reached.
+	healthChecks map[string]ClusterHealthCheck
+	// clusterLock guards the state of the build clusters.
+	clusterLock sync.Mutex
+	// unhealthyClusters holds the errors of the build clusters that
+	// failed their last health check.
+	unhealthyClusters map[string]error
+	// activePods holds the pending and running pods of each build cluster,
+	// as seen by the events of its pod informer.
+	activePods map[string]sets.String
+	// reservedPods holds the pods that are being created in each build
+	// cluster, until the cache of the cluster has them.
+	reservedPods map[string]sets.String
 
 	// if skip report job results to github
 	skipReport bool
 }
 
-// NewController creates a new Controller from the provided clients.
-func NewController(kc *kube.Client, pkcs map[string]*kube.Client, ghc GitHubClient, logger *logrus.Entry, cfg config.Getter, totURL, selector string, skipReport bool) (*Controller, error) {
+// NewController creates a new Controller from the provided clients. The
+// informers have to be started with the Controller.
+func NewController(kc *kube.Client, pkcs map[string]*kube.Client, pjInformer pjinformers.ProwJobInformer, podInformers map[string]cache.SharedIndexInformer, healthChecks map[string]ClusterHealthCheck, ghc GitHubClient, logger *logrus.Entry, cfg config.Getter, totURL string, skipReport bool) (*Controller, error) {
 	if logger == nil {
 		logger = logrus.NewEntry(logrus.StandardLogger())
 	}
@@ -95,17 +149,299 @@ func NewController(kc *kube.Client, pkcs map[string]*kube.Client, ghc GitHubClie
 	for alias, client := range pkcs {
 		buildClusters[alias] = kubeClient(client)
 	}
-	return &Controller{
-		kc:          kc,
-		pkcs:        buildClusters,
-		ghc:         ghc,
-		log:         logger,
-		config:      cfg,
-		pendingJobs: make(map[string]int),
-		totURL:      totURL,
-		selector:    selector,
-		skipReport:  skipReport,
-	}, nil
+	if err := pjInformer.Informer().AddIndexers(cache.Indexers{dupeIndex: dupeIndexFunc}); err != nil {
+		return nil, fmt.Errorf("error adding the index of duplicate prowjobs: %v", err)
+	}
+	c := &Controller{
+		kc:           kc,
+		pkcs:         buildClusters,
+		ghc:          ghc,
+		log:          logger,
+		config:       cfg,
+		informers:    []cache.SharedIndexInformer{pjInformer.Informer()},
+		pjIndexer:    pjInformer.Informer().GetIndexer(),
+		podIndexers:  map[string]cache.Indexer{},
+		queue:        kube.RateLimiter("plank"),
+		pendingJobs:  make(map[string]int),
+		pendingRepos: make(map[string]int),
+		started:      sets.NewString(),
+		healthChecks: healthChecks,
+		activePods:   map[string]sets.String{},
+		reservedPods: map[string]sets.String{},
+		totURL:       totURL,
+		skipReport:   skipReport,
+	}
+
+	pjInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.invalidateAdmissions()
+			c.enqueue(obj)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			c.enqueue(new)
+			// A ProwJob that stops running frees capacity for the
+			// queued ones.
+			if oldPJ, ok := old.(*prowapi.ProwJob); ok && isActive(oldPJ) {
+				if newPJ, ok := new.(*prowapi.ProwJob); ok && !isActive(newPJ) {
+					c.enqueueTriggered()
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.enqueueTriggered()
+		},
+	})
+	for alias, informer := range podInformers {
+		alias := alias
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.trackPod(alias, obj, false)
+				c.enqueue(obj)
+			},
+			UpdateFunc: func(old, new interface{}) {
+				c.trackPod(alias, new, false)
+				c.enqueue(new)
+			},
+			DeleteFunc: func(obj interface{}) {
+				c.trackPod(alias, obj, true)
+				c.enqueue(obj)
+			},
+		})
+		c.informers = append(c.informers, informer)
+		c.podIndexers[alias] = informer.GetIndexer()
+	}
+	return c, nil
+}
+
+// NewPodInformer creates an informer for the pods that prow created in a
+// build cluster and that match the label selector of ProwJobs.
+func NewPodInformer(client corev1.PodInterface, selector string, resync time.Duration) cache.SharedIndexInformer {
+	selector = podSelector(selector)
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = selector
+				return client.List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = selector
+				return client.Watch(options)
+			},
+		},
+		&coreapi.Pod{},
+		resync,
+		cache.Indexers{},
+	)
+}
+
+// podSelector selects the pods that prow created for the ProwJobs that
+// match the selector.
+func podSelector(selector string) string {
+	podSelector := fmt.Sprintf("%s=true", kube.CreatedByProw)
+	if len(selector) > 0 {
+		podSelector = strings.Join([]string{selector, podSelector}, ",")
+	}
+	return podSelector
+}
+
+// dupeIndexFunc indexes presubmits that are not complete by job and PR.
+func dupeIndexFunc(obj interface{}) ([]string, error) {
+	pj, ok := obj.(*prowapi.ProwJob)
+	if !ok {
+		return nil, fmt.Errorf("expected a prowjob, got %T", obj)
+	}
+	if pj.Complete() || pj.Spec.Type != prowapi.PresubmitJob || pj.Spec.Refs == nil || len(pj.Spec.Refs.Pulls) == 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("%s %s/%s#%d", pj.Spec.Job, pj.Spec.Refs.Org, pj.Spec.Refs.Repo, pj.Spec.Refs.Pulls[0].Number)}, nil
+}
+
+// enqueue schedules the ProwJob that a ProwJob or pod event is about for a
+// sync. Pods have the name of their ProwJob.
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.log.WithError(err).Warn("Cannot get key from object meta.")
+		return
+	}
+	_, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		c.log.WithError(err).WithField("key", key).Warn("Invalid object key.")
+		return
+	}
+	c.queue.Add(name)
+}
+
+// isActive determines whether a ProwJob counts against the limits, or
+// waits for capacity to count against them.
+func isActive(pj *prowapi.ProwJob) bool {
+	return pj.Status.State == prowapi.PendingState || pj.Status.State == prowapi.TriggeredState
+}
+
+// triggeredKey is the key in the queue that stands for the triggered
+// ProwJobs that have been waiting for capacity.
+type triggeredKey struct{}
+
+// invalidateAdmissions discards the cached admission decisions.
+func (c *Controller) invalidateAdmissions() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+}
+
+// enqueueTriggered schedules a sync of the triggered ProwJobs that can be
+// started after capacity freed up. Changes that arrive before the sync are
+// handled by the same sync.
+func (c *Controller) enqueueTriggered() {
+	c.invalidateAdmissions()
+	c.queue.Add(triggeredKey{})
+}
+
+// syncTriggered schedules the triggered ProwJobs that are admitted now for
+// a sync.
+func (c *Controller) syncTriggered() error {
+	c.admission.Lock()
+	defer c.admission.Unlock()
+	admitted, _, err := c.admissions()
+	if err != nil {
+		return err
+	}
+	for _, pj := range admitted {
+		c.queue.Add(pj.ObjectMeta.Name)
+	}
+	return nil
+}
+
+// Run starts the informers and syncs ProwJobs with the configured number of
+// workers until the stop channel is closed.
+func (c *Controller) Run(stop <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	for _, informer := range c.informers {
+		go informer.Run(stop)
+	}
+	c.log.Info("Waiting for informer caches to sync.")
+	if !cache.WaitForCacheSync(stop, c.HasSynced) {
+		return errors.New("failed to wait for caches to sync")
+	}
+
+	go wait.Until(c.checkClusterHealth, clusterHealthCheckPeriod, stop)
+
+	workers := c.config().Plank.MaxGoroutines
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stop)
+	}
+	c.log.Infof("Started %d workers.", workers)
+	<-stop
+	c.log.Info("Shutting down workers.")
+	return nil
+}
+
+// HasSynced determines whether the caches of all informers have synced.
+func (c *Controller) HasSynced() bool {
+	for _, informer := range c.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// runWorker syncs the ProwJobs in the queue until it shuts down.
+func (c *Controller) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+// processNextItem syncs the next ProwJob in the queue, or schedules the
+// triggered ProwJobs that can be started for a sync. Failed syncs are
+// retried with a rate limit.
+func (c *Controller) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	name, isProwJob := key.(string)
+	syncKey := func() error { return c.syncProwJob(name) }
+	if !isProwJob {
+		name, syncKey = "triggered", c.syncTriggered
+	}
+	start := time.Now()
+	if err := syncKey(); err != nil {
+		log := c.log.WithError(err).WithField("prowjob", name)
+		if c.queue.NumRequeues(key) < maxSyncRetries {
+			log.Warn("Failed to sync prowjob, retrying.")
+			c.queue.AddRateLimited(key)
+			return true
+		}
+		log.Error("Failed to sync prowjob, no more retries.")
+	}
+	c.queue.Forget(key)
+	c.log.WithField("prowjob", name).WithField("duration", time.Since(start).String()).Debug("Synced prowjob.")
+	return true
+}
+
+// objectKey is the key of an object in the caches.
+func objectKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// getProwJob returns a copy of a ProwJob from the cache.
+func (c *Controller) getProwJob(name string) (*prowapi.ProwJob, bool, error) {
+	obj, exists, err := c.pjIndexer.GetByKey(objectKey(c.config().ProwJobNamespace, name))
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	pj, ok := obj.(*prowapi.ProwJob)
+	if !ok {
+		return nil, false, fmt.Errorf("expected a prowjob, got %T", obj)
+	}
+	return pj.DeepCopy(), true, nil
+}
+
+// listProwJobs returns copies of the ProwJobs in the cache that plank runs.
+func (c *Controller) listProwJobs() []prowapi.ProwJob {
+	var pjs []prowapi.ProwJob
+	for _, obj := range c.pjIndexer.List() {
+		// TODO: Replace the following filtering with a field selector once CRDs support field selectors.
+		// https://github.com/kubernetes/kubernetes/issues/53459
+		if pj, ok := obj.(*prowapi.ProwJob); ok && pj.Spec.Agent == prowapi.KubernetesAgent {
+			pjs = append(pjs, *pj.DeepCopy())
+		}
+	}
+	return pjs
+}
+
+// podMap returns the pods of the given ProwJobs from the caches of their
+// build clusters, by name.
+func (c *Controller) podMap(pjs ...prowapi.ProwJob) (map[string]coreapi.Pod, error) {
+	pm := map[string]coreapi.Pod{}
+	for _, pj := range pjs {
+		indexer, ok := c.podIndexers[pj.ClusterAlias()]
+		if !ok {
+			// Starting the pod reports the unknown cluster.
+			continue
+		}
+		obj, exists, err := indexer.GetByKey(objectKey(c.config().PodNamespace, pj.ObjectMeta.Name))
+		if err != nil {
+			return nil, fmt.Errorf("error getting pod %s from cluster %q: %v", pj.ObjectMeta.Name, pj.ClusterAlias(), err)
+		}
+		if !exists {
+			continue
+		}
+		pod, ok := obj.(*coreapi.Pod)
+		if !ok {
+			return nil, fmt.Errorf("expected a pod, got %T", obj)
+		}
+		pm[pod.ObjectMeta.Name] = *pod.DeepCopy()
+	}
+	return pm, nil
 }
 
 // canExecuteConcurrently checks whether the provided ProwJob can
@@ -125,8 +461,15 @@ func (c *Controller) canExecuteConcurrently(pj *prowapi.ProwJob) bool {
 		}
 	}
 
+	for _, key := range quotaKeys(pj) {
+		if quota := c.config().Plank.Quotas[key]; quota > 0 && c.pendingRepos[key] >= quota {
+			c.log.WithFields(pjutil.ProwJobFields(pj)).Debugf("Not starting another job for %s, already %d running.", key, c.pendingRepos[key])
+			return false
+		}
+	}
+
 	if pj.Spec.MaxConcurrency == 0 {
-		c.pendingJobs[pj.Spec.Job]++
+		c.addPendingJob(pj)
 		return true
 	}
 
@@ -135,16 +478,117 @@ func (c *Controller) canExecuteConcurrently(pj *prowapi.ProwJob) bool {
 		c.log.WithFields(pjutil.ProwJobFields(pj)).Debugf("Not starting another instance of %s, already %d running.", pj.Spec.Job, numPending)
 		return false
 	}
-	c.pendingJobs[pj.Spec.Job]++
+	c.addPendingJob(pj)
 	return true
 }
 
-// incrementNumPendingJobs increments the amount of
-// pending ProwJobs for the given job identifier
-func (c *Controller) incrementNumPendingJobs(job string) {
+// addPendingJob accounts a pending ProwJob against its job and
+// quotas. The caller must hold the lock.
+func (c *Controller) addPendingJob(pj *prowapi.ProwJob) {
+	c.pendingJobs[pj.Spec.Job]++
+	if c.pendingRepos == nil {
+		c.pendingRepos = make(map[string]int)
+	}
+	for _, key := range quotaKeys(pj) {
+		c.pendingRepos[key]++
+	}
+}
+
+// admitTriggeredJobs orders the triggered ProwJobs by priority and fair
+// share and returns the ones that can be started now, reserving capacity
+// for them. The ProwJobs that have to wait for capacity are returned
+// separately.
+func (c *Controller) admitTriggeredJobs(pjs []prowapi.ProwJob, pm map[string]coreapi.Pod) (admitted, queued []prowapi.ProwJob) {
+	pjs = prioritize(pjs, c.config().Plank.GetPriority)
+	for i := range pjs {
+		// ProwJobs whose pod has been created already only need
+		// their status to be updated.
+		if _, podExists := pm[pjs[i].ObjectMeta.Name]; podExists || c.canExecuteConcurrently(&pjs[i]) {
+			admitted = append(admitted, pjs[i])
+		} else {
+			queued = append(queued, pjs[i])
+		}
+	}
+	return admitted, queued
+}
+
+// admissions determines which of the triggered ProwJobs in the cache can
+// be started now, given the ProwJobs that are running or have been admitted
+// already, and caches the decisions. The caller must hold the admission lock.
+func (c *Controller) admissions() (admitted, queued []prowapi.ProwJob, err error) {
+	var triggered []prowapi.ProwJob
+	cfg := c.config()
 	c.lock.Lock()
-	defer c.lock.Unlock()
-	c.pendingJobs[job]++
+	generation := c.generation
+	// Recount on every admission instead of trying to keep the counts
+	// in sync with the state of the world.
+	c.pendingJobs = make(map[string]int)
+	c.pendingRepos = make(map[string]int)
+	stillTriggered := sets.NewString()
+	for _, pj := range c.listProwJobs() {
+		switch pj.Status.State {
+		case prowapi.PendingState:
+			c.addPendingJob(&pj)
+		case prowapi.TriggeredState:
+			if c.started.Has(pj.ObjectMeta.Name) {
+				stillTriggered.Insert(pj.ObjectMeta.Name)
+				c.addPendingJob(&pj)
+				continue
+			}
+			triggered = append(triggered, pj)
+		}
+	}
+	// Admitted ProwJobs that the cache shows as started now count as
+	// pending ProwJobs.
+	c.started = c.started.Intersection(stillTriggered)
+	c.lock.Unlock()
+
+	pm, err := c.podMap(triggered...)
+	if err != nil {
+		return nil, nil, err
+	}
+	admitted, queued = c.admitTriggeredJobs(triggered, pm)
+	c.admitted, c.queued = sets.NewString(), sets.NewString()
+	for _, pj := range admitted {
+		c.admitted.Insert(pj.ObjectMeta.Name)
+	}
+	for _, pj := range queued {
+		c.queued.Insert(pj.ObjectMeta.Name)
+	}
+	c.admissionsGeneration, c.admissionsConfig = generation, cfg
+	return admitted, queued, nil
+}
+
+// admissionsCurrent determines whether the cached admission decisions still
+// hold. The caller must hold the admission lock.
+func (c *Controller) admissionsCurrent() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.admitted != nil && c.admissionsGeneration == c.generation && c.admissionsConfig == c.config()
+}
+
+// admit determines whether a triggered ProwJob can be started now and
+// reserves capacity for it if so. The triggered ProwJobs are only ordered
+// again if the cached decisions do not hold anymore or do not cover the
+// ProwJob yet, so that syncing all of them does not take quadratic time.
+func (c *Controller) admit(pj *prowapi.ProwJob) (bool, error) {
+	c.admission.Lock()
+	defer c.admission.Unlock()
+	name := pj.ObjectMeta.Name
+	if c.started.Has(name) {
+		return true, nil
+	}
+	if !c.admissionsCurrent() || (!c.admitted.Has(name) && !c.queued.Has(name)) {
+		if _, _, err := c.admissions(); err != nil {
+			return false, err
+		}
+	}
+	if !c.admitted.Has(name) {
+		return false, nil
+	}
+	c.admitted.Delete(name)
+	c.started.Insert(name)
+	return true, nil
 }
 
 // setPreviousReportState sets the github key for PrevReportStates
@@ -165,97 +609,151 @@ func (c *Controller) setPreviousReportState(pj prowapi.ProwJob) error {
 	return err
 }
 
-// Sync does one sync iteration.
-func (c *Controller) Sync() error {
-	pjs, err := c.kc.ListProwJobs(c.selector)
+// syncProwJob syncs a ProwJob with its pod. It aborts presubmits that have
+// a newer run, starts the pods of triggered ProwJobs once they are admitted,
+// updates pending ProwJobs when their pods change and stops the pods of
+// aborted ProwJobs.
+func (c *Controller) syncProwJob(name string) error {
+	pj, exists, err := c.getProwJob(name)
 	if err != nil {
-		return fmt.Errorf("error listing prow jobs: %v", err)
+		return fmt.Errorf("error getting prowjob: %v", err)
 	}
-	selector := fmt.Sprintf("%s=true", kube.CreatedByProw)
-	if len(c.selector) > 0 {
-		selector = strings.Join([]string{c.selector, selector}, ",")
+	if !exists || pj.Spec.Agent != prowapi.KubernetesAgent {
+		return nil
+	}
+	if pj.Complete() {
+		return c.stopAbortedPod(pj)
 	}
 
-	pm := map[string]kube.Pod{}
-	for alias, client := range c.pkcs {
-		pods, err := client.ListPods(selector)
-		if err != nil {
-			return fmt.Errorf("error listing pods in cluster %q: %v", alias, err)
-		}
-		for _, pod := range pods {
-			pm[pod.ObjectMeta.Name] = pod
+	if aborted, err := c.terminateDupesOf(pj); err != nil || aborted {
+		return err
+	}
+
+	if pj.Spec.Cluster == "" && len(pj.Spec.Clusters) > 0 {
+		if pj.Spec.Cluster, err = c.scheduledCluster(pj); err != nil {
+			return err
 		}
 	}
-	// TODO: Replace the following filtering with a field selector once CRDs support field selectors.
-	// https://github.com/kubernetes/kubernetes/issues/53459
-	var k8sJobs []prowapi.ProwJob
-	for _, pj := range pjs {
-		if pj.Spec.Agent == prowapi.KubernetesAgent {
-			k8sJobs = append(k8sJobs, pj)
+	pm, err := c.podMap(*pj)
+	if err != nil {
+		return err
+	}
+	reports := make(chan prowapi.ProwJob, 1)
+	switch pj.Status.State {
+	case prowapi.PendingState:
+		err = c.syncPendingJob(*pj, pm, reports)
+	case prowapi.TriggeredState:
+		var admitted bool
+		if _, podExists := pm[pj.ObjectMeta.Name]; podExists {
+			admitted = true
+		} else if admitted, err = c.admit(pj); err != nil {
+			return fmt.Errorf("error admitting prowjob: %v", err)
+		}
+		if !admitted {
+			c.log.WithFields(pjutil.ProwJobFields(pj)).Debug("Prowjob is queued.")
+			return nil
 		}
+		err = c.startTriggeredJob(*pj, pm, reports)
 	}
-	pjs = k8sJobs
-
-	var syncErrs []error
-	if err := c.terminateDupes(pjs, pm); err != nil {
-		syncErrs = append(syncErrs, err)
+	close(reports)
+	for report := range reports {
+		c.report(report)
 	}
+	return err
+}
 
-	// Share what we have for gathering metrics.
-	c.pjLock.Lock()
-	c.pjs = pjs
-	c.pjLock.Unlock()
-
-	pendingCh, triggeredCh := pjutil.PartitionActive(pjs)
-	errCh := make(chan error, len(pjs))
-	reportCh := make(chan prowapi.ProwJob, len(pjs))
-
-	// Reinstantiate on every resync of the controller instead of trying
-	// to keep this in sync with the state of the world.
-	c.pendingJobs = make(map[string]int)
-	// Sync pending jobs first so we can determine what is the maximum
-	// number of new jobs we can trigger when syncing the non-pendings.
-	maxSyncRoutines := c.config().Plank.MaxGoroutines
-	c.log.Debugf("Handling %d pending prowjobs", len(pendingCh))
-	syncProwJobs(c.log, c.syncPendingJob, maxSyncRoutines, pendingCh, reportCh, errCh, pm)
-	c.log.Debugf("Handling %d triggered prowjobs", len(triggeredCh))
-	syncProwJobs(c.log, c.syncTriggeredJob, maxSyncRoutines, triggeredCh, reportCh, errCh, pm)
-
-	close(errCh)
-	close(reportCh)
-
-	for err := range errCh {
-		syncErrs = append(syncErrs, err)
-	}
-
-	var reportErrs []error
-	if !c.skipReport {
-		reportTemplate := c.config().Plank.ReportTemplate
-		reportTypes := c.config().GitHubReporter.JobTypesToReport
-		for report := range reportCh {
-			if err := reportlib.Report(c.ghc, reportTemplate, report, reportTypes); err != nil {
-				reportErrs = append(reportErrs, err)
-				c.log.WithFields(pjutil.ProwJobFields(&report)).WithError(err).Warn("Failed to report ProwJob status")
-			}
-
-			// plank is not retrying on errors, so we just set the current state as reported
-			if err := c.setPreviousReportState(report); err != nil {
-				c.log.WithFields(pjutil.ProwJobFields(&report)).WithError(err).Error("Failed to patch PrevReportStates")
-			}
+// terminateDupesOf aborts the runs of a presubmit for older commits of the
+// same PR, which may be the given presubmit. It returns whether the given
+// presubmit was aborted.
+func (c *Controller) terminateDupesOf(pj *prowapi.ProwJob) (bool, error) {
+	keys, err := dupeIndexFunc(pj)
+	if err != nil || len(keys) == 0 {
+		return false, err
+	}
+	objs, err := c.pjIndexer.ByIndex(dupeIndex, keys[0])
+	if err != nil {
+		return false, fmt.Errorf("error getting duplicate prowjobs: %v", err)
+	}
+	if len(objs) < 2 {
+		return false, nil
+	}
+	var dupes []prowapi.ProwJob
+	for _, obj := range objs {
+		if dupe, ok := obj.(*prowapi.ProwJob); ok {
+			dupes = append(dupes, *dupe.DeepCopy())
 		}
 	}
+	pm, err := c.podMap(dupes...)
+	if err != nil {
+		return false, err
+	}
+	if err := c.terminateDupes(dupes, pm); err != nil {
+		return false, err
+	}
+	for _, dupe := range dupes {
+		if dupe.ObjectMeta.Name == pj.ObjectMeta.Name {
+			return dupe.Complete(), nil
+		}
+	}
+	return false, nil
+}
 
-	if len(syncErrs) == 0 && len(reportErrs) == 0 {
+// stopAbortedPod deletes the pod of a ProwJob that was aborted while its pod
+// ran, like a presubmit for a PR that was closed or updated, if cancellations
+// are allowed.
+func (c *Controller) stopAbortedPod(pj *prowapi.ProwJob) error {
+	if pj.Status.State != prowapi.AbortedState || !c.config().Plank.AllowCancellations {
+		return nil
+	}
+	pm, err := c.podMap(*pj)
+	if err != nil {
+		return err
+	}
+	pod, exists := pm[pj.ObjectMeta.Name]
+	if !exists || pod.DeletionTimestamp != nil || (pod.Status.Phase != coreapi.PodPending && pod.Status.Phase != coreapi.PodRunning) {
 		return nil
 	}
-	return fmt.Errorf("errors syncing: %v, errors reporting: %v", syncErrs, reportErrs)
+	client, ok := c.pkcs[pj.ClusterAlias()]
+	if !ok {
+		return fmt.Errorf("unknown cluster alias %q", pj.ClusterAlias())
+	}
+	c.log.WithFields(pjutil.ProwJobFields(pj)).Info("Deleting the pod of the aborted prowjob.")
+	if err := client.DeletePod(pod.ObjectMeta.Name); err != nil {
+		if _, notFound := err.(kube.NotFoundError); !notFound {
+			return fmt.Errorf("error deleting the pod of the aborted prowjob: %v", err)
+		}
+	}
+	return nil
+}
+
+// report reports the status of a ProwJob to GitHub.
+func (c *Controller) report(pj prowapi.ProwJob) {
+	if c.skipReport {
+		return
+	}
+	reportTemplate := c.config().Plank.ReportTemplate
+	reportTypes := c.config().GitHubReporter.JobTypesToReport
+	if err := reportlib.Report(c.ghc, reportTemplate, pj, reportTypes); err != nil {
+		c.log.WithFields(pjutil.ProwJobFields(&pj)).WithError(err).Warn("Failed to report ProwJob status")
+	}
+
+	// plank is not retrying on errors, so we just set the current state as reported
+	if err := c.setPreviousReportState(pj); err != nil {
+		c.log.WithFields(pjutil.ProwJobFields(&pj)).WithError(err).Error("Failed to patch PrevReportStates")
+	}
 }
 
 // SyncMetrics records metrics for the cached prowjobs.
 func (c *Controller) SyncMetrics() {
-	c.pjLock.RLock()
-	defer c.pjLock.RUnlock()
-	kube.GatherProwJobMetrics(c.pjs)
+	kube.GatherProwJobMetrics(c.listProwJobs())
+	c.admission.Lock()
+	_, queued, err := c.admissions()
+	c.admission.Unlock()
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to determine the queued prowjobs.")
+		return
+	}
+	gatherQueueMetrics(queued)
 }
 
 // terminateDupes aborts presubmits that have a newer version. It modifies pjs
@@ -306,34 +804,78 @@ func (c *Controller) terminateDupes(pjs []prowapi.ProwJob, pm map[string]coreapi
 	return nil
 }
 
-// TODO: Dry this out
-func syncProwJobs(
-	l *logrus.Entry,
-	syncFn syncFn,
-	maxSyncRoutines int,
-	jobs <-chan prowapi.ProwJob,
-	reports chan<- prowapi.ProwJob,
-	syncErrors chan<- error,
-	pm map[string]coreapi.Pod,
-) {
-	goroutines := maxSyncRoutines
-	if goroutines > len(jobs) {
-		goroutines = len(jobs)
-	}
-	wg := &sync.WaitGroup{}
-	wg.Add(goroutines)
-	l.Debugf("Firing up %d goroutines", goroutines)
-	for i := 0; i < goroutines; i++ {
-		go func() {
-			defer wg.Done()
-			for pj := range jobs {
-				if err := syncFn(pj, pm, reports); err != nil {
-					syncErrors <- err
-				}
-			}
-		}()
+// derivedName returns the name of a ProwJob that plank creates on behalf of
+// the ProwJob with the given name. The name only depends on its inputs, so a
+// sync that is repeated because the parent could not be updated or was read
+// from a stale cache finds the ProwJob it created before.
+func derivedName(parent, purpose string) string {
+	return uuid.NewV5(uuid.NamespaceOID, parent+"/"+purpose).String()
+}
+
+// createDerivedProwJob creates a ProwJob with a derived name, treating one
+// that exists already as created.
+func (c *Controller) createDerivedProwJob(pj prowapi.ProwJob) error {
+	if _, err := c.kc.CreateProwJob(pj); err != nil {
+		if _, exists := err.(kube.ConflictError); !exists {
+			return err
+		}
+		c.log.WithFields(pjutil.ProwJobFields(&pj)).Debug("Prowjob exists already.")
 	}
-	wg.Wait()
+	return nil
+}
+
+// startNextJobs creates the ProwJobs that are configured to run after the
+// given ProwJob has completed successfully.
+func (c *Controller) startNextJobs(pj prowapi.ProwJob) error {
+	for _, nj := range pj.Spec.RunAfterSuccess {
+		labels := map[string]string{kube.ParentJobLabel: pj.ObjectMeta.Name}
+		if guid, ok := pj.ObjectMeta.Labels[github.EventGUID]; ok {
+			labels[github.EventGUID] = guid
+		}
+		child := pjutil.NewProwJob(nj, labels)
+		child.ObjectMeta.Name = derivedName(pj.ObjectMeta.Name, "run-after-success/"+nj.Job)
+		c.log.WithFields(pjutil.ProwJobFields(&child)).WithField("parent", pj.ObjectMeta.Name).Info("Creating next prowjob.")
+		if err := c.createDerivedProwJob(child); err != nil {
+			return fmt.Errorf("error starting next prowjob %s: %v", nj.Job, err)
+		}
+	}
+	return nil
+}
+
+// retryJob creates a new attempt at running the given ProwJob if its retry
+// policy allows retrying the failure class, completing the given ProwJob as
+// errored and linking both attempts. It returns whether a retry was started.
+func (c *Controller) retryJob(pj *prowapi.ProwJob, reason prowapi.RetryReason, description string) (bool, error) {
+	if !pj.Spec.Retry.ShouldRetry(reason, pj.Status.Retries) {
+		return false, nil
+	}
+	next := pjutil.NewProwJobWithAnnotation(pj.Spec, pj.ObjectMeta.Labels, pj.ObjectMeta.Annotations)
+	// The job was approved already if it needed to be, along with the
+	// approval annotations that the next attempt carries over.
+	next.Status.State = prowapi.TriggeredState
+	next.Status.Retries = pj.Status.Retries + 1
+	next.Status.PrevAttempt = pj.ObjectMeta.Name
+	next.ObjectMeta.Name = derivedName(pj.ObjectMeta.Name, "retry")
+	c.log.WithFields(pjutil.ProwJobFields(pj)).WithField("reason", reason).WithField("next", next.ObjectMeta.Name).Info("Retrying prowjob.")
+	if err := c.createDerivedProwJob(next); err != nil {
+		return false, fmt.Errorf("error creating next attempt of prowjob %s: %v", pj.ObjectMeta.Name, err)
+	}
+	pj.SetComplete()
+	pj.Status.State = prowapi.ErrorState
+	pj.Status.Description = fmt.Sprintf("%s Retrying (attempt %d of %d).", description, next.Status.Retries+1, pj.Spec.Retry.MaxAttempts)
+	pj.Status.NextAttempt = next.ObjectMeta.Name
+	return true, nil
+}
+
+// cloneFailed determines if the pod failed because the refs could not be
+// cloned, which the initupload container reports by exiting with an error.
+func cloneFailed(pod coreapi.Pod) bool {
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name == decorate.InitUploadName && status.State.Terminated != nil && status.State.Terminated.ExitCode != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error {
@@ -342,10 +884,9 @@ func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Po
 
 	pod, podExists := pm[pj.ObjectMeta.Name]
 	if !podExists {
-		c.incrementNumPendingJobs(pj.Spec.Job)
 		// Pod is missing. This can happen in case the previous pod was deleted manually or by
 		// a rescheduler. Start a new pod.
-		id, pn, err := c.startPod(pj)
+		id, pn, err := c.startPod(&pj)
 		if err != nil {
 			_, isUnprocessable := err.(kube.UnprocessableEntityError)
 			if !isUnprocessable {
@@ -363,7 +904,6 @@ func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Po
 	} else {
 		switch pod.Status.Phase {
 		case coreapi.PodUnknown:
-			c.incrementNumPendingJobs(pj.Spec.Job)
 			// Pod is in Unknown state. This can happen if there is a problem with
 			// the node. Delete the old pod, we'll start a new one next loop.
 			c.log.WithFields(pjutil.ProwJobFields(&pj)).Info("Pod is in unknown state, deleting & restarting pod")
@@ -378,10 +918,20 @@ func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Po
 			pj.SetComplete()
 			pj.Status.State = prowapi.SuccessState
 			pj.Status.Description = "Job succeeded."
+			if err := c.startNextJobs(pj); err != nil {
+				return err
+			}
 
 		case coreapi.PodFailed:
 			if pod.Status.Reason == kube.Evicted {
 				// Pod was evicted.
+				retried, err := c.retryJob(&pj, prowapi.RetryOnEviction, "Job pod was evicted by the cluster.")
+				if err != nil {
+					return err
+				}
+				if retried {
+					break
+				}
 				if pj.Spec.ErrorOnEviction {
 					// ErrorOnEviction is enabled, complete the PJ and mark it as errored.
 					pj.SetComplete()
@@ -391,13 +941,21 @@ func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Po
 				}
 				// ErrorOnEviction is disabled. Delete the pod now and recreate it in
 				// the next resync.
-				c.incrementNumPendingJobs(pj.Spec.Job)
 				client, ok := c.pkcs[pj.ClusterAlias()]
 				if !ok {
 					return fmt.Errorf("unknown cluster alias %q", pj.ClusterAlias())
 				}
 				return client.DeletePod(pj.ObjectMeta.Name)
 			}
+			if cloneFailed(pod) {
+				retried, err := c.retryJob(&pj, prowapi.RetryOnCloneFailure, "Cloning the refs failed.")
+				if err != nil {
+					return err
+				}
+				if retried {
+					break
+				}
+			}
 			// Pod failed. Update ProwJob, talk to GitHub.
 			pj.SetComplete()
 			pj.Status.State = prowapi.FailureState
@@ -407,15 +965,20 @@ func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Po
 			maxPodPending := c.config().Plank.PodPendingTimeout
 			if pod.Status.StartTime.IsZero() || time.Since(pod.Status.StartTime.Time) < maxPodPending {
 				// Pod is running. Do nothing.
-				c.incrementNumPendingJobs(pj.Spec.Job)
 				return nil
 			}
 
 			// Pod is stuck in pending state longer than maxPodPending
-			// abort the job, and talk to GitHub
-			pj.SetComplete()
-			pj.Status.State = prowapi.ErrorState
-			pj.Status.Description = "Pod pending timeout."
+			// abort the job, retry it if possible, and talk to GitHub
+			retried, err := c.retryJob(&pj, prowapi.RetryOnPodPendingTimeout, "Pod pending timeout.")
+			if err != nil {
+				return err
+			}
+			if !retried {
+				pj.SetComplete()
+				pj.Status.State = prowapi.ErrorState
+				pj.Status.Description = "Pod pending timeout."
+			}
 			client, ok := c.pkcs[pj.ClusterAlias()]
 			if !ok {
 				return fmt.Errorf("unknown cluster alias %q", pj.ClusterAlias())
@@ -427,7 +990,6 @@ func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Po
 
 		default:
 			// Pod is running. Do nothing.
-			c.incrementNumPendingJobs(pj.Spec.Job)
 			return nil
 		}
 	}
@@ -445,7 +1007,8 @@ func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Po
 	return err
 }
 
-func (c *Controller) syncTriggeredJob(pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error {
+// startTriggeredJob starts a triggered ProwJob that has been admitted.
+func (c *Controller) startTriggeredJob(pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error {
 	// Record last known state so we can log state transitions.
 	prevState := pj.Status.State
 
@@ -456,13 +1019,9 @@ func (c *Controller) syncTriggeredJob(pj prowapi.ProwJob, pm map[string]coreapi.
 	// sync but the prowjob update fails. Simply ignore creating a new pod
 	// and rerun the prowjob update.
 	if !podExists {
-		// Do not start more jobs than specified.
-		if !c.canExecuteConcurrently(&pj) {
-			return nil
-		}
 		// We haven't started the pod yet. Do so.
 		var err error
-		id, pn, err = c.startPod(pj)
+		id, pn, err = c.startPod(&pj)
 		if err != nil {
 			_, isUnprocessable := err.(kube.UnprocessableEntityError)
 			if !isUnprocessable {
@@ -496,27 +1055,38 @@ func (c *Controller) syncTriggeredJob(pj prowapi.ProwJob, pm map[string]coreapi.
 	return err
 }
 
+// startPod creates the pod of a ProwJob in the build cluster selected for
+// it, which is recorded in the ProwJob.
 // TODO: No need to return the pod name since we already have the
 // prowjob in the call site.
-func (c *Controller) startPod(pj prowapi.ProwJob) (string, string, error) {
+func (c *Controller) startPod(pj *prowapi.ProwJob) (string, string, error) {
 	buildID, err := c.getBuildID(pj.Spec.Job)
 	if err != nil {
 		return "", "", fmt.Errorf("error getting build ID: %v", err)
 	}
 
-	pod, err := decorate.ProwJobToPod(pj, buildID)
+	pod, err := decorate.ProwJobToPod(*pj, buildID)
 	if err != nil {
 		return "", "", err
 	}
 
-	client, ok := c.pkcs[pj.ClusterAlias()]
+	alias, err := c.selectCluster(pj)
+	if err != nil {
+		return "", "", err
+	}
+	client, ok := c.pkcs[alias]
 	if !ok {
-		return "", "", fmt.Errorf("unknown cluster alias %q", pj.ClusterAlias())
+		c.releasePod(alias, pj.ObjectMeta.Name)
+		return "", "", fmt.Errorf("unknown cluster alias %q", alias)
 	}
 	actual, err := client.CreatePod(*pod)
 	if err != nil {
+		c.releasePod(alias, pj.ObjectMeta.Name)
 		return "", "", err
 	}
+	if len(pj.Spec.Clusters) > 0 {
+		pj.Spec.Cluster = alias
+	}
 	return buildID, actual.ObjectMeta.Name, nil
 }
 
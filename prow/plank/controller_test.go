@@ -30,6 +30,8 @@ import (
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
@@ -37,6 +39,7 @@ import (
 	"k8s.io/test-infra/prow/github/reporter"
 	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/pjutil"
+	"k8s.io/test-infra/prow/pod-utils/decorate"
 )
 
 type fca struct {
@@ -110,6 +113,11 @@ type fkc struct {
 func (f *fkc) CreateProwJob(pj prowapi.ProwJob) (prowapi.ProwJob, error) {
 	f.Lock()
 	defer f.Unlock()
+	for _, existing := range f.prowjobs {
+		if existing.ObjectMeta.Name == pj.ObjectMeta.Name {
+			return prowapi.ProwJob{}, kube.NewConflictError(fmt.Errorf("prowjob %s already exists", pj.ObjectMeta.Name))
+		}
+	}
 	f.prowjobs = append(f.prowjobs, pj)
 	return pj, nil
 }
@@ -711,36 +719,35 @@ func TestSyncTriggeredJobs(t *testing.T) {
 	for _, tc := range testcases {
 		totServ := httptest.NewServer(http.HandlerFunc(handleTot))
 		defer totServ.Close()
-		pm := make(map[string]kube.Pod)
-		for _, pods := range tc.pods {
-			for i := range pods {
-				pm[pods[i].ObjectMeta.Name] = pods[i]
-			}
+		if tc.pj.ObjectMeta.Name == "" {
+			tc.pj.ObjectMeta.Name = "triggered"
 		}
+		tc.pj.Spec.Agent = prowapi.KubernetesAgent
 		fc := &fkc{
 			prowjobs: []prowapi.ProwJob{tc.pj},
 		}
 		pkcs := map[string]kubeClient{}
+		buildClusters := map[string]*fkc{}
 		for alias, pods := range tc.pods {
-			pkcs[alias] = &fkc{
+			buildClusters[alias] = &fkc{
 				pods: pods,
 				err:  tc.podErr,
 			}
+			pkcs[alias] = buildClusters[alias]
 		}
 		c := Controller{
-			kc:          fc,
-			pkcs:        pkcs,
-			log:         logrus.NewEntry(logrus.StandardLogger()),
-			config:      newFakeConfigAgent(t, tc.maxConcurrency).Config,
-			totURL:      totServ.URL,
-			pendingJobs: make(map[string]int),
-		}
-		if tc.pendingJobs != nil {
-			c.pendingJobs = tc.pendingJobs
+			kc:      fc,
+			pkcs:    pkcs,
+			ghc:     &fghc{},
+			log:     logrus.NewEntry(logrus.StandardLogger()),
+			config:  newFakeConfigAgent(t, tc.maxConcurrency).Config,
+			totURL:  totServ.URL,
+			started: sets.NewString(),
 		}
+		setCaches(t, &c, fc, buildClusters)
+		cachePendingJobs(t, &c, tc.pendingJobs)
 
-		reports := make(chan prowapi.ProwJob, 100)
-		if err := c.syncTriggeredJob(tc.pj, pm, reports); (err != nil) != tc.expectError {
+		if err := c.syncProwJob(tc.pj.ObjectMeta.Name); (err != nil) != tc.expectError {
 			if tc.expectError {
 				t.Errorf("for case %q expected an error, but got none", tc.name)
 			} else {
@@ -748,15 +755,6 @@ func TestSyncTriggeredJobs(t *testing.T) {
 			}
 			continue
 		}
-		close(reports)
-
-		numReports := len(reports)
-		// for asserting recorded report states
-		for report := range reports {
-			if err := c.setPreviousReportState(report); err != nil {
-				t.Errorf("for case %q got error in setPreviousReportState : %v", tc.name, err)
-			}
-		}
 
 		actual := fc.prowjobs[0]
 		if actual.Status.State != tc.expectedState {
@@ -776,11 +774,9 @@ func TestSyncTriggeredJobs(t *testing.T) {
 		if len(fc.prowjobs) != tc.expectedCreatedPJs+1 {
 			t.Errorf("for case %q got %d created prowjobs", tc.name, len(fc.prowjobs)-1)
 		}
-		if tc.expectedReport && numReports != 1 {
-			t.Errorf("for case %q wanted one report but got %d", tc.name, numReports)
-		}
-		if !tc.expectedReport && numReports != 0 {
-			t.Errorf("for case %q did not want any reports but got %d", tc.name, numReports)
+		// Reports record the reported state.
+		if reported := actual.Status.PrevReportStates != nil; reported != tc.expectedReport {
+			t.Errorf("for case %q wanted a report: %t, got one: %t", tc.name, tc.expectedReport, reported)
 		}
 		if !reflect.DeepEqual(tc.expectPrevReportState, actual.Status.PrevReportStates) {
 			t.Errorf("for case %q want prev report state %v, got %v", tc.name, tc.expectPrevReportState, actual.Status.PrevReportStates)
@@ -814,6 +810,7 @@ func TestSyncPendingJob(t *testing.T) {
 		expectedNumPods    int
 		expectedComplete   bool
 		expectedCreatedPJs int
+		expectedRetry      bool
 		expectedReport     bool
 		expectedURL        string
 	}{
@@ -898,6 +895,47 @@ func TestSyncPendingJob(t *testing.T) {
 			expectedReport:     true,
 			expectedURL:        "boop-42/success",
 		},
+		{
+			name: "succeeded pod starts next jobs",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-42",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Type:    prowapi.PostsubmitJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+					Refs:    &prowapi.Refs{Org: "fejtaverse"},
+					RunAfterSuccess: []prowapi.ProwJobSpec{
+						{
+							Job:     "next-job",
+							Type:    prowapi.PostsubmitJob,
+							PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+							Refs:    &prowapi.Refs{Org: "fejtaverse"},
+						},
+					},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "boop-42",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase: kube.PodSucceeded,
+					},
+				},
+			},
+			expectedComplete:   true,
+			expectedState:      prowapi.SuccessState,
+			expectedNumPods:    1,
+			expectedCreatedPJs: 1,
+			expectedReport:     true,
+			expectedURL:        "boop-42/success",
+		},
 		{
 			name: "failed pod",
 			pj: prowapi.ProwJob{
@@ -995,6 +1033,180 @@ func TestSyncPendingJob(t *testing.T) {
 			expectedReport:   true,
 			expectedURL:      "boop-42/error",
 		},
+		{
+			name: "evicted pod w/ retry policy, complete PJ and start next attempt",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-42",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Retry:   &prowapi.RetryPolicy{MaxAttempts: 2, On: []prowapi.RetryReason{prowapi.RetryOnEviction}},
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "boop-42",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase:  kube.PodFailed,
+						Reason: kube.Evicted,
+					},
+				},
+			},
+			expectedComplete:   true,
+			expectedState:      prowapi.ErrorState,
+			expectedNumPods:    1,
+			expectedCreatedPJs: 1,
+			expectedRetry:      true,
+			expectedReport:     true,
+			expectedURL:        "boop-42/error",
+		},
+		{
+			name: "evicted pod of approved job w/ retry policy, start next attempt w/o approval",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "boop-42",
+					Annotations: map[string]string{kube.ApprovedByAnnotation: "someone"},
+				},
+				Spec: prowapi.ProwJobSpec{
+					Retry:     &prowapi.RetryPolicy{MaxAttempts: 2, On: []prowapi.RetryReason{prowapi.RetryOnEviction}},
+					Approvers: []string{"someone"},
+					PodSpec:   &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "boop-42",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase:  kube.PodFailed,
+						Reason: kube.Evicted,
+					},
+				},
+			},
+			expectedComplete:   true,
+			expectedState:      prowapi.ErrorState,
+			expectedNumPods:    1,
+			expectedCreatedPJs: 1,
+			expectedRetry:      true,
+			expectedReport:     true,
+			expectedURL:        "boop-42/error",
+		},
+		{
+			name: "evicted pod w/ exhausted retries, delete pod",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-42",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Retry:   &prowapi.RetryPolicy{MaxAttempts: 2},
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "boop-42",
+					Retries: 1,
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase:  kube.PodFailed,
+						Reason: kube.Evicted,
+					},
+				},
+			},
+			expectedComplete: false,
+			expectedState:    prowapi.PendingState,
+			expectedNumPods:  0,
+		},
+		{
+			name: "clone failure w/ retry policy, complete PJ and start next attempt",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-42",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Retry:   &prowapi.RetryPolicy{MaxAttempts: 3, On: []prowapi.RetryReason{prowapi.RetryOnCloneFailure}},
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "boop-42",
+					Retries: 1,
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase: kube.PodFailed,
+						InitContainerStatuses: []v1.ContainerStatus{
+							{
+								Name: decorate.InitUploadName,
+								State: v1.ContainerState{
+									Terminated: &v1.ContainerStateTerminated{ExitCode: 1},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedComplete:   true,
+			expectedState:      prowapi.ErrorState,
+			expectedNumPods:    1,
+			expectedCreatedPJs: 1,
+			expectedRetry:      true,
+			expectedReport:     true,
+			expectedURL:        "boop-42/error",
+		},
+		{
+			name: "failure w/o clone failure is not retried",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-42",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Retry:   &prowapi.RetryPolicy{MaxAttempts: 3},
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "boop-42",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase: kube.PodFailed,
+					},
+				},
+			},
+			expectedComplete: true,
+			expectedState:    prowapi.FailureState,
+			expectedNumPods:  1,
+			expectedReport:   true,
+			expectedURL:      "boop-42/failure",
+		},
 		{
 			name: "running pod",
 			pj: prowapi.ProwJob{
@@ -1146,6 +1358,21 @@ func TestSyncPendingJob(t *testing.T) {
 		if len(fc.prowjobs) != tc.expectedCreatedPJs+1 {
 			t.Errorf("for case %q got %d created prowjobs", tc.name, len(fc.prowjobs)-1)
 		}
+		for _, created := range fc.prowjobs[1:] {
+			if tc.expectedRetry {
+				if created.Status.PrevAttempt != tc.pj.ObjectMeta.Name || actual.Status.NextAttempt != created.ObjectMeta.Name {
+					t.Errorf("for case %q attempts are not linked: %q -> %q -> %q", tc.name, created.Status.PrevAttempt, actual.Status.NextAttempt, created.ObjectMeta.Name)
+				}
+				if created.Status.Retries != tc.pj.Status.Retries+1 {
+					t.Errorf("for case %q created prowjob has %d retries, expected %d", tc.name, created.Status.Retries, tc.pj.Status.Retries+1)
+				}
+			} else if parent := created.ObjectMeta.Labels[kube.ParentJobLabel]; parent != tc.pj.ObjectMeta.Name {
+				t.Errorf("for case %q created prowjob has parent %q, expected %q", tc.name, parent, tc.pj.ObjectMeta.Name)
+			}
+			if created.Status.State != prowapi.TriggeredState {
+				t.Errorf("for case %q created prowjob is in state %v, expected triggered", tc.name, created.Status.State)
+			}
+		}
 		if tc.expectedReport && len(reports) != 1 {
 			t.Errorf("for case %q wanted one report but got %d", tc.name, len(reports))
 		}
@@ -1162,6 +1389,46 @@ func TestSyncPendingJob(t *testing.T) {
 	}
 }
 
+// setCaches fills the caches of the controller with the ProwJobs and pods of
+// the fake clients, like the informers do.
+func setCaches(t *testing.T, c *Controller, fc *fkc, buildClusters map[string]*fkc) {
+	c.pjIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{dupeIndex: dupeIndexFunc})
+	for i := range fc.prowjobs {
+		if err := c.pjIndexer.Add(fc.prowjobs[i].DeepCopy()); err != nil {
+			t.Fatalf("Failed to cache prowjob: %v", err)
+		}
+	}
+	c.podIndexers = map[string]cache.Indexer{}
+	for alias, client := range buildClusters {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for i := range client.pods {
+			pod := client.pods[i].DeepCopy()
+			if err := indexer.Add(pod); err != nil {
+				t.Fatalf("Failed to cache pod: %v", err)
+			}
+			c.trackPod(alias, pod, false)
+		}
+		c.podIndexers[alias] = indexer
+	}
+}
+
+// cachePendingJobs adds pending ProwJobs to the cache of a Controller, by
+// job name.
+func cachePendingJobs(t *testing.T, c *Controller, pendingJobs map[string]int) {
+	for job, num := range pendingJobs {
+		for i := 0; i < num; i++ {
+			pj := &prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-pending-%d", job, i)},
+				Spec:       prowapi.ProwJobSpec{Job: job, Agent: prowapi.KubernetesAgent},
+				Status:     prowapi.ProwJobStatus{State: prowapi.PendingState},
+			}
+			if err := c.pjIndexer.Add(pj); err != nil {
+				t.Fatalf("Failed to cache prowjob: %v", err)
+			}
+		}
+	}
+}
+
 // TestPeriodic walks through the happy path of a periodic job.
 func TestPeriodic(t *testing.T) {
 	per := config.Periodic{
@@ -1178,17 +1445,22 @@ func TestPeriodic(t *testing.T) {
 	fc := &fkc{
 		prowjobs: []prowapi.ProwJob{pjutil.NewProwJob(pjutil.PeriodicSpec(per), nil)},
 	}
+	defaultCluster := &fkc{}
 	c := Controller{
 		kc:          fc,
 		ghc:         &fghc{},
-		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: &fkc{}, "trusted": fc},
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: defaultCluster, "trusted": fc},
 		log:         logrus.NewEntry(logrus.StandardLogger()),
 		config:      newFakeConfigAgent(t, 0).Config,
 		totURL:      totServ.URL,
 		pendingJobs: make(map[string]int),
-		lock:        sync.RWMutex{},
+		started:     sets.NewString(),
+	}
+	sync := func() error {
+		setCaches(t, &c, fc, map[string]*fkc{kube.DefaultClusterAlias: defaultCluster, "trusted": fc})
+		return c.syncProwJob(fc.prowjobs[0].ObjectMeta.Name)
 	}
-	if err := c.Sync(); err != nil {
+	if err := sync(); err != nil {
 		t.Fatalf("Error on first sync: %v", err)
 	}
 	if len(fc.prowjobs[0].Spec.PodSpec.Containers) != 1 || fc.prowjobs[0].Spec.PodSpec.Containers[0].Name != "test-name" {
@@ -1203,14 +1475,14 @@ func TestPeriodic(t *testing.T) {
 	if len(fc.pods[0].Spec.Containers[0].Env) == 0 {
 		t.Fatal("Container has no env set.")
 	}
-	if err := c.Sync(); err != nil {
+	if err := sync(); err != nil {
 		t.Fatalf("Error on second sync: %v", err)
 	}
 	if len(fc.pods) != 1 {
 		t.Fatalf("Wrong number of pods after second sync: %d", len(fc.pods))
 	}
 	fc.pods[0].Status.Phase = kube.PodSucceeded
-	if err := c.Sync(); err != nil {
+	if err := sync(); err != nil {
 		t.Fatalf("Error on third sync: %v", err)
 	}
 	if !fc.prowjobs[0].Complete() {
@@ -1222,7 +1494,7 @@ func TestPeriodic(t *testing.T) {
 	if len(fc.prowjobs) != 1 {
 		t.Fatalf("Wrong number of prow jobs: %d", len(fc.prowjobs))
 	}
-	if err := c.Sync(); err != nil {
+	if err := sync(); err != nil {
 		t.Fatalf("Error on fourth sync: %v", err)
 	}
 }
@@ -1331,31 +1603,351 @@ func TestMaxConcurrencyWithNewlyTriggeredJobs(t *testing.T) {
 
 	for _, test := range tests {
 		t.Logf("Running scenario %q", test.name)
-		jobs := make(chan prowapi.ProwJob, len(test.pjs))
-		for _, pj := range test.pjs {
-			jobs <- pj
+		for i := range test.pjs {
+			test.pjs[i].ObjectMeta.Name = fmt.Sprintf("triggered-%d", i)
+			test.pjs[i].Spec.Agent = prowapi.KubernetesAgent
 		}
-		close(jobs)
 
 		fc := &fkc{
 			prowjobs: test.pjs,
 		}
 		fpc := &fkc{}
 		c := Controller{
-			kc:          fc,
-			pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fpc},
-			log:         logrus.NewEntry(logrus.StandardLogger()),
-			config:      newFakeConfigAgent(t, 0).Config,
-			pendingJobs: test.pendingJobs,
+			kc:         fc,
+			pkcs:       map[string]kubeClient{kube.DefaultClusterAlias: fpc},
+			log:        logrus.NewEntry(logrus.StandardLogger()),
+			config:     newFakeConfigAgent(t, 0).Config,
+			started:    sets.NewString(),
+			skipReport: true,
 		}
+		setCaches(t, &c, fc, map[string]*fkc{kube.DefaultClusterAlias: fpc})
+		cachePendingJobs(t, &c, test.pendingJobs)
 
-		reports := make(chan prowapi.ProwJob, len(test.pjs))
-		errors := make(chan error, len(test.pjs))
-		pm := make(map[string]kube.Pod)
-
-		syncProwJobs(c.log, c.syncTriggeredJob, 20, jobs, reports, errors, pm)
+		// The cache is not updated between the syncs.
+		for _, pj := range test.pjs {
+			if err := c.syncProwJob(pj.ObjectMeta.Name); err != nil {
+				t.Errorf("unexpected error syncing triggered job: %v", err)
+			}
+		}
 		if len(fpc.pods) != test.expectedPods {
 			t.Errorf("expected pods: %d, got: %d", test.expectedPods, len(fpc.pods))
 		}
 	}
 }
+
+func TestSyncProwJob(t *testing.T) {
+	pj := func(name string, jobType prowapi.ProwJobType, state prowapi.ProwJobState, age time.Duration) prowapi.ProwJob {
+		pj := prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: prowapi.ProwJobSpec{
+				Job:     "test-bazel-build",
+				Type:    jobType,
+				Agent:   prowapi.KubernetesAgent,
+				PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				Refs: &prowapi.Refs{
+					Org:   "kubernetes",
+					Repo:  "kubernetes",
+					Pulls: []prowapi.Pull{{Number: 1}},
+				},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:     state,
+				StartTime: metav1.NewTime(time.Now().Add(-age)),
+			},
+		}
+		if state == prowapi.PendingState {
+			pj.Status.PodName = name
+		}
+		return pj
+	}
+	pod := func(name string, phase v1.PodPhase) kube.Pod {
+		return kube.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     v1.PodStatus{Phase: phase},
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		pjs            []prowapi.ProwJob
+		pods           []kube.Pod
+		maxConcurrency int
+		// allowCancellations allows deleting the pods of aborted jobs.
+		allowCancellations bool
+		// sync lists the ProwJobs to sync in order, without updating
+		// the caches in between.
+		sync           []string
+		expectedStates map[string]prowapi.ProwJobState
+		expectedPods   []string
+	}{
+		{
+			name:           "triggered job is started",
+			pjs:            []prowapi.ProwJob{pj("new", prowapi.PostsubmitJob, prowapi.TriggeredState, time.Minute)},
+			sync:           []string{"new"},
+			expectedStates: map[string]prowapi.ProwJobState{"new": prowapi.PendingState},
+			expectedPods:   []string{"new"},
+		},
+		{
+			name: "triggered job waits for a pending job",
+			pjs: []prowapi.ProwJob{
+				pj("running", prowapi.PostsubmitJob, prowapi.PendingState, time.Hour),
+				pj("new", prowapi.PostsubmitJob, prowapi.TriggeredState, time.Minute),
+			},
+			pods:           []kube.Pod{pod("running", v1.PodRunning)},
+			maxConcurrency: 1,
+			sync:           []string{"new"},
+			expectedStates: map[string]prowapi.ProwJobState{"running": prowapi.PendingState, "new": prowapi.TriggeredState},
+			expectedPods:   []string{"running"},
+		},
+		{
+			name: "admitted job counts before the cache shows it as pending",
+			pjs: []prowapi.ProwJob{
+				pj("first", prowapi.PostsubmitJob, prowapi.TriggeredState, time.Hour),
+				pj("second", prowapi.PostsubmitJob, prowapi.TriggeredState, time.Minute),
+			},
+			maxConcurrency: 1,
+			sync:           []string{"second", "first", "second"},
+			expectedStates: map[string]prowapi.ProwJobState{"first": prowapi.PendingState, "second": prowapi.TriggeredState},
+			expectedPods:   []string{"first"},
+		},
+		{
+			name: "pending job completes with its pod",
+			pjs: []prowapi.ProwJob{
+				pj("running", prowapi.PostsubmitJob, prowapi.PendingState, time.Hour),
+			},
+			pods:           []kube.Pod{pod("running", v1.PodSucceeded)},
+			sync:           []string{"running"},
+			expectedStates: map[string]prowapi.ProwJobState{"running": prowapi.SuccessState},
+			expectedPods:   []string{"running"},
+		},
+		{
+			name: "older run of a presubmit is aborted",
+			pjs: []prowapi.ProwJob{
+				pj("old", prowapi.PresubmitJob, prowapi.PendingState, time.Hour),
+				pj("new", prowapi.PresubmitJob, prowapi.TriggeredState, time.Minute),
+			},
+			pods:           []kube.Pod{pod("old", v1.PodRunning)},
+			sync:           []string{"old"},
+			expectedStates: map[string]prowapi.ProwJobState{"old": prowapi.AbortedState, "new": prowapi.TriggeredState},
+			expectedPods:   []string{"old"},
+		},
+		{
+			name: "complete and deleted jobs are ignored",
+			pjs: []prowapi.ProwJob{
+				pj("done", prowapi.PostsubmitJob, prowapi.SuccessState, time.Hour),
+			},
+			sync:           []string{"done", "deleted"},
+			expectedStates: map[string]prowapi.ProwJobState{"done": prowapi.SuccessState},
+		},
+		{
+			name: "pod of aborted job is deleted",
+			pjs: []prowapi.ProwJob{
+				pj("aborted", prowapi.PresubmitJob, prowapi.AbortedState, time.Hour),
+			},
+			pods:               []kube.Pod{pod("aborted", v1.PodRunning)},
+			allowCancellations: true,
+			sync:               []string{"aborted"},
+			expectedStates:     map[string]prowapi.ProwJobState{"aborted": prowapi.AbortedState},
+		},
+		{
+			name: "pod of aborted job is kept without cancellations",
+			pjs: []prowapi.ProwJob{
+				pj("aborted", prowapi.PresubmitJob, prowapi.AbortedState, time.Hour),
+			},
+			pods:           []kube.Pod{pod("aborted", v1.PodRunning)},
+			sync:           []string{"aborted"},
+			expectedStates: map[string]prowapi.ProwJobState{"aborted": prowapi.AbortedState},
+			expectedPods:   []string{"aborted"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+			defer totServ.Close()
+			for i := range tc.pjs {
+				if state := tc.pjs[i].Status.State; state == prowapi.SuccessState || state == prowapi.AbortedState {
+					tc.pjs[i].SetComplete()
+				}
+			}
+			fc := &fkc{prowjobs: tc.pjs}
+			fpc := &fkc{pods: tc.pods}
+			ca := newFakeConfigAgent(t, tc.maxConcurrency)
+			ca.c.Plank.AllowCancellations = tc.allowCancellations
+			c := Controller{
+				kc:          fc,
+				pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fpc},
+				log:         logrus.NewEntry(logrus.StandardLogger()),
+				config:      ca.Config,
+				totURL:      totServ.URL,
+				pendingJobs: make(map[string]int),
+				started:     sets.NewString(),
+				skipReport:  true,
+			}
+			setCaches(t, &c, fc, map[string]*fkc{kube.DefaultClusterAlias: fpc})
+
+			for _, name := range tc.sync {
+				if err := c.syncProwJob(name); err != nil {
+					t.Fatalf("Unexpected error syncing %s: %v", name, err)
+				}
+			}
+
+			states := map[string]prowapi.ProwJobState{}
+			for _, pj := range fc.prowjobs {
+				states[pj.ObjectMeta.Name] = pj.Status.State
+			}
+			if !reflect.DeepEqual(states, tc.expectedStates) {
+				t.Errorf("Expected states %v, got %v.", tc.expectedStates, states)
+			}
+			var pods []string
+			for _, pod := range fpc.pods {
+				pods = append(pods, pod.ObjectMeta.Name)
+			}
+			if !reflect.DeepEqual(pods, tc.expectedPods) {
+				t.Errorf("Expected pods %v, got %v.", tc.expectedPods, pods)
+			}
+		})
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	c := Controller{
+		log:   logrus.NewEntry(logrus.StandardLogger()),
+		queue: kube.RateLimiter("plank-test"),
+	}
+	defer c.queue.ShutDown()
+
+	// Pods are synced as the ProwJob of the same name, even when they
+	// are in another namespace or have been deleted. The triggered
+	// ProwJobs are scheduled once for any number of changes.
+	c.enqueue(&kube.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "test-pods"}})
+	c.enqueue(cache.DeletedFinalStateUnknown{Key: "test-pods/deleted"})
+	c.enqueueTriggered()
+	c.enqueueTriggered()
+
+	var keys []interface{}
+	for c.queue.Len() > 0 {
+		key, _ := c.queue.Get()
+		keys = append(keys, key)
+		c.queue.Done(key)
+	}
+	if expected := []interface{}{"pod", "deleted", triggeredKey{}}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected queued keys %v, got %v.", expected, keys)
+	}
+	if c.generation != 2 {
+		t.Errorf("Expected the admissions to be invalidated twice, got generation %d.", c.generation)
+	}
+}
+
+func TestSyncTriggered(t *testing.T) {
+	triggered := func(name string, age time.Duration) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       prowapi.ProwJobSpec{Job: "test-bazel-build", Type: prowapi.PeriodicJob, Agent: prowapi.KubernetesAgent},
+			Status:     prowapi.ProwJobStatus{State: prowapi.TriggeredState, StartTime: metav1.NewTime(time.Now().Add(-age))},
+		}
+	}
+	fc := &fkc{prowjobs: []prowapi.ProwJob{
+		triggered("oldest", 3*time.Hour),
+		triggered("older", 2*time.Hour),
+		triggered("newest", time.Hour),
+	}}
+	c := Controller{
+		log:     logrus.NewEntry(logrus.StandardLogger()),
+		config:  newFakeConfigAgent(t, 2).Config,
+		queue:   kube.RateLimiter("plank-test"),
+		started: sets.NewString(),
+	}
+	defer c.queue.ShutDown()
+	setCaches(t, &c, fc, nil)
+
+	// Only the ProwJobs that can start are scheduled.
+	if err := c.syncTriggered(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	queued := sets.NewString()
+	for c.queue.Len() > 0 {
+		key, _ := c.queue.Get()
+		queued.Insert(key.(string))
+		c.queue.Done(key)
+	}
+	if expected := sets.NewString("oldest", "older"); !queued.Equal(expected) {
+		t.Errorf("Expected the admitted prowjobs %v to be scheduled, got %v.", expected.List(), queued.List())
+	}
+
+	// The cached decisions are used until they are invalidated.
+	if err := c.pjIndexer.Delete(&fc.prowjobs[0]); err != nil {
+		t.Fatalf("Failed to delete prowjob from the cache: %v", err)
+	}
+	for _, name := range []string{"newest", "older"} {
+		pj, _, _ := c.getProwJob(name)
+		admitted, err := c.admit(pj)
+		if err != nil {
+			t.Fatalf("Unexpected error admitting %s: %v", name, err)
+		}
+		if admitted != (name == "older") {
+			t.Errorf("Expected %s to be admitted: %t, got %t.", name, name == "older", admitted)
+		}
+	}
+	c.invalidateAdmissions()
+	pj, _, _ := c.getProwJob("newest")
+	if admitted, err := c.admit(pj); err != nil || !admitted {
+		t.Errorf("Expected the newest prowjob to be admitted once the admissions are decided again, got %t and error %v.", admitted, err)
+	}
+}
+
+func TestStartNextJobsOnce(t *testing.T) {
+	parent := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent"},
+		Spec: prowapi.ProwJobSpec{
+			Job: "unit",
+			RunAfterSuccess: []prowapi.ProwJobSpec{
+				{Job: "integration", Type: prowapi.PeriodicJob},
+				{Job: "e2e", Type: prowapi.PeriodicJob},
+			},
+		},
+		Status: prowapi.ProwJobStatus{State: prowapi.SuccessState},
+	}
+	fc := &fkc{}
+	c := Controller{kc: fc, log: logrus.NewEntry(logrus.StandardLogger())}
+	// The parent is synced again if it could not be updated after its
+	// children were created.
+	for i := 0; i < 2; i++ {
+		if err := c.startNextJobs(parent); err != nil {
+			t.Fatalf("Unexpected error starting next jobs: %v", err)
+		}
+	}
+	if len(fc.prowjobs) != 2 {
+		t.Errorf("Expected 2 children, got %d.", len(fc.prowjobs))
+	}
+}
+
+func TestRetryJobOnce(t *testing.T) {
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "attempt"},
+		Spec: prowapi.ProwJobSpec{
+			Job:   "flaky",
+			Retry: &prowapi.RetryPolicy{MaxAttempts: 3},
+		},
+		Status: prowapi.ProwJobStatus{State: prowapi.PendingState},
+	}
+	fc := &fkc{}
+	c := Controller{kc: fc, log: logrus.NewEntry(logrus.StandardLogger())}
+	// The attempt is synced again if it could not be updated after the
+	// next attempt was created.
+	var next []string
+	for i := 0; i < 2; i++ {
+		attempt := *pj.DeepCopy()
+		retried, err := c.retryJob(&attempt, prowapi.RetryOnEviction, "Evicted.")
+		if err != nil || !retried {
+			t.Fatalf("Expected the job to be retried, got %t and error %v", retried, err)
+		}
+		next = append(next, attempt.Status.NextAttempt)
+	}
+	if len(fc.prowjobs) != 1 {
+		t.Errorf("Expected 1 next attempt, got %d.", len(fc.prowjobs))
+	}
+	if next[0] != next[1] || next[0] != fc.prowjobs[0].ObjectMeta.Name {
+		t.Errorf("Expected both syncs to link to next attempt %s, got %v.", fc.prowjobs[0].ObjectMeta.Name, next)
+	}
+}
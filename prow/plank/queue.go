@@ -0,0 +1,128 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plank
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+var (
+	queuedProwJobs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "plank_queued_prowjobs",
+		Help: "Number of triggered prowjobs waiting for capacity to be started",
+	}, []string{
+		// org of the prowjob, empty for prowjobs without refs
+		"org",
+		// repo of the prowjob, empty for prowjobs without refs
+		"repo",
+		// type of the prowjob: presubmit, postsubmit, periodic, batch
+		"type",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(queuedProwJobs)
+}
+
+// gatherQueueMetrics records the number of queued ProwJobs.
+func gatherQueueMetrics(queued []prowapi.ProwJob) {
+	type queueKey struct {
+		org, repo, jobType string
+	}
+	counts := map[queueKey]float64{}
+	for _, pj := range queued {
+		key := queueKey{jobType: string(pj.Spec.Type)}
+		if refs := primaryRefs(&pj); refs != nil {
+			key.org, key.repo = refs.Org, refs.Repo
+		}
+		counts[key]++
+	}
+
+	// Remove the queues that have been drained since the last sync.
+	queuedProwJobs.Reset()
+	for key, count := range counts {
+		queuedProwJobs.WithLabelValues(key.org, key.repo, key.jobType).Set(count)
+	}
+}
+
+// primaryRefs returns the refs a ProwJob is accounted against for fair
+// sharing: its refs, or the first extra refs for jobs without refs.
+func primaryRefs(pj *prowapi.ProwJob) *prowapi.Refs {
+	if pj.Spec.Refs != nil {
+		return pj.Spec.Refs
+	}
+	if len(pj.Spec.ExtraRefs) > 0 {
+		return &pj.Spec.ExtraRefs[0]
+	}
+	return nil
+}
+
+// quotaKeys returns the keys of the plank quotas that apply to a ProwJob.
+func quotaKeys(pj *prowapi.ProwJob) []string {
+	refs := primaryRefs(pj)
+	if refs == nil {
+		return nil
+	}
+	return []string{refs.Org, fmt.Sprintf("%s/%s", refs.Org, refs.Repo)}
+}
+
+// prioritize orders triggered ProwJobs in the order they should be started.
+// ProwJobs with a higher priority come first. ProwJobs of the same priority
+// are shared fairly between repos by taking turns, in order of the oldest
+// ProwJob of every repo, so that a flood of ProwJobs for one repo does not
+// starve the others. ProwJobs for the same repo are started oldest first.
+func prioritize(pjs []prowapi.ProwJob, priorityFor func(prowapi.ProwJobSpec) int) []prowapi.ProwJob {
+	sort.SliceStable(pjs, func(i, j int) bool {
+		if pi, pj := priorityFor(pjs[i].Spec), priorityFor(pjs[j].Spec); pi != pj {
+			return pi > pj
+		}
+		return pjs[i].Status.StartTime.Before(&pjs[j].Status.StartTime)
+	})
+
+	ordered := make([]prowapi.ProwJob, 0, len(pjs))
+	for start := 0; start < len(pjs); {
+		priority := priorityFor(pjs[start].Spec)
+		end := start
+		var repos []string
+		queues := map[string][]prowapi.ProwJob{}
+		for ; end < len(pjs) && priorityFor(pjs[end].Spec) == priority; end++ {
+			var repo string
+			if keys := quotaKeys(&pjs[end]); len(keys) > 0 {
+				repo = keys[len(keys)-1]
+			}
+			if _, seen := queues[repo]; !seen {
+				repos = append(repos, repo)
+			}
+			queues[repo] = append(queues[repo], pjs[end])
+		}
+		for len(ordered) < end {
+			for _, repo := range repos {
+				if queue := queues[repo]; len(queue) > 0 {
+					ordered = append(ordered, queue[0])
+					queues[repo] = queue[1:]
+				}
+			}
+		}
+		start = end
+	}
+	return ordered
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plank
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/kube"
+)
+
+func queuedJob(name string, jobType prowapi.ProwJobType, priority int, org, repo string, age time.Duration) prowapi.ProwJob {
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: prowapi.ProwJobSpec{
+			Job:      name,
+			Type:     jobType,
+			Priority: priority,
+		},
+		Status: prowapi.ProwJobStatus{
+			State:     prowapi.TriggeredState,
+			StartTime: metav1.NewTime(time.Now().Add(-age)),
+		},
+	}
+	if org != "" {
+		pj.Spec.Refs = &prowapi.Refs{Org: org, Repo: repo}
+	}
+	return pj
+}
+
+func names(pjs []prowapi.ProwJob) []string {
+	var names []string
+	for _, pj := range pjs {
+		names = append(names, pj.ObjectMeta.Name)
+	}
+	return names
+}
+
+func TestPrioritize(t *testing.T) {
+	defaults := map[prowapi.ProwJobType]int{
+		prowapi.PresubmitJob: 400,
+		prowapi.BatchJob:     200,
+		prowapi.PeriodicJob:  100,
+	}
+	priorityFor := func(spec prowapi.ProwJobSpec) int {
+		if spec.Priority != 0 {
+			return spec.Priority
+		}
+		return defaults[spec.Type]
+	}
+
+	testCases := []struct {
+		name     string
+		pjs      []prowapi.ProwJob
+		expected []string
+	}{
+		{
+			name: "higher priority first",
+			pjs: []prowapi.ProwJob{
+				queuedJob("periodic", prowapi.PeriodicJob, 0, "", "", 3*time.Hour),
+				queuedJob("batch", prowapi.BatchJob, 0, "org", "repo", 2*time.Hour),
+				queuedJob("presubmit", prowapi.PresubmitJob, 0, "org", "repo", time.Hour),
+			},
+			expected: []string{"presubmit", "batch", "periodic"},
+		},
+		{
+			name: "explicit priority overrides the default",
+			pjs: []prowapi.ProwJob{
+				queuedJob("presubmit", prowapi.PresubmitJob, 0, "org", "repo", time.Hour),
+				queuedJob("urgent-periodic", prowapi.PeriodicJob, 1000, "", "", time.Minute),
+			},
+			expected: []string{"urgent-periodic", "presubmit"},
+		},
+		{
+			name: "oldest first within a repo",
+			pjs: []prowapi.ProwJob{
+				queuedJob("new", prowapi.PresubmitJob, 0, "org", "repo", time.Minute),
+				queuedJob("old", prowapi.PresubmitJob, 0, "org", "repo", time.Hour),
+			},
+			expected: []string{"old", "new"},
+		},
+		{
+			name: "repos take turns within a priority",
+			pjs: []prowapi.ProwJob{
+				queuedJob("busy-1", prowapi.PresubmitJob, 0, "org", "busy", 5*time.Hour),
+				queuedJob("busy-2", prowapi.PresubmitJob, 0, "org", "busy", 4*time.Hour),
+				queuedJob("busy-3", prowapi.PresubmitJob, 0, "org", "busy", 3*time.Hour),
+				queuedJob("quiet-1", prowapi.PresubmitJob, 0, "org", "quiet", 2*time.Hour),
+				queuedJob("other-1", prowapi.PresubmitJob, 0, "other", "repo", time.Hour),
+			},
+			expected: []string{"busy-1", "quiet-1", "other-1", "busy-2", "busy-3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := names(prioritize(tc.pjs, priorityFor)); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected order %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAdmitTriggeredJobs(t *testing.T) {
+	testCases := []struct {
+		name             string
+		maxConcurrency   int
+		quotas           map[string]int
+		pendingJobs      map[string]int
+		pjs              []prowapi.ProwJob
+		existingPods     []string
+		expectedAdmitted []string
+		expectedQueued   []string
+	}{
+		{
+			name:           "capacity goes to higher priorities",
+			maxConcurrency: 2,
+			pjs: []prowapi.ProwJob{
+				queuedJob("periodic", prowapi.PeriodicJob, 0, "", "", 3*time.Hour),
+				queuedJob("batch", prowapi.BatchJob, 0, "org", "repo", 2*time.Hour),
+				queuedJob("presubmit", prowapi.PresubmitJob, 0, "org", "repo", time.Hour),
+			},
+			expectedAdmitted: []string{"presubmit", "batch"},
+			expectedQueued:   []string{"periodic"},
+		},
+		{
+			name:   "repo quota is enforced",
+			quotas: map[string]int{"org/busy": 1},
+			pjs: []prowapi.ProwJob{
+				queuedJob("busy-1", prowapi.PresubmitJob, 0, "org", "busy", 2*time.Hour),
+				queuedJob("busy-2", prowapi.PresubmitJob, 0, "org", "busy", time.Hour),
+				queuedJob("quiet-1", prowapi.PresubmitJob, 0, "org", "quiet", time.Minute),
+			},
+			expectedAdmitted: []string{"busy-1", "quiet-1"},
+			expectedQueued:   []string{"busy-2"},
+		},
+		{
+			name:   "org quota is enforced",
+			quotas: map[string]int{"org": 2},
+			pjs: []prowapi.ProwJob{
+				queuedJob("busy-1", prowapi.PresubmitJob, 0, "org", "busy", 2*time.Hour),
+				queuedJob("busy-2", prowapi.PresubmitJob, 0, "org", "busy", time.Hour),
+				queuedJob("quiet-1", prowapi.PresubmitJob, 0, "org", "quiet", time.Minute),
+				queuedJob("other-1", prowapi.PresubmitJob, 0, "other", "repo", time.Minute),
+			},
+			expectedAdmitted: []string{"busy-1", "quiet-1", "other-1"},
+			expectedQueued:   []string{"busy-2"},
+		},
+		{
+			name:           "jobs with an existing pod are always admitted",
+			maxConcurrency: 1,
+			pendingJobs:    map[string]int{"running": 1},
+			pjs: []prowapi.ProwJob{
+				queuedJob("started", prowapi.PeriodicJob, 0, "", "", time.Hour),
+				queuedJob("presubmit", prowapi.PresubmitJob, 0, "org", "repo", time.Hour),
+			},
+			existingPods:     []string{"started"},
+			expectedAdmitted: []string{"started"},
+			expectedQueued:   []string{"presubmit"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newFakeConfigAgent(t, tc.maxConcurrency).Config
+			cfg().Plank.Quotas = tc.quotas
+			cfg().Plank.DefaultPriorities = map[prowapi.ProwJobType]int{
+				prowapi.PresubmitJob: 400,
+				prowapi.BatchJob:     200,
+				prowapi.PeriodicJob:  100,
+			}
+			c := Controller{
+				log:         logrus.NewEntry(logrus.StandardLogger()),
+				config:      cfg,
+				pendingJobs: make(map[string]int),
+			}
+			if tc.pendingJobs != nil {
+				c.pendingJobs = tc.pendingJobs
+			}
+			pm := map[string]kube.Pod{}
+			for _, name := range tc.existingPods {
+				pm[name] = kube.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}
+			}
+			admitted, queued := c.admitTriggeredJobs(tc.pjs, pm)
+			if actual := names(admitted); !reflect.DeepEqual(actual, tc.expectedAdmitted) {
+				t.Errorf("expected admitted %v, got %v", tc.expectedAdmitted, actual)
+			}
+			if actual := names(queued); !reflect.DeepEqual(actual, tc.expectedQueued) {
+				t.Errorf("expected queued %v, got %v", tc.expectedQueued, actual)
+			}
+		})
+	}
+}
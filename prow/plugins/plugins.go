@@ -44,6 +44,7 @@ var (
 	issueCommentHandlers       = map[string]IssueCommentHandler{}
 	pullRequestHandlers        = map[string]PullRequestHandler{}
 	pushEventHandlers          = map[string]PushEventHandler{}
+	releaseEventHandlers       = map[string]ReleaseEventHandler{}
 	reviewEventHandlers        = map[string]ReviewEventHandler{}
 	reviewCommentEventHandlers = map[string]ReviewCommentEventHandler{}
 	statusEventHandlers        = map[string]StatusEventHandler{}
@@ -103,6 +104,15 @@ func RegisterPushEventHandler(name string, fn PushEventHandler, help HelpProvide
 	pushEventHandlers[name] = fn
 }
 
+// ReleaseEventHandler defines the function contract for a github.ReleaseEvent handler.
+type ReleaseEventHandler func(Agent, github.ReleaseEvent) error
+
+// RegisterReleaseEventHandler registers a plugin's github.ReleaseEvent handler.
+func RegisterReleaseEventHandler(name string, fn ReleaseEventHandler, help HelpProvider) {
+	pluginHelp[name] = help
+	releaseEventHandlers[name] = fn
+}
+
 // ReviewEventHandler defines the function contract for a github.ReviewEvent handler.
 type ReviewEventHandler func(Agent, github.ReviewEvent) error
 
@@ -374,6 +384,21 @@ func (pa *ConfigAgent) PushEventHandlers(owner, repo string) map[string]PushEven
 	return hs
 }
 
+// ReleaseEventHandlers returns a map of plugin names to handlers for the repo.
+func (pa *ConfigAgent) ReleaseEventHandlers(owner, repo string) map[string]ReleaseEventHandler {
+	pa.mut.Lock()
+	defer pa.mut.Unlock()
+
+	hs := map[string]ReleaseEventHandler{}
+	for _, p := range pa.getPlugins(owner, repo) {
+		if h, ok := releaseEventHandlers[p]; ok {
+			hs[p] = h
+		}
+	}
+
+	return hs
+}
+
 // getPlugins returns a list of plugins that are enabled on a given (org, repository).
 func (pa *ConfigAgent) getPlugins(owner, repo string) []string {
 	var plugins []string
@@ -400,6 +425,9 @@ func EventsForPlugin(name string) []string {
 	if _, ok := pushEventHandlers[name]; ok {
 		events = append(events, "push")
 	}
+	if _, ok := releaseEventHandlers[name]; ok {
+		events = append(events, "release")
+	}
 	if _, ok := reviewEventHandlers[name]; ok {
 		events = append(events, "pull_request_review")
 	}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/errorutil"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/kube"
+	"k8s.io/test-infra/prow/pjutil"
+)
+
+// abortPresubmits aborts the presubmits of a PR that are not complete and
+// test another head than the given one, or all of them if the head is empty.
+// Only the presubmits whose agent allows cancellations are aborted, as the
+// agent then stops their pods and builds.
+func abortPresubmits(c Client, pr *github.PullRequest, head, description string) error {
+	org, repo := pr.Base.Repo.Owner.Login, pr.Base.Repo.Name
+	selector := fmt.Sprintf("%s=%s,%s=%d", kube.ProwJobTypeLabel, prowapi.PresubmitJob, kube.PullLabel, pr.Number)
+	pjs, err := c.ProwJobClient.List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list prowjobs: %v", err)
+	}
+
+	var errors []error
+	for _, pj := range pjs.Items {
+		// The labels of the PR are shared by the PRs of the same number
+		// in other repos.
+		refs := pj.Spec.Refs
+		if pj.Complete() || refs == nil || refs.Org != org || refs.Repo != repo || len(refs.Pulls) == 0 || refs.Pulls[0].Number != pr.Number {
+			continue
+		}
+		if head != "" && refs.Pulls[0].SHA == head {
+			continue
+		}
+		if !cancellationsAllowed(c.Config, &pj) {
+			continue
+		}
+		prevState := pj.Status.State
+		pj.SetComplete()
+		pj.Status.State = prowapi.AbortedState
+		pj.Status.Description = description
+		c.Logger.WithFields(pjutil.ProwJobFields(&pj)).
+			WithField("from", prevState).
+			WithField("to", pj.Status.State).Info("Transitioning states.")
+		if _, err := c.ProwJobClient.Update(&pj); err != nil {
+			c.Logger.WithError(err).WithFields(pjutil.ProwJobFields(&pj)).Error("Failed to abort prowjob.")
+			errors = append(errors, err)
+		}
+	}
+	return errorutil.NewAggregate(errors...)
+}
+
+// cancellationsAllowed determines whether the agent of a prowjob stops it
+// once it is aborted. Plank and the build controller share the setting of
+// plank, while each jenkins-operator has its own.
+func cancellationsAllowed(cfg *config.Config, pj *prowapi.ProwJob) bool {
+	switch pj.Spec.Agent {
+	case prowapi.KubernetesAgent, prowapi.KnativeBuildAgent:
+		return cfg.Plank.AllowCancellations
+	case prowapi.JenkinsAgent:
+		for _, operator := range cfg.JenkinsOperators {
+			if len(cfg.JenkinsOperators) == 1 || operator.LabelSelector == nil || operator.LabelSelector.Matches(labels.Set(pj.ObjectMeta.Labels)) {
+				return operator.AllowCancellations
+			}
+		}
+	}
+	return false
+}
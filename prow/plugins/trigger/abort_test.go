@@ -0,0 +1,217 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/client/clientset/versioned/fake"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+	"k8s.io/test-infra/prow/kube"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestAbortPresubmits(t *testing.T) {
+	pj := func(name, repo string, number int, sha string, state prowapi.ProwJobState) runtime.Object {
+		pj := &prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "prowjobs",
+				Labels: map[string]string{
+					kube.ProwJobTypeLabel: string(prowapi.PresubmitJob),
+					kube.PullLabel:        strconv.Itoa(number),
+				},
+			},
+			Spec: prowapi.ProwJobSpec{
+				Type:  prowapi.PresubmitJob,
+				Agent: prowapi.KubernetesAgent,
+				Refs: &prowapi.Refs{
+					Org:   "org",
+					Repo:  repo,
+					Pulls: []prowapi.Pull{{Number: number, SHA: sha}},
+				},
+			},
+			Status: prowapi.ProwJobStatus{State: state},
+		}
+		if state == prowapi.SuccessState {
+			pj.SetComplete()
+		}
+		return pj
+	}
+
+	testCases := []struct {
+		name                  string
+		action                github.PullRequestEventAction
+		disallowCancellations bool
+		expected              []string
+	}{
+		{
+			name:     "closing the PR aborts all of its running jobs",
+			action:   github.PullRequestActionClosed,
+			expected: []string{"old-pending", "old-triggered", "new-pending"},
+		},
+		{
+			name:     "pushing to the PR aborts the jobs for the previous head",
+			action:   github.PullRequestActionSynchronize,
+			expected: []string{"old-pending", "old-triggered"},
+		},
+		{
+			name:   "other events do not abort jobs",
+			action: github.PullRequestActionLabeled,
+		},
+		{
+			name:                  "jobs are not aborted when their agent does not allow cancellations",
+			action:                github.PullRequestActionClosed,
+			disallowCancellations: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeProwJobClient := fake.NewSimpleClientset(
+				pj("old-pending", "repo", 1, "old", prowapi.PendingState),
+				pj("old-triggered", "repo", 1, "old", prowapi.TriggeredState),
+				pj("old-done", "repo", 1, "old", prowapi.SuccessState),
+				pj("new-pending", "repo", 1, "new", prowapi.PendingState),
+				pj("other-pr", "repo", 2, "old", prowapi.PendingState),
+				pj("other-repo", "other", 1, "old", prowapi.PendingState),
+			)
+			c := Client{
+				GitHubClient:  &fakegithub.FakeClient{},
+				ProwJobClient: fakeProwJobClient.ProwV1().ProwJobs("prowjobs"),
+				Config: &config.Config{ProwConfig: config.ProwConfig{
+					Plank: config.Plank{Controller: config.Controller{AllowCancellations: !tc.disallowCancellations}},
+				}},
+				Logger: logrus.WithField("plugin", PluginName),
+			}
+			pr := github.PullRequestEvent{
+				Action: tc.action,
+				PullRequest: github.PullRequest{
+					Number: 1,
+					User:   github.User{Login: "author"},
+					Base: github.PullRequestBranch{
+						Ref:  "master",
+						Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+					},
+					Head: github.PullRequestBranch{SHA: "new"},
+				},
+			}
+			if err := handlePR(c, plugins.Trigger{}, pr); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			pjs, err := fakeProwJobClient.ProwV1().ProwJobs("prowjobs").List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("Failed to list prowjobs: %v", err)
+			}
+			var aborted []string
+			for _, pj := range pjs.Items {
+				if pj.Status.State == prowapi.AbortedState {
+					if !pj.Complete() {
+						t.Errorf("Expected aborted prowjob %s to be complete.", pj.Name)
+					}
+					aborted = append(aborted, pj.Name)
+				}
+			}
+			expected := map[string]bool{}
+			for _, name := range tc.expected {
+				expected[name] = true
+			}
+			actual := map[string]bool{}
+			for _, name := range aborted {
+				actual[name] = true
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("Expected aborted prowjobs %v, got %v.", tc.expected, aborted)
+			}
+		})
+	}
+}
+
+func TestCancellationsAllowed(t *testing.T) {
+	testCases := []struct {
+		name      string
+		agent     prowapi.ProwJobAgent
+		labels    map[string]string
+		plank     bool
+		operators []config.JenkinsOperator
+		expected  bool
+	}{
+		{
+			name:     "kubernetes jobs follow plank",
+			agent:    prowapi.KubernetesAgent,
+			plank:    true,
+			expected: true,
+		},
+		{
+			name:  "kubernetes jobs are not cancelled by default",
+			agent: prowapi.KubernetesAgent,
+		},
+		{
+			name:     "build jobs follow plank",
+			agent:    prowapi.KnativeBuildAgent,
+			plank:    true,
+			expected: true,
+		},
+		{
+			name:      "jenkins jobs follow the only jenkins-operator",
+			agent:     prowapi.JenkinsAgent,
+			operators: []config.JenkinsOperator{{Controller: config.Controller{AllowCancellations: true}}},
+			expected:  true,
+		},
+		{
+			name:   "jenkins jobs follow the jenkins-operator that selects them",
+			agent:  prowapi.JenkinsAgent,
+			labels: map[string]string{"master": "b"},
+			plank:  true,
+			operators: []config.JenkinsOperator{
+				{Controller: config.Controller{AllowCancellations: true}, LabelSelector: labels.SelectorFromSet(labels.Set{"master": "a"})},
+				{LabelSelector: labels.SelectorFromSet(labels.Set{"master": "b"})},
+			},
+		},
+		{
+			name:  "jenkins jobs without a jenkins-operator are not cancelled",
+			agent: prowapi.JenkinsAgent,
+			plank: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{ProwConfig: config.ProwConfig{
+				Plank:            config.Plank{Controller: config.Controller{AllowCancellations: tc.plank}},
+				JenkinsOperators: tc.operators,
+			}}
+			pj := &prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{Labels: tc.labels},
+				Spec:       prowapi.ProwJobSpec{Agent: tc.agent},
+			}
+			if actual := cancellationsAllowed(cfg, pj); actual != tc.expected {
+				t.Errorf("Expected %t, got %t.", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -42,7 +42,7 @@ func handlePR(c Client, trigger plugins.Trigger, pr github.PullRequestEvent) err
 		}
 		if member {
 			c.Logger.Info("Starting all jobs for new PR.")
-			return buildAll(c, &pr.PullRequest, pr.GUID, trigger.ElideSkippedContexts)
+			return buildAll(c, &pr.PullRequest, pr.GUID, trigger.ElideSkippedContexts, true)
 		}
 		c.Logger.Infof("Welcome message to PR author %q.", author)
 		if err := welcomeMsg(c.GitHubClient, trigger, pr.PullRequest); err != nil {
@@ -63,7 +63,7 @@ func handlePR(c Client, trigger plugins.Trigger, pr github.PullRequestEvent) err
 				}
 			}
 			c.Logger.Info("Starting all jobs for updated PR.")
-			return buildAll(c, &pr.PullRequest, pr.GUID, trigger.ElideSkippedContexts)
+			return buildAll(c, &pr.PullRequest, pr.GUID, trigger.ElideSkippedContexts, true)
 		}
 	case github.PullRequestActionEdited:
 		// if someone changes the base of their PR, we will get this
@@ -88,7 +88,12 @@ func handlePR(c Client, trigger plugins.Trigger, pr github.PullRequestEvent) err
 			return buildAllIfTrusted(c, trigger, pr)
 		}
 	case github.PullRequestActionSynchronize:
-		return buildAllIfTrusted(c, trigger, pr)
+		// The jobs for the previous head of the PR are obsolete.
+		abortErr := abortPresubmits(c, &pr.PullRequest, pr.PullRequest.Head.SHA, "Aborted because the PR was updated.")
+		return errorutil.NewAggregate(abortErr, buildAllIfTrusted(c, trigger, pr))
+	case github.PullRequestActionClosed:
+		c.Logger.Info("Aborting the running jobs of the closed PR.")
+		return abortPresubmits(c, &pr.PullRequest, "", "Aborted because the PR was closed.")
 	case github.PullRequestActionLabeled:
 		// When a PR is LGTMd, if it is untrusted then build it once.
 		if pr.Label.Name == labels.LGTM {
@@ -97,7 +102,7 @@ func handlePR(c Client, trigger plugins.Trigger, pr github.PullRequestEvent) err
 				return fmt.Errorf("could not validate PR: %s", err)
 			} else if !trusted {
 				c.Logger.Info("Starting all jobs for untrusted PR with LGTM.")
-				return buildAll(c, &pr.PullRequest, pr.GUID, trigger.ElideSkippedContexts)
+				return buildAll(c, &pr.PullRequest, pr.GUID, trigger.ElideSkippedContexts, false)
 			}
 		}
 	}
@@ -132,7 +137,7 @@ func buildAllIfTrusted(c Client, trigger plugins.Trigger, pr github.PullRequestE
 			}
 		}
 		c.Logger.Info("Starting all jobs for updated PR.")
-		return buildAll(c, &pr.PullRequest, pr.GUID, trigger.ElideSkippedContexts)
+		return buildAll(c, &pr.PullRequest, pr.GUID, trigger.ElideSkippedContexts, true)
 	}
 	return nil
 }
@@ -216,9 +221,14 @@ func TrustedPullRequest(ghc githubClient, trigger plugins.Trigger, author, org,
 	return l, github.HasLabel(labels.OkToTest, l), nil
 }
 
-// buildAll ensures that all builds that should run and will be required are built
-func buildAll(c Client, pr *github.PullRequest, eventGUID string, elideSkippedContexts bool) error {
-	toTest, toSkip, err := filterPresubmits(testAllFilter(), c.GitHubClient, pr, c.Config.Presubmits[pr.Base.Repo.FullName], c.Logger)
+// buildAll ensures that all builds that should run and will be required are built.
+// Jobs from the .prow.yaml at the head of the PR are only considered if trustedHead is set.
+func buildAll(c Client, pr *github.PullRequest, eventGUID string, elideSkippedContexts, trustedHead bool) error {
+	presubmits, err := getPresubmits(c, pr, trustedHead)
+	if err != nil {
+		return err
+	}
+	toTest, toSkip, err := filterPresubmits(testAllFilter(), c.GitHubClient, pr, presubmits, c.Logger)
 	if err != nil {
 		return err
 	}
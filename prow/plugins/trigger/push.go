@@ -46,10 +46,14 @@ func listPushEventChanges(pe github.PushEvent) config.ChangedFilesProvider {
 }
 
 func createRefs(pe github.PushEvent) prowapi.Refs {
+	baseRef := pe.Branch()
+	if tag, ok := pe.Tag(); ok {
+		baseRef = tag
+	}
 	return prowapi.Refs{
 		Org:      pe.Repo.Owner.Name,
 		Repo:     pe.Repo.Name,
-		BaseRef:  pe.Branch(),
+		BaseRef:  baseRef,
 		BaseSHA:  pe.After,
 		BaseLink: pe.Compare,
 	}
@@ -60,23 +64,45 @@ func handlePE(c Client, pe github.PushEvent) error {
 		// we should not trigger jobs for a branch deletion
 		return nil
 	}
-	for _, j := range c.Config.Postsubmits[pe.Repo.FullName] {
-		if shouldRun, err := j.ShouldRun(pe.Branch(), listPushEventChanges(pe)); err != nil {
+	// Whoever pushed to the branch has write access, so the .prow.yaml
+	// at the pushed SHA can be trusted.
+	postsubmits, err := c.Config.GetPostsubmits(c.GitClient, pe.Repo.FullName, func() (string, error) { return pe.After, nil })
+	if err != nil {
+		return err
+	}
+	tag, isTag := pe.Tag()
+	for _, j := range postsubmits {
+		// Plank triggers these once their parent succeeds.
+		if j.RunsAfterParent() {
+			continue
+		}
+		var shouldRun bool
+		var err error
+		if isTag {
+			shouldRun, err = j.ShouldRunForTag(tag, listPushEventChanges(pe))
+		} else {
+			shouldRun, err = j.ShouldRun(pe.Branch(), listPushEventChanges(pe))
+		}
+		if err != nil {
 			return err
 		} else if !shouldRun {
 			continue
 		}
-		refs := createRefs(pe)
-		labels := make(map[string]string)
-		for k, v := range j.Labels {
-			labels[k] = v
-		}
-		labels[github.EventGUID] = pe.GUID
-		pj := pjutil.NewProwJob(pjutil.PostsubmitSpec(j, refs), labels)
-		c.Logger.WithFields(pjutil.ProwJobFields(&pj)).Info("Creating a new prowjob.")
-		if _, err := c.ProwJobClient.Create(&pj); err != nil {
+		if err := createPostsubmit(c, j, createRefs(pe), pe.GUID); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+func createPostsubmit(c Client, j config.Postsubmit, refs prowapi.Refs, eventGUID string) error {
+	labels := make(map[string]string)
+	for k, v := range j.Labels {
+		labels[k] = v
+	}
+	labels[github.EventGUID] = eventGUID
+	pj := pjutil.NewProwJob(pjutil.PostsubmitSpec(j, refs), labels)
+	c.Logger.WithFields(pjutil.ProwJobFields(&pj)).Info("Creating a new prowjob.")
+	_, err := c.ProwJobClient.Create(&pj)
+	return err
+}
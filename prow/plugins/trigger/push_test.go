@@ -55,6 +55,12 @@ func TestCreateRefs(t *testing.T) {
 	if actual := createRefs(pe); !equality.Semantic.DeepEqual(expected, actual) {
 		t.Errorf("diff between expected and actual refs:%s", diff.ObjectReflectDiff(expected, actual))
 	}
+
+	pe.Ref = "refs/tags/release/v1.0"
+	expected.BaseRef = "release/v1.0"
+	if actual := createRefs(pe); !equality.Semantic.DeepEqual(expected, actual) {
+		t.Errorf("diff between expected and actual tag refs:%s", diff.ObjectReflectDiff(expected, actual))
+	}
 }
 
 func TestHandlePE(t *testing.T) {
@@ -119,6 +125,36 @@ func TestHandlePE(t *testing.T) {
 			},
 			jobsToRun: 1,
 		},
+		{
+			name: "matching tag pushed",
+			pe: github.PushEvent{
+				Ref: "refs/tags/v1.0.0",
+				Repo: github.Repo{
+					FullName: "org3/repo3",
+				},
+			},
+			jobsToRun: 1,
+		},
+		{
+			name: "other tag pushed",
+			pe: github.PushEvent{
+				Ref: "refs/tags/nightly",
+				Repo: github.Repo{
+					FullName: "org3/repo3",
+				},
+			},
+			jobsToRun: 0,
+		},
+		{
+			name: "branch pushed in repo with tag jobs",
+			pe: github.PushEvent{
+				Ref: "refs/heads/master",
+				Repo: github.Repo{
+					FullName: "org3/repo3",
+				},
+			},
+			jobsToRun: 1,
+		},
 	}
 	for _, tc := range testCases {
 		g := &fakegithub.FakeClient{}
@@ -143,7 +179,40 @@ func TestHandlePE(t *testing.T) {
 			"org2/repo2": {
 				{
 					JobBase: config.JobBase{
-						Name: "pass-salt",
+						Name:            "pass-salt",
+						RunAfterSuccess: []string{"pass-pepper"},
+					},
+				},
+				{
+					// Runs only once pass-salt succeeds.
+					JobBase: config.JobBase{
+						Name: "pass-pepper",
+					},
+				},
+			},
+			"org3/repo3": {
+				{
+					JobBase: config.JobBase{
+						Name: "push-image",
+					},
+					Tagger: config.Tagger{
+						Tags: []string{`^v\d+\.\d+\.\d+$`},
+					},
+				},
+				{
+					JobBase: config.JobBase{
+						Name: "publish-release",
+					},
+					Tagger: config.Tagger{
+						Releases: []string{`^v.*`},
+					},
+				},
+				{
+					JobBase: config.JobBase{
+						Name: "build-master",
+					},
+					Brancher: config.Brancher{
+						Branches: []string{`^master$`},
 					},
 				},
 			},
@@ -0,0 +1,58 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"fmt"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/github"
+)
+
+func handleRE(c Client, re github.ReleaseEvent) error {
+	if re.Action != github.ReleaseActionPublished {
+		// we only run jobs for releases once they are published
+		return nil
+	}
+	org, repo, tag := re.Repo.Owner.Login, re.Repo.Name, re.Release.TagName
+	sha, err := c.GitHubClient.GetRef(org, repo, "tags/"+tag)
+	if err != nil {
+		return fmt.Errorf("failed to get the SHA of tag %s: %v", tag, err)
+	}
+	// Only users with write access can publish releases, so the .prow.yaml
+	// at the tagged SHA can be trusted.
+	postsubmits, err := c.Config.GetPostsubmits(c.GitClient, re.Repo.FullName, func() (string, error) { return sha, nil })
+	if err != nil {
+		return err
+	}
+	for _, j := range postsubmits {
+		if j.RunsAfterParent() || !j.ShouldRunForRelease(tag) {
+			continue
+		}
+		refs := prowapi.Refs{
+			Org:      org,
+			Repo:     repo,
+			BaseRef:  tag,
+			BaseSHA:  sha,
+			BaseLink: re.Release.HTMLURL,
+		}
+		if err := createPostsubmit(c, j, refs, re.GUID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
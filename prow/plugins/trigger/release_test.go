@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	clienttesting "k8s.io/client-go/testing"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/client/clientset/versioned/fake"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+)
+
+func TestHandleRE(t *testing.T) {
+	testCases := []struct {
+		name         string
+		re           github.ReleaseEvent
+		expectedJobs []string
+	}{
+		{
+			name: "draft created",
+			re: github.ReleaseEvent{
+				Action:  github.ReleaseActionCreated,
+				Release: github.Release{TagName: "v1.0.0", Draft: true},
+			},
+		},
+		{
+			name: "matching release published",
+			re: github.ReleaseEvent{
+				Action:  github.ReleaseActionPublished,
+				Release: github.Release{TagName: "v1.0.0", HTMLURL: "https://github.com/org/repo/releases/tag/v1.0.0"},
+			},
+			expectedJobs: []string{"publish-release"},
+		},
+		{
+			name: "other release published",
+			re: github.ReleaseEvent{
+				Action:  github.ReleaseActionPublished,
+				Release: github.Release{TagName: "nightly"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.re.Repo = github.Repo{
+				Owner:    github.User{Login: "org"},
+				Name:     "repo",
+				FullName: "org/repo",
+			}
+			fakeProwJobClient := fake.NewSimpleClientset()
+			c := Client{
+				GitHubClient:  &fakegithub.FakeClient{},
+				ProwJobClient: fakeProwJobClient.ProwV1().ProwJobs("prowjobs"),
+				Config:        &config.Config{ProwConfig: config.ProwConfig{ProwJobNamespace: "prowjobs"}},
+				Logger:        logrus.WithField("plugin", PluginName),
+			}
+			postsubmits := map[string][]config.Postsubmit{
+				"org/repo": {
+					{
+						JobBase: config.JobBase{Name: "publish-release"},
+						Tagger:  config.Tagger{Releases: []string{`^v.*`}},
+					},
+					{
+						JobBase: config.JobBase{Name: "push-image"},
+						Tagger:  config.Tagger{Tags: []string{`^v.*`}},
+					},
+					{
+						JobBase: config.JobBase{Name: "build"},
+					},
+				},
+			}
+			if err := c.Config.SetPostsubmits(postsubmits); err != nil {
+				t.Fatalf("failed to set postsubmits: %v", err)
+			}
+			if err := handleRE(c, tc.re); err != nil {
+				t.Fatalf("handleRE returned unexpected error %v", err)
+			}
+			var created []string
+			for _, action := range fakeProwJobClient.Fake.Actions() {
+				create, ok := action.(clienttesting.CreateActionImpl)
+				if !ok {
+					continue
+				}
+				pj := create.GetObject().(*prowapi.ProwJob)
+				created = append(created, pj.Spec.Job)
+				if pj.Spec.Refs.BaseRef != tc.re.Release.TagName {
+					t.Errorf("expected base ref %q, got %q", tc.re.Release.TagName, pj.Spec.Refs.BaseRef)
+				}
+				if pj.Spec.Refs.BaseSHA != fakegithub.TestRef {
+					t.Errorf("expected base SHA %q, got %q", fakegithub.TestRef, pj.Spec.Refs.BaseSHA)
+				}
+			}
+			if len(created) != len(tc.expectedJobs) {
+				t.Fatalf("expected jobs %v to run, got %v", tc.expectedJobs, created)
+			}
+			for i := range created {
+				if created[i] != tc.expectedJobs[i] {
+					t.Errorf("expected jobs %v to run, got %v", tc.expectedJobs, created)
+				}
+			}
+		})
+	}
+}
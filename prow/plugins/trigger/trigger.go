@@ -21,10 +21,12 @@ import (
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/errorutil"
+	"k8s.io/test-infra/prow/git"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/pjutil"
 	"k8s.io/test-infra/prow/pluginhelp"
@@ -40,6 +42,7 @@ func init() {
 	plugins.RegisterGenericCommentHandler(PluginName, handleGenericCommentEvent, helpProvider)
 	plugins.RegisterPullRequestHandler(PluginName, handlePullRequest, helpProvider)
 	plugins.RegisterPushEventHandler(PluginName, handlePush, helpProvider)
+	plugins.RegisterReleaseEventHandler(PluginName, handleRelease, helpProvider)
 }
 
 func helpProvider(config *plugins.Configuration, enabledRepos []string) (*pluginhelp.PluginHelp, error) {
@@ -64,7 +67,9 @@ func helpProvider(config *plugins.Configuration, enabledRepos []string) (*plugin
 	pluginHelp := &pluginhelp.PluginHelp{
 		Description: `The trigger plugin starts tests in reaction to commands and pull request events. It is responsible for ensuring that test jobs are only run on trusted PRs. A PR is considered trusted if the author is a member of the 'trusted organization' for the repository or if such a member has left an '/ok-to-test' command on the PR.
 <br>Trigger starts jobs automatically when a new trusted PR is created or when an untrusted PR becomes trusted, but it can also be used to start jobs manually via the '/test' command.
-<br>The '/retest' command can be used to rerun jobs that have reported failure.`,
+<br>The '/retest' command can be used to rerun jobs that have reported failure.
+<br>Trigger also starts postsubmit jobs when branches or tags are pushed and when GitHub releases are published.
+<br>Presubmit jobs that are still running are aborted when their PR is closed, or when new commits are pushed to it, if the agent that runs them allows cancellations.`,
 		Config: configInfo,
 	}
 	pluginHelp.AddCommand(pluginhelp.Command{
@@ -110,6 +115,8 @@ type githubClient interface {
 
 type prowJobClient interface {
 	Create(*prowapi.ProwJob) (*prowapi.ProwJob, error)
+	List(opts metav1.ListOptions) (*prowapi.ProwJobList, error)
+	Update(*prowapi.ProwJob) (*prowapi.ProwJob, error)
 }
 
 // Client holds the necessary structures to work with prow via logging, github, kubernetes and its configuration.
@@ -118,6 +125,7 @@ type prowJobClient interface {
 type Client struct {
 	GitHubClient  githubClient
 	ProwJobClient prowJobClient
+	GitClient     *git.Client
 	Config        *config.Config
 	Logger        *logrus.Entry
 }
@@ -132,6 +140,7 @@ func getClient(pc plugins.Agent) Client {
 		GitHubClient:  pc.GitHubClient,
 		Config:        pc.Config,
 		ProwJobClient: pc.ProwJobClient,
+		GitClient:     pc.GitClient,
 		Logger:        pc.Logger,
 	}
 }
@@ -149,6 +158,10 @@ func handlePush(pc plugins.Agent, pe github.PushEvent) error {
 	return handlePE(getClient(pc), pe)
 }
 
+func handleRelease(pc plugins.Agent, re github.ReleaseEvent) error {
+	return handleRE(getClient(pc), re)
+}
+
 // TrustedUser returns true if user is trusted in repo.
 //
 // Trusted users are either repo collaborators, org members or trusted org members.
@@ -185,6 +198,28 @@ func TrustedUser(ghc trustedUserClient, trigger plugins.Trigger, user, org, repo
 	return member, nil
 }
 
+// getPresubmits returns the presubmits for the PR, including the ones defined
+// in the repo's .prow.yaml if in-repo config is enabled. The .prow.yaml is only
+// read from the head of the PR if trustedHead is set, otherwise it is read from
+// the base branch so that untrusted changes cannot inject jobs.
+func getPresubmits(c Client, pr *github.PullRequest, trustedHead bool) ([]config.Presubmit, error) {
+	org, repo := pr.Base.Repo.Owner.Login, pr.Base.Repo.Name
+	baseSHAGetter := func() (string, error) {
+		return c.GitHubClient.GetRef(org, repo, "heads/"+pr.Base.Ref)
+	}
+	var headSHAGetters []config.RefGetter
+	if trustedHead {
+		headSHAGetters = append(headSHAGetters, func() (string, error) {
+			return pr.Head.SHA, nil
+		})
+	}
+	presubmits, err := c.Config.GetPresubmits(c.GitClient, org+"/"+repo, baseSHAGetter, headSHAGetters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get presubmits: %v", err)
+	}
+	return presubmits, nil
+}
+
 func skippedStatusFor(context string) github.Status {
 	return github.Status{
 		State:       github.StatusSuccess,
@@ -246,6 +281,18 @@ func RunRequested(c Client, pr *github.PullRequest, requestedJobs []config.Presu
 	return errorutil.NewAggregate(errors...)
 }
 
+// RunOrSkipRequested executes the config.Presubmits that are requested and
+// should run against the changes in the PR, and posts skipped statuses for the
+// reporting ones that should not.
+func RunOrSkipRequested(c Client, pr *github.PullRequest, requestedJobs []config.Presubmit, eventGUID string) error {
+	requestedFilter := func(config.Presubmit) (bool, bool, bool) { return true, false, true }
+	toTest, toSkip, err := filterPresubmits(requestedFilter, c.GitHubClient, pr, requestedJobs, c.Logger)
+	if err != nil {
+		return err
+	}
+	return runAndSkipJobs(c, pr, toTest, toSkip, eventGUID, false)
+}
+
 // skipRequested posts skipped statuses for the config.Presubmits that are requested
 func skipRequested(c Client, pr *github.PullRequest, skippedJobs []config.Presubmit) error {
 	var errors []error
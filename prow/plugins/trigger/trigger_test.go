@@ -31,6 +31,7 @@ import (
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/client/clientset/versioned/fake"
 	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/github/fakegithub"
 	"k8s.io/test-infra/prow/plugins"
@@ -464,6 +465,61 @@ func TestRunRequested(t *testing.T) {
 	}
 }
 
+func TestRunOrSkipRequested(t *testing.T) {
+	pr := &github.PullRequest{
+		Number: 1,
+		Base: github.PullRequestBranch{
+			Repo: github.Repo{
+				Owner: github.User{
+					Login: "org",
+				},
+				Name: "repo",
+			},
+			Ref: "branch",
+		},
+		Head: github.PullRequestBranch{
+			SHA: "foobar1",
+		},
+	}
+	requestedJobs := []config.Presubmit{{
+		JobBase:             config.JobBase{Name: "code"},
+		Reporter:            config.Reporter{Context: "code-context"},
+		RegexpChangeMatcher: config.RegexpChangeMatcher{SkipIfOnlyChanged: `\.md$`},
+	}, {
+		JobBase:             config.JobBase{Name: "docs"},
+		Reporter:            config.Reporter{Context: "docs-context"},
+		RegexpChangeMatcher: config.RegexpChangeMatcher{IncludeChanges: []string{"*.md"}},
+	}}
+	if err := config.SetPresubmitRegexes(requestedJobs); err != nil {
+		t.Fatalf("failed to set presubmit regexes: %v", err)
+	}
+
+	fakeGitHubClient := fakegithub.FakeClient{
+		PullRequestChanges: map[int][]github.PullRequestChange{1: {{Filename: "README.md"}}},
+	}
+	fakeProwJobClient := fake.NewSimpleClientset()
+	client := Client{
+		GitHubClient:  &fakeGitHubClient,
+		ProwJobClient: fakeProwJobClient.ProwV1().ProwJobs("prowjobs"),
+		Logger:        logrus.WithField("plugin", PluginName),
+	}
+	if err := RunOrSkipRequested(client, pr, requestedJobs, "event-guid"); err != nil {
+		t.Fatalf("expected no error but got one: %v", err)
+	}
+
+	existingProwJobs, err := fakeProwJobClient.ProwV1().ProwJobs("prowjobs").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("could not list current state of prow jobs: %v", err)
+	}
+	if len(existingProwJobs.Items) != 1 || existingProwJobs.Items[0].Spec.Job != "docs" {
+		t.Errorf("expected only the docs job to run, got %v", existingProwJobs.Items)
+	}
+	statuses := fakeGitHubClient.CreatedStatuses["foobar1"]
+	if len(statuses) != 1 || statuses[0].Context != "code-context" || statuses[0].State != github.StatusSuccess {
+		t.Errorf("expected a passing skipped status for code-context, got %v", statuses)
+	}
+}
+
 func TestValidateContextOverlap(t *testing.T) {
 	var testCases = []struct {
 		name          string
@@ -515,3 +571,92 @@ func TestValidateContextOverlap(t *testing.T) {
 		}
 	}
 }
+
+func TestGetPresubmits(t *testing.T) {
+	const headSHA = "head-sha"
+	enabled := true
+	var testCases = []struct {
+		name        string
+		inRepo      bool
+		trustedHead bool
+
+		expectedJobs     sets.String
+		expectedHeadSHAs []string
+	}{
+		{
+			name:         "in-repo config disabled only returns central jobs",
+			trustedHead:  true,
+			expectedJobs: sets.NewString("central"),
+		},
+		{
+			name:             "in-repo config on trusted PR reads the head",
+			inRepo:           true,
+			trustedHead:      true,
+			expectedJobs:     sets.NewString("central", "in-repo"),
+			expectedHeadSHAs: []string{headSHA},
+		},
+		{
+			name:         "in-repo config on untrusted PR only reads the base",
+			inRepo:       true,
+			expectedJobs: sets.NewString("central", "in-repo"),
+		},
+	}
+
+	pr := &github.PullRequest{
+		Base: github.PullRequestBranch{
+			Repo: github.Repo{
+				Owner:    github.User{Login: "org"},
+				Name:     "repo",
+				FullName: "org/repo",
+			},
+			Ref: "branch",
+		},
+		Head: github.PullRequestBranch{
+			SHA: headSHA,
+		},
+	}
+
+	for _, testCase := range testCases {
+		var observedBaseSHA string
+		var observedHeadSHAs []string
+		cfg := &config.Config{
+			JobConfig: config.JobConfig{
+				Presubmits: map[string][]config.Presubmit{
+					"org/repo": {{JobBase: config.JobBase{Name: "central"}}},
+				},
+			},
+			ProwYAMLGetter: func(_ *config.Config, _ *git.Client, _, baseSHA string, headSHAs ...string) (*config.ProwYAML, error) {
+				observedBaseSHA = baseSHA
+				observedHeadSHAs = headSHAs
+				return &config.ProwYAML{Presubmits: []config.Presubmit{{JobBase: config.JobBase{Name: "in-repo"}}}}, nil
+			},
+		}
+		if testCase.inRepo {
+			cfg.InRepoConfig.Enabled = map[string]*bool{"org/repo": &enabled}
+		}
+		client := Client{
+			GitHubClient: &fakegithub.FakeClient{},
+			Config:       cfg,
+			Logger:       logrus.WithField("testcase", testCase.name),
+		}
+
+		presubmits, err := getPresubmits(client, pr, testCase.trustedHead)
+		if err != nil {
+			t.Errorf("%s: expected no error but got one: %v", testCase.name, err)
+			continue
+		}
+		observedJobs := sets.NewString()
+		for _, presubmit := range presubmits {
+			observedJobs.Insert(presubmit.Name)
+		}
+		if !observedJobs.Equal(testCase.expectedJobs) {
+			t.Errorf("%s: expected jobs %v, got %v", testCase.name, testCase.expectedJobs.List(), observedJobs.List())
+		}
+		if testCase.inRepo && observedBaseSHA != fakegithub.TestRef {
+			t.Errorf("%s: expected base SHA %q, got %q", testCase.name, fakegithub.TestRef, observedBaseSHA)
+		}
+		if !reflect.DeepEqual(observedHeadSHAs, testCase.expectedHeadSHAs) {
+			t.Errorf("%s: expected head SHAs %v, got %v", testCase.name, testCase.expectedHeadSHAs, observedHeadSHAs)
+		}
+	}
+}
@@ -439,6 +439,10 @@ func GCSOptions(dc prowapi.DecorationConfig) (coreapi.Volume, coreapi.VolumeMoun
 	return vol, mount, opt
 }
 
+// InitUploadName is the name of the init container that uploads the clone
+// records and exits with an error if cloning any of the refs failed.
+const InitUploadName = "initupload"
+
 func InitUpload(image string, opt gcsupload.Options, creds coreapi.VolumeMount, cloneLogMount *coreapi.VolumeMount, encodedJobSpec string) (*coreapi.Container, error) {
 	// TODO(fejta): remove encodedJobSpec
 	initUploadOptions := initupload.Options{
@@ -456,7 +460,7 @@ func InitUpload(image string, opt gcsupload.Options, creds coreapi.VolumeMount,
 		return nil, fmt.Errorf("could not encode initupload configuration as JSON: %v", err)
 	}
 	return &coreapi.Container{
-		Name:    "initupload",
+		Name:    InitUploadName,
 		Image:   image,
 		Command: []string{"/initupload"}, // TODO(fejta): remove this, use image's entrypoint and delete /initupload symlink
 		Env: kubeEnv(map[string]string{
@@ -17,6 +17,7 @@ limitations under the License.
 package slack
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -49,6 +50,28 @@ const (
 	botIconEmoji = ":prow:"
 )
 
+// Attachment adds a colored block with a title, text and fields to a message.
+type Attachment struct {
+	// Fallback is the plain text summary of the attachment that is shown
+	// by clients that cannot display attachments.
+	Fallback string `json:"fallback,omitempty"`
+	// Color is the color of the bar next to the attachment, either a hex
+	// color code or one of good, warning and danger.
+	Color     string            `json:"color,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	TitleLink string            `json:"title_link,omitempty"`
+	Text      string            `json:"text,omitempty"`
+	Fields    []AttachmentField `json:"fields,omitempty"`
+}
+
+// AttachmentField is shown in a table in an attachment.
+type AttachmentField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	// Short fields are shown next to each other.
+	Short bool `json:"short,omitempty"`
+}
+
 // NewClient creates a slack client with an API token.
 func NewClient(tokenGenerator func() []byte) *Client {
 	return &Client{
@@ -111,3 +134,22 @@ func (sl *Client) WriteMessage(text, channel string) error {
 	_, err := sl.postMessage(chatPostMessage, uv)
 	return err
 }
+
+// WriteMessageWithAttachments adds text with attachments to channel
+func (sl *Client) WriteMessageWithAttachments(text, channel string, attachments []Attachment) error {
+	sl.log("WriteMessageWithAttachments", text, channel, attachments)
+	if sl.fake {
+		return nil
+	}
+	raw, err := json.Marshal(attachments)
+	if err != nil {
+		return fmt.Errorf("failed to marshal attachments: %v", err)
+	}
+	var uv = sl.urlValues()
+	uv.Add("channel", channel)
+	uv.Add("text", text)
+	uv.Add("attachments", string(raw))
+
+	_, err = sl.postMessage(chatPostMessage, uv)
+	return err
+}
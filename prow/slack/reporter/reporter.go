@@ -0,0 +1,141 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reporter implements a crier reporter that sends messages about
+// ProwJobs to the Slack channels configured on their jobs.
+package reporter
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/slack"
+)
+
+const (
+	// SlackReporterName is the name for slack reporter
+	SlackReporterName = "slack-reporter"
+
+	defaultReportTemplate = "Job {{.Spec.Job}} of type {{.Spec.Type}} ended with state {{.Status.State}}."
+)
+
+// defaultJobStatesToReport are reported for jobs that do not configure
+// the states to report.
+var defaultJobStatesToReport = []prowapi.ProwJobState{prowapi.FailureState, prowapi.ErrorState}
+
+// SlackClient sends messages to Slack.
+type SlackClient interface {
+	WriteMessageWithAttachments(text, channel string, attachments []slack.Attachment) error
+}
+
+// Client is a slack reporter client fed to crier controller
+type Client struct {
+	sc SlackClient
+}
+
+// NewReporter returns a reporter client
+func NewReporter(sc SlackClient) *Client {
+	return &Client{
+		sc: sc,
+	}
+}
+
+// GetName returns the name of the reporter
+func (c *Client) GetName() string {
+	return SlackReporterName
+}
+
+// ShouldReport returns if the prowjob configures a Slack channel and is
+// in one of the states to report to it.
+func (c *Client) ShouldReport(pj *prowapi.ProwJob) bool {
+	if pj.Spec.ReporterConfig == nil || pj.Spec.ReporterConfig.Slack == nil {
+		return false
+	}
+	states := pj.Spec.ReporterConfig.Slack.JobStatesToReport
+	if len(states) == 0 {
+		states = defaultJobStatesToReport
+	}
+	for _, state := range states {
+		if pj.Status.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Report sends a message about the prowjob to its Slack channel
+func (c *Client) Report(pj *prowapi.ProwJob) error {
+	config := pj.Spec.ReporterConfig.Slack
+	text, err := reportText(pj, config.ReportTemplate)
+	if err != nil {
+		return err
+	}
+	if err := c.sc.WriteMessageWithAttachments(text, config.Channel, []slack.Attachment{attachment(pj)}); err != nil {
+		return fmt.Errorf("failed to write message to channel %s: %v", config.Channel, err)
+	}
+	return nil
+}
+
+// reportText executes the report template of a prowjob on it.
+func reportText(pj *prowapi.ProwJob, reportTemplate string) (string, error) {
+	if reportTemplate == "" {
+		reportTemplate = defaultReportTemplate
+	}
+	tmpl, err := template.New("report").Parse(reportTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse report template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, pj); err != nil {
+		return "", fmt.Errorf("failed to execute report template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// attachment summarizes a prowjob, colored by its state and linking to
+// its logs.
+func attachment(pj *prowapi.ProwJob) slack.Attachment {
+	fields := []slack.AttachmentField{
+		{Title: "State", Value: string(pj.Status.State), Short: true},
+		{Title: "Type", Value: string(pj.Spec.Type), Short: true},
+	}
+	if pj.Spec.Refs != nil {
+		fields = append(fields, slack.AttachmentField{
+			Title: "Refs",
+			Value: fmt.Sprintf("%s/%s %s", pj.Spec.Refs.Org, pj.Spec.Refs.Repo, pj.Spec.Refs.String()),
+		})
+	}
+	return slack.Attachment{
+		Fallback:  fmt.Sprintf("%s: %s", pj.Spec.Job, pj.Status.State),
+		Color:     stateColor(pj.Status.State),
+		Title:     pj.Spec.Job,
+		TitleLink: pj.Status.URL,
+		Fields:    fields,
+	}
+}
+
+func stateColor(state prowapi.ProwJobState) string {
+	switch state {
+	case prowapi.SuccessState:
+		return "good"
+	case prowapi.FailureState, prowapi.ErrorState:
+		return "danger"
+	default:
+		return "warning"
+	}
+}
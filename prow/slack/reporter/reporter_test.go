@@ -0,0 +1,171 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reporter
+
+import (
+	"reflect"
+	"testing"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/slack"
+)
+
+type message struct {
+	text        string
+	channel     string
+	attachments []slack.Attachment
+}
+
+type fakeSlackClient struct {
+	messages []message
+}
+
+func (f *fakeSlackClient) WriteMessageWithAttachments(text, channel string, attachments []slack.Attachment) error {
+	f.messages = append(f.messages, message{text: text, channel: channel, attachments: attachments})
+	return nil
+}
+
+func TestShouldReport(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   *prowapi.ReporterConfig
+		state    prowapi.ProwJobState
+		expected bool
+	}{
+		{
+			name:  "no reporter config",
+			state: prowapi.FailureState,
+		},
+		{
+			name:   "no slack config",
+			config: &prowapi.ReporterConfig{},
+			state:  prowapi.FailureState,
+		},
+		{
+			name:     "failures are reported by default",
+			config:   &prowapi.ReporterConfig{Slack: &prowapi.SlackReporterConfig{Channel: "alerts"}},
+			state:    prowapi.FailureState,
+			expected: true,
+		},
+		{
+			name:   "successes are not reported by default",
+			config: &prowapi.ReporterConfig{Slack: &prowapi.SlackReporterConfig{Channel: "alerts"}},
+			state:  prowapi.SuccessState,
+		},
+		{
+			name: "configured states are reported",
+			config: &prowapi.ReporterConfig{Slack: &prowapi.SlackReporterConfig{
+				Channel:           "alerts",
+				JobStatesToReport: []prowapi.ProwJobState{prowapi.SuccessState},
+			}},
+			state:    prowapi.SuccessState,
+			expected: true,
+		},
+		{
+			name: "only configured states are reported",
+			config: &prowapi.ReporterConfig{Slack: &prowapi.SlackReporterConfig{
+				Channel:           "alerts",
+				JobStatesToReport: []prowapi.ProwJobState{prowapi.SuccessState},
+			}},
+			state: prowapi.FailureState,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pj := &prowapi.ProwJob{
+				Spec:   prowapi.ProwJobSpec{ReporterConfig: tc.config},
+				Status: prowapi.ProwJobStatus{State: tc.state},
+			}
+			if actual := NewReporter(&fakeSlackClient{}).ShouldReport(pj); actual != tc.expected {
+				t.Errorf("Expected ShouldReport to return %t, got %t.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	testCases := []struct {
+		name         string
+		template     string
+		expectedText string
+		expectedErr  bool
+	}{
+		{
+			name:         "default template",
+			expectedText: "Job ci-foo of type periodic ended with state failure.",
+		},
+		{
+			name:         "custom template",
+			template:     "{{.Spec.Job}} failed, see {{.Status.URL}}",
+			expectedText: "ci-foo failed, see https://prow/view/ci-foo/1",
+		},
+		{
+			name:        "template that does not execute",
+			template:    "{{.Spec.Missing}}",
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pj := &prowapi.ProwJob{
+				Spec: prowapi.ProwJobSpec{
+					Type: prowapi.PeriodicJob,
+					Job:  "ci-foo",
+					ReporterConfig: &prowapi.ReporterConfig{Slack: &prowapi.SlackReporterConfig{
+						Channel:        "alerts",
+						ReportTemplate: tc.template,
+					}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.FailureState,
+					URL:   "https://prow/view/ci-foo/1",
+				},
+			}
+			sc := &fakeSlackClient{}
+			err := NewReporter(sc).Report(pj)
+			if tc.expectedErr {
+				if err == nil {
+					t.Error("Expected an error, got none.")
+				}
+				if len(sc.messages) != 0 {
+					t.Errorf("Expected no messages, got %v.", sc.messages)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected := []message{{
+				text:    tc.expectedText,
+				channel: "alerts",
+				attachments: []slack.Attachment{{
+					Fallback:  "ci-foo: failure",
+					Color:     "danger",
+					Title:     "ci-foo",
+					TitleLink: "https://prow/view/ci-foo/1",
+					Fields: []slack.AttachmentField{
+						{Title: "State", Value: "failure", Short: true},
+						{Title: "Type", Value: "periodic", Short: true},
+					},
+				}},
+			}}
+			if !reflect.DeepEqual(sc.messages, expected) {
+				t.Errorf("Expected messages %+v, got %+v.", expected, sc.messages)
+			}
+		})
+	}
+}
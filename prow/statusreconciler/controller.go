@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 	prowv1 "k8s.io/test-infra/prow/client/clientset/versioned/typed/prowjobs/v1"
 
 	"k8s.io/test-infra/maintenance/migratestatus/migrator"
@@ -89,7 +90,7 @@ type kubeProwJobTriggerer struct {
 }
 
 func (t *kubeProwJobTriggerer) run(pr *github.PullRequest, requestedJobs []config.Presubmit) error {
-	return trigger.RunRequested(
+	return trigger.RunOrSkipRequested(
 		trigger.Client{
 			GitHubClient:  t.githubClient,
 			ProwJobClient: t.prowJobClient,
@@ -158,7 +159,8 @@ func (c *Controller) reconcile(delta config.Delta) error {
 		}
 	}
 
-	if err := c.retireRemovedContexts(removedBlockingPresubmits(delta.Before.Presubmits, delta.After.Presubmits)); err != nil {
+	removed := removedBlockingPresubmits(delta.Before.Presubmits, delta.After.Presubmits)
+	if err := c.retireRemovedContexts(withoutInRepoConfigRepos(&delta.After, removed)); err != nil {
 		errors = append(errors, err)
 		if !c.continueOnError {
 			return errorutil.NewAggregate(errors...)
@@ -296,7 +298,7 @@ func addedBlockingPresubmits(old, new map[string][]config.Presubmit) map[string]
 							"name": oldPresubmit.Name,
 						}).Debug("Identified a newly-reporting blocking presubmit.")
 					}
-					if oldPresubmit.RunIfChanged != newPresubmit.RunIfChanged {
+					if changeMatcherChanged(oldPresubmit.RegexpChangeMatcher, newPresubmit.RegexpChangeMatcher) {
 						added[repo] = append(added[repo], newPresubmit)
 						logrus.WithFields(logrus.Fields{
 							"repo": repo,
@@ -325,6 +327,15 @@ func addedBlockingPresubmits(old, new map[string][]config.Presubmit) map[string]
 	return added
 }
 
+// changeMatcherChanged determines if a presubmit now runs over a different
+// set of files.
+func changeMatcherChanged(old, new config.RegexpChangeMatcher) bool {
+	return old.RunIfChanged != new.RunIfChanged ||
+		old.SkipIfOnlyChanged != new.SkipIfOnlyChanged ||
+		!sets.NewString(old.IncludeChanges...).Equal(sets.NewString(new.IncludeChanges...)) ||
+		!sets.NewString(old.ExcludeChanges...).Equal(sets.NewString(new.ExcludeChanges...))
+}
+
 // removedBlockingPresubmits determines stale blocking presubmits based on a
 // config update. Presubmits that are no longer blocking due to no longer
 // reporting or being optional require no action as Tide will honor those
@@ -363,6 +374,24 @@ func removedBlockingPresubmits(old, new map[string][]config.Presubmit) map[strin
 	return removed
 }
 
+// withoutInRepoConfigRepos drops the presubmits of repos that have in-repo
+// config enabled. A job that was removed from the central config of such a
+// repo may now be defined in its .prow.yaml, in which case PRs still need
+// its context, so we can not retire it.
+func withoutInRepoConfigRepos(cfg *config.Config, presubmits map[string][]config.Presubmit) map[string][]config.Presubmit {
+	filtered := map[string][]config.Presubmit{}
+	for repo, jobs := range presubmits {
+		if cfg.InRepoConfigEnabled(repo) {
+			if len(jobs) > 0 {
+				logrus.WithField("repo", repo).Infof("Not retiring %d removed blocking presubmits as the repo uses in-repo config.", len(jobs))
+			}
+			continue
+		}
+		filtered[repo] = jobs
+	}
+	return filtered
+}
+
 type presubmitMigration struct {
 	from, to config.Presubmit
 }
@@ -179,6 +179,27 @@ func TestAddedBlockingPresubmits(t *testing.T) {
 				}},
 			},
 		},
+		{
+			name: "required presubmit transitioning exclude_changes means added blocking jobs",
+			old: `"org/repo":
+- name: old-job
+  context: old-context
+  exclude_changes:
+  - docs/**`,
+			new: `"org/repo":
+- name: old-job
+  context: old-context
+  exclude_changes:
+  - docs/**
+  - "*.md"`,
+			expected: map[string][]config.Presubmit{
+				"org/repo": {{
+					JobBase:             config.JobBase{Name: "old-job"},
+					Reporter:            config.Reporter{Context: "old-context"},
+					RegexpChangeMatcher: config.RegexpChangeMatcher{ExcludeChanges: []string{"docs/**", "*.md"}},
+				}},
+			},
+		},
 		{
 			name: "optional presubmit transitioning run_if_changed means no added blocking jobs",
 			old: `"org/repo":
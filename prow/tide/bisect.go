@@ -0,0 +1,118 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// batchExclusionPeriod is how long a PR that broke its batch is left out of
+// new batches, unless its head changes first.
+const batchExclusionPeriod = time.Hour
+
+// batchExclusions tracks the PRs that bisection identified as breaking the
+// batches they were part of. Such PRs can still merge after passing their
+// presubmits, but are not picked for batches until their exclusion ends.
+type batchExclusions struct {
+	sync.Mutex
+	// until maps the key and head of an excluded PR to the end of its exclusion.
+	until map[string]time.Time
+}
+
+func exclusionKey(pr *PullRequest) string {
+	return fmt.Sprintf("%s@%s", prKey(pr), string(pr.HeadRefOID))
+}
+
+// exclude leaves a PR out of batches until the exclusion period has passed.
+// It returns false if the PR was already excluded.
+func (e *batchExclusions) exclude(pr *PullRequest, now time.Time) bool {
+	if e == nil {
+		return false
+	}
+	e.Lock()
+	defer e.Unlock()
+	for key, until := range e.until {
+		if !now.Before(until) {
+			delete(e.until, key)
+		}
+	}
+	key := exclusionKey(pr)
+	if _, excluded := e.until[key]; excluded {
+		return false
+	}
+	if e.until == nil {
+		e.until = make(map[string]time.Time)
+	}
+	e.until[key] = now.Add(batchExclusionPeriod)
+	return true
+}
+
+// excluded determines whether a PR is currently left out of batches.
+func (e *batchExclusions) excluded(pr *PullRequest, now time.Time) bool {
+	if e == nil {
+		return false
+	}
+	e.Lock()
+	defer e.Unlock()
+	until, ok := e.until[exclusionKey(pr)]
+	return ok && now.Before(until)
+}
+
+// batchCulprits returns the PRs that failed their tests when bisection tested
+// them alone in a batch of their own.
+func batchCulprits(batches []batchState) []PullRequest {
+	var culprits []PullRequest
+	for _, batch := range batches {
+		if len(batch.prs) == 1 && batch.state == failureState {
+			culprits = append(culprits, batch.prs[0])
+		}
+	}
+	return culprits
+}
+
+// bisectBatches returns the halves of the failed batches of which neither half
+// has been tested yet, and the PRs of those batches. Halves that fail in turn are bisected again
+// until the PRs that break the batch are tested on their own.
+func bisectBatches(batches []batchState) (failed []PullRequest, halves [][]PullRequest) {
+	tested := make(map[string]bool)
+	for _, batch := range batches {
+		tested[fmt.Sprint(prNumbers(batch.prs))] = true
+	}
+	inFailed := make(map[int]bool)
+	for _, batch := range batches {
+		if batch.state != failureState || len(batch.prs) < 2 {
+			continue
+		}
+		mid := len(batch.prs) / 2
+		first, second := batch.prs[:mid], batch.prs[mid:]
+		firstKey, secondKey := fmt.Sprint(prNumbers(first)), fmt.Sprint(prNumbers(second))
+		if tested[firstKey] || tested[secondKey] {
+			continue
+		}
+		tested[firstKey], tested[secondKey] = true, true
+		halves = append(halves, first, second)
+		for _, pr := range batch.prs {
+			if !inFailed[int(pr.Number)] {
+				inFailed[int(pr.Number)] = true
+				failed = append(failed, pr)
+			}
+		}
+	}
+	return failed, halves
+}
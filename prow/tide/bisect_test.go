@@ -0,0 +1,237 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	clienttesting "k8s.io/client-go/testing"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/client/clientset/versioned/fake"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git/localgit"
+)
+
+func TestBatchExclusions(t *testing.T) {
+	var pr PullRequest
+	pr.Repository.NameWithOwner = "o/r"
+	pr.Number = 1
+	pr.HeadRefOID = "sha"
+	updated := pr
+	updated.HeadRefOID = "new-sha"
+
+	now := time.Now()
+	e := &batchExclusions{}
+	if e.excluded(&pr, now) {
+		t.Error("PR should not be excluded before it is excluded")
+	}
+	if !e.exclude(&pr, now) {
+		t.Error("PR should be newly excluded")
+	}
+	if e.exclude(&pr, now) {
+		t.Error("PR should already be excluded")
+	}
+	if !e.excluded(&pr, now.Add(batchExclusionPeriod/2)) {
+		t.Error("PR should be excluded during the exclusion period")
+	}
+	if e.excluded(&updated, now) {
+		t.Error("PR should not be excluded once its head changed")
+	}
+	if e.excluded(&pr, now.Add(batchExclusionPeriod)) {
+		t.Error("PR should not be excluded after the exclusion period")
+	}
+	if !e.exclude(&pr, now.Add(batchExclusionPeriod)) {
+		t.Error("PR should be excluded again after the exclusion period")
+	}
+
+	var unset *batchExclusions
+	if unset.exclude(&pr, now) || unset.excluded(&pr, now) {
+		t.Error("PRs should never be excluded without exclusions")
+	}
+}
+
+func TestBisectBatches(t *testing.T) {
+	pr := func(num int) PullRequest {
+		var pr PullRequest
+		pr.Number = githubql.Int(num)
+		return pr
+	}
+	prs := func(nums ...int) []PullRequest {
+		var res []PullRequest
+		for _, num := range nums {
+			res = append(res, pr(num))
+		}
+		return res
+	}
+
+	testCases := []struct {
+		name             string
+		batches          []batchState
+		expectedFailed   []int
+		expectedHalves   []string
+		expectedCulprits []int
+	}{
+		{
+			name: "passing and pending batches are not bisected",
+			batches: []batchState{
+				{prs: prs(1, 2, 3), state: successState},
+				{prs: prs(4, 5), state: pendingState},
+			},
+		},
+		{
+			name: "failed batch is bisected",
+			batches: []batchState{
+				{prs: prs(1, 2, 3, 4, 5), state: failureState},
+			},
+			expectedFailed: []int{1, 2, 3, 4, 5},
+			expectedHalves: []string{"[1 2]", "[3 4 5]"},
+		},
+		{
+			name: "failed batch with tested halves is not bisected again",
+			batches: []batchState{
+				{prs: prs(1, 2, 3, 4), state: failureState},
+				{prs: prs(1, 2), state: successState},
+				{prs: prs(3, 4), state: pendingState},
+			},
+		},
+		{
+			name: "failed half is bisected down to the culprit",
+			batches: []batchState{
+				{prs: prs(1, 2, 3, 4), state: failureState},
+				{prs: prs(1, 2), state: successState},
+				{prs: prs(3, 4), state: failureState},
+			},
+			expectedFailed: []int{3, 4},
+			expectedHalves: []string{"[3]", "[4]"},
+		},
+		{
+			name: "PR failing on its own is a culprit",
+			batches: []batchState{
+				{prs: prs(3, 4), state: failureState},
+				{prs: prs(3), state: successState},
+				{prs: prs(4), state: failureState},
+			},
+			expectedCulprits: []int{4},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			failed, halves := bisectBatches(tc.batches)
+			if actual := prNumbers(failed); !reflect.DeepEqual(actual, tc.expectedFailed) {
+				t.Errorf("expected failed PRs %v, got %v", tc.expectedFailed, actual)
+			}
+			var actualHalves []string
+			for _, half := range halves {
+				actualHalves = append(actualHalves, fmt.Sprint(prNumbers(half)))
+			}
+			if !reflect.DeepEqual(actualHalves, tc.expectedHalves) {
+				t.Errorf("expected halves %v, got %v", tc.expectedHalves, actualHalves)
+			}
+			if actual := prNumbers(batchCulprits(tc.batches)); !reflect.DeepEqual(actual, tc.expectedCulprits) {
+				t.Errorf("expected culprits %v, got %v", tc.expectedCulprits, actual)
+			}
+		})
+	}
+}
+
+func TestTakeActionBisectsFailedBatch(t *testing.T) {
+	lg, gc, err := localgit.New()
+	if err != nil {
+		t.Fatalf("Error making local git: %v", err)
+	}
+	defer gc.Clean()
+	defer lg.Clean()
+	if err := lg.MakeFakeRepo("o", "r"); err != nil {
+		t.Fatalf("Error making fake repo: %v", err)
+	}
+	if err := lg.AddCommit("o", "r", map[string][]byte{"foo": []byte("foo")}); err != nil {
+		t.Fatalf("Adding initial commit: %v", err)
+	}
+
+	sp := subpool{
+		log:        logrus.WithField("component", "tide"),
+		presubmits: map[int][]config.Presubmit{},
+		cc:         &config.TideContextPolicy{},
+		org:        "o",
+		repo:       "r",
+		branch:     "master",
+		sha:        "master",
+	}
+	failedBatch := prowapi.ProwJob{
+		Spec: prowapi.ProwJobSpec{
+			Type:    prowapi.BatchJob,
+			Context: "foo",
+			Refs:    &prowapi.Refs{Org: "o", Repo: "r", BaseRef: "master", BaseSHA: "master"},
+		},
+		Status: prowapi.ProwJobStatus{State: prowapi.FailureState},
+	}
+	for i := 1; i <= 4; i++ {
+		var pr PullRequest
+		pr.Number = githubql.Int(i)
+		pr.HeadRefOID = githubql.String(fmt.Sprintf("sha-%d", i))
+		sp.prs = append(sp.prs, pr)
+		sp.presubmits[i] = []config.Presubmit{{Reporter: config.Reporter{Context: "foo"}}}
+		failedBatch.Spec.Refs.Pulls = append(failedBatch.Spec.Refs.Pulls, prowapi.Pull{Number: i, SHA: string(pr.HeadRefOID)})
+	}
+	sp.pjs = []prowapi.ProwJob{failedBatch}
+
+	ca := &config.Agent{}
+	ca.Set(&config.Config{})
+	fakeProwJobClient := fake.NewSimpleClientset()
+	c := &Controller{
+		logger:        logrus.WithField("controller", "tide"),
+		gc:            gc,
+		config:        ca.Config,
+		ghc:           &fgc{},
+		prowJobClient: fakeProwJobClient.ProwV1().ProwJobs("prowjobs"),
+	}
+
+	act, targets, err := c.takeAction(sp, nil, nil, nil, sp.prs, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error in takeAction: %v", err)
+	}
+	if act != Bisect {
+		t.Errorf("Wrong action. Got %v, wanted %v.", act, Bisect)
+	}
+	if actual, expected := prNumbers(targets), []int{1, 2, 3, 4}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Wrong targets. Got %v, wanted %v.", actual, expected)
+	}
+	var triggered []string
+	for _, action := range fakeProwJobClient.Actions() {
+		if action, ok := action.(clienttesting.CreateActionImpl); ok {
+			pj := action.Object.(*prowapi.ProwJob)
+			if pj.Spec.Type != prowapi.BatchJob {
+				t.Errorf("Expected only batch jobs, got a %s job.", pj.Spec.Type)
+			}
+			var nums []int
+			for _, pull := range pj.Spec.Refs.Pulls {
+				nums = append(nums, pull.Number)
+			}
+			triggered = append(triggered, fmt.Sprint(nums))
+		}
+	}
+	if expected := []string{"[1 2]", "[3 4]"}; !reflect.DeepEqual(triggered, expected) {
+		t.Errorf("Wrong batches triggered. Got %v, wanted %v.", triggered, expected)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"sort"
+	"time"
+
+	"k8s.io/test-infra/prow/config"
+)
+
+// Freeze is an active merge freeze that blocks a pool.
+type Freeze struct {
+	Name  string
+	Until time.Time
+}
+
+// activeFreezes returns the merge freezes that apply to a branch and are
+// active at the given time, sorted by when they end.
+func activeFreezes(freezes []config.TideMergeFreeze, org, repo, branch string, now time.Time) []Freeze {
+	var res []Freeze
+	for i := range freezes {
+		if !freezes[i].AppliesTo(org, repo, branch) {
+			continue
+		}
+		if until, active := freezes[i].ActiveUntil(now); active {
+			res = append(res, Freeze{Name: freezes[i].Name, Until: until})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Until.Before(res[j].Until) })
+	return res
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/config"
+)
+
+func TestActiveFreezes(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2019, time.December, d, 0, 0, 0, 0, time.UTC)
+	}
+	freezes := []config.TideMergeFreeze{
+		{Name: "release", Orgs: []string{"o"}, Branches: []string{"master"}, Start: day(2), End: day(16)},
+		{Name: "holiday", Start: day(1), End: day(9)},
+		{Name: "other repo", Repos: []string{"o/other"}, Start: day(1), End: day(31)},
+		{Name: "past", Start: day(1), End: day(3)},
+	}
+
+	testCases := []struct {
+		name     string
+		branch   string
+		expected []Freeze
+	}{
+		{
+			name:   "freezes are sorted by their end",
+			branch: "master",
+			expected: []Freeze{
+				{Name: "holiday", Until: day(9)},
+				{Name: "release", Until: day(16)},
+			},
+		},
+		{
+			name:     "freezes of other branches do not apply",
+			branch:   "release-1.17",
+			expected: []Freeze{{Name: "holiday", Until: day(9)}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := activeFreezes(freezes, "o", "r", tc.branch, day(5)); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected freezes %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
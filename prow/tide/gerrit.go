@@ -0,0 +1,340 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/gerrit/adapter"
+	gerritclient "k8s.io/test-infra/prow/gerrit/client"
+	"k8s.io/test-infra/prow/pjutil"
+)
+
+type gerritClient interface {
+	Query(instance, query string, rateLimit int) ([]gerritclient.ChangeInfo, error)
+	GetBranchRevision(instance, project, branch string) (string, error)
+	Submit(instance, id, revision string) error
+}
+
+// gerritChange holds the data that is needed to test and submit a Gerrit
+// change in addition to the PullRequest that represents it in its subpool.
+type gerritChange struct {
+	instance string
+	cloneURI *url.URL
+	info     gerritclient.ChangeInfo
+}
+
+// gerritPullRequest converts a Gerrit change into a PullRequest, so that it
+// can share the logic of GitHub subpools. The org of the PR is the host of
+// the Gerrit instance and the repo is the project, like in the refs of the
+// ProwJobs that test the change.
+func gerritPullRequest(host string, info gerritclient.ChangeInfo) PullRequest {
+	var pr PullRequest
+	pr.Number = githubql.Int(info.Number)
+	pr.Author.Login = githubql.String(info.Owner.Name)
+	pr.BaseRef.Name = githubql.String(info.Branch)
+	pr.BaseRef.Prefix = "refs/heads/"
+	pr.HeadRefOID = githubql.String(info.CurrentRevision)
+	pr.Repository.Name = githubql.String(info.Project)
+	pr.Repository.NameWithOwner = githubql.String(host + "/" + info.Project)
+	pr.Repository.Owner.Login = githubql.String(host)
+	pr.Commits.Nodes = []struct{ Commit Commit }{{Commit: Commit{OID: githubql.String(info.CurrentRevision)}}}
+	pr.Title = githubql.String(info.Subject)
+	return pr
+}
+
+// gerritChanges runs the Gerrit queries and returns the matching changes as
+// PullRequests, along with the Gerrit data of every change, both keyed by
+// prKey.
+func (c *Controller) gerritChanges() (map[string]PullRequest, map[string]gerritChange) {
+	queries := c.config().Tide.GerritQueries
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	if c.gerrit == nil {
+		c.logger.Warning("Ignoring the Gerrit queries, no Gerrit client is configured.")
+		return nil, nil
+	}
+	prs := make(map[string]PullRequest)
+	changes := make(map[string]gerritChange)
+	for _, query := range queries {
+		q := query.Query()
+		results, err := c.gerrit.Query(query.Instance, q, c.config().Gerrit.RateLimit)
+		if err != nil {
+			// Do not let an unavailable Gerrit instance block GitHub merges.
+			c.logger.WithError(err).WithFields(logrus.Fields{
+				"instance": query.Instance,
+				"query":    q,
+			}).Warning("Failed to query Gerrit changes.")
+			continue
+		}
+		for _, info := range results {
+			cloneURI, err := adapter.MakeCloneURI(query.Instance, info.Project)
+			if err != nil {
+				c.logger.WithError(err).WithField("instance", query.Instance).Warning("Failed to create clone URI.")
+				continue
+			}
+			pr := gerritPullRequest(cloneURI.Host, info)
+			prs[prKey(&pr)] = pr
+			changes[prKey(&pr)] = gerritChange{
+				instance: query.Instance,
+				cloneURI: cloneURI,
+				info:     info,
+			}
+		}
+	}
+	return prs, changes
+}
+
+// divideGerritPool splits up the Gerrit changes and prow jobs into a group
+// per project and branch, like dividePool does for GitHub PRs. It determines
+// the required presubmits of every change right away.
+func (c *Controller) divideGerritPool(prs map[string]PullRequest, changes map[string]gerritChange, pjs []prowapi.ProwJob) (map[string]*subpool, error) {
+	cfg := c.config()
+	sps := make(map[string]*subpool)
+	unavailable := sets.NewString()
+	for key, pr := range prs {
+		change := changes[key]
+		org := string(pr.Repository.Owner.Login)
+		repo := string(pr.Repository.Name)
+		branch := string(pr.BaseRef.Name)
+		fn := poolKey(org, repo, branch)
+		if unavailable.Has(fn) {
+			continue
+		}
+		if sps[fn] == nil {
+			sha, err := c.gerrit.GetBranchRevision(change.instance, repo, branch)
+			if err != nil {
+				// Do not let an unavailable Gerrit instance block other pools.
+				c.logger.WithError(err).WithField("pool", fn).Warning("Failed to get the revision of the branch.")
+				unavailable.Insert(fn)
+				continue
+			}
+			sps[fn] = &subpool{
+				log: c.logger.WithFields(logrus.Fields{
+					"org":      org,
+					"repo":     repo,
+					"branch":   branch,
+					"base-sha": sha,
+				}),
+				org:        org,
+				repo:       repo,
+				branch:     branch,
+				sha:        sha,
+				cc:         &config.TideContextPolicy{},
+				presubmits: make(map[int][]config.Presubmit),
+			}
+		}
+		sp := sps[fn]
+		sp.prs = append(sp.prs, pr)
+
+		// The Gerrit adapter looks up presubmits by both forms of the clone URI.
+		presubmits := cfg.Presubmits[change.cloneURI.String()]
+		presubmits = append(presubmits, cfg.Presubmits[change.cloneURI.Host+"/"+change.cloneURI.Path]...)
+		for _, ps := range presubmits {
+			if !ps.ContextRequired() {
+				continue
+			}
+			if shouldRun, err := ps.ShouldRun(branch, gerritChangedFiles(change.info), false, false); err != nil {
+				return nil, err
+			} else if shouldRun {
+				sp.presubmits[int(pr.Number)] = append(sp.presubmits[int(pr.Number)], ps)
+			}
+		}
+	}
+	for _, sp := range sps {
+		sortByPriority(sp.prs, cfg.Tide.PriorityFor(sp.org, sp.repo))
+	}
+	for _, pj := range pjs {
+		if pj.Spec.Type != prowapi.PresubmitJob {
+			continue
+		}
+		fn := poolKey(pj.Spec.Refs.Org, pj.Spec.Refs.Repo, pj.Spec.Refs.BaseRef)
+		if sps[fn] == nil || pj.Spec.Refs.BaseSHA != sps[fn].sha {
+			continue
+		}
+		sps[fn].pjs = append(sps[fn].pjs, pj)
+	}
+	return sps, nil
+}
+
+// gerritChangedFiles lists the files changed by the current revision of a
+// change.
+func gerritChangedFiles(info gerritclient.ChangeInfo) config.ChangedFilesProvider {
+	return func() ([]string, error) {
+		var changed []string
+		for file := range info.Revisions[info.CurrentRevision].Files {
+			changed = append(changed, file)
+		}
+		return changed, nil
+	}
+}
+
+// syncGerritSubpool takes the action for a subpool of Gerrit changes. Gerrit
+// changes are tested and submitted one at a time: the passing change with the
+// highest priority is submitted, otherwise the presubmits of the next change
+// are run against the tip of the branch.
+func (c *Controller) syncGerritSubpool(sp subpool, changes map[string]gerritChange, freezes []Freeze) (Pool, error) {
+	sp.log.Infof("Syncing Gerrit subpool: %d changes, %d PJs.", len(sp.prs), len(sp.pjs))
+	positions := make(map[int]int, len(sp.prs))
+	for i, pr := range sp.prs {
+		positions[int(pr.Number)] = i + 1
+	}
+	successes, pendings, nones := accumulate(sp.presubmits, sp.prs, sp.pjs, sp.log)
+	failures, nones := splitFailedChanges(sp, nones)
+	sp.log.WithFields(logrus.Fields{
+		"changes-passing": prNumbers(successes),
+		"changes-pending": prNumbers(pendings),
+		"changes-failing": prNumbers(failures),
+		"changes-missing": prNumbers(nones),
+	}).Info("Gerrit subpool accumulated.")
+
+	var act Action
+	var targets []PullRequest
+	var err error
+	var errorString string
+	if len(freezes) > 0 {
+		act = PoolFrozen
+	} else {
+		act, targets, err = c.takeGerritAction(sp, changes, successes, pendings, nones)
+		if err != nil {
+			errorString = err.Error()
+		}
+		c.recordAction(sp, act, targets)
+		if recordableActions[act] {
+			c.History.Record(
+				poolKey(sp.org, sp.repo, sp.branch),
+				string(act),
+				sp.sha,
+				errorString,
+				prMeta(targets...),
+			)
+		}
+	}
+
+	sp.log.WithFields(logrus.Fields{
+		"action":  string(act),
+		"targets": prNumbers(targets),
+	}).Info("Gerrit subpool synced.")
+	tideMetrics.pooledPRs.WithLabelValues(sp.org, sp.repo, sp.branch).Set(float64(len(sp.prs)))
+	tideMetrics.updateTime.WithLabelValues(sp.org, sp.repo, sp.branch).Set(float64(time.Now().Unix()))
+	return Pool{
+			Org:     sp.org,
+			Repo:    sp.repo,
+			Branch:  sp.branch,
+			BaseSHA: sp.sha,
+
+			SuccessPRs: successes,
+			PendingPRs: pendings,
+			MissingPRs: nones,
+			Positions:  positions,
+
+			Action:  act,
+			Target:  targets,
+			Freezes: freezes,
+			Error:   errorString,
+		},
+		err
+}
+
+// splitFailedChanges separates the changes with a required presubmit that
+// failed for their current revision on the current tip from those that were
+// not tested yet. Failed changes are not retested until they get a new
+// revision or the tip moves.
+func splitFailedChanges(sp subpool, nones []PullRequest) (failures, missings []PullRequest) {
+	for _, pr := range nones {
+		psStates := presubmitStates(pr, sp.pjs)
+		failed := false
+		for _, ps := range sp.presubmits[int(pr.Number)] {
+			if psStates[ps.Context] == failureState {
+				failed = true
+				break
+			}
+		}
+		if failed {
+			failures = append(failures, pr)
+		} else {
+			missings = append(missings, pr)
+		}
+	}
+	return failures, missings
+}
+
+// takeGerritAction submits or tests the first change of a subpool. The changes
+// are already sorted by priority.
+func (c *Controller) takeGerritAction(sp subpool, changes map[string]gerritChange, successes, pendings, nones []PullRequest) (Action, []PullRequest, error) {
+	if len(successes) > 0 {
+		pr := successes[0]
+		change := changes[prKey(&pr)]
+		if err := c.gerrit.Submit(change.instance, change.info.ID, change.info.CurrentRevision); err != nil {
+			return Merge, []PullRequest{pr}, err
+		}
+		tideMetrics.merges.WithLabelValues(sp.org, sp.repo, sp.branch).Observe(1)
+		c.recordMerged(sp, pr)
+		return Merge, []PullRequest{pr}, nil
+	}
+	// If no presubmits are configured, just wait.
+	if len(sp.presubmits) == 0 {
+		return Wait, nil, nil
+	}
+	// Only retest one change at a time, as every submit moves the tip of the
+	// branch and invalidates the results of the other changes.
+	if len(nones) > 0 && len(pendings) == 0 {
+		pr := nones[0]
+		return Trigger, []PullRequest{pr}, c.triggerGerrit(sp, changes[prKey(&pr)])
+	}
+	return Wait, nil, nil
+}
+
+// triggerGerrit creates the presubmits of a change against the tip of its
+// branch. The ProwJobs carry the same annotations and labels as the ones the
+// Gerrit adapter creates, so that their results are reported to the change.
+func (c *Controller) triggerGerrit(sp subpool, change gerritChange) error {
+	refs, err := adapter.CreateRefs(change.instance, change.info, change.cloneURI, sp.sha)
+	if err != nil {
+		return fmt.Errorf("failed to create refs: %v", err)
+	}
+	annotations := map[string]string{
+		gerritclient.GerritID:       change.info.ID,
+		gerritclient.GerritInstance: change.instance,
+	}
+	for _, ps := range sp.presubmits[change.info.Number] {
+		labels := make(map[string]string)
+		for k, v := range ps.Labels {
+			labels[k] = v
+		}
+		labels[gerritclient.GerritRevision] = change.info.CurrentRevision
+
+		spec := pjutil.PresubmitSpec(ps, refs)
+		pj := pjutil.NewProwJobWithAnnotation(spec, labels, annotations)
+		start := time.Now()
+		if _, err := c.prowJobClient.Create(&pj); err != nil {
+			c.logger.WithField("duration", time.Since(start).String()).Debug("Failed to create ProwJob on the cluster.")
+			return fmt.Errorf("failed to create a ProwJob for job: %q, change: %d: %v", spec.Job, change.info.Number, err)
+		}
+		c.logger.WithField("duration", time.Since(start).String()).Debug("Created ProwJob on the cluster.")
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	clienttesting "k8s.io/client-go/testing"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/client/clientset/versioned/fake"
+	"k8s.io/test-infra/prow/config"
+	gerritclient "k8s.io/test-infra/prow/gerrit/client"
+	"k8s.io/test-infra/prow/tide/history"
+)
+
+const (
+	gerritInstance = "https://host-review.example.com"
+	gerritHost     = "host-review.example.com"
+)
+
+type fakeGerrit struct {
+	changes   []gerritclient.ChangeInfo
+	queries   []string
+	tip       string
+	submitted []string
+	submitErr error
+}
+
+func (f *fakeGerrit) Query(instance, query string, rateLimit int) ([]gerritclient.ChangeInfo, error) {
+	if instance != gerritInstance {
+		return nil, errors.New("unknown instance")
+	}
+	f.queries = append(f.queries, query)
+	return f.changes, nil
+}
+
+func (f *fakeGerrit) GetBranchRevision(instance, project, branch string) (string, error) {
+	return f.tip, nil
+}
+
+func (f *fakeGerrit) Submit(instance, id, revision string) error {
+	if f.submitErr != nil {
+		return f.submitErr
+	}
+	f.submitted = append(f.submitted, id+"@"+revision)
+	return nil
+}
+
+func gerritChangeInfo(number int, id, revision string) gerritclient.ChangeInfo {
+	return gerritclient.ChangeInfo{
+		ID:              id,
+		Number:          number,
+		Project:         "proj",
+		Branch:          "master",
+		Status:          gerritclient.New,
+		CurrentRevision: revision,
+		Revisions: map[string]gerritclient.RevisionInfo{
+			revision: {Ref: "refs/changes/" + id},
+		},
+	}
+}
+
+func gerritJob(number int, revision, baseSHA string, state prowapi.ProwJobState) prowapi.ProwJob {
+	return prowapi.ProwJob{
+		Spec: prowapi.ProwJobSpec{
+			Type:    prowapi.PresubmitJob,
+			Context: "verify",
+			Refs: &prowapi.Refs{
+				Org:     gerritHost,
+				Repo:    "proj",
+				BaseRef: "master",
+				BaseSHA: baseSHA,
+				Pulls:   []prowapi.Pull{{Number: number, SHA: revision}},
+			},
+		},
+		Status: prowapi.ProwJobStatus{State: state},
+	}
+}
+
+func TestSyncGerrit(t *testing.T) {
+	testCases := []struct {
+		name    string
+		changes []gerritclient.ChangeInfo
+		pjs     []prowapi.ProwJob
+		freeze  bool
+
+		expectedAction    Action
+		expectedTargets   []int
+		expectedSubmitted []string
+		expectedTriggered int
+	}{
+		{
+			name:              "untested change is tested against the tip",
+			changes:           []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a")},
+			expectedAction:    Trigger,
+			expectedTargets:   []int{1},
+			expectedTriggered: 1,
+		},
+		{
+			name:              "change tested against an old tip is retested",
+			changes:           []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a")},
+			pjs:               []prowapi.ProwJob{gerritJob(1, "rev-a", "old-tip", prowapi.SuccessState)},
+			expectedAction:    Trigger,
+			expectedTargets:   []int{1},
+			expectedTriggered: 1,
+		},
+		{
+			name:            "change is not retested while another one is pending",
+			changes:         []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a"), gerritChangeInfo(2, "b", "rev-b")},
+			pjs:             []prowapi.ProwJob{gerritJob(2, "rev-b", "tip", prowapi.PendingState)},
+			expectedAction:  Wait,
+			expectedTargets: nil,
+		},
+		{
+			name:              "passing change is submitted",
+			changes:           []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a"), gerritChangeInfo(2, "b", "rev-b")},
+			pjs:               []prowapi.ProwJob{gerritJob(2, "rev-b", "tip", prowapi.SuccessState)},
+			expectedAction:    Merge,
+			expectedTargets:   []int{2},
+			expectedSubmitted: []string{"b@rev-b"},
+		},
+		{
+			name:              "change that passed on an old revision is retested",
+			changes:           []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a2")},
+			pjs:               []prowapi.ProwJob{gerritJob(1, "rev-a1", "tip", prowapi.SuccessState)},
+			expectedAction:    Trigger,
+			expectedTargets:   []int{1},
+			expectedTriggered: 1,
+		},
+		{
+			name:              "change that failed on the tip is not retested",
+			changes:           []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a"), gerritChangeInfo(2, "b", "rev-b")},
+			pjs:               []prowapi.ProwJob{gerritJob(1, "rev-a", "tip", prowapi.FailureState)},
+			expectedAction:    Trigger,
+			expectedTargets:   []int{2},
+			expectedTriggered: 1,
+		},
+		{
+			name:           "failed change is not retested while alone in the pool",
+			changes:        []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a")},
+			pjs:            []prowapi.ProwJob{gerritJob(1, "rev-a", "tip", prowapi.FailureState)},
+			expectedAction: Wait,
+		},
+		{
+			name:              "change that failed on an old revision is retested",
+			changes:           []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a2")},
+			pjs:               []prowapi.ProwJob{gerritJob(1, "rev-a1", "tip", prowapi.FailureState)},
+			expectedAction:    Trigger,
+			expectedTargets:   []int{1},
+			expectedTriggered: 1,
+		},
+		{
+			name:           "frozen pool is not submitted",
+			changes:        []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a")},
+			pjs:            []prowapi.ProwJob{gerritJob(1, "rev-a", "tip", prowapi.SuccessState)},
+			freeze:         true,
+			expectedAction: PoolFrozen,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			if err := cfg.SetPresubmits(map[string][]config.Presubmit{
+				gerritInstance + "/proj": {{
+					JobBase:   config.JobBase{Name: "verify"},
+					Reporter:  config.Reporter{Context: "verify"},
+					AlwaysRun: true,
+				}},
+			}); err != nil {
+				t.Fatalf("failed to set presubmits: %v", err)
+			}
+			cfg.Tide.GerritQueries = []config.TideGerritQuery{{
+				Instance: gerritInstance,
+				Projects: []string{"proj"},
+				Labels:   []string{"Code-Review=+2"},
+			}}
+			if tc.freeze {
+				cfg.Tide.MergeFreezes = []config.TideMergeFreeze{{
+					Name:  "freeze",
+					Start: time.Now().Add(-time.Hour),
+					End:   time.Now().Add(time.Hour),
+				}}
+			}
+			ca := &config.Agent{}
+			ca.Set(cfg)
+			hist, err := history.New(100, nil, "")
+			if err != nil {
+				t.Fatalf("Failed to create history client: %v", err)
+			}
+			fgerrit := &fakeGerrit{changes: tc.changes, tip: "tip"}
+			fakeProwJobClient := fake.NewSimpleClientset()
+			c := &Controller{
+				logger:        logrus.WithField("component", "tide"),
+				config:        ca.Config,
+				gerrit:        fgerrit,
+				prowJobClient: fakeProwJobClient.ProwV1().ProwJobs("prowjobs"),
+				History:       hist,
+			}
+
+			prs, changes := c.gerritChanges()
+			sps, err := c.divideGerritPool(prs, changes, tc.pjs)
+			if err != nil {
+				t.Fatalf("Unexpected error dividing the pool: %v", err)
+			}
+			sp, ok := sps[poolKey(gerritHost, "proj", "master")]
+			if !ok {
+				t.Fatalf("Expected a subpool for the project, got %v", sps)
+			}
+			freezes := activeFreezes(cfg.Tide.MergeFreezes, sp.org, sp.repo, sp.branch, time.Now())
+			pool, err := c.syncGerritSubpool(*sp, changes, freezes)
+			if err != nil {
+				t.Fatalf("Unexpected error syncing the subpool: %v", err)
+			}
+
+			if pool.Action != tc.expectedAction {
+				t.Errorf("Wrong action. Got %v, wanted %v.", pool.Action, tc.expectedAction)
+			}
+			if actual := prNumbers(pool.Target); !reflect.DeepEqual(actual, tc.expectedTargets) {
+				t.Errorf("Wrong targets. Got %v, wanted %v.", actual, tc.expectedTargets)
+			}
+			if !reflect.DeepEqual(fgerrit.submitted, tc.expectedSubmitted) {
+				t.Errorf("Wrong changes submitted. Got %v, wanted %v.", fgerrit.submitted, tc.expectedSubmitted)
+			}
+			var triggered int
+			for _, action := range fakeProwJobClient.Actions() {
+				if action, ok := action.(clienttesting.CreateActionImpl); ok {
+					triggered++
+					pj := action.Object.(*prowapi.ProwJob)
+					if pj.Spec.Refs.BaseSHA != "tip" {
+						t.Errorf("Expected the change to be tested against the tip, got %q.", pj.Spec.Refs.BaseSHA)
+					}
+					if pj.Spec.Refs.CloneURI != gerritInstance+"/proj" {
+						t.Errorf("Wrong clone URI %q.", pj.Spec.Refs.CloneURI)
+					}
+					if pj.Annotations[gerritclient.GerritInstance] != gerritInstance {
+						t.Errorf("Expected the job to be annotated with the Gerrit instance, got %v.", pj.Annotations)
+					}
+				}
+			}
+			if triggered != tc.expectedTriggered {
+				t.Errorf("Wrong number of jobs triggered. Got %d, wanted %d.", triggered, tc.expectedTriggered)
+			}
+		})
+	}
+}
+
+func TestSyncGerritSubmitError(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tide.GerritQueries = []config.TideGerritQuery{{Instance: gerritInstance, Projects: []string{"proj"}}}
+	ca := &config.Agent{}
+	ca.Set(cfg)
+	hist, err := history.New(100, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create history client: %v", err)
+	}
+	fgerrit := &fakeGerrit{
+		changes:   []gerritclient.ChangeInfo{gerritChangeInfo(1, "a", "rev-a")},
+		tip:       "tip",
+		submitErr: errors.New("outdated revision"),
+	}
+	c := &Controller{
+		logger:  logrus.WithField("component", "tide"),
+		config:  ca.Config,
+		gerrit:  fgerrit,
+		History: hist,
+	}
+
+	prs, changes := c.gerritChanges()
+	sps, err := c.divideGerritPool(prs, changes, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dividing the pool: %v", err)
+	}
+	// Without presubmits, the change passes right away.
+	pool, err := c.syncGerritSubpool(*sps[poolKey(gerritHost, "proj", "master")], changes, nil)
+	if err == nil {
+		t.Error("Expected an error submitting the change.")
+	}
+	if pool.Action != Merge || pool.Error == "" {
+		t.Errorf("Expected a failed merge, got action %v with error %q.", pool.Action, pool.Error)
+	}
+	if expected := `status:open project:"proj"`; !reflect.DeepEqual(fgerrit.queries, []string{expected}) {
+		t.Errorf("Wrong queries. Got %v, wanted %v.", fgerrit.queries, []string{expected})
+	}
+}
@@ -15,7 +15,7 @@ limitations under the License.
 */
 
 // Package history provides an append only, size limited log of recent actions
-// that Tide has taken for each subpool.
+// that Tide has taken for each subpool, and a timeline of the events of each PR.
 package history
 
 import (
@@ -42,6 +42,8 @@ var now = time.Now
 // for inactive pools even if other pools are very active.
 type History struct {
 	logs map[string]*recordLog
+	// timelines maps PR keys (org/repo#1) to the timelines of the PRs.
+	timelines map[string]*Timeline
 	sync.Mutex
 	logSizeLimit int
 
@@ -108,12 +110,26 @@ type Record struct {
 	BaseSHA string         `json:"baseSHA,omitempty"`
 	Target  []prowapi.Pull `json:"target,omitempty"`
 	Err     string         `json:"err,omitempty"`
+	// MergeSHA is the SHA of the branch after a merge, if merges into the
+	// pool are verified by postsubmits.
+	MergeSHA string `json:"mergeSHA,omitempty"`
+	// Queue is the state of the speculative merge queue, if the pool uses one.
+	Queue []QueuedBatch `json:"queue,omitempty"`
+}
+
+// QueuedBatch is one of the candidate batches of a speculative merge queue and
+// the state of its tests ("success", "pending" or "failure") when the action
+// was taken.
+type QueuedBatch struct {
+	Pulls []prowapi.Pull `json:"pulls"`
+	State string         `json:"state"`
 }
 
 // New creates a new History struct with the specificed recordLog size limit.
 func New(maxRecordsPerKey int, opener io.Opener, path string) (*History, error) {
 	hist := &History{
 		logs:         map[string]*recordLog{},
+		timelines:    map[string]*Timeline{},
 		logSizeLimit: maxRecordsPerKey,
 		opener:       opener,
 		path:         path,
@@ -131,6 +147,16 @@ func New(maxRecordsPerKey int, opener io.Opener, path string) (*History, error)
 			"duration": time.Since(start).String(),
 			"path":     hist.path,
 		}).Debugf("Successfully read action history for %d pools.", len(hist.logs))
+
+		start = time.Now()
+		hist.timelines, err = readTimelines(hist.opener, timelinesPath(hist.path))
+		if err != nil {
+			return nil, err
+		}
+		logrus.WithFields(logrus.Fields{
+			"duration": time.Since(start).String(),
+			"path":     timelinesPath(hist.path),
+		}).Debugf("Successfully read timelines for %d PRs.", len(hist.timelines))
 	}
 
 	return hist, nil
@@ -138,16 +164,30 @@ func New(maxRecordsPerKey int, opener io.Opener, path string) (*History, error)
 
 // Record appends an entry to the recordlog specified by the poolKey.
 func (h *History) Record(poolKey, action, baseSHA, err string, targets []prowapi.Pull) {
+	h.RecordQueue(poolKey, action, baseSHA, err, targets, nil)
+}
+
+// RecordQueue appends an entry to the recordlog specified by the poolKey that
+// also records the state of the speculative merge queue of the pool.
+func (h *History) RecordQueue(poolKey, action, baseSHA, err string, targets []prowapi.Pull, queue []QueuedBatch) {
+	h.RecordMerge(poolKey, action, baseSHA, "", err, targets, queue)
+}
+
+// RecordMerge appends an entry to the recordlog specified by the poolKey that
+// also records the SHA of the branch after a merge.
+func (h *History) RecordMerge(poolKey, action, baseSHA, mergeSHA, err string, targets []prowapi.Pull, queue []QueuedBatch) {
 	t := now()
 	sort.Sort(ByNum(targets))
 	h.addRecord(
 		poolKey,
 		&Record{
-			Time:    t,
-			Action:  action,
-			BaseSHA: baseSHA,
-			Target:  targets,
-			Err:     err,
+			Time:     t,
+			Action:   action,
+			BaseSHA:  baseSHA,
+			MergeSHA: mergeSHA,
+			Target:   targets,
+			Err:      err,
+			Queue:    queue,
 		},
 	)
 }
@@ -162,8 +202,16 @@ func (h *History) addRecord(poolKey string, rec *Record) {
 }
 
 // ServeHTTP serves a JSON mapping from pool key -> sorted records for the pool.
+// If the "timelines" query parameter is set, it serves a JSON mapping from PR
+// key -> timeline of the PR instead.
 func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	b, err := json.Marshal(h.AllRecords())
+	var b []byte
+	var err error
+	if r.URL.Query().Get("timelines") != "" {
+		b, err = json.Marshal(h.Timelines())
+	} else {
+		b, err = json.Marshal(h.AllRecords())
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Encoding JSON history.")
 		b = []byte("{}")
@@ -190,6 +238,19 @@ func (h *History) Flush() {
 	} else {
 		log.Debugf("Successfully flushed action history for %d pools.", len(h.logs))
 	}
+
+	timelines := h.Timelines()
+	start = time.Now()
+	err = writeTimelines(h.opener, timelinesPath(h.path), timelines)
+	log = logrus.WithFields(logrus.Fields{
+		"duration": time.Since(start).String(),
+		"path":     timelinesPath(h.path),
+	})
+	if err != nil {
+		log.WithError(err).Error("Error flushing timelines to GCS.")
+	} else {
+		log.Debugf("Successfully flushed timelines for %d PRs.", len(timelines))
+	}
 }
 
 // AllRecords generates a map from pool key -> sorted records for the pool.
@@ -204,6 +265,17 @@ func (h *History) AllRecords() map[string][]*Record {
 	return res
 }
 
+// PoolRecords returns the records of a pool, newest first.
+func (h *History) PoolRecords(poolKey string) []*Record {
+	h.Lock()
+	defer h.Unlock()
+
+	if log, ok := h.logs[poolKey]; ok {
+		return log.toSlice()
+	}
+	return nil
+}
+
 // recordLog is a space efficient, limited size, append only list.
 type recordLog struct {
 	buff  []*Record
@@ -64,9 +64,12 @@ func TestHistory(t *testing.T) {
 	time3 := nextTime()
 	hist.Record("pool B", "MERGE", "sha B2", "", []prowapi.Pull{testMeta(3, "jeff")})
 	time4 := nextTime()
-	hist.Record("pool B", "MERGE_BATCH", "sha B3", "", []prowapi.Pull{testMeta(4, "joe"), testMeta(5, "jim")})
+	hist.RecordMerge("pool B", "MERGE_BATCH", "sha B3", "sha B4", "", []prowapi.Pull{testMeta(4, "joe"), testMeta(5, "jim")}, nil)
 	time5 := nextTime()
-	hist.Record("pool C", "TRIGGER_BATCH", "sha C1", "", []prowapi.Pull{testMeta(6, "joe"), testMeta(8, "me")})
+	hist.RecordQueue("pool C", "TRIGGER_BATCH", "sha C1", "", []prowapi.Pull{testMeta(6, "joe"), testMeta(8, "me")}, []QueuedBatch{
+		{Pulls: []prowapi.Pull{testMeta(6, "joe")}, State: "success"},
+		{Pulls: []prowapi.Pull{testMeta(6, "joe"), testMeta(8, "me")}, State: "pending"},
+	})
 	time6 := nextTime()
 	hist.Record("pool B", "TRIGGER", "sha B4", "", []prowapi.Pull{testMeta(7, "abe")})
 
@@ -91,9 +94,10 @@ func TestHistory(t *testing.T) {
 				},
 			},
 			&Record{
-				Time:    time4,
-				BaseSHA: "sha B3",
-				Action:  "MERGE_BATCH",
+				Time:     time4,
+				BaseSHA:  "sha B3",
+				MergeSHA: "sha B4",
+				Action:   "MERGE_BATCH",
 				Target: []prowapi.Pull{
 					testMeta(4, "joe"),
 					testMeta(5, "jim"),
@@ -117,6 +121,10 @@ func TestHistory(t *testing.T) {
 					testMeta(6, "joe"),
 					testMeta(8, "me"),
 				},
+				Queue: []QueuedBatch{
+					{Pulls: []prowapi.Pull{testMeta(6, "joe")}, State: "success"},
+					{Pulls: []prowapi.Pull{testMeta(6, "joe"), testMeta(8, "me")}, State: "pending"},
+				},
 			},
 		},
 	}
@@ -127,6 +135,12 @@ func TestHistory(t *testing.T) {
 		t.Errorf("Expected history \n%s, but got \n%s.", es, gs)
 		t.Logf("strs equal: %v.", string(es) == string(gs))
 	}
+	if got := hist.PoolRecords("pool B"); !reflect.DeepEqual(got, expected["pool B"]) {
+		t.Errorf("Expected records of pool B %v, but got %v.", expected["pool B"], got)
+	}
+	if got := hist.PoolRecords("pool D"); got != nil {
+		t.Errorf("Expected no records for unknown pool, but got %v.", got)
+	}
 }
 
 const fakePath = "/some/random/path"
@@ -0,0 +1,227 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"k8s.io/test-infra/pkg/io"
+)
+
+// Events of PR timelines, in addition to the actions that Tide takes for PRs.
+const (
+	// Approved is recorded when a PR starts to match a Tide query.
+	Approved = "APPROVED"
+	// Unapproved is recorded when a PR stops matching the Tide queries without
+	// being merged, e.g. because a label was removed or the PR was closed.
+	Unapproved = "UNAPPROVED"
+	// Pooled is recorded when a PR enters the merge pool, i.e. when it matches
+	// a Tide query and passes its status contexts.
+	Pooled = "POOLED"
+	// Unpooled is recorded when a PR leaves the merge pool without being merged.
+	Unpooled = "UNPOOLED"
+	// Merged is recorded when Tide merges a PR. It ends the timeline of the PR.
+	Merged = "MERGED"
+)
+
+// timelineRetention is how long the timelines of PRs that were merged or are
+// no longer approved are kept.
+const timelineRetention = 7 * 24 * time.Hour
+
+// TimelineEvent is a change of the state of a PR in Tide, or an action that
+// Tide took for the PR.
+type TimelineEvent struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	BaseSHA string    `json:"baseSHA,omitempty"`
+}
+
+// Timeline is the history of a single PR in Tide, oldest event first.
+type Timeline struct {
+	Pool   string          `json:"pool"`
+	Events []TimelineEvent `json:"events"`
+}
+
+// Last returns the last event of one of the given types.
+func (t *Timeline) Last(events ...string) (TimelineEvent, bool) {
+	for i := len(t.Events) - 1; i >= 0; i-- {
+		for _, event := range events {
+			if t.Events[i].Event == event {
+				return t.Events[i], true
+			}
+		}
+	}
+	return TimelineEvent{}, false
+}
+
+// CountSince counts the events of the given types after a point in time.
+func (t *Timeline) CountSince(since time.Time, events ...string) int {
+	var count int
+	for _, e := range t.Events {
+		if !e.Time.After(since) {
+			continue
+		}
+		for _, event := range events {
+			if e.Event == event {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// in determines whether the last of two opposite events is the first one.
+func (t *Timeline) in(state, opposite string) bool {
+	last, ok := t.Last(state, opposite)
+	return ok && last.Event == state
+}
+
+// ended determines whether a PR was merged or is no longer approved.
+func (t *Timeline) ended() bool {
+	if len(t.Events) == 0 {
+		return false
+	}
+	last := t.Events[len(t.Events)-1].Event
+	return last == Merged || last == Unapproved
+}
+
+func (t *Timeline) merged() bool {
+	_, ok := t.Last(Merged)
+	return ok
+}
+
+func (t *Timeline) add(event, baseSHA string, time time.Time) {
+	t.Events = append(t.Events, TimelineEvent{Time: time, Event: event, BaseSHA: baseSHA})
+}
+
+// timeline returns the timeline of a PR, creating it if needed.
+func (h *History) timeline(prKey, poolKey string) *Timeline {
+	tl, ok := h.timelines[prKey]
+	if !ok {
+		tl = &Timeline{Pool: poolKey}
+		h.timelines[prKey] = tl
+	}
+	tl.Pool = poolKey
+	return tl
+}
+
+// RecordPRs updates the timelines with the PRs that match a Tide query and the
+// PRs that are in the merge pools. Both map the keys of the PRs (org/repo#1)
+// to the keys of their pools. PRs that are missing from either are recorded
+// as having left them. Merged PRs are ignored since search results may lag
+// behind merges. Timelines that ended long ago are dropped.
+func (h *History) RecordPRs(approved, pooled map[string]string) {
+	t := now()
+	h.Lock()
+	defer h.Unlock()
+	for key, tl := range h.timelines {
+		if tl.ended() {
+			if t.Sub(tl.Events[len(tl.Events)-1].Time) > timelineRetention {
+				delete(h.timelines, key)
+			}
+			continue
+		}
+		if _, ok := pooled[key]; !ok && tl.in(Pooled, Unpooled) {
+			tl.add(Unpooled, "", t)
+		}
+		if _, ok := approved[key]; !ok && tl.in(Approved, Unapproved) {
+			tl.add(Unapproved, "", t)
+		}
+	}
+	for key, poolKey := range approved {
+		if tl := h.timeline(key, poolKey); !tl.merged() && !tl.in(Approved, Unapproved) {
+			tl.add(Approved, "", t)
+		}
+	}
+	for key, poolKey := range pooled {
+		if tl := h.timeline(key, poolKey); !tl.merged() && !tl.in(Pooled, Unpooled) {
+			tl.add(Pooled, "", t)
+		}
+	}
+}
+
+// RecordPREvent appends an event to the timeline of a PR and returns a copy of
+// the timeline.
+func (h *History) RecordPREvent(prKey, poolKey, event, baseSHA string) Timeline {
+	t := now()
+	h.Lock()
+	defer h.Unlock()
+	tl := h.timeline(prKey, poolKey)
+	tl.add(event, baseSHA, t)
+	return Timeline{Pool: tl.Pool, Events: append([]TimelineEvent(nil), tl.Events...)}
+}
+
+// Timelines returns a copy of the timelines of all PRs, keyed by PR.
+func (h *History) Timelines() map[string]Timeline {
+	h.Lock()
+	defer h.Unlock()
+	res := make(map[string]Timeline, len(h.timelines))
+	for key, tl := range h.timelines {
+		res[key] = Timeline{Pool: tl.Pool, Events: append([]TimelineEvent(nil), tl.Events...)}
+	}
+	return res
+}
+
+// timelinesPath returns the path that the timelines are stored at next to the
+// action history.
+func timelinesPath(path string) string {
+	return strings.TrimSuffix(path, ".json") + "-timelines.json"
+}
+
+func readTimelines(opener io.Opener, path string) (map[string]*Timeline, error) {
+	reader, err := opener.Reader(context.Background(), path)
+	if io.IsNotExist(err) { // No timelines exist yet. This is not an error.
+		return map[string]*Timeline{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open: %v", err)
+	}
+	defer io.LogClose(reader)
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("read: %v", err)
+	}
+	timelines := map[string]*Timeline{}
+	if err := json.Unmarshal(raw, &timelines); err != nil {
+		return nil, fmt.Errorf("unmarshal: %v", err)
+	}
+	return timelines, nil
+}
+
+func writeTimelines(opener io.Opener, path string, timelines map[string]Timeline) error {
+	writer, err := opener.Writer(context.Background(), path)
+	if err != nil {
+		return fmt.Errorf("open: %v", err)
+	}
+	b, err := json.Marshal(timelines)
+	if err != nil {
+		return fmt.Errorf("marshal: %v", err)
+	}
+	if _, err := fmt.Fprint(writer, string(b)); err != nil {
+		io.LogClose(writer)
+		return fmt.Errorf("write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("close: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func events(tl Timeline) []string {
+	var res []string
+	for _, e := range tl.Events {
+		res = append(res, e.Event)
+	}
+	return res
+}
+
+func TestTimelines(t *testing.T) {
+	var nowTime = time.Now()
+	oldNow := now
+	now = func() time.Time { return nowTime }
+	defer func() { now = oldNow }()
+
+	hist, err := New(3, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create history client: %v", err)
+	}
+
+	hist.RecordPRs(map[string]string{"o/r#1": "o/r:master", "o/r#2": "o/r:master"}, nil)
+	nowTime = nowTime.Add(time.Minute)
+	hist.RecordPRs(map[string]string{"o/r#1": "o/r:master", "o/r#2": "o/r:master"}, map[string]string{"o/r#1": "o/r:master"})
+	nowTime = nowTime.Add(time.Minute)
+	hist.RecordPREvent("o/r#1", "o/r:master", "TRIGGER", "sha")
+	nowTime = nowTime.Add(time.Minute)
+	hist.RecordPRs(map[string]string{"o/r#1": "o/r:master"}, nil)
+	nowTime = nowTime.Add(time.Minute)
+	hist.RecordPRs(map[string]string{"o/r#1": "o/r:master"}, map[string]string{"o/r#1": "o/r:master"})
+	nowTime = nowTime.Add(time.Minute)
+	merged := hist.RecordPREvent("o/r#1", "o/r:master", Merged, "sha")
+	hist.RecordPRs(nil, nil)
+
+	timelines := hist.Timelines()
+	if expected, actual := []string{Approved, Pooled, "TRIGGER", Unpooled, Pooled, Merged}, events(timelines["o/r#1"]); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected events %v for the merged PR, got %v.", expected, actual)
+	}
+	if !reflect.DeepEqual(merged, timelines["o/r#1"]) {
+		t.Errorf("Expected the recorded timeline %v to match %v.", merged, timelines["o/r#1"])
+	}
+	if expected, actual := []string{Approved, Unapproved}, events(timelines["o/r#2"]); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected events %v for the unapproved PR, got %v.", expected, actual)
+	}
+
+	approved, _ := merged.Last(Approved)
+	if count := merged.CountSince(approved.Time, "TRIGGER"); count != 1 {
+		t.Errorf("Expected 1 trigger since approval, got %d.", count)
+	}
+	if pooled, _ := merged.Last(Pooled); pooled.Time != approved.Time.Add(4*time.Minute) {
+		t.Errorf("Expected the PR to be pooled last 4 minutes after approval, got %v.", pooled.Time.Sub(approved.Time))
+	}
+
+	// Search results that lag behind the merge do not change the timeline.
+	hist.RecordPRs(map[string]string{"o/r#1": "o/r:master"}, map[string]string{"o/r#1": "o/r:master"})
+	if !reflect.DeepEqual(merged, hist.Timelines()["o/r#1"]) {
+		t.Errorf("Expected the timeline of the merged PR to stay %v, got %v.", merged, hist.Timelines()["o/r#1"])
+	}
+
+	// Timelines that ended are dropped after the retention period.
+	nowTime = nowTime.Add(timelineRetention + time.Minute)
+	hist.RecordPRs(map[string]string{"o/r#3": "o/r:master"}, nil)
+	if timelines := hist.Timelines(); len(timelines) != 1 || len(timelines["o/r#3"].Events) != 1 {
+		t.Errorf("Expected only the timeline of the approved PR to be kept, got %v.", timelines)
+	}
+}
+
+func TestServeTimelines(t *testing.T) {
+	hist, err := New(3, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create history client: %v", err)
+	}
+	hist.Record("o/r:master", "TRIGGER", "sha", "", nil)
+	hist.RecordPRs(map[string]string{"o/r#1": "o/r:master"}, nil)
+
+	rec := httptest.NewRecorder()
+	hist.ServeHTTP(rec, httptest.NewRequest("GET", "/history", nil))
+	var records map[string][]*Record
+	if err := json.Unmarshal(rec.Body.Bytes(), &records); err != nil {
+		t.Fatalf("Failed to unmarshal records: %v", err)
+	}
+	if len(records["o/r:master"]) != 1 {
+		t.Errorf("Expected the records of the pool to be served by default, got %v.", records)
+	}
+
+	rec = httptest.NewRecorder()
+	hist.ServeHTTP(rec, httptest.NewRequest("GET", "/history?timelines=true", nil))
+	var timelines map[string]Timeline
+	if err := json.Unmarshal(rec.Body.Bytes(), &timelines); err != nil {
+		t.Fatalf("Failed to unmarshal timelines: %v", err)
+	}
+	if expected, actual := []string{Approved}, events(timelines["o/r#1"]); !reflect.DeepEqual(expected, actual) || timelines["o/r#1"].Pool != "o/r:master" {
+		t.Errorf("Expected timeline with events %v in pool o/r:master, got %+v.", expected, timelines["o/r#1"])
+	}
+}
+
+func TestTimelinesPath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"gs://bucket/tide-history.json": "gs://bucket/tide-history-timelines.json",
+		"/some/random/path":             "/some/random/path-timelines.json",
+	} {
+		if actual := timelinesPath(path); actual != expected {
+			t.Errorf("Expected timelines of %q at %q, got %q.", path, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+)
+
+// releaseNoteRE matches the release-note block of a PR body, like the
+// release-note plugin does.
+var releaseNoteRE = regexp.MustCompile(`(?s)(?:Release note\*\*:\s*(?:<!--[^<>]*-->\s*)?` + "```(?:release-note)?|```release-note)(.+?)```")
+
+// releaseNote returns the content of the release-note block of a PR body.
+func releaseNote(body string) string {
+	if match := releaseNoteRE.FindStringSubmatch(body); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return ""
+}
+
+// mergeCommitData gathers the data that the templates of merge commits can
+// refer to. The body, commits and reviews of the PR are not part of the pool,
+// so they are fetched from GitHub.
+func (c *Controller) mergeCommitData(sp subpool, pr PullRequest) (config.TideMergeCommitTemplateData, error) {
+	data := config.TideMergeCommitTemplateData{
+		Org:    sp.org,
+		Repo:   sp.repo,
+		Branch: sp.branch,
+		Number: int(pr.Number),
+		Title:  string(pr.Title),
+		Author: string(pr.Author.Login),
+	}
+	ghPR, err := c.ghc.GetPullRequest(sp.org, sp.repo, int(pr.Number))
+	if err != nil {
+		return data, fmt.Errorf("failed to get PR: %v", err)
+	}
+	data.Body = ghPR.Body
+	data.ReleaseNote = releaseNote(ghPR.Body)
+
+	commits, err := c.ghc.ListPRCommits(sp.org, sp.repo, int(pr.Number))
+	if err != nil {
+		return data, fmt.Errorf("failed to list commits: %v", err)
+	}
+	authors := sets.NewString()
+	for _, commit := range commits {
+		// Commits by authors without a GitHub account have no login.
+		if commit.Author.Login != "" {
+			authors.Insert(commit.Author.Login)
+		}
+	}
+	data.Authors = authors.List()
+
+	reviews, err := c.reviews.prReviews(&pr)
+	if err != nil {
+		return data, err
+	}
+	data.Approvers = approvedBy(reviews).List()
+	return data, nil
+}
+
+// mergeCommitMessage executes the templates of the merge commit of a PR. The
+// title and body are empty if GitHub's defaults are used.
+func (c *Controller) mergeCommitMessage(sp subpool, pr PullRequest) (string, string, error) {
+	tmpl := c.config().Tide.MergeCommitTemplate(sp.org, sp.repo, sp.branch)
+	if tmpl.Title == nil && tmpl.Body == nil {
+		return "", "", nil
+	}
+	data, err := c.mergeCommitData(sp, pr)
+	if err != nil {
+		return "", "", err
+	}
+	execute := func(t *template.Template) (string, error) {
+		if t == nil {
+			return "", nil
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to execute the %s template: %v", t.Name(), err)
+		}
+		return buf.String(), nil
+	}
+	title, err := execute(tmpl.Title)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := execute(tmpl.Body)
+	if err != nil {
+		return "", "", err
+	}
+	return title, body, nil
+}
+
+// mergeDetails determines how to merge a PR: its merge method, which a squash
+// label overrides, and the message of its merge commit.
+func (c *Controller) mergeDetails(sp subpool, pr PullRequest) (github.MergeDetails, error) {
+	mergeMethod := c.config().Tide.MergeMethod(sp.org, sp.repo, sp.branch)
+	if squashLabel := c.config().Tide.SquashLabel; squashLabel != "" {
+		for _, prlabel := range pr.Labels.Nodes {
+			if string(prlabel.Name) == squashLabel {
+				mergeMethod = github.MergeSquash
+				break
+			}
+		}
+	}
+	title, body, err := c.mergeCommitMessage(sp, pr)
+	if err != nil {
+		return github.MergeDetails{}, err
+	}
+	return github.MergeDetails{
+		SHA:           string(pr.HeadRefOID),
+		MergeMethod:   string(mergeMethod),
+		CommitTitle:   title,
+		CommitMessage: body,
+	}, nil
+}
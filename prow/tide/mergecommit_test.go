@@ -0,0 +1,170 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/tide/history"
+)
+
+func TestReleaseNote(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name: "no release note",
+			body: "Fixes a bug.",
+		},
+		{
+			name:     "release-note block",
+			body:     "Fixes a bug.\n\n```release-note\nFixed a crash on startup.\n```\n",
+			expected: "Fixed a crash on startup.",
+		},
+		{
+			name:     "block after the template heading",
+			body:     "**Release note**:\n<!-- Write your release note -->\n```\nNONE\n```",
+			expected: "NONE",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := releaseNote(tc.body); actual != tc.expected {
+				t.Errorf("Expected release note %q, got %q.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMergeDetails(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tide.SquashLabel = "tide/squash"
+	cfg.Tide.MergeType = map[string]github.PullRequestMergeType{
+		"o/r":         github.MergeRebase,
+		"o/r@release": github.MergeMerge,
+	}
+	body := "{{.ReleaseNote}}\n{{range .Authors}}\nAuthored-by: {{.}}{{end}}{{range .Approvers}}\nApproved-by: {{.}}{{end}}"
+	cfg.Tide.MergeTemplate = map[string]config.TideMergeCommitTemplate{
+		"o/r@release": {
+			Title: template.Must(template.New("title").Parse("{{.Title}} (#{{.Number}})")),
+			Body:  template.Must(template.New("body").Parse(body)),
+		},
+	}
+	ca := &config.Agent{}
+	ca.Set(cfg)
+	hist, err := history.New(100, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create history client: %v", err)
+	}
+	ghc := &fgc{
+		bodies: map[int]string{2: "```release-note\nAdded a flag.\n```"},
+		commits: map[int][]github.RepositoryCommit{2: {
+			{Author: github.User{Login: "bob"}},
+			{Author: github.User{Login: "alice"}},
+			{Author: github.User{Login: "bob"}},
+			{},
+		}},
+		reviews: map[int][]github.Review{2: {
+			{User: github.User{Login: "Carol"}, State: github.ReviewStateApproved},
+		}},
+	}
+	c := &Controller{
+		logger: logrus.WithField("component", "tide"),
+		config: ca.Config,
+		ghc:    ghc,
+		reviews: &reviewsAgent{
+			ghc:             ghc,
+			nextReviewCache: make(map[reviewCacheKey][]github.Review),
+		},
+		History: hist,
+	}
+
+	master := subpool{log: logrus.WithField("component", "tide"), org: "o", repo: "r", branch: "master"}
+	pr1 := testPR("o", "r", "master", 1, githubql.MergeableStateMergeable)
+	squashed := testPR("o", "r", "master", 3, githubql.MergeableStateMergeable)
+	squashed.Labels.Nodes = append(squashed.Labels.Nodes, struct{ Name githubql.String }{Name: "tide/squash"})
+	if err := c.mergePRs(master, []PullRequest{pr1, squashed}); err != nil {
+		t.Fatalf("Unexpected error merging: %v", err)
+	}
+
+	release := subpool{log: logrus.WithField("component", "tide"), org: "o", repo: "r", branch: "release"}
+	pr2 := testPR("o", "r", "release", 2, githubql.MergeableStateMergeable)
+	pr2.Title = "Add a flag"
+	if err := c.mergePRs(release, []PullRequest{pr2}); err != nil {
+		t.Fatalf("Unexpected error merging: %v", err)
+	}
+
+	expected := map[int]github.MergeDetails{
+		1: {SHA: "SHA", MergeMethod: "rebase"},
+		2: {
+			SHA:           "SHA",
+			MergeMethod:   "merge",
+			CommitTitle:   "Add a flag (#2)",
+			CommitMessage: "Added a flag.\n\nAuthored-by: alice\nAuthored-by: bob\nApproved-by: carol",
+		},
+		3: {SHA: "SHA", MergeMethod: "squash"},
+	}
+	if !reflect.DeepEqual(ghc.mergeDetails, expected) {
+		t.Errorf("Expected merges %+v, got %+v.", expected, ghc.mergeDetails)
+	}
+}
+
+func TestMergePRsWithoutMergeDetails(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tide.MergeTemplate = map[string]config.TideMergeCommitTemplate{
+		"o/r": {Title: template.Must(template.New("title").Parse("{{if eq .Number 2}}{{.Missing}}{{end}}"))},
+	}
+	ca := &config.Agent{}
+	ca.Set(cfg)
+	hist, err := history.New(100, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create history client: %v", err)
+	}
+	ghc := &fgc{}
+	c := &Controller{
+		logger: logrus.WithField("component", "tide"),
+		config: ca.Config,
+		ghc:    ghc,
+		reviews: &reviewsAgent{
+			ghc:             ghc,
+			nextReviewCache: make(map[reviewCacheKey][]github.Review),
+		},
+		History: hist,
+	}
+
+	sp := subpool{log: logrus.WithField("component", "tide"), org: "o", repo: "r", branch: "master"}
+	batch := []PullRequest{
+		testPR("o", "r", "master", 1, githubql.MergeableStateMergeable),
+		testPR("o", "r", "master", 2, githubql.MergeableStateMergeable),
+		testPR("o", "r", "master", 3, githubql.MergeableStateMergeable),
+	}
+	if err := c.mergePRs(sp, batch); err == nil {
+		t.Error("Expected an error merging the batch.")
+	}
+	if ghc.merged != 0 {
+		t.Errorf("Expected no PR of the batch to be merged, got %d merges.", ghc.merged)
+	}
+}
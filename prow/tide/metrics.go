@@ -0,0 +1,132 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/test-infra/prow/tide/history"
+)
+
+// durationBuckets are the buckets in seconds of the histograms of the time
+// PRs spend in Tide, from a minute to a week.
+var durationBuckets = []float64{
+	60, 5 * 60, 15 * 60, 30 * 60,
+	3600, 2 * 3600, 4 * 3600, 8 * 3600, 16 * 3600,
+	24 * 3600, 2 * 24 * 3600, 4 * 24 * 3600, 7 * 24 * 3600,
+}
+
+// retestActions are the actions that test PRs again. They are counted as
+// retests of a PR between its approval and its merge.
+var retestActions = []string{Trigger, TriggerBatch, Bisect}
+
+// batchResultPeriod is how long the result of a batch is remembered so that
+// it is only counted once.
+const batchResultPeriod = 48 * time.Hour
+
+// recordTimelines records the PRs that match the Tide queries and the PRs in
+// the merge pools in the timelines of the PRs.
+func (c *Controller) recordTimelines(approved []map[string]PullRequest, pooled []map[string]*subpool) {
+	approvedKeys := make(map[string]string)
+	for _, prs := range approved {
+		for key, pr := range prs {
+			approvedKeys[key] = poolKey(string(pr.Repository.Owner.Login), string(pr.Repository.Name), string(pr.BaseRef.Name))
+		}
+	}
+	pooledKeys := make(map[string]string)
+	for _, subpools := range pooled {
+		for key, sp := range subpools {
+			for _, pr := range sp.prs {
+				pooledKeys[prKey(&pr)] = key
+			}
+		}
+	}
+	c.History.RecordPRs(approvedKeys, pooledKeys)
+}
+
+// recordAction records an action in the timelines of its targets.
+func (c *Controller) recordAction(sp subpool, act Action, targets []PullRequest) {
+	switch act {
+	case Trigger, TriggerBatch, Bisect:
+		for _, pr := range targets {
+			c.History.RecordPREvent(prKey(&pr), poolKey(sp.org, sp.repo, sp.branch), string(act), sp.sha)
+		}
+	}
+}
+
+// recordMerged records the merge of a PR in its timeline and observes how long
+// the PR waited to be merged and how often it was tested again.
+func (c *Controller) recordMerged(sp subpool, pr PullRequest) {
+	tl := c.History.RecordPREvent(prKey(&pr), poolKey(sp.org, sp.repo, sp.branch), history.Merged, sp.sha)
+	merged := tl.Events[len(tl.Events)-1].Time
+	if approved, ok := tl.Last(history.Approved); ok {
+		tideMetrics.approvalToMerge.WithLabelValues(sp.org, sp.repo, sp.branch).Observe(merged.Sub(approved.Time).Seconds())
+		tideMetrics.retests.WithLabelValues(sp.org, sp.repo, sp.branch).Observe(float64(tl.CountSince(approved.Time, retestActions...)))
+	}
+	if pooled, ok := tl.Last(history.Pooled); ok {
+		tideMetrics.timeInPool.WithLabelValues(sp.org, sp.repo, sp.branch).Observe(merged.Sub(pooled.Time).Seconds())
+	}
+}
+
+// batchResults tracks the batches whose results were counted.
+type batchResults struct {
+	sync.Mutex
+	// seen maps the key of a batch to the time its result was counted.
+	seen map[string]time.Time
+}
+
+func batchKey(sp subpool, prs []PullRequest) string {
+	var pulls []string
+	for _, pr := range prs {
+		pulls = append(pulls, fmt.Sprintf("%d@%s", int(pr.Number), string(pr.HeadRefOID)))
+	}
+	sort.Strings(pulls)
+	return fmt.Sprintf("%s@%s:%s", poolKey(sp.org, sp.repo, sp.branch), sp.sha, strings.Join(pulls, ","))
+}
+
+// count counts the result of every batch of a subpool that finished testing
+// and was not counted before.
+func (r *batchResults) count(sp subpool, batches []batchState, now time.Time) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	for key, seen := range r.seen {
+		if now.Sub(seen) > batchResultPeriod {
+			delete(r.seen, key)
+		}
+	}
+	for _, batch := range batches {
+		if batch.state == pendingState {
+			continue
+		}
+		key := batchKey(sp, batch.prs)
+		if _, ok := r.seen[key]; ok {
+			continue
+		}
+		if r.seen == nil {
+			r.seen = make(map[string]time.Time)
+		}
+		r.seen[key] = now
+		tideMetrics.batchResults.WithLabelValues(sp.org, sp.repo, sp.branch, string(batch.state)).Inc()
+	}
+}
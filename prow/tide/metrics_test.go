@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/tide/history"
+)
+
+func metricValue(t *testing.T, m prometheus.Metric) *dto.Metric {
+	var res dto.Metric
+	if err := m.Write(&res); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	return &res
+}
+
+func TestRecordMerged(t *testing.T) {
+	hist, err := history.New(100, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create history client: %v", err)
+	}
+	c := &Controller{History: hist}
+	sp := subpool{
+		log:    logrus.WithField("component", "tide"),
+		org:    "merged-org",
+		repo:   "r",
+		branch: "master",
+		sha:    "sha",
+	}
+	pr := testPR("merged-org", "r", "master", 1, githubql.MergeableStateMergeable)
+	other := testPR("merged-org", "r", "master", 2, githubql.MergeableStateMergeable)
+
+	c.recordTimelines(
+		[]map[string]PullRequest{{prKey(&pr): pr, prKey(&other): other}},
+		[]map[string]*subpool{{"merged-org/r:master": {prs: []PullRequest{pr}}}},
+	)
+	c.recordAction(sp, TriggerBatch, []PullRequest{pr, other})
+	c.recordAction(sp, Trigger, []PullRequest{pr})
+	c.recordAction(sp, Wait, []PullRequest{pr})
+	c.recordMerged(sp, pr)
+
+	retests := metricValue(t, tideMetrics.retests.WithLabelValues("merged-org", "r", "master").(prometheus.Histogram))
+	if count, sum := retests.GetHistogram().GetSampleCount(), retests.GetHistogram().GetSampleSum(); count != 1 || sum != 2 {
+		t.Errorf("Expected 1 merged PR with 2 retests, got %d merged PRs with %v retests.", count, sum)
+	}
+	for name, vec := range map[string]*prometheus.HistogramVec{
+		"timeinpool":      tideMetrics.timeInPool,
+		"approvaltomerge": tideMetrics.approvalToMerge,
+	} {
+		m := metricValue(t, vec.WithLabelValues("merged-org", "r", "master").(prometheus.Histogram))
+		if count := m.GetHistogram().GetSampleCount(); count != 1 {
+			t.Errorf("Expected 1 observation of %s, got %d.", name, count)
+		}
+	}
+
+	tl := hist.Timelines()["merged-org/r#1"]
+	if last, _ := tl.Last(history.Merged, Trigger); last.Event != history.Merged || last.BaseSHA != "sha" {
+		t.Errorf("Expected the merge into sha to end the timeline, got %+v.", tl)
+	}
+	if len(hist.Timelines()["merged-org/r#2"].Events) != 2 {
+		t.Errorf("Expected the other PR to be approved and triggered, got %+v.", hist.Timelines()["merged-org/r#2"])
+	}
+}
+
+func TestBatchResults(t *testing.T) {
+	sp := subpool{org: "batch-org", repo: "r", branch: "master", sha: "sha"}
+	pr1 := testPR("batch-org", "r", "master", 1, githubql.MergeableStateMergeable)
+	pr2 := testPR("batch-org", "r", "master", 2, githubql.MergeableStateMergeable)
+	pr3 := testPR("batch-org", "r", "master", 3, githubql.MergeableStateMergeable)
+	batches := []batchState{
+		{prs: []PullRequest{pr1, pr2}, state: successState},
+		{prs: []PullRequest{pr2, pr3}, state: failureState},
+		{prs: []PullRequest{pr1, pr3}, state: pendingState},
+	}
+
+	var nilResults *batchResults
+	nilResults.count(sp, batches, time.Now())
+
+	results := &batchResults{}
+	now := time.Now()
+	results.count(sp, batches, now)
+	// The same batches in a different order are only counted once.
+	results.count(sp, []batchState{{prs: []PullRequest{pr2, pr1}, state: successState}}, now.Add(time.Minute))
+	// The same batch against another base is counted again.
+	sp.sha = "other"
+	results.count(sp, batches[:1], now.Add(time.Minute))
+
+	for state, expected := range map[simpleState]float64{successState: 2, failureState: 1, pendingState: 0} {
+		m := metricValue(t, tideMetrics.batchResults.WithLabelValues("batch-org", "r", "master", string(state)))
+		if actual := m.GetCounter().GetValue(); actual != expected {
+			t.Errorf("Expected %v %s batches, got %v.", expected, state, actual)
+		}
+	}
+
+	results.count(sp, nil, now.Add(batchResultPeriod+2*time.Minute))
+	if len(results.seen) != 0 {
+		t.Errorf("Expected the counted batches to expire, got %v.", results.seen)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+// newOwnersClient creates the client that loads the OWNERS of repos. Tide
+// does not load the plugin config, so OWNERS in markdown files are not read
+// and approvers have to be collaborators of the repo.
+func newOwnersClient(gc *git.Client, ghc *github.Client, cfg config.Getter) repoowners.Interface {
+	never := func(org, repo string) bool { return false }
+	return repoowners.NewClient(gc, ghc, never, never, func() config.OwnersDirBlacklist {
+		return cfg().OwnersDirBlacklist
+	})
+}
+
+// ownersApproved returns the PRs that have the approvals from the OWNERS of
+// their changed files that a query requires. PRs whose approvals cannot be
+// determined are left out. The reasons why PRs are left out are added to
+// missing by the keys of the PRs.
+func (c *Controller) ownersApproved(q *config.TideQuery, prs []PullRequest, missing map[string]string) []PullRequest {
+	if !q.RequiresOwnersApproval() {
+		return prs
+	}
+	var res []PullRequest
+	for _, pr := range prs {
+		log := c.logger.WithFields(pr.logFields())
+		reason, err := c.missingOwnersApproval(q, &pr)
+		if err != nil {
+			log.WithError(err).Warning("Failed to check the approvals from OWNERS, leaving the PR out of the pool.")
+			missing[prKey(&pr)] = "approvals from OWNERS could not be checked"
+			continue
+		}
+		if reason != "" {
+			log.WithField("missing", reason).Debug("PR lacks approvals from OWNERS.")
+			missing[prKey(&pr)] = reason
+			continue
+		}
+		res = append(res, pr)
+	}
+	return res
+}
+
+// missingOwnersApproval describes the approvals from OWNERS that a PR lacks
+// to meet the requirements of a query. It returns an empty string if the PR
+// has all the approvals it needs.
+func (c *Controller) missingOwnersApproval(q *config.TideQuery, pr *PullRequest) (string, error) {
+	if c.owners == nil {
+		return "", errors.New("no OWNERS client is configured")
+	}
+	org, repo := string(pr.Repository.Owner.Login), string(pr.Repository.Name)
+	files, err := c.changedFiles.prChanges(pr)()
+	if err != nil {
+		return "", fmt.Errorf("failed to get changed files: %v", err)
+	}
+	owners, err := c.owners.LoadRepoOwners(org, repo, string(pr.BaseRef.Name))
+	if err != nil {
+		return "", fmt.Errorf("failed to load OWNERS: %v", err)
+	}
+	reviews, err := c.reviews.prReviews(pr)
+	if err != nil {
+		return "", err
+	}
+	approvers := approvedBy(reviews)
+
+	// approvals are the approvers of any changed file that approved the PR.
+	approvals := sets.NewString()
+	unapproved := sets.NewString()
+	for _, file := range files {
+		fileApprovals := owners.Approvers(file).Intersection(approvers)
+		if fileApprovals.Len() == 0 {
+			dir := owners.FindApproverOwnersForFile(file)
+			if dir == "" {
+				dir = "/"
+			}
+			unapproved.Insert(dir)
+		}
+		approvals = approvals.Union(fileApprovals)
+	}
+
+	if q.OwnersApprovalRequired && unapproved.Len() > 0 {
+		return fmt.Sprintf("needs approval from an approver of %s", truncateDirs(unapproved.List())), nil
+	}
+	if approvals.Len() < q.RequiredApprovals {
+		return fmt.Sprintf("needs %d approvals from OWNERS, has %d", q.RequiredApprovals, approvals.Len()), nil
+	}
+	return "", nil
+}
+
+// truncateDirs joins directories, but leaves out directories beyond the first
+// to keep the result short enough for a status description.
+func truncateDirs(dirs []string) string {
+	const maxDirChars = 50
+	i := 1
+	chars := len(dirs[0])
+	for ; i < len(dirs); i++ {
+		if chars+len(dirs[i]) > maxDirChars {
+			break
+		}
+		chars += len(dirs[i]) + 2 // ", "
+	}
+	if i == len(dirs) {
+		return strings.Join(dirs, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(dirs[:i], ", "), len(dirs)-i)
+}
+
+// approvedBy returns the lower cased logins of the users whose latest review
+// of a PR approves it. Reviews that only comment do not change the state of
+// an earlier review.
+func approvedBy(reviews []github.Review) sets.String {
+	latest := make(map[string]github.ReviewState)
+	for _, review := range reviews {
+		if review.State == github.ReviewStateCommented {
+			continue
+		}
+		latest[github.NormLogin(review.User.Login)] = review.State
+	}
+	approvers := sets.NewString()
+	for login, state := range latest {
+		if state == github.ReviewStateApproved {
+			approvers.Insert(login)
+		}
+	}
+	return approvers
+}
+
+// reviewsAgent queries and caches the reviews of PRs. Reviews are cached by
+// the head, the number of reviews and the update time of a PR, as a review
+// that is added or dismissed changes at least one of them. Cache entries
+// expire if they are not used during a sync loop.
+type reviewsAgent struct {
+	ghc         githubClient
+	reviewCache map[reviewCacheKey][]github.Review
+	// nextReviewCache caches the reviews that are relevant this sync for use
+	// next sync. It becomes the new reviewCache when prune() is called at the
+	// end of each sync.
+	nextReviewCache map[reviewCacheKey][]github.Review
+	sync.Mutex
+}
+
+type reviewCacheKey struct {
+	org, repo string
+	number    int
+	sha       string
+	reviews   int
+	updatedAt time.Time
+}
+
+// prReviews returns the reviews of a PR.
+func (a *reviewsAgent) prReviews(pr *PullRequest) ([]github.Review, error) {
+	cacheKey := reviewCacheKey{
+		org:       string(pr.Repository.Owner.Login),
+		repo:      string(pr.Repository.Name),
+		number:    int(pr.Number),
+		sha:       string(pr.HeadRefOID),
+		reviews:   int(pr.Reviews.TotalCount),
+		updatedAt: pr.UpdatedAt.Time,
+	}
+
+	a.Lock()
+	reviews, ok := a.nextReviewCache[cacheKey]
+	if !ok {
+		reviews, ok = a.reviewCache[cacheKey]
+	}
+	if ok {
+		a.nextReviewCache[cacheKey] = reviews
+		a.Unlock()
+		return reviews, nil
+	}
+	a.Unlock()
+
+	reviews, err := a.ghc.ListReviews(cacheKey.org, cacheKey.repo, cacheKey.number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reviews: %v", err)
+	}
+	a.Lock()
+	a.nextReviewCache[cacheKey] = reviews
+	a.Unlock()
+	return reviews, nil
+}
+
+// prune removes any cached reviews that were not used since the last prune.
+func (a *reviewsAgent) prune() {
+	a.Lock()
+	defer a.Unlock()
+	a.reviewCache = a.nextReviewCache
+	a.nextReviewCache = make(map[reviewCacheKey][]github.Review)
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+// fakeRepoOwners has an OWNERS file with approvers in some directories.
+// Approvers of a directory approve all files below it.
+type fakeRepoOwners struct {
+	repoowners.RepoOwner
+	approvers map[string]sets.String
+}
+
+func (f *fakeRepoOwners) FindApproverOwnersForFile(path string) string {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if dir == "." {
+			dir = ""
+		}
+		if _, ok := f.approvers[dir]; ok || dir == "" {
+			return dir
+		}
+	}
+}
+
+func (f *fakeRepoOwners) Approvers(path string) sets.String {
+	res := sets.NewString()
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if dir == "." {
+			dir = ""
+		}
+		res = res.Union(f.approvers[dir])
+		if dir == "" {
+			return res
+		}
+	}
+}
+
+type fakeOwnersClient struct {
+	repoowners.Interface
+	owners *fakeRepoOwners
+}
+
+func (f *fakeOwnersClient) LoadRepoOwners(org, repo, base string) (repoowners.RepoOwner, error) {
+	return f.owners, nil
+}
+
+func TestApprovedBy(t *testing.T) {
+	review := func(login string, state github.ReviewState) github.Review {
+		return github.Review{User: github.User{Login: login}, State: state}
+	}
+	reviews := []github.Review{
+		review("Alice", github.ReviewStateApproved),
+		review("alice", github.ReviewStateCommented),
+		review("bob", github.ReviewStateApproved),
+		review("bob", github.ReviewStateChangesRequested),
+		review("carol", github.ReviewStateChangesRequested),
+		review("carol", github.ReviewStateApproved),
+		review("dave", github.ReviewStateApproved),
+		review("dave", github.ReviewStateDismissed),
+	}
+	if expected, actual := []string{"alice", "carol"}, approvedBy(reviews).List(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected approvers %v, got %v.", expected, actual)
+	}
+}
+
+func TestMissingOwnersApproval(t *testing.T) {
+	owners := &fakeRepoOwners{approvers: map[string]sets.String{
+		"":    sets.NewString("root"),
+		"foo": sets.NewString("alice", "bob"),
+		"bar": sets.NewString("carol"),
+	}}
+	files := []string{"foo/a.go", "foo/sub/b.go", "bar/c.go"}
+
+	testCases := []struct {
+		name      string
+		query     config.TideQuery
+		approvers []string
+		expected  string
+	}{
+		{
+			name:      "every directory approved",
+			query:     config.TideQuery{OwnersApprovalRequired: true},
+			approvers: []string{"alice", "carol"},
+		},
+		{
+			name:      "root approver approves everything",
+			query:     config.TideQuery{OwnersApprovalRequired: true},
+			approvers: []string{"root"},
+		},
+		{
+			name:      "directory without approval",
+			query:     config.TideQuery{OwnersApprovalRequired: true},
+			approvers: []string{"alice", "bob", "dave"},
+			expected:  "needs approval from an approver of bar",
+		},
+		{
+			name:     "no approvals",
+			query:    config.TideQuery{OwnersApprovalRequired: true},
+			expected: "needs approval from an approver of bar, foo",
+		},
+		{
+			name:      "enough approvals from distinct owners",
+			query:     config.TideQuery{RequiredApprovals: 2},
+			approvers: []string{"alice", "bob"},
+		},
+		{
+			name:      "approvals from users that are not owners do not count",
+			query:     config.TideQuery{RequiredApprovals: 2},
+			approvers: []string{"alice", "dave"},
+			expected:  "needs 2 approvals from OWNERS, has 1",
+		},
+		{
+			name:      "both requirements",
+			query:     config.TideQuery{OwnersApprovalRequired: true, RequiredApprovals: 3},
+			approvers: []string{"alice", "bob", "carol"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pr := testPR("o", "r", "master", 1, githubql.MergeableStateMergeable)
+			var reviews []github.Review
+			for _, login := range tc.approvers {
+				reviews = append(reviews, github.Review{User: github.User{Login: login}, State: github.ReviewStateApproved})
+			}
+			ghc := &fgc{reviews: map[int][]github.Review{1: reviews}}
+			c := &Controller{
+				logger: logrus.WithField("component", "tide"),
+				ghc:    ghc,
+				changedFiles: &changedFilesAgent{
+					nextChangeCache: map[changeCacheKey][]string{
+						{org: "o", repo: "r", number: 1, sha: "SHA"}: files,
+					},
+				},
+				owners: &fakeOwnersClient{owners: owners},
+				reviews: &reviewsAgent{
+					ghc:             ghc,
+					nextReviewCache: make(map[reviewCacheKey][]github.Review),
+				},
+			}
+			missing, err := c.missingOwnersApproval(&tc.query, &pr)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if missing != tc.expected {
+				t.Errorf("Expected missing approvals %q, got %q.", tc.expected, missing)
+			}
+
+			reasons := make(map[string]string)
+			approved := c.ownersApproved(&tc.query, []PullRequest{pr}, reasons)
+			if (len(approved) == 1) != (tc.expected == "") {
+				t.Errorf("Expected the PR to be approved: %t, got PRs %v.", tc.expected == "", prNumbers(approved))
+			}
+			if tc.expected != "" && reasons[prKey(&pr)] != tc.expected {
+				t.Errorf("Expected the reason %q to be recorded, got %v.", tc.expected, reasons)
+			}
+		})
+	}
+}
+
+func TestOwnersApprovedWithoutRequirements(t *testing.T) {
+	prs := []PullRequest{testPR("o", "r", "master", 1, githubql.MergeableStateMergeable)}
+	// No OWNERS client is needed if the query does not require approvals.
+	c := &Controller{logger: logrus.WithField("component", "tide")}
+	if approved := c.ownersApproved(&config.TideQuery{ReviewApprovedRequired: true}, prs, map[string]string{}); len(approved) != 1 {
+		t.Errorf("Expected the PR to be kept, got %v.", prNumbers(approved))
+	}
+	if approved := c.ownersApproved(&config.TideQuery{RequiredApprovals: 1}, prs, map[string]string{}); len(approved) != 0 {
+		t.Errorf("Expected the PR to be left out without an OWNERS client, got %v.", prNumbers(approved))
+	}
+}
+
+func TestPRReviewsCached(t *testing.T) {
+	ghc := &fgc{reviews: map[int][]github.Review{1: {{User: github.User{Login: "alice"}, State: github.ReviewStateApproved}}}}
+	a := &reviewsAgent{ghc: ghc, nextReviewCache: make(map[reviewCacheKey][]github.Review)}
+	pr := testPR("o", "r", "master", 1, githubql.MergeableStateMergeable)
+	pr.Reviews.TotalCount = 1
+
+	get := func() []github.Review {
+		reviews, err := a.prReviews(&pr)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return reviews
+	}
+	get()
+	a.prune()
+	ghc.reviews[1] = append(ghc.reviews[1], github.Review{User: github.User{Login: "bob"}, State: github.ReviewStateApproved})
+	if reviews := get(); len(reviews) != 1 {
+		t.Errorf("Expected the cached reviews, got %v.", reviews)
+	}
+
+	// A new review changes the number of reviews of the PR.
+	pr.Reviews.TotalCount = 2
+	if reviews := get(); len(reviews) != 2 {
+		t.Errorf("Expected the reviews to be listed again, got %v.", reviews)
+	}
+
+	// Entries that are not used during a sync expire.
+	a.prune()
+	a.prune()
+	ghc.reviews[1] = nil
+	if reviews := get(); len(reviews) != 0 {
+		t.Errorf("Expected the reviews to be listed again after expiring, got %v.", reviews)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
+)
+
+// queuePosition is the 1-based position of a PR in the merge queue of its
+// subpool and the number of PRs in that queue.
+type queuePosition struct {
+	position, total int
+}
+
+// priorityOf returns the index of the first priority that a PR matches, or
+// the number of priorities if it matches none. Lower values go first.
+func priorityOf(pr *PullRequest, priorities []config.TidePriority) int {
+	labels := sets.NewString()
+	for _, label := range pr.Labels.Nodes {
+		labels.Insert(string(label.Name))
+	}
+	for i, priority := range priorities {
+		if priority.Matches(labels) {
+			return i
+		}
+	}
+	return len(priorities)
+}
+
+// sortByPriority orders PRs in the order they should be merged: by priority,
+// then oldest first.
+func sortByPriority(prs []PullRequest, priorities []config.TidePriority) {
+	sort.SliceStable(prs, func(i, j int) bool {
+		if pi, pj := priorityOf(&prs[i], priorities), priorityOf(&prs[j], priorities); pi != pj {
+			return pi < pj
+		}
+		return prs[i].Number < prs[j].Number
+	})
+}
+
+// poolPositions returns the position of every PR in the merge queue of its
+// subpool, keyed by prKey. The PRs of the subpools must be sorted by priority.
+func poolPositions(subpoolMap map[string]*subpool) map[string]queuePosition {
+	positions := make(map[string]queuePosition)
+	for _, sp := range subpoolMap {
+		for i := range sp.prs {
+			positions[prKey(&sp.prs[i])] = queuePosition{position: i + 1, total: len(sp.prs)}
+		}
+	}
+	return positions
+}
+
+// pickHighestPriorityPR returns the PR that should be merged or tested first
+// among those that pass their tests, if any.
+func pickHighestPriorityPR(log *logrus.Entry, ghc githubClient, prs []PullRequest, cc contextChecker, priorities []config.TidePriority) (bool, PullRequest) {
+	sorted := make([]PullRequest, len(prs))
+	copy(sorted, prs)
+	sortByPriority(sorted, priorities)
+	for _, pr := range sorted {
+		if len(pr.Commits.Nodes) < 1 {
+			continue
+		}
+		if !isPassingTests(log, ghc, pr, cc) {
+			continue
+		}
+		return true, pr
+	}
+	return false, PullRequest{}
+}
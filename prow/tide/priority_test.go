@@ -0,0 +1,125 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"reflect"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/config"
+)
+
+func prWithLabels(num int, labels ...string) PullRequest {
+	var pr PullRequest
+	pr.Number = githubql.Int(num)
+	pr.Repository.NameWithOwner = "o/r"
+	pr.Commits.Nodes = []struct{ Commit Commit }{{}}
+	for _, label := range labels {
+		pr.Labels.Nodes = append(pr.Labels.Nodes, struct{ Name githubql.String }{Name: githubql.String(label)})
+	}
+	return pr
+}
+
+func TestSortByPriority(t *testing.T) {
+	priorities := []config.TidePriority{
+		{Labels: []string{"kind/bug|kind/regression", "priority/critical-urgent"}},
+		{Labels: []string{"kind/bug"}},
+	}
+	testCases := []struct {
+		name       string
+		priorities []config.TidePriority
+		prs        []PullRequest
+		expected   []int
+	}{
+		{
+			name: "oldest first without priorities",
+			prs: []PullRequest{
+				prWithLabels(3, "kind/bug"),
+				prWithLabels(1),
+				prWithLabels(2, "kind/bug", "priority/critical-urgent"),
+			},
+			expected: []int{1, 2, 3},
+		},
+		{
+			name:       "higher priority first, then oldest first",
+			priorities: priorities,
+			prs: []PullRequest{
+				prWithLabels(1),
+				prWithLabels(5, "kind/bug"),
+				prWithLabels(4, "kind/regression", "priority/critical-urgent"),
+				prWithLabels(3, "kind/bug"),
+				prWithLabels(2, "priority/critical-urgent"),
+			},
+			expected: []int{4, 3, 5, 1, 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sortByPriority(tc.prs, tc.priorities)
+			if actual := prNumbers(tc.prs); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected order %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPickHighestPriorityPR(t *testing.T) {
+	priorities := []config.TidePriority{{Labels: []string{"kind/bug"}}}
+	failing := prWithLabels(1, "kind/bug")
+	failing.Commits.Nodes[0].Commit.Status.Contexts = []Context{{Context: "job", State: githubql.StatusStateFailure}}
+	prs := []PullRequest{
+		prWithLabels(3),
+		failing,
+		prWithLabels(4, "kind/bug"),
+		prWithLabels(2),
+	}
+
+	ok, pr := pickHighestPriorityPR(logrus.WithField("component", "tide"), &fgc{}, prs, &config.TideContextPolicy{}, priorities)
+	if !ok {
+		t.Fatal("expected a PR to be picked")
+	}
+	if pr.Number != 4 {
+		t.Errorf("expected PR 4 to be picked, got %d", pr.Number)
+	}
+	if actual := prNumbers(prs); !reflect.DeepEqual(actual, []int{3, 1, 4, 2}) {
+		t.Errorf("expected the PRs to be left in order, got %v", actual)
+	}
+
+	if ok, _ := pickHighestPriorityPR(logrus.WithField("component", "tide"), &fgc{}, []PullRequest{failing}, &config.TideContextPolicy{}, priorities); ok {
+		t.Error("expected no PR to be picked when none pass their tests")
+	}
+}
+
+func TestPoolPositions(t *testing.T) {
+	subpools := map[string]*subpool{
+		"o/r:master": {prs: []PullRequest{prWithLabels(3), prWithLabels(1), prWithLabels(2)}},
+		"o/r:dev":    {prs: []PullRequest{prWithLabels(4)}},
+	}
+	expected := map[string]queuePosition{
+		"o/r#3": {position: 1, total: 3},
+		"o/r#1": {position: 2, total: 3},
+		"o/r#2": {position: 3, total: 3},
+		"o/r#4": {position: 1, total: 1},
+	}
+	if actual := poolPositions(subpools); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected positions %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/tide/history"
+)
+
+// SimulatedPR is the decision that a simulated sync made for a PR.
+type SimulatedPR struct {
+	Org    string
+	Repo   string
+	Branch string
+	Number int
+	Title  string
+
+	// InPool is true if the PR matches a Tide query and is not filtered out of
+	// its subpool.
+	InPool bool
+	// Action is the action that Tide takes for the pool of the PR, if the PR
+	// is in the pool.
+	Action Action
+	// Target is true if the action is taken for this PR, e.g. if it merges.
+	Target bool
+
+	// State and Description are the tide status context that Tide sets on
+	// the PR. The description explains why a PR is not in the pool.
+	State       string
+	Description string
+}
+
+// SimulateGitHub runs a sync of Tide against the open PRs on GitHub and the
+// given ProwJobs without changing anything. GitHub is only read from and no
+// ProwJobs are created. It returns the decision for every open PR in the
+// repos of the Tide queries, along with the resulting pools.
+func SimulateGitHub(cfg config.Getter, ghc *github.Client, gc *git.Client, pjs []prowapi.ProwJob, logger *logrus.Entry) ([]SimulatedPR, []Pool, error) {
+	c, err := newSimulationController(cfg, ghc, gc, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	// OWNERS can only be loaded with a git client.
+	if gc != nil {
+		c.owners = newOwnersClient(gc, ghc, cfg)
+	}
+
+	pool := make(map[string]PullRequest)
+	missingApprovals := make(map[string]string)
+	for _, query := range cfg().Tide.Queries {
+		q := query.Query()
+		results, err := search(ghc.Query, logger, q, time.Time{}, time.Now())
+		if err != nil && len(results) == 0 {
+			return nil, nil, fmt.Errorf("query %q, err: %v", q, err)
+		}
+		if err != nil {
+			logger.WithError(err).WithField("query", q).Warning("found partial results")
+		}
+		for _, pr := range c.ownersApproved(&query, results, missingApprovals) {
+			pool[prKey(&pr)] = pr
+		}
+	}
+	for key := range pool {
+		delete(missingApprovals, key)
+	}
+
+	orgExceptions, repos := cfg().Tide.Queries.OrgExceptionsAndRepos()
+	q := openPRsQuery(sets.StringKeySet(orgExceptions).List(), repos.List(), orgExceptions)
+	all, err := search(ghc.Query, logger, q, time.Time{}, time.Now())
+	if err != nil && len(all) == 0 {
+		return nil, nil, fmt.Errorf("query %q, err: %v", q, err)
+	}
+	if err != nil {
+		logger.WithError(err).WithField("query", q).Warning("found partial results")
+	}
+	open := byRepoAndNumber(all)
+	for key, pr := range pool {
+		if _, ok := open[key]; !ok {
+			all = append(all, pr)
+		}
+	}
+	return c.simulate(pool, all, pjs, missingApprovals)
+}
+
+// SimulateSnapshot runs a sync of Tide against the PRs of a snapshot of the
+// Tide pools, as served by Tide or by Deck's /tide.js, and the given
+// ProwJobs. The PRs are matched against the Tide queries locally, which only
+// considers the branches, milestones and labels that the queries require.
+// The changed files of PRs are not part of snapshots, so presubmits that run
+// if files changed are not required.
+func SimulateSnapshot(cfg config.Getter, snapshot []Pool, pjs []prowapi.ProwJob, logger *logrus.Entry) ([]SimulatedPR, []Pool, error) {
+	ghc := &snapshotGitHubClient{refs: make(map[string]string)}
+	prs := make(map[string]PullRequest)
+	for _, p := range snapshot {
+		ghc.refs[poolKey(p.Org, p.Repo, p.Branch)] = p.BaseSHA
+		for _, group := range [][]PullRequest{p.SuccessPRs, p.PendingPRs, p.MissingPRs} {
+			for _, pr := range group {
+				prs[prKey(&pr)] = pr
+			}
+		}
+	}
+
+	queryMap := cfg().Tide.Queries.QueryMap()
+	pool := make(map[string]PullRequest)
+	var all []PullRequest
+	for key, pr := range prs {
+		all = append(all, pr)
+		for _, q := range queryMap.ForRepo(string(pr.Repository.Owner.Login), string(pr.Repository.Name)) {
+			// Status contexts are checked when filtering the subpools.
+			if _, diff := requirementDiff(&pr, &q, ignoredContexts{}); diff == 0 {
+				pool[key] = pr
+				break
+			}
+		}
+	}
+	c, err := newSimulationController(cfg, ghc, nil, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Snapshots only contain PRs of the pools, which have the approvals
+	// from OWNERS they need.
+	return c.simulate(pool, all, pjs, nil)
+}
+
+// newSimulationController creates a Controller that reads from GitHub, but
+// does not change anything.
+func newSimulationController(cfg config.Getter, ghc githubClient, gc *git.Client, logger *logrus.Entry) (*Controller, error) {
+	hist, err := history.New(10, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Controller{
+		logger:        logger,
+		config:        cfg,
+		ghc:           simulationGitHubClient{ghc},
+		prowJobClient: simulationProwJobClient{},
+		gc:            gc,
+		changedFiles: &changedFilesAgent{
+			ghc:             ghc,
+			nextChangeCache: make(map[changeCacheKey][]string),
+		},
+		reviews: &reviewsAgent{
+			ghc:             ghc,
+			nextReviewCache: make(map[reviewCacheKey][]github.Review),
+		},
+		batchExclusions: &batchExclusions{},
+		History:         hist,
+	}, nil
+}
+
+// simulate divides the PRs that match a Tide query into subpools, filters
+// them and takes the action of every subpool without side effects.
+// missingApprovals describes the approvals from OWNERS that PRs lack by the
+// keys of the PRs.
+func (c *Controller) simulate(pool map[string]PullRequest, all []PullRequest, pjs []prowapi.ProwJob, missingApprovals map[string]string) ([]SimulatedPR, []Pool, error) {
+	cfg := c.config
+	rawPools, err := c.dividePool(pool, pjs)
+	if err != nil {
+		return nil, nil, err
+	}
+	filteredPools := c.filterSubpools(cfg().Tide.MaxGoroutines, rawPools)
+	for _, sp := range filteredPools {
+		sortByPriority(sp.prs, cfg().Tide.PriorityFor(sp.org, sp.repo))
+	}
+	positions := poolPositions(filteredPools)
+	poolPRs := poolPRMap(filteredPools)
+
+	pools := make([]Pool, 0, len(filteredPools))
+	poolsByKey := make(map[string]Pool, len(filteredPools))
+	for key, sp := range filteredPools {
+		freezes := activeFreezes(cfg().Tide.MergeFreezes, sp.org, sp.repo, sp.branch, time.Now())
+		p, err := c.syncSubpool(*sp, nil, freezes)
+		if err != nil {
+			sp.log.WithError(err).Warning("Error simulating subpool.")
+		}
+		pools = append(pools, p)
+		poolsByKey[key] = p
+	}
+	sortPools(pools)
+
+	queryMap := cfg().Tide.Queries.QueryMap()
+	decisions := make([]SimulatedPR, 0, len(all))
+	for _, pr := range all {
+		org, repo, branch := string(pr.Repository.Owner.Login), string(pr.Repository.Name), string(pr.BaseRef.Name)
+		d := SimulatedPR{
+			Org:    org,
+			Repo:   repo,
+			Branch: branch,
+			Number: int(pr.Number),
+			Title:  string(pr.Title),
+		}
+		cc, err := cfg().GetTideContextPolicy(org, repo, branch)
+		if err != nil {
+			d.State, d.Description = github.StatusError, fmt.Sprintf("Failed to get the context policy: %v", err)
+			decisions = append(decisions, d)
+			continue
+		}
+		freezes := activeFreezes(cfg().Tide.MergeFreezes, org, repo, branch, time.Now())
+		d.State, d.Description = expectedStatus(queryMap, &pr, poolPRs, positions, missingApprovals, freezes, cc)
+		if _, ok := poolPRs[prKey(&pr)]; ok {
+			p := poolsByKey[poolKey(org, repo, branch)]
+			d.InPool = true
+			d.Action = p.Action
+			for _, target := range p.Target {
+				if target.Number == pr.Number {
+					d.Target = true
+				}
+			}
+		}
+		decisions = append(decisions, d)
+	}
+	sort.Slice(decisions, func(i, j int) bool {
+		if a, b := decisions[i].Org+"/"+decisions[i].Repo, decisions[j].Org+"/"+decisions[j].Repo; a != b {
+			return a < b
+		}
+		return decisions[i].Number < decisions[j].Number
+	})
+	return decisions, pools, nil
+}
+
+// ignoredContexts is a contextChecker that treats all contexts as optional.
+type ignoredContexts struct{}
+
+func (ignoredContexts) IsOptional(string) bool                    { return true }
+func (ignoredContexts) MissingRequiredContexts([]string) []string { return nil }
+
+// simulationGitHubClient wraps a GitHub client so that a simulated sync can
+// read from GitHub, but not change anything.
+type simulationGitHubClient struct {
+	githubClient
+}
+
+func (simulationGitHubClient) CreateStatus(string, string, string, github.Status) error { return nil }
+func (simulationGitHubClient) Merge(string, string, int, github.MergeDetails) error     { return nil }
+func (simulationGitHubClient) CreateCommit(org, repo, message, tree string, parents []string) (string, error) {
+	return "", nil
+}
+func (simulationGitHubClient) CreateRef(org, repo, ref, sha string) error { return nil }
+func (simulationGitHubClient) CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error) {
+	return 0, nil
+}
+
+// simulationProwJobClient drops the ProwJobs that a simulated sync triggers.
+type simulationProwJobClient struct{}
+
+func (simulationProwJobClient) Create(pj *prowapi.ProwJob) (*prowapi.ProwJob, error) { return pj, nil }
+func (simulationProwJobClient) List(metav1.ListOptions) (*prowapi.ProwJobList, error) {
+	return &prowapi.ProwJobList{}, nil
+}
+
+// errNotInSnapshot is returned for all reads from GitHub that a snapshot
+// cannot answer.
+var errNotInSnapshot = errors.New("not recorded in the snapshot")
+
+// snapshotGitHubClient answers the reads of a simulated sync from a snapshot
+// of the Tide pools. Writes are dropped by the simulationGitHubClient it
+// embeds.
+type snapshotGitHubClient struct {
+	simulationGitHubClient
+	// refs maps pool keys to the base SHAs of the pools.
+	refs map[string]string
+}
+
+func (c *snapshotGitHubClient) GetRef(org, repo, ref string) (string, error) {
+	return c.refs[poolKey(org, repo, strings.TrimPrefix(ref, "heads/"))], nil
+}
+
+func (c *snapshotGitHubClient) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
+	return nil, nil
+}
+
+func (c *snapshotGitHubClient) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error) {
+	return nil, errNotInSnapshot
+}
+
+// The bodies, commits and reviews of PRs are not part of snapshots, so merge
+// commit templates are executed without them.
+func (c *snapshotGitHubClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	return &github.PullRequest{Number: number}, nil
+}
+
+func (c *snapshotGitHubClient) ListPRCommits(org, repo string, number int) ([]github.RepositoryCommit, error) {
+	return nil, nil
+}
+
+func (c *snapshotGitHubClient) ListReviews(org, repo string, number int) ([]github.Review, error) {
+	return nil, nil
+}
+
+func (c *snapshotGitHubClient) GetSingleCommit(org, repo, SHA string) (github.SingleCommit, error) {
+	return github.SingleCommit{}, errNotInSnapshot
+}
+
+func (c *snapshotGitHubClient) Query(context.Context, interface{}, map[string]interface{}) error {
+	return errNotInSnapshot
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"reflect"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestSimulateSnapshot(t *testing.T) {
+	withLabels := func(pr PullRequest, labels ...string) PullRequest {
+		for _, label := range labels {
+			pr.Labels.Nodes = append(pr.Labels.Nodes, struct{ Name githubql.String }{Name: githubql.String(label)})
+		}
+		return pr
+	}
+	failing := testPR("o", "r", "master", 3, githubql.MergeableStateMergeable)
+	failing.Commits.Nodes[0].Commit.Status.Contexts[0].State = githubql.StatusStateFailure
+	snapshot := []Pool{{
+		Org:     "o",
+		Repo:    "r",
+		Branch:  "master",
+		BaseSHA: "base",
+		SuccessPRs: []PullRequest{
+			withLabels(testPR("o", "r", "master", 1, githubql.MergeableStateMergeable), "lgtm", "approved"),
+			withLabels(testPR("o", "r", "master", 2, githubql.MergeableStateMergeable), "lgtm"),
+		},
+		MissingPRs: []PullRequest{withLabels(failing, "lgtm", "approved")},
+	}}
+
+	cfg := &config.Config{}
+	cfg.Tide.Queries = config.TideQueries{{
+		Repos:  []string{"o/r"},
+		Labels: []string{"lgtm", "approved"},
+	}}
+	cfg.Tide.MaxGoroutines = 1
+	ca := &config.Agent{}
+	ca.Set(cfg)
+
+	prs, pools, err := SimulateSnapshot(ca.Config, snapshot, nil, logrus.WithField("component", "tide"))
+	if err != nil {
+		t.Fatalf("Unexpected error simulating Tide: %v", err)
+	}
+
+	expectedPRs := []SimulatedPR{
+		{Org: "o", Repo: "r", Branch: "master", Number: 1, InPool: true, Action: Merge, Target: true, State: "success", Description: "In merge pool at position 1 of 1."},
+		{Org: "o", Repo: "r", Branch: "master", Number: 2, State: "pending", Description: "Not mergeable. Needs approved label."},
+		{Org: "o", Repo: "r", Branch: "master", Number: 3, State: "pending", Description: "Not mergeable. Job context has not succeeded."},
+	}
+	if !reflect.DeepEqual(prs, expectedPRs) {
+		t.Errorf("Wrong decisions.\nGot:  %+v\nWant: %+v", prs, expectedPRs)
+	}
+	if len(pools) != 1 || pools[0].Action != Merge || pools[0].BaseSHA != "base" {
+		t.Errorf("Expected the pool to merge PR 1 into base, got %+v.", pools)
+	}
+}
+
+func TestSimulationHasNoSideEffects(t *testing.T) {
+	ghc := &fgc{}
+	c := simulationGitHubClient{ghc}
+	if err := c.Merge("o", "r", 1, github.MergeDetails{}); err != nil {
+		t.Errorf("Unexpected error merging: %v", err)
+	}
+	if _, err := c.CreatePullRequest("o", "r", "title", "body", "head", "master", true); err != nil {
+		t.Errorf("Unexpected error creating a PR: %v", err)
+	}
+	if ghc.merged != 0 || len(ghc.createdPRs) != 0 {
+		t.Errorf("Expected the GitHub client not to be changed, got %d merges and PRs %v.", ghc.merged, ghc.createdPRs)
+	}
+	pj := &prowapi.ProwJob{}
+	if created, err := (simulationProwJobClient{}).Create(pj); err != nil || created != pj {
+		t.Errorf("Expected the ProwJob to be returned as created, got %v, %v.", created, err)
+	}
+}
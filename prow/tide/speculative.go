@@ -0,0 +1,137 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"fmt"
+
+	"k8s.io/test-infra/prow/tide/history"
+)
+
+// missingState is the state of a candidate batch of the speculative queue
+// that is not being tested.
+const missingState simpleState = "missing"
+
+// SpeculativeBatch is one of the overlapping candidate batches of the
+// speculative merge queue of a pool. The PRs of every candidate batch are a
+// prefix of the queue, so the candidates for a queue of A, B and C are A,
+// A+B and A+B+C.
+type SpeculativeBatch struct {
+	PRs   []PullRequest
+	State string
+}
+
+// speculativeCandidates pairs every prefix of the queue with the state of the
+// tests of that prefix. Prefixes of a single PR are tested by the presubmits
+// of the PR, longer ones by batch jobs.
+func speculativeCandidates(queue []PullRequest, batches []batchState, successes, pendings []PullRequest) []batchState {
+	states := make(map[string]simpleState)
+	for _, batch := range batches {
+		states[fmt.Sprint(prNumbers(batch.prs))] = batch.state
+	}
+	for _, pr := range successes {
+		states[fmt.Sprint([]int{int(pr.Number)})] = successState
+	}
+	for _, pr := range pendings {
+		states[fmt.Sprint([]int{int(pr.Number)})] = pendingState
+	}
+
+	var candidates []batchState
+	for i := range queue {
+		prefix := queue[:i+1]
+		state, ok := states[fmt.Sprint(prNumbers(prefix))]
+		if !ok {
+			state = missingState
+		}
+		candidates = append(candidates, batchState{prs: prefix, state: state})
+	}
+	return candidates
+}
+
+// takeSpeculativeAction is the equivalent of takeAction for pools that use
+// the speculative merge queue. It merges the longest passing candidate batch
+// once no longer candidate is pending, as that one would merge more PRs.
+// Otherwise it triggers every candidate that has not been tested yet, so that
+// all of them are tested in parallel. Failed candidates are not triggered
+// again, bisection and the exclusion of culprits take care of them.
+func (c *Controller) takeSpeculativeAction(sp subpool, depth int, batches []batchState, successes, pendings []PullRequest) (Action, []PullRequest, []SpeculativeBatch, error) {
+	// If no presubmits are configured, just wait.
+	if len(sp.presubmits) == 0 {
+		return Wait, nil, nil, nil
+	}
+	queue, err := c.pickBatch(sp, sp.cc, depth)
+	if err != nil {
+		return Wait, nil, nil, err
+	}
+	candidates := speculativeCandidates(queue, batches, successes, pendings)
+	var state []SpeculativeBatch
+	for _, candidate := range candidates {
+		state = append(state, SpeculativeBatch{PRs: candidate.prs, State: string(candidate.state)})
+	}
+
+	passing := -1
+	for i, candidate := range candidates {
+		switch candidate.state {
+		case successState:
+			passing = i
+		case pendingState:
+			if passing >= 0 && i > passing {
+				// Wait for the longer candidate rather than invalidating it.
+				passing = -1
+			}
+		}
+	}
+	if passing >= 0 {
+		prs := candidates[passing].prs
+		if len(prs) == 1 {
+			return Merge, prs, state, c.mergePRs(sp, prs)
+		}
+		return MergeBatch, prs, state, c.mergePRs(sp, prs)
+	}
+
+	var triggered []PullRequest
+	for i, candidate := range candidates {
+		if candidate.state != missingState {
+			continue
+		}
+		if err := c.trigger(sp, sp.presubmits, candidate.prs); err != nil {
+			return TriggerBatch, candidate.prs, state, err
+		}
+		state[i].State = string(pendingState)
+		triggered = candidate.prs
+	}
+	switch len(triggered) {
+	case 0:
+		return Wait, nil, state, nil
+	case 1:
+		return Trigger, triggered, state, nil
+	default:
+		return TriggerBatch, triggered, state, nil
+	}
+}
+
+// queueHistory converts the state of a speculative queue for the history.
+func queueHistory(queue []SpeculativeBatch) []history.QueuedBatch {
+	var res []history.QueuedBatch
+	for _, batch := range queue {
+		res = append(res, history.QueuedBatch{
+			Pulls: prMeta(batch.PRs...),
+			State: batch.State,
+		})
+	}
+	return res
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	clienttesting "k8s.io/client-go/testing"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/client/clientset/versioned/fake"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git/localgit"
+	"k8s.io/test-infra/prow/tide/history"
+)
+
+func TestSpeculativeCandidates(t *testing.T) {
+	pr := func(num int) PullRequest {
+		var pr PullRequest
+		pr.Number = githubql.Int(num)
+		return pr
+	}
+	queue := []PullRequest{pr(1), pr(2), pr(3)}
+	batches := []batchState{
+		{prs: []PullRequest{pr(1), pr(2)}, state: successState},
+		{prs: []PullRequest{pr(2), pr(3)}, state: pendingState},
+	}
+
+	candidates := speculativeCandidates(queue, batches, nil, []PullRequest{pr(1)})
+	var actual []string
+	for _, candidate := range candidates {
+		actual = append(actual, fmt.Sprintf("%v:%s", prNumbers(candidate.prs), candidate.state))
+	}
+	expected := []string{"[1]:pending", "[1 2]:success", "[1 2 3]:missing"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected candidates %v, got %v", expected, actual)
+	}
+}
+
+func TestTakeSpeculativeAction(t *testing.T) {
+	// PRs 1-3 exist. All are mergeable, and all are passing tests.
+	testCases := []struct {
+		name      string
+		depth     int
+		batches   map[string]simpleState
+		successes []int
+		pendings  []int
+
+		action           Action
+		targets          []int
+		merged           int
+		triggered        int
+		triggeredBatches int
+		queue            []string
+	}{
+		{
+			name:             "nothing tested, trigger every candidate",
+			depth:            3,
+			action:           TriggerBatch,
+			targets:          []int{1, 2, 3},
+			triggered:        3,
+			triggeredBatches: 2,
+			queue:            []string{"[1]:pending", "[1 2]:pending", "[1 2 3]:pending"},
+		},
+		{
+			name:             "queue is limited to the depth",
+			depth:            2,
+			action:           TriggerBatch,
+			targets:          []int{1, 2},
+			triggered:        2,
+			triggeredBatches: 1,
+			queue:            []string{"[1]:pending", "[1 2]:pending"},
+		},
+		{
+			name:      "only the first PR is missing, trigger it alone",
+			depth:     3,
+			batches:   map[string]simpleState{"[1 2]": pendingState, "[1 2 3]": pendingState},
+			action:    Trigger,
+			targets:   []int{1},
+			triggered: 1,
+			queue:     []string{"[1]:pending", "[1 2]:pending", "[1 2 3]:pending"},
+		},
+		{
+			name:      "longest passing prefix is merged",
+			depth:     3,
+			batches:   map[string]simpleState{"[1 2]": successState, "[1 2 3]": failureState},
+			successes: []int{1},
+			action:    MergeBatch,
+			targets:   []int{1, 2},
+			merged:    2,
+			queue:     []string{"[1]:success", "[1 2]:success", "[1 2 3]:failure"},
+		},
+		{
+			name:     "passing prefix is merged while a shorter one is pending",
+			depth:    3,
+			batches:  map[string]simpleState{"[1 2]": successState, "[1 2 3]": failureState},
+			pendings: []int{1},
+			action:   MergeBatch,
+			targets:  []int{1, 2},
+			merged:   2,
+			queue:    []string{"[1]:pending", "[1 2]:success", "[1 2 3]:failure"},
+		},
+		{
+			name:      "wait for a longer pending prefix",
+			depth:     3,
+			batches:   map[string]simpleState{"[1 2]": pendingState, "[1 2 3]": failureState},
+			successes: []int{1},
+			action:    Wait,
+			queue:     []string{"[1]:success", "[1 2]:pending", "[1 2 3]:failure"},
+		},
+		{
+			name:      "failed candidates are not triggered again",
+			depth:     3,
+			batches:   map[string]simpleState{"[1 2]": failureState, "[1 2 3]": failureState},
+			action:    Trigger,
+			targets:   []int{1},
+			triggered: 1,
+			queue:     []string{"[1]:pending", "[1 2]:failure", "[1 2 3]:failure"},
+		},
+		{
+			name:      "single passing PR is merged",
+			depth:     3,
+			batches:   map[string]simpleState{"[1 2]": failureState, "[1 2 3]": failureState},
+			successes: []int{1},
+			action:    Merge,
+			targets:   []int{1},
+			merged:    1,
+			queue:     []string{"[1]:success", "[1 2]:failure", "[1 2 3]:failure"},
+		},
+		{
+			name:     "everything pending, nothing to do",
+			depth:    3,
+			batches:  map[string]simpleState{"[1 2]": pendingState, "[1 2 3]": pendingState},
+			pendings: []int{1},
+			action:   Wait,
+			queue:    []string{"[1]:pending", "[1 2]:pending", "[1 2 3]:pending"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lg, gc, err := localgit.New()
+			if err != nil {
+				t.Fatalf("Error making local git: %v", err)
+			}
+			defer gc.Clean()
+			defer lg.Clean()
+			if err := lg.MakeFakeRepo("o", "r"); err != nil {
+				t.Fatalf("Error making fake repo: %v", err)
+			}
+			if err := lg.AddCommit("o", "r", map[string][]byte{"foo": []byte("foo")}); err != nil {
+				t.Fatalf("Adding initial commit: %v", err)
+			}
+
+			sp := subpool{
+				log:        logrus.WithField("component", "tide"),
+				presubmits: map[int][]config.Presubmit{},
+				cc:         &config.TideContextPolicy{},
+				org:        "o",
+				repo:       "r",
+				branch:     "master",
+				sha:        "master",
+			}
+			prs := map[int]PullRequest{}
+			for i := 1; i <= 3; i++ {
+				if err := lg.CheckoutNewBranch("o", "r", fmt.Sprintf("pr-%d", i)); err != nil {
+					t.Fatalf("Error checking out new branch: %v", err)
+				}
+				if err := lg.AddCommit("o", "r", map[string][]byte{fmt.Sprintf("%d", i): []byte("WOW")}); err != nil {
+					t.Fatalf("Error adding commit: %v", err)
+				}
+				if err := lg.Checkout("o", "r", "master"); err != nil {
+					t.Fatalf("Error checking out master: %v", err)
+				}
+				oid := githubql.String(fmt.Sprintf("origin/pr-%d", i))
+				var pr PullRequest
+				pr.Number = githubql.Int(i)
+				pr.HeadRefOID = oid
+				pr.Commits.Nodes = []struct {
+					Commit Commit
+				}{{Commit: Commit{OID: oid}}}
+				sp.prs = append(sp.prs, pr)
+				sp.presubmits[i] = []config.Presubmit{{Reporter: config.Reporter{Context: "foo"}}}
+				prs[i] = pr
+			}
+			pulls := func(nums ...int) []PullRequest {
+				var res []PullRequest
+				for _, num := range nums {
+					res = append(res, prs[num])
+				}
+				return res
+			}
+			var batches []batchState
+			for _, nums := range [][]int{{1, 2}, {1, 2, 3}} {
+				if state, ok := tc.batches[fmt.Sprint(nums)]; ok {
+					batches = append(batches, batchState{prs: pulls(nums...), state: state})
+				}
+			}
+
+			ca := &config.Agent{}
+			ca.Set(&config.Config{})
+			fgc := fgc{}
+			fakeProwJobClient := fake.NewSimpleClientset()
+			hist, err := history.New(100, nil, "")
+			if err != nil {
+				t.Fatalf("Failed to create history client: %v", err)
+			}
+			c := &Controller{
+				logger:        logrus.WithField("controller", "tide"),
+				gc:            gc,
+				config:        ca.Config,
+				ghc:           &fgc,
+				prowJobClient: fakeProwJobClient.ProwV1().ProwJobs("prowjobs"),
+				History:       hist,
+			}
+
+			act, targets, queue, err := c.takeSpeculativeAction(sp, tc.depth, batches, pulls(tc.successes...), pulls(tc.pendings...))
+			if err != nil {
+				t.Fatalf("Unexpected error in takeSpeculativeAction: %v", err)
+			}
+			if act != tc.action {
+				t.Errorf("Wrong action. Got %v, wanted %v.", act, tc.action)
+			}
+			if actual := prNumbers(targets); !reflect.DeepEqual(actual, tc.targets) {
+				t.Errorf("Wrong targets. Got %v, wanted %v.", actual, tc.targets)
+			}
+			var actualQueue []string
+			for _, batch := range queue {
+				actualQueue = append(actualQueue, fmt.Sprintf("%v:%s", prNumbers(batch.PRs), batch.State))
+			}
+			if !reflect.DeepEqual(actualQueue, tc.queue) {
+				t.Errorf("Wrong queue. Got %v, wanted %v.", actualQueue, tc.queue)
+			}
+			if fgc.merged != tc.merged {
+				t.Errorf("Wrong number of merges. Got %d, expected %d.", fgc.merged, tc.merged)
+			}
+
+			var triggered, triggeredBatches int
+			for _, action := range fakeProwJobClient.Actions() {
+				if action, ok := action.(clienttesting.CreateActionImpl); ok {
+					triggered++
+					if pj, ok := action.Object.(*prowapi.ProwJob); ok && pj.Spec.Type == prowapi.BatchJob {
+						triggeredBatches++
+					}
+				}
+			}
+			if triggered != tc.triggered {
+				t.Errorf("Wrong number of jobs triggered. Got %d, expected %d.", triggered, tc.triggered)
+			}
+			if triggeredBatches != tc.triggeredBatches {
+				t.Errorf("Wrong number of batches triggered. Got %d, expected %d.", triggeredBatches, tc.triggeredBatches)
+			}
+		})
+	}
+}
@@ -40,6 +40,14 @@ import (
 const (
 	statusContext string = "tide"
 	statusInPool         = "In merge pool."
+	// statusInPoolPosition is a format string used for PRs in a tide pool when
+	// merge priorities are configured. It is populated with the position of the
+	// PR in the merge queue of its pool and the number of PRs in the queue.
+	statusInPoolPosition = "In merge pool at position %d of %d."
+	// statusInPoolFrozen is a format string used for PRs in a tide pool that
+	// is blocked by a merge freeze. It is populated with the end and the name
+	// of the freeze that ends first.
+	statusInPoolFrozen = "In merge pool, but merges are frozen until %s: %s."
 	// statusNotInPool is a format string used when a PR is not in a tide pool.
 	// The '%s' field is populated with the reason why the PR is not in a
 	// tide pool or the empty string if the reason is unknown. See requirementDiff.
@@ -70,7 +78,11 @@ type statusController struct {
 	lastSyncStart time.Time
 
 	sync.Mutex
-	poolPRs map[string]PullRequest
+	poolPRs       map[string]PullRequest
+	poolPositions map[string]queuePosition
+	// missingApprovals maps the keys of PRs that lack approvals from OWNERS
+	// to a description of the approvals they lack.
+	missingApprovals map[string]string
 
 	storedState
 	opener io.Opener
@@ -220,7 +232,11 @@ func requirementDiff(pr *PullRequest, q *config.TideQuery, cc contextChecker) (s
 // in order to generate a diff for the status description. We choose the query
 // for the repo that the PR is closest to meeting (as determined by the number
 // of unmet/violated requirements).
-func expectedStatus(queryMap *config.QueryMap, pr *PullRequest, pool map[string]PullRequest, cc contextChecker) (string, string) {
+// If a PR meets a query, but lacks approvals from OWNERS, the description says
+// which approvals it lacks.
+// If the position of a PR in the pool is known, it is included in the
+// description, unless merges into the branch of the PR are frozen.
+func expectedStatus(queryMap *config.QueryMap, pr *PullRequest, pool map[string]PullRequest, positions map[string]queuePosition, missingApprovals map[string]string, freezes []Freeze, cc contextChecker) (string, string) {
 	if _, ok := pool[prKey(pr)]; !ok {
 		minDiffCount := -1
 		var minDiff string
@@ -231,8 +247,17 @@ func expectedStatus(queryMap *config.QueryMap, pr *PullRequest, pool map[string]
 				minDiff = diff
 			}
 		}
+		if missing, ok := missingApprovals[prKey(pr)]; ok && minDiff == "" {
+			minDiff = fmt.Sprintf(" %s%s.", strings.ToUpper(missing[:1]), missing[1:])
+		}
 		return github.StatusPending, fmt.Sprintf(statusNotInPool, minDiff)
 	}
+	if len(freezes) > 0 {
+		return github.StatusSuccess, fmt.Sprintf(statusInPoolFrozen, freezes[0].Until.UTC().Format("Mon Jan 2 15:04 MST"), freezes[0].Name)
+	}
+	if pos, ok := positions[prKey(pr)]; ok {
+		return github.StatusSuccess, fmt.Sprintf(statusInPoolPosition, pos.position, pos.total)
+	}
 	return github.StatusSuccess, statusInPool
 }
 
@@ -258,7 +283,7 @@ func targetURL(c config.Getter, pr *PullRequest, log *logrus.Entry) string {
 	return link
 }
 
-func (sc *statusController) setStatuses(all []PullRequest, pool map[string]PullRequest) {
+func (sc *statusController) setStatuses(all []PullRequest, pool map[string]PullRequest, positions map[string]queuePosition, missingApprovals map[string]string) {
 	// queryMap caches which queries match a repo.
 	// Make a new one each sync loop as queries will change.
 	queryMap := sc.config().Tide.Queries.QueryMap()
@@ -281,7 +306,19 @@ func (sc *statusController) setStatuses(all []PullRequest, pool map[string]PullR
 			return
 		}
 
-		wantState, wantDesc := expectedStatus(queryMap, pr, pool, cr)
+		freezes := activeFreezes(
+			sc.config().Tide.MergeFreezes,
+			string(pr.Repository.Owner.Login),
+			string(pr.Repository.Name),
+			string(pr.BaseRef.Name),
+			time.Now())
+		// Only report positions when they are determined by priorities, to avoid
+		// updating the status of every PR in a pool whenever one merges.
+		prPositions := positions
+		if len(sc.config().Tide.PriorityFor(string(pr.Repository.Owner.Login), string(pr.Repository.Name))) == 0 {
+			prPositions = nil
+		}
+		wantState, wantDesc := expectedStatus(queryMap, pr, pool, prPositions, missingApprovals, freezes, cr)
 		var actualState githubql.StatusState
 		var actualDesc string
 		for _, ctx := range contexts {
@@ -414,8 +451,10 @@ func (sc *statusController) waitSync() {
 		case <-wait:
 			sc.Lock()
 			pool := sc.poolPRs
+			positions := sc.poolPositions
+			missingApprovals := sc.missingApprovals
 			sc.Unlock()
-			sc.sync(pool)
+			sc.sync(pool, positions, missingApprovals)
 			return
 		case more := <-sc.newPoolPending:
 			if !more {
@@ -425,7 +464,7 @@ func (sc *statusController) waitSync() {
 	}
 }
 
-func (sc *statusController) sync(pool map[string]PullRequest) {
+func (sc *statusController) sync(pool map[string]PullRequest, positions map[string]queuePosition, missingApprovals map[string]string) {
 	sc.lastSyncStart = time.Now()
 	defer func() {
 		duration := time.Since(sc.lastSyncStart)
@@ -433,7 +472,7 @@ func (sc *statusController) sync(pool map[string]PullRequest) {
 		tideMetrics.statusUpdateDuration.Set(duration.Seconds())
 	}()
 
-	sc.setStatuses(sc.search(), pool)
+	sc.setStatuses(sc.search(), pool, positions, missingApprovals)
 }
 
 func (sc *statusController) search() []PullRequest {
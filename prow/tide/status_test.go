@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	githubql "github.com/shurcooL/githubv4"
 	"github.com/sirupsen/logrus"
@@ -43,6 +44,9 @@ func TestExpectedStatus(t *testing.T) {
 		milestone       string
 		contexts        []Context
 		inPool          bool
+		positions       map[string]queuePosition
+		missing         string
+		freezes         []Freeze
 
 		state string
 		desc  string
@@ -54,6 +58,23 @@ func TestExpectedStatus(t *testing.T) {
 			state: github.StatusSuccess,
 			desc:  statusInPool,
 		},
+		{
+			name:      "in pool with a position",
+			inPool:    true,
+			positions: map[string]queuePosition{"#0": {position: 2, total: 5}},
+
+			state: github.StatusSuccess,
+			desc:  "In merge pool at position 2 of 5.",
+		},
+		{
+			name:      "in frozen pool",
+			inPool:    true,
+			positions: map[string]queuePosition{"#0": {position: 2, total: 5}},
+			freezes:   []Freeze{{Name: "weekend", Until: time.Date(2019, time.December, 9, 9, 0, 0, 0, time.UTC)}},
+
+			state: github.StatusSuccess,
+			desc:  "In merge pool, but merges are frozen until Mon Dec 9 09:00 UTC: weekend.",
+		},
 		{
 			name:      "check truncation of label list",
 			milestone: "v1.0",
@@ -184,6 +205,27 @@ func TestExpectedStatus(t *testing.T) {
 			state: github.StatusPending,
 			desc:  fmt.Sprintf(statusNotInPool, ""),
 		},
+		{
+			name:      "missing approvals from OWNERS",
+			labels:    neededLabels,
+			milestone: "v1.0",
+			contexts:  []Context{{Context: githubql.String("job-name"), State: githubql.StatusStateSuccess}},
+			inPool:    false,
+			missing:   "needs approval from an approver of foo",
+
+			state: github.StatusPending,
+			desc:  fmt.Sprintf(statusNotInPool, " Needs approval from an approver of foo."),
+		},
+		{
+			name:      "unmet query requirements take precedence over approvals from OWNERS",
+			labels:    neededLabels,
+			milestone: "v1.1",
+			inPool:    false,
+			missing:   "needs approval from an approver of foo",
+
+			state: github.StatusPending,
+			desc:  fmt.Sprintf(statusNotInPool, " Must be in milestone v1.0."),
+		},
 		{
 			name:      "check that min diff query is used",
 			labels:    []string{"3", "4", "5", "6", "7"},
@@ -254,7 +296,12 @@ func TestExpectedStatus(t *testing.T) {
 			pool = map[string]PullRequest{"#0": {}}
 		}
 
-		state, desc := expectedStatus(queriesByRepo, &pr, pool, &config.TideContextPolicy{})
+		var missingApprovals map[string]string
+		if tc.missing != "" {
+			missingApprovals = map[string]string{"#0": tc.missing}
+		}
+
+		state, desc := expectedStatus(queriesByRepo, &pr, pool, tc.positions, missingApprovals, tc.freezes, &config.TideContextPolicy{})
 		if state != tc.state {
 			t.Errorf("Expected status state %q, but got %q.", string(tc.state), string(state))
 		}
@@ -371,7 +418,7 @@ func TestSetStatuses(t *testing.T) {
 		}
 
 		sc := &statusController{ghc: fc, config: ca.Config, logger: log}
-		sc.setStatuses([]PullRequest{pr}, pool)
+		sc.setStatuses([]PullRequest{pr}, pool, nil, nil)
 		if str, err := log.String(); err != nil {
 			t.Fatalf("For case %s: failed to get log output: %v", tc.name, err)
 		} else if str != initialLog {
@@ -41,9 +41,11 @@ import (
 	prowv1 "k8s.io/test-infra/prow/client/clientset/versioned/typed/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/errorutil"
+	gerritclient "k8s.io/test-infra/prow/gerrit/client"
 	"k8s.io/test-infra/prow/git"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/pjutil"
+	"k8s.io/test-infra/prow/repoowners"
 	"k8s.io/test-infra/prow/tide/blockers"
 	"k8s.io/test-infra/prow/tide/history"
 )
@@ -55,9 +57,16 @@ type prowJobClient interface {
 
 type githubClient interface {
 	CreateStatus(string, string, string, github.Status) error
+	CreateCommit(org, repo, message, tree string, parents []string) (string, error)
+	CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error)
+	CreateRef(org, repo, ref, sha string) error
 	GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error)
+	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
 	GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error)
 	GetRef(string, string, string) (string, error)
+	GetSingleCommit(org, repo, SHA string) (github.SingleCommit, error)
+	ListPRCommits(org, repo string, number int) ([]github.RepositoryCommit, error)
+	ListReviews(org, repo string, number int) ([]github.Review, error)
 	Merge(string, string, int, github.MergeDetails) error
 	Query(context.Context, interface{}, map[string]interface{}) error
 }
@@ -75,7 +84,9 @@ type Controller struct {
 	config        config.Getter
 	ghc           githubClient
 	prowJobClient prowJobClient
-	gc            *git.Client
+	// gerrit is nil unless Tide is configured to submit Gerrit changes.
+	gerrit gerritClient
+	gc     *git.Client
 
 	sc *statusController
 
@@ -86,6 +97,19 @@ type Controller struct {
 	// Cache entries expire if they are not used during a sync loop.
 	changedFiles *changedFilesAgent
 
+	// owners loads the OWNERS of repos for queries that require approvals
+	// from them.
+	owners repoowners.Interface
+	// reviews caches the reviews of PRs.
+	reviews *reviewsAgent
+
+	// batchExclusions tracks the PRs that are left out of batches after
+	// bisection found that they break them.
+	batchExclusions *batchExclusions
+
+	// batchResults tracks the batches whose results were counted.
+	batchResults *batchResults
+
 	History *history.History
 }
 
@@ -100,7 +124,15 @@ const (
 	TriggerBatch        = "TRIGGER_BATCH"
 	Merge               = "MERGE"
 	MergeBatch          = "MERGE_BATCH"
+	Bisect              = "BISECT"
 	PoolBlocked         = "BLOCKED"
+	PoolFrozen          = "FROZEN"
+	PoolPaused          = "PAUSED"
+	Revert              = "REVERT"
+
+	// ExcludeFromBatch is never taken as an action, but recorded in the history
+	// when bisection identifies a PR that breaks its batch.
+	ExcludeFromBatch = "EXCLUDE_FROM_BATCH"
 )
 
 // recordableActions is the subset of actions that we keep historical record of.
@@ -110,6 +142,7 @@ var recordableActions = map[Action]bool{
 	TriggerBatch: true,
 	Merge:        true,
 	MergeBatch:   true,
+	Bisect:       true,
 }
 
 // Pool represents information about a tide pool. There is one for every
@@ -118,6 +151,9 @@ type Pool struct {
 	Org    string
 	Repo   string
 	Branch string
+	// BaseSHA is the SHA of the branch that the PRs of the pool are tested
+	// against.
+	BaseSHA string
 
 	// PRs with passing tests, pending tests, and missing or failed tests.
 	// Note that these results are rolled up. If all tests for a PR are passing
@@ -126,13 +162,22 @@ type Pool struct {
 	PendingPRs []PullRequest
 	MissingPRs []PullRequest
 
+	// Positions maps PR numbers to their 1-based position in the merge queue
+	// of the pool, which is ordered by priority, then oldest first.
+	Positions map[int]int
+
 	// Empty if there is no pending batch.
 	BatchPending []PullRequest
 
+	// The candidate batches of the speculative merge queue, shortest first.
+	// Empty unless the pool uses a speculative queue.
+	SpeculativeQueue []SpeculativeBatch
+
 	// Which action did we last take, and to what target(s), if any.
 	Action   Action
 	Target   []PullRequest
 	Blockers []blockers.Blocker
+	Freezes  []Freeze
 	Error    string
 }
 
@@ -144,6 +189,14 @@ var (
 		updateTime *prometheus.GaugeVec
 		merges     *prometheus.HistogramVec
 
+		// Per pool, observed for every merged PR
+		timeInPool      *prometheus.HistogramVec
+		approvalToMerge *prometheus.HistogramVec
+		retests         *prometheus.HistogramVec
+
+		// Per pool and result ("success" or "failure")
+		batchResults *prometheus.CounterVec
+
 		// Singleton
 		syncDuration         prometheus.Gauge
 		statusUpdateDuration prometheus.Gauge
@@ -175,6 +228,43 @@ var (
 			"branch",
 		}),
 
+		timeInPool: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "timeinpool",
+			Help:    "Histogram of the seconds that merged PRs spent in the merge pool since they last entered it.",
+			Buckets: durationBuckets,
+		}, []string{
+			"org",
+			"repo",
+			"branch",
+		}),
+		approvalToMerge: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "approvaltomerge",
+			Help:    "Histogram of the seconds from the time merged PRs last started to match a Tide query to their merge.",
+			Buckets: durationBuckets,
+		}, []string{
+			"org",
+			"repo",
+			"branch",
+		}),
+		retests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "retests",
+			Help:    "Histogram of the number of times merged PRs were tested by Tide since they last started to match a Tide query.",
+			Buckets: []float64{0, 1, 2, 3, 4, 5, 7, 10, 15},
+		}, []string{
+			"org",
+			"repo",
+			"branch",
+		}),
+		batchResults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "batchresults",
+			Help: "Number of batches that finished testing, by result.",
+		}, []string{
+			"org",
+			"repo",
+			"branch",
+			"result",
+		}),
+
 		syncDuration: prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "syncdur",
 			Help: "The duration of the last loop of the sync controller.",
@@ -191,12 +281,16 @@ func init() {
 	prometheus.MustRegister(tideMetrics.pooledPRs)
 	prometheus.MustRegister(tideMetrics.updateTime)
 	prometheus.MustRegister(tideMetrics.merges)
+	prometheus.MustRegister(tideMetrics.timeInPool)
+	prometheus.MustRegister(tideMetrics.approvalToMerge)
+	prometheus.MustRegister(tideMetrics.retests)
+	prometheus.MustRegister(tideMetrics.batchResults)
 	prometheus.MustRegister(tideMetrics.syncDuration)
 	prometheus.MustRegister(tideMetrics.statusUpdateDuration)
 }
 
 // NewController makes a Controller out of the given clients.
-func NewController(ghcSync, ghcStatus *github.Client, prowJobClient prowv1.ProwJobInterface, cfg config.Getter, gc *git.Client, maxRecordsPerPool int, opener io.Opener, historyURI, statusURI string, logger *logrus.Entry) (*Controller, error) {
+func NewController(ghcSync, ghcStatus *github.Client, gerritc *gerritclient.Client, prowJobClient prowv1.ProwJobInterface, cfg config.Getter, gc *git.Client, maxRecordsPerPool int, opener io.Opener, historyURI, statusURI string, logger *logrus.Entry) (*Controller, error) {
 	if logger == nil {
 		logger = logrus.NewEntry(logrus.StandardLogger())
 	}
@@ -214,9 +308,15 @@ func NewController(ghcSync, ghcStatus *github.Client, prowJobClient prowv1.ProwJ
 		path:           statusURI,
 	}
 	go sc.run()
+	var gerrit gerritClient
+	// Avoid storing a nil pointer in the interface.
+	if gerritc != nil {
+		gerrit = gerritc
+	}
 	return &Controller{
 		logger:        logger.WithField("controller", "sync"),
 		ghc:           ghcSync,
+		gerrit:        gerrit,
 		prowJobClient: prowJobClient,
 		config:        cfg,
 		gc:            gc,
@@ -225,7 +325,14 @@ func NewController(ghcSync, ghcStatus *github.Client, prowJobClient prowv1.ProwJ
 			ghc:             ghcSync,
 			nextChangeCache: make(map[changeCacheKey][]string),
 		},
-		History: hist,
+		owners: newOwnersClient(gc, ghcSync, cfg),
+		reviews: &reviewsAgent{
+			ghc:             ghcSync,
+			nextReviewCache: make(map[reviewCacheKey][]github.Review),
+		},
+		batchExclusions: &batchExclusions{},
+		batchResults:    &batchResults{},
+		History:         hist,
 	}, nil
 }
 
@@ -278,9 +385,11 @@ func (c *Controller) Sync() error {
 		tideMetrics.syncDuration.Set(duration.Seconds())
 	}()
 	defer c.changedFiles.prune()
+	defer c.reviews.prune()
 
 	c.logger.Debug("Building tide pool.")
 	prs := make(map[string]PullRequest)
+	missingApprovals := make(map[string]string)
 	for _, query := range c.config().Tide.Queries {
 		q := query.Query()
 		results, err := search(c.ghc.Query, c.logger, q, time.Time{}, time.Now())
@@ -290,18 +399,23 @@ func (c *Controller) Sync() error {
 		if err != nil {
 			c.logger.WithError(err).WithField("query", q).Warning("found partial results")
 		}
-		for _, pr := range results {
+		for _, pr := range c.ownersApproved(&query, results, missingApprovals) {
 			prs[prKey(&pr)] = pr
 		}
 	}
+	for key := range prs {
+		delete(missingApprovals, key)
+	}
 	c.logger.WithField(
 		"duration", time.Since(start).String(),
 	).Debugf("Found %d (unfiltered) pool PRs.", len(prs))
 
+	gerritPRs, gerritChanges := c.gerritChanges()
+
 	var pjs []prowapi.ProwJob
 	var blocks blockers.Blockers
 	var err error
-	if len(prs) > 0 {
+	if len(prs) > 0 || len(gerritPRs) > 0 {
 		start := time.Now()
 		pjList, err := c.prowJobClient.List(metav1.ListOptions{LabelSelector: labels.Everything().String()})
 		if err != nil {
@@ -311,7 +425,7 @@ func (c *Controller) Sync() error {
 		c.logger.WithField("duration", time.Since(start).String()).Debug("Listed ProwJobs from the cluster.")
 		pjs = pjList.Items
 
-		if label := c.config().Tide.BlockerLabel; label != "" {
+		if label := c.config().Tide.BlockerLabel; label != "" && len(prs) > 0 {
 			c.logger.Debugf("Searching for blocking issues (label %q).", label)
 			orgExcepts, repos := c.config().Tide.Queries.OrgExceptionsAndRepos()
 			orgs := make([]string, 0, len(orgExcepts))
@@ -331,29 +445,56 @@ func (c *Controller) Sync() error {
 		return err
 	}
 	filteredPools := c.filterSubpools(c.config().Tide.MaxGoroutines, rawPools)
+	for _, sp := range filteredPools {
+		sortByPriority(sp.prs, c.config().Tide.PriorityFor(sp.org, sp.repo))
+	}
 
 	// Notify statusController about the new pool.
 	c.sc.Lock()
 	c.sc.poolPRs = poolPRMap(filteredPools)
+	c.sc.poolPositions = poolPositions(filteredPools)
+	c.sc.missingApprovals = missingApprovals
 	select {
 	case c.sc.newPoolPending <- true:
 	default:
 	}
 	c.sc.Unlock()
 
+	gerritPools, err := c.divideGerritPool(gerritPRs, gerritChanges, pjs)
+	if err != nil {
+		return err
+	}
+	c.recordTimelines(
+		[]map[string]PullRequest{prs, gerritPRs},
+		[]map[string]*subpool{filteredPools, gerritPools},
+	)
+
 	// Sync subpools in parallel.
-	poolChan := make(chan Pool, len(filteredPools))
+	poolChan := make(chan Pool, len(filteredPools)+len(gerritPools))
 	subpoolsInParallel(
 		c.config().Tide.MaxGoroutines,
 		filteredPools,
 		func(sp *subpool) {
-			pool, err := c.syncSubpool(*sp, blocks.GetApplicable(sp.org, sp.repo, sp.branch))
+			freezes := activeFreezes(c.config().Tide.MergeFreezes, sp.org, sp.repo, sp.branch, time.Now())
+			pool, err := c.syncSubpool(*sp, blocks.GetApplicable(sp.org, sp.repo, sp.branch), freezes)
 			if err != nil {
 				sp.log.WithError(err).Errorf("Error syncing subpool.")
 			}
 			poolChan <- pool
 		},
 	)
+	subpoolsInParallel(
+		c.config().Tide.MaxGoroutines,
+		gerritPools,
+		func(sp *subpool) {
+			freezes := activeFreezes(c.config().Tide.MergeFreezes, sp.org, sp.repo, sp.branch, time.Now())
+			pool, err := c.syncGerritSubpool(*sp, gerritChanges, freezes)
+			if err != nil {
+				sp.log.WithError(err).Errorf("Error syncing Gerrit subpool.")
+			}
+			poolChan <- pool
+		},
+	)
 
 	close(poolChan)
 	pools := make([]Pool, 0, len(poolChan))
@@ -580,34 +721,16 @@ func unsuccessfulContexts(contexts []Context, cc contextChecker, log *logrus.Ent
 	return failed
 }
 
-func pickSmallestPassingNumber(log *logrus.Entry, ghc githubClient, prs []PullRequest, cc contextChecker) (bool, PullRequest) {
-	smallestNumber := -1
-	var smallestPR PullRequest
-	for _, pr := range prs {
-		if smallestNumber != -1 && int(pr.Number) >= smallestNumber {
-			continue
-		}
-		if len(pr.Commits.Nodes) < 1 {
-			continue
-		}
-		if !isPassingTests(log, ghc, pr, cc) {
-			continue
-		}
-		smallestNumber = int(pr.Number)
-		smallestPR = pr
-	}
-	return smallestNumber > -1, smallestPR
+// batchState is the accumulated state of the jobs testing one batch of PRs.
+type batchState struct {
+	prs   []PullRequest
+	state simpleState
 }
 
-// accumulateBatch returns a list of PRs that can be merged after passing batch
-// testing, if any exist. It also returns a list of PRs currently being batch
-// tested.
-func accumulateBatch(presubmits map[int][]config.Presubmit, prs []PullRequest, pjs []prowapi.ProwJob, log *logrus.Entry) ([]PullRequest, []PullRequest) {
-	log.Debug("accumulating PRs for batch testing")
-	if len(presubmits) == 0 {
-		log.Debug("no presubmits configured, no batch can be triggered")
-		return nil, nil
-	}
+// accumulateBatches returns the state of every batch that is still tested
+// against the heads of its PRs. The PRs of a batch are in the order of the
+// pulls in its refs.
+func accumulateBatches(presubmits map[int][]config.Presubmit, prs []PullRequest, pjs []prowapi.ProwJob, log *logrus.Entry) []batchState {
 	prNums := make(map[int]PullRequest)
 	for _, pr := range prs {
 		prNums[int(pr.Number)] = pr
@@ -659,7 +782,7 @@ func accumulateBatch(presubmits map[int][]config.Presubmit, prs []PullRequest, p
 			states[ref].jobStates[context] = jobState
 		}
 	}
-	var pendingBatch, successBatch []PullRequest
+	var batches []batchState
 	for ref, state := range states {
 		if !state.validPulls {
 			continue
@@ -680,13 +803,29 @@ func accumulateBatch(presubmits map[int][]config.Presubmit, prs []PullRequest, p
 				overallState = pendingState
 			}
 		}
-		switch overallState {
+		batches = append(batches, batchState{prs: state.prs, state: overallState})
+	}
+	return batches
+}
+
+// accumulateBatch returns a list of PRs that can be merged after passing batch
+// testing, if any exist. It also returns a list of PRs currently being batch
+// tested.
+func accumulateBatch(presubmits map[int][]config.Presubmit, prs []PullRequest, pjs []prowapi.ProwJob, log *logrus.Entry) ([]PullRequest, []PullRequest) {
+	log.Debug("accumulating PRs for batch testing")
+	if len(presubmits) == 0 {
+		log.Debug("no presubmits configured, no batch can be triggered")
+		return nil, nil
+	}
+	var pendingBatch, successBatch []PullRequest
+	for _, batch := range accumulateBatches(presubmits, prs, pjs, log) {
+		switch batch.state {
 		// Currently we only consider 1 pending batch and 1 success batch at a time.
 		// If more are somehow present they will be ignored.
 		case pendingState:
-			pendingBatch = state.prs
+			pendingBatch = batch.prs
 		case successState:
-			successBatch = state.prs
+			successBatch = batch.prs
 		}
 	}
 	return successBatch, pendingBatch
@@ -696,28 +835,7 @@ func accumulateBatch(presubmits map[int][]config.Presubmit, prs []PullRequest, p
 // accumulated state across the presubmits.
 func accumulate(presubmits map[int][]config.Presubmit, prs []PullRequest, pjs []prowapi.ProwJob, log *logrus.Entry) (successes, pendings, nones []PullRequest) {
 	for _, pr := range prs {
-		// Accumulate the best result for each job.
-		psStates := make(map[string]simpleState)
-		for _, pj := range pjs {
-			if pj.Spec.Type != prowapi.PresubmitJob {
-				continue
-			}
-			if pj.Spec.Refs.Pulls[0].Number != int(pr.Number) {
-				continue
-			}
-			if pj.Spec.Refs.Pulls[0].SHA != string(pr.HeadRefOID) {
-				continue
-			}
-
-			name := pj.Spec.Context
-			oldState := psStates[name]
-			newState := toSimpleState(pj.Status.State)
-			if oldState == failureState || oldState == "" {
-				psStates[name] = newState
-			} else if oldState == pendingState && newState == successState {
-				psStates[name] = successState
-			}
-		}
+		psStates := presubmitStates(pr, pjs)
 		// The overall result is the worst of the best.
 		overallState := successState
 		for _, ps := range presubmits[int(pr.Number)] {
@@ -745,6 +863,33 @@ func accumulate(presubmits map[int][]config.Presubmit, prs []PullRequest, pjs []
 	return
 }
 
+// presubmitStates returns the best result of each presubmit context that ran
+// against the current head of the PR.
+func presubmitStates(pr PullRequest, pjs []prowapi.ProwJob) map[string]simpleState {
+	psStates := make(map[string]simpleState)
+	for _, pj := range pjs {
+		if pj.Spec.Type != prowapi.PresubmitJob {
+			continue
+		}
+		if pj.Spec.Refs.Pulls[0].Number != int(pr.Number) {
+			continue
+		}
+		if pj.Spec.Refs.Pulls[0].SHA != string(pr.HeadRefOID) {
+			continue
+		}
+
+		name := pj.Spec.Context
+		oldState := psStates[name]
+		newState := toSimpleState(pj.Status.State)
+		if oldState == failureState || oldState == "" {
+			psStates[name] = newState
+		} else if oldState == pendingState && newState == successState {
+			psStates[name] = successState
+		}
+	}
+	return psStates
+}
+
 func prNumbers(prs []PullRequest) []int {
 	var nums []int
 	for _, pr := range prs {
@@ -753,12 +898,22 @@ func prNumbers(prs []PullRequest) []int {
 	return nums
 }
 
-func (c *Controller) pickBatch(sp subpool, cc contextChecker) ([]PullRequest, error) {
-	// we must choose the oldest PRs for the batch
-	sort.Slice(sp.prs, func(i, j int) bool { return sp.prs[i].Number < sp.prs[j].Number })
+// pickBatch returns up to maxSize of the PRs with the highest priority, oldest
+// first, that pass their tests and merge cleanly on top of each other, in the
+// order they were merged. A
+// maxSize of 0 means there is no limit. PRs that are excluded from batches
+// are not picked.
+func (c *Controller) pickBatch(sp subpool, cc contextChecker, maxSize int) ([]PullRequest, error) {
+	// we must choose the PRs with the highest priority, oldest first, for the batch
+	sortByPriority(sp.prs, c.config().Tide.PriorityFor(sp.org, sp.repo))
 
 	var candidates []PullRequest
+	now := time.Now()
 	for _, pr := range sp.prs {
+		if c.batchExclusions.excluded(&pr, now) {
+			sp.log.WithFields(pr.logFields()).Debug("PR is excluded from batches")
+			continue
+		}
 		if isPassingTests(sp.log, c.ghc, pr, cc) {
 			candidates = append(candidates, pr)
 		}
@@ -796,8 +951,7 @@ func (c *Controller) pickBatch(sp subpool, cc contextChecker) ([]PullRequest, er
 			return nil, err
 		} else if ok {
 			res = append(res, pr)
-			// TODO: Make this configurable per subpool.
-			if len(res) == 5 {
+			if len(res) == maxSize {
 				break
 			}
 		}
@@ -816,23 +970,27 @@ func (c *Controller) mergePRs(sp subpool, prs []PullRequest) error {
 
 	var errs []error
 	log := sp.log.WithField("merge-targets", prNumbers(prs))
+	// Determine the merge commits of all PRs before merging any, so that a
+	// batch is not merged partially if one of them cannot be determined.
+	allDetails := make([]github.MergeDetails, len(prs))
 	for i, pr := range prs {
-		log := log.WithFields(pr.logFields())
-		mergeMethod := c.config().Tide.MergeMethod(sp.org, sp.repo)
-		if squashLabel := c.config().Tide.SquashLabel; squashLabel != "" {
-			for _, prlabel := range pr.Labels.Nodes {
-				if string(prlabel.Name) == squashLabel {
-					mergeMethod = github.MergeSquash
-					break
-				}
-			}
+		details, err := c.mergeDetails(sp, pr)
+		if err != nil {
+			log.WithFields(pr.logFields()).WithError(err).Error("Failed to determine the merge commit.")
+			errs = append(errs, err)
+			failed = append(failed, int(pr.Number))
 		}
+		allDetails[i] = details
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to determine the merge commits of %v, merged none of %v: %v", failed, prNumbers(prs), errorutil.NewAggregate(errs...))
+	}
 
+	for i, pr := range prs {
+		log := log.WithFields(pr.logFields())
+		details := allDetails[i]
 		keepTrying, err := tryMerge(func() error {
-			return c.ghc.Merge(sp.org, sp.repo, int(pr.Number), github.MergeDetails{
-				SHA:         string(pr.HeadRefOID),
-				MergeMethod: string(mergeMethod),
-			})
+			return c.ghc.Merge(sp.org, sp.repo, int(pr.Number), details)
 		})
 		if err != nil {
 			log.WithError(err).Error("Merge failed.")
@@ -841,6 +999,7 @@ func (c *Controller) mergePRs(sp subpool, prs []PullRequest) error {
 		} else {
 			log.Info("Merged.")
 			merged = append(merged, int(pr.Number))
+			c.recordMerged(sp, pr)
 		}
 		if !keepTrying {
 			break
@@ -929,7 +1088,15 @@ func tryMerge(mergeFunc func() error) (bool, error) {
 	return true, err
 }
 
+// trigger creates the ProwJobs that test the PRs, presubmits for a single PR
+// or batch jobs for several.
 func (c *Controller) trigger(sp subpool, presubmits map[int][]config.Presubmit, prs []PullRequest) error {
+	return c.triggerJobs(sp, presubmits, prs, len(prs) > 1)
+}
+
+// triggerJobs creates the ProwJobs that test the PRs, as batch jobs if batch
+// is set, even for a single PR.
+func (c *Controller) triggerJobs(sp subpool, presubmits map[int][]config.Presubmit, prs []PullRequest, batch bool) error {
 	refs := prowapi.Refs{
 		Org:     sp.org,
 		Repo:    sp.repo,
@@ -958,10 +1125,10 @@ func (c *Controller) trigger(sp subpool, presubmits map[int][]config.Presubmit,
 			}
 			triggeredContexts.Insert(string(ps.Context))
 			var spec prowapi.ProwJobSpec
-			if len(prs) == 1 {
-				spec = pjutil.PresubmitSpec(ps, refs)
-			} else {
+			if batch {
 				spec = pjutil.BatchSpec(ps, refs)
+			} else {
+				spec = pjutil.PresubmitSpec(ps, refs)
 			}
 			pj := pjutil.NewProwJob(spec, ps.Labels)
 			start := time.Now()
@@ -983,7 +1150,7 @@ func (c *Controller) takeAction(sp subpool, batchPending, successes, pendings, n
 	// Do not merge PRs while waiting for a batch to complete. We don't want to
 	// invalidate the old batch result.
 	if len(successes) > 0 && len(batchPending) == 0 {
-		if ok, pr := pickSmallestPassingNumber(sp.log, c.ghc, successes, sp.cc); ok {
+		if ok, pr := pickHighestPriorityPR(sp.log, c.ghc, successes, sp.cc, c.config().Tide.PriorityFor(sp.org, sp.repo)); ok {
 			return Merge, []PullRequest{pr}, c.mergePRs(sp, []PullRequest{pr})
 		}
 	}
@@ -991,9 +1158,22 @@ func (c *Controller) takeAction(sp subpool, batchPending, successes, pendings, n
 	if len(sp.presubmits) == 0 {
 		return Wait, nil, nil
 	}
+	batchSizeLimit := c.config().Tide.BatchSizeLimit(sp.org, sp.repo)
+	// Bisect failed batches to find the PRs that break them before testing
+	// new batches.
+	if batchSizeLimit >= 0 && len(batchPending) == 0 {
+		if failed, halves := bisectBatches(accumulateBatches(sp.presubmits, sp.prs, sp.pjs, sp.log)); len(halves) > 0 {
+			for _, half := range halves {
+				if err := c.triggerJobs(sp, sp.presubmits, half, true); err != nil {
+					return Bisect, failed, err
+				}
+			}
+			return Bisect, failed, nil
+		}
+	}
 	// If we have no batch, trigger one.
-	if len(sp.prs) > 1 && len(batchPending) == 0 {
-		batch, err := c.pickBatch(sp, sp.cc)
+	if batchSizeLimit >= 0 && len(sp.prs) > 1 && len(batchPending) == 0 {
+		batch, err := c.pickBatch(sp, sp.cc, batchSizeLimit)
 		if err != nil {
 			return Wait, nil, err
 		}
@@ -1003,7 +1183,7 @@ func (c *Controller) takeAction(sp subpool, batchPending, successes, pendings, n
 	}
 	// If we have no serial jobs pending or successful, trigger one.
 	if len(nones) > 0 && len(pendings) == 0 && len(successes) == 0 {
-		if ok, pr := pickSmallestPassingNumber(sp.log, c.ghc, nones, sp.cc); ok {
+		if ok, pr := pickHighestPriorityPR(sp.log, c.ghc, nones, sp.cc, c.config().Tide.PriorityFor(sp.org, sp.repo)); ok {
 			return Trigger, []PullRequest{pr}, c.trigger(sp, sp.presubmits, []PullRequest{pr})
 		}
 	}
@@ -1092,7 +1272,35 @@ func (c *Controller) presubmitsByPull(sp *subpool) (map[int][]config.Presubmit,
 		}
 	}
 
-	for _, ps := range c.config().Presubmits[sp.org+"/"+sp.repo] {
+	cfg := c.config()
+	orgRepo := sp.org + "/" + sp.repo
+	if cfg.InRepoConfigEnabled(orgRepo) {
+		// Every PR may carry its own .prow.yaml, so the required presubmits
+		// have to be determined separately for each of them. PRs in the pool
+		// have passed the tide query and are therefore trusted.
+		baseSHAGetter := func() (string, error) { return sp.sha, nil }
+		for _, pr := range sp.prs {
+			headSHA := string(pr.HeadRefOID)
+			headSHAGetter := func() (string, error) { return headSHA, nil }
+			prPresubmits, err := cfg.GetPresubmits(c.gc, orgRepo, baseSHAGetter, headSHAGetter)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get presubmits for PR %d: %v", pr.Number, err)
+			}
+			for _, ps := range prPresubmits {
+				if !ps.ContextRequired() {
+					continue
+				}
+				if shouldRun, err := ps.ShouldRun(sp.branch, c.changedFiles.prChanges(&pr), false, false); err != nil {
+					return nil, err
+				} else if shouldRun {
+					record(int(pr.Number), ps)
+				}
+			}
+		}
+		return presubmits, nil
+	}
+
+	for _, ps := range cfg.Presubmits[orgRepo] {
 		if !ps.ContextRequired() {
 			continue
 		}
@@ -1108,8 +1316,12 @@ func (c *Controller) presubmitsByPull(sp *subpool) (map[int][]config.Presubmit,
 	return presubmits, nil
 }
 
-func (c *Controller) syncSubpool(sp subpool, blocks []blockers.Blocker) (Pool, error) {
+func (c *Controller) syncSubpool(sp subpool, blocks []blockers.Blocker, freezes []Freeze) (Pool, error) {
 	sp.log.Infof("Syncing subpool: %d PRs, %d PJs.", len(sp.prs), len(sp.pjs))
+	positions := make(map[int]int, len(sp.prs))
+	for i, pr := range sp.prs {
+		positions[int(pr.Number)] = i + 1
+	}
 	successes, pendings, nones := accumulate(sp.presubmits, sp.prs, sp.pjs, sp.log)
 	batchMerge, batchPending := accumulateBatch(sp.presubmits, sp.prs, sp.pjs, sp.log)
 	sp.log.WithFields(logrus.Fields{
@@ -1120,27 +1332,84 @@ func (c *Controller) syncSubpool(sp subpool, blocks []blockers.Blocker) (Pool, e
 		"batch-pending": prNumbers(batchPending),
 	}).Info("Subpool accumulated.")
 
+	key := poolKey(sp.org, sp.repo, sp.branch)
+	verification := c.config().Tide.PostMergeVerificationFor(sp.org, sp.repo)
+	var broken *history.Record
+	if verification != nil {
+		broken = brokenMerge(verification, c.History.PoolRecords(key), sp.postsubmits)
+	}
+
 	var act Action
 	var targets []PullRequest
+	var queue []SpeculativeBatch
 	var err error
 	var errorString string
 	if len(blocks) > 0 {
 		act = PoolBlocked
+	} else if len(freezes) > 0 {
+		act = PoolFrozen
+	} else if broken != nil {
+		sp.log.WithField("merge-sha", broken.MergeSHA).Info("Pausing merges, the postsubmits of the last merge failed.")
+		act = PoolPaused
+		targets = mergedPRs(sp, broken)
+		if verification.Revert {
+			if pr := c.revertPR(sp, successes, broken); pr != nil {
+				// Merging the revert PR fixes the branch, so the pause does not
+				// apply to it.
+				sp.log.WithFields(pr.logFields()).Info("Merging the PR that reverts the last merge.")
+				act, targets = Merge, []PullRequest{*pr}
+				err = c.mergePRs(sp, targets)
+			} else if !reverted(c.History.PoolRecords(key), broken) {
+				act = Revert
+				if number, revertErr := c.revert(sp, broken); revertErr != nil {
+					sp.log.WithError(revertErr).Warning("Failed to open a PR to revert the last merge, retrying on the next sync.")
+					errorString = revertErr.Error()
+				} else {
+					sp.log.WithField("revert-pr", number).Info("Opened a PR to revert the last merge.")
+					c.History.Record(key, Revert, broken.MergeSHA, "", broken.Target)
+				}
+			}
+		}
 	} else {
-		act, targets, err = c.takeAction(sp, batchPending, successes, pendings, nones, batchMerge)
-		if err != nil {
-			errorString = err.Error()
+		batches := accumulateBatches(sp.presubmits, sp.prs, sp.pjs, sp.log)
+		c.batchResults.count(sp, batches, time.Now())
+		for _, pr := range batchCulprits(batches) {
+			if c.batchExclusions.exclude(&pr, time.Now()) {
+				sp.log.WithFields(pr.logFields()).Info("Excluding PR from batches, it failed its batch on its own.")
+				c.History.Record(
+					key,
+					ExcludeFromBatch,
+					sp.sha,
+					"",
+					prMeta(pr),
+				)
+			}
 		}
-		if recordableActions[act] {
-			c.History.Record(
-				poolKey(sp.org, sp.repo, sp.branch),
-				string(act),
-				sp.sha,
-				errorString,
-				prMeta(targets...),
-			)
+		if depth := c.config().Tide.SpeculativeQueueDepth(sp.org, sp.repo); depth > 0 {
+			act, targets, queue, err = c.takeSpeculativeAction(sp, depth, batches, successes, pendings)
+		} else {
+			act, targets, err = c.takeAction(sp, batchPending, successes, pendings, nones, batchMerge)
 		}
 	}
+	if err != nil {
+		errorString = err.Error()
+	}
+	var mergeSHA string
+	if verification != nil && (act == Merge || act == MergeBatch) {
+		mergeSHA = c.mergedSHA(sp)
+	}
+	c.recordAction(sp, act, targets)
+	if recordableActions[act] {
+		c.History.RecordMerge(
+			key,
+			string(act),
+			sp.sha,
+			mergeSHA,
+			errorString,
+			prMeta(targets...),
+			queueHistory(queue),
+		)
+	}
 
 	sp.log.WithFields(logrus.Fields{
 		"action":  string(act),
@@ -1149,24 +1418,42 @@ func (c *Controller) syncSubpool(sp subpool, blocks []blockers.Blocker) (Pool, e
 	tideMetrics.pooledPRs.WithLabelValues(sp.org, sp.repo, sp.branch).Set(float64(len(sp.prs)))
 	tideMetrics.updateTime.WithLabelValues(sp.org, sp.repo, sp.branch).Set(float64(time.Now().Unix()))
 	return Pool{
-			Org:    sp.org,
-			Repo:   sp.repo,
-			Branch: sp.branch,
+			Org:     sp.org,
+			Repo:    sp.repo,
+			Branch:  sp.branch,
+			BaseSHA: sp.sha,
 
 			SuccessPRs: successes,
 			PendingPRs: pendings,
 			MissingPRs: nones,
+			Positions:  positions,
 
-			BatchPending: batchPending,
+			BatchPending:     batchPending,
+			SpeculativeQueue: queue,
 
 			Action:   act,
 			Target:   targets,
 			Blockers: blocks,
+			Freezes:  freezes,
 			Error:    errorString,
 		},
 		err
 }
 
+// mergedSHA returns the SHA of the branch of a subpool after a merge, or ""
+// if the branch did not move.
+func (c *Controller) mergedSHA(sp subpool) string {
+	sha, err := c.ghc.GetRef(sp.org, sp.repo, "heads/"+sp.branch)
+	if err != nil {
+		sp.log.WithError(err).Warning("Failed to get the SHA of the branch after merging, the merge will not be verified.")
+		return ""
+	}
+	if sha == sp.sha {
+		return ""
+	}
+	return sha
+}
+
 func prMeta(prs ...PullRequest) []prowapi.Pull {
 	var res []prowapi.Pull
 	for _, pr := range prs {
@@ -1211,6 +1498,9 @@ type subpool struct {
 
 	pjs []prowapi.ProwJob
 	prs []PullRequest
+	// postsubmits are the postsubmits of the branch for any SHA, which verify
+	// the merges into the pool.
+	postsubmits []prowapi.ProwJob
 
 	cc         contextChecker
 	presubmits map[int][]config.Presubmit
@@ -1251,6 +1541,13 @@ func (c *Controller) dividePool(pool map[string]PullRequest, pjs []prowapi.ProwJ
 		sps[fn].prs = append(sps[fn].prs, pr)
 	}
 	for _, pj := range pjs {
+		if pj.Spec.Type == prowapi.PostsubmitJob {
+			fn := poolKey(pj.Spec.Refs.Org, pj.Spec.Refs.Repo, pj.Spec.Refs.BaseRef)
+			if sps[fn] != nil {
+				sps[fn].postsubmits = append(sps[fn].postsubmits, pj)
+			}
+			continue
+		}
 		if pj.Spec.Type != prowapi.PresubmitJob && pj.Spec.Type != prowapi.BatchJob {
 			continue
 		}
@@ -1301,6 +1598,11 @@ type PullRequest struct {
 	Milestone *struct {
 		Title githubql.String
 	}
+	// Reviews only counts the reviews, which are listed with the REST API
+	// when needed.
+	Reviews struct {
+		TotalCount githubql.Int
+	}
 	Title     githubql.String
 	UpdatedAt githubql.DateTime
 }
@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	githubql "github.com/shurcooL/githubv4"
@@ -479,6 +480,21 @@ type fgc struct {
 
 	expectedSHA    string
 	combinedStatus map[string]string
+
+	// trees maps SHAs to the SHAs of their trees.
+	trees          map[string]string
+	createdCommits []string
+	createdRefs    map[string]string
+	createdPRs     []string
+	createPRErr    error
+
+	// reviews maps PR numbers to their reviews.
+	reviews map[int][]github.Review
+	// bodies and commits map PR numbers to their bodies and commits.
+	bodies  map[int]string
+	commits map[int][]github.RepositoryCommit
+	// mergeDetails records the details of every merge by PR number.
+	mergeDetails map[int]github.MergeDetails
 }
 
 func (f *fgc) GetRef(o, r, ref string) (string, error) {
@@ -506,9 +522,21 @@ func (f *fgc) Merge(org, repo string, number int, details github.MergeDetails) e
 		return err
 	}
 	f.merged++
+	if f.mergeDetails == nil {
+		f.mergeDetails = make(map[int]github.MergeDetails)
+	}
+	f.mergeDetails[number] = details
 	return nil
 }
 
+func (f *fgc) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	return &github.PullRequest{Number: number, Body: f.bodies[number]}, nil
+}
+
+func (f *fgc) ListPRCommits(org, repo string, number int) ([]github.RepositoryCommit, error) {
+	return f.commits[number], nil
+}
+
 func (f *fgc) CreateStatus(org, repo, ref string, s github.Status) error {
 	switch s.State {
 	case github.StatusSuccess, github.StatusError, github.StatusPending, github.StatusFailure:
@@ -532,6 +560,45 @@ func (f *fgc) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus,
 		nil
 }
 
+func (f *fgc) GetSingleCommit(org, repo, SHA string) (github.SingleCommit, error) {
+	var commit github.SingleCommit
+	tree, ok := f.trees[SHA]
+	if !ok {
+		return commit, fmt.Errorf("commit %s not found", SHA)
+	}
+	commit.Commit.Tree.SHA = tree
+	return commit, nil
+}
+
+func (f *fgc) CreateCommit(org, repo, message, tree string, parents []string) (string, error) {
+	sha := fmt.Sprintf("%s-%s", tree, strings.Join(parents, "-"))
+	f.createdCommits = append(f.createdCommits, sha)
+	return sha, nil
+}
+
+func (f *fgc) CreateRef(org, repo, ref, sha string) error {
+	if f.createdRefs == nil {
+		f.createdRefs = make(map[string]string)
+	}
+	f.createdRefs[ref] = sha
+	if f.refs != nil {
+		f.refs[org+"/"+repo+" "+strings.TrimPrefix(ref, "refs/")] = sha
+	}
+	return nil
+}
+
+func (f *fgc) CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error) {
+	if f.createPRErr != nil {
+		return 0, f.createPRErr
+	}
+	f.createdPRs = append(f.createdPRs, head+":"+base)
+	return len(f.createdPRs), nil
+}
+
+func (f *fgc) ListReviews(org, repo string, number int) ([]github.Review, error) {
+	return f.reviews[number], nil
+}
+
 func (f *fgc) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
 	if number != 100 {
 		return nil, nil
@@ -799,7 +866,7 @@ func TestPickBatch(t *testing.T) {
 		gc:     gc,
 		config: ca.Config,
 	}
-	prs, err := c.pickBatch(sp, &config.TideContextPolicy{})
+	prs, err := c.pickBatch(sp, &config.TideContextPolicy{}, config.DefaultBatchSizeLimit)
 	if err != nil {
 		t.Fatalf("Error from pickBatch: %v", err)
 	}
@@ -831,6 +898,7 @@ func TestTakeAction(t *testing.T) {
 		batchMerges  []int
 		presubmits   map[int][]config.Presubmit
 		mergeErrs    map[int]error
+		batchLimits  map[string]int
 
 		merged           int
 		triggered        int
@@ -929,6 +997,25 @@ func TestTakeAction(t *testing.T) {
 			triggeredBatches: 1,
 			action:           TriggerBatch,
 		},
+		{
+			name: "batching disabled, should trigger serial",
+
+			batchPending: false,
+			successes:    []int{},
+			pendings:     []int{},
+			nones:        []int{0, 1, 2, 3},
+			batchMerges:  []int{},
+			presubmits: map[int][]config.Presubmit{
+				100: {
+					{Reporter: config.Reporter{Context: "foo"}},
+					{Reporter: config.Reporter{Context: "if-changed"}},
+				},
+			},
+			batchLimits: map[string]int{"o/r": -1},
+			merged:      0,
+			triggered:   1,
+			action:      Trigger,
+		},
 		{
 			name: "one PR, should not trigger batch",
 
@@ -1141,6 +1228,7 @@ func TestTakeAction(t *testing.T) {
 		); err != nil {
 			t.Fatalf("failed to set presubmits: %v", err)
 		}
+		cfg.Tide.BatchSizeLimitMap = tc.batchLimits
 		ca.Set(cfg)
 		if len(tc.presubmits) > 0 {
 			for i := 0; i <= 8; i++ {
@@ -1195,12 +1283,17 @@ func TestTakeAction(t *testing.T) {
 		}
 		fgc := fgc{mergeErrs: tc.mergeErrs}
 		fakeProwJobClient := fake.NewSimpleClientset()
+		hist, err := history.New(100, nil, "")
+		if err != nil {
+			t.Fatalf("Failed to create history client: %v", err)
+		}
 		c := &Controller{
 			logger:        logrus.WithField("controller", "tide"),
 			gc:            gc,
 			config:        ca.Config,
 			ghc:           &fgc,
 			prowJobClient: fakeProwJobClient.ProwV1().ProwJobs("prowjobs"),
+			History:       hist,
 		}
 		var batchPending []PullRequest
 		if tc.batchPending {
@@ -1406,6 +1499,7 @@ func TestSync(t *testing.T) {
 				Repo:       "repo",
 				Branch:     "A",
 				SuccessPRs: []PullRequest{mergeableA},
+				Positions:  map[int]int{5: 1},
 				Action:     Merge,
 				Target:     []PullRequest{mergeableA},
 			}},
@@ -1423,6 +1517,7 @@ func TestSync(t *testing.T) {
 				Repo:       "repo",
 				Branch:     "A",
 				SuccessPRs: []PullRequest{unknownA},
+				Positions:  map[int]int{8: 1},
 				Action:     Merge,
 				Target:     []PullRequest{unknownA},
 			}},
@@ -1435,6 +1530,7 @@ func TestSync(t *testing.T) {
 				Repo:       "repo",
 				Branch:     "A",
 				SuccessPRs: []PullRequest{mergeableA},
+				Positions:  map[int]int{5: 1},
 				Action:     Merge,
 				Target:     []PullRequest{mergeableA},
 			}},
@@ -1447,6 +1543,7 @@ func TestSync(t *testing.T) {
 				Repo:       "repo",
 				Branch:     "A",
 				SuccessPRs: []PullRequest{mergeableA},
+				Positions:  map[int]int{5: 1},
 				Action:     Merge,
 				Target:     []PullRequest{mergeableA},
 			}},
@@ -1459,6 +1556,7 @@ func TestSync(t *testing.T) {
 				Repo:       "repo",
 				Branch:     "A",
 				SuccessPRs: []PullRequest{mergeableA},
+				Positions:  map[int]int{5: 1},
 				Action:     Merge,
 				Target:     []PullRequest{mergeableA},
 			}},
@@ -1501,6 +1599,10 @@ func TestSync(t *testing.T) {
 				ghc:             fgc,
 				nextChangeCache: make(map[changeCacheKey][]string),
 			},
+			reviews: &reviewsAgent{
+				ghc:             fgc,
+				nextReviewCache: make(map[reviewCacheKey][]github.Review),
+			},
 			History: hist,
 		}
 
@@ -2178,6 +2280,37 @@ func TestPresubmitsByPull(t *testing.T) {
 			}}},
 			expectedChangeCache: map[changeCacheKey][]string{{number: 100, sha: "sha"}: {"FILE"}},
 		},
+		{
+			name: "skip_if_only_changed and exclude_changes (cached)",
+			presubmits: []config.Presubmit{
+				{
+					Reporter: config.Reporter{Context: "skipped"},
+					RegexpChangeMatcher: config.RegexpChangeMatcher{
+						SkipIfOnlyChanged: "^FIL.$",
+					},
+				},
+				{
+					Reporter: config.Reporter{Context: "excluded"},
+					RegexpChangeMatcher: config.RegexpChangeMatcher{
+						ExcludeChanges: []string{"FILE"},
+					},
+				},
+				{
+					Reporter: config.Reporter{Context: "presubmit"},
+					RegexpChangeMatcher: config.RegexpChangeMatcher{
+						SkipIfOnlyChanged: "^CHANGE.$",
+					},
+				},
+			},
+			initialChangeCache: map[changeCacheKey][]string{{number: 100, sha: "sha"}: {"FILE"}},
+			expectedPresubmits: map[int][]config.Presubmit{100: {{
+				Reporter: config.Reporter{Context: "presubmit"},
+				RegexpChangeMatcher: config.RegexpChangeMatcher{
+					SkipIfOnlyChanged: "^CHANGE.$",
+				},
+			}}},
+			expectedChangeCache: map[changeCacheKey][]string{{number: 100, sha: "sha"}: {"FILE"}},
+		},
 	}
 
 	for _, tc := range testcases {
@@ -0,0 +1,209 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"fmt"
+	"strings"
+
+	githubql "github.com/shurcooL/githubv4"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/tide/history"
+)
+
+// revertBranchPrefix is the prefix of the branches that hold the commits of
+// revert PRs.
+const revertBranchPrefix = "tide-revert-"
+
+// lastVerifiedMerge returns the newest merge into a pool that recorded the
+// SHA of the branch after the merge, or nil if there is none.
+func lastVerifiedMerge(records []*history.Record) *history.Record {
+	for _, rec := range records {
+		if (rec.Action == Merge || rec.Action == MergeBatch) && rec.MergeSHA != "" {
+			return rec
+		}
+	}
+	return nil
+}
+
+// postsubmitStates returns the best state of every watched postsubmit that
+// ran for a SHA, keyed by job name. A job that ran several times counts as
+// passing if any run passed and as pending if any run is still pending.
+// Aborted jobs are ignored.
+func postsubmitStates(v *config.TidePostMergeVerification, pjs []prowapi.ProwJob, sha string) map[string]simpleState {
+	states := make(map[string]simpleState)
+	for _, pj := range pjs {
+		if pj.Spec.Refs.BaseSHA != sha || !v.Watches(pj.Spec.Job) || pj.Status.State == prowapi.AbortedState {
+			continue
+		}
+		state := toSimpleState(pj.Status.State)
+		switch states[pj.Spec.Job] {
+		case successState:
+		case pendingState:
+			if state == successState {
+				states[pj.Spec.Job] = state
+			}
+		default:
+			states[pj.Spec.Job] = state
+		}
+	}
+	return states
+}
+
+// brokenMerge returns the last merge into a pool if any of the watched
+// postsubmits of the merged SHA failed and the branch has not been fixed
+// since. The branch counts as fixed once a later commit passed all of the
+// failed postsubmits. It returns nil while the merge is fine or still being
+// verified.
+func brokenMerge(v *config.TidePostMergeVerification, records []*history.Record, pjs []prowapi.ProwJob) *history.Record {
+	merge := lastVerifiedMerge(records)
+	if merge == nil {
+		return nil
+	}
+	failed := sets.NewString()
+	for job, state := range postsubmitStates(v, pjs, merge.MergeSHA) {
+		if state == failureState {
+			failed.Insert(job)
+		}
+	}
+	if failed.Len() == 0 {
+		return nil
+	}
+
+	laterSHAs := sets.NewString()
+	for _, pj := range pjs {
+		if pj.Spec.Refs.BaseSHA != merge.MergeSHA && pj.Status.StartTime.Time.After(merge.Time) {
+			laterSHAs.Insert(pj.Spec.Refs.BaseSHA)
+		}
+	}
+	for _, sha := range laterSHAs.List() {
+		states := postsubmitStates(v, pjs, sha)
+		fixed := true
+		for _, job := range failed.List() {
+			if states[job] != successState {
+				fixed = false
+				break
+			}
+		}
+		if fixed {
+			return nil
+		}
+	}
+	return merge
+}
+
+// reverted determines whether Tide already opened a PR to revert a merge.
+func reverted(records []*history.Record, merge *history.Record) bool {
+	for _, rec := range records {
+		if rec.Action == Revert && rec.BaseSHA == merge.MergeSHA {
+			return true
+		}
+	}
+	return false
+}
+
+// mergedPRs converts the targets of a merge record back into PRs, so that
+// they can be shown as the targets of a paused pool.
+func mergedPRs(sp subpool, merge *history.Record) []PullRequest {
+	var prs []PullRequest
+	for _, pull := range merge.Target {
+		var pr PullRequest
+		pr.Number = githubql.Int(pull.Number)
+		pr.Author.Login = githubql.String(pull.Author)
+		pr.Title = githubql.String(pull.Title)
+		pr.HeadRefOID = githubql.String(pull.SHA)
+		pr.BaseRef.Name = githubql.String(sp.branch)
+		pr.Repository.Name = githubql.String(sp.repo)
+		pr.Repository.NameWithOwner = githubql.String(sp.org + "/" + sp.repo)
+		pr.Repository.Owner.Login = githubql.String(sp.org)
+		prs = append(prs, pr)
+	}
+	return prs
+}
+
+// revertBranch returns the name of the branch that holds the commit that
+// reverts a merge.
+func revertBranch(merge *history.Record) string {
+	shortSHA := merge.MergeSHA
+	if len(shortSHA) > 7 {
+		shortSHA = shortSHA[:7]
+	}
+	return revertBranchPrefix + shortSHA
+}
+
+// revertPR returns the PR that Tide opened to revert a merge if it is ready
+// to be merged, or nil. PRs from forks only qualify if their head is the
+// revert branch of the repo itself.
+func (c *Controller) revertPR(sp subpool, successes []PullRequest, merge *history.Record) *PullRequest {
+	branch := revertBranch(merge)
+	for i, pr := range successes {
+		if string(pr.HeadRefName) != branch {
+			continue
+		}
+		if sha, err := c.ghc.GetRef(sp.org, sp.repo, "heads/"+branch); err != nil || sha != string(pr.HeadRefOID) {
+			continue
+		}
+		return &successes[i]
+	}
+	return nil
+}
+
+// revert opens a PR that reverts a merge. The revert commit has the merged
+// SHA as its parent and the tree of the branch before the merge, so it undoes
+// all PRs of the merge at once. A revert branch that is left over from an
+// earlier attempt is reused. It returns the number of the PR.
+func (c *Controller) revert(sp subpool, merge *history.Record) (int, error) {
+	var numbers []string
+	for _, pull := range merge.Target {
+		numbers = append(numbers, fmt.Sprintf("#%d", pull.Number))
+	}
+	title := fmt.Sprintf("Revert %s", strings.Join(numbers, ", "))
+	body := fmt.Sprintf("The postsubmits of %s failed after Tide merged %s into %s, so Tide reverts the merge. Merges into %s are paused until its postsubmits pass again, except for this PR once its tests pass.",
+		merge.MergeSHA, strings.Join(numbers, ", "), sp.branch, sp.branch)
+
+	branch := revertBranch(merge)
+	if sha, err := c.ghc.GetRef(sp.org, sp.repo, "heads/"+branch); err == nil && sha != "" {
+		sp.log.WithField("revert-branch", branch).Info("Reusing the revert branch of an earlier attempt.")
+	} else if err := c.createRevertBranch(sp, merge, branch, title+"\n\n"+body); err != nil {
+		return 0, err
+	}
+	number, err := c.ghc.CreatePullRequest(sp.org, sp.repo, title, body, branch, sp.branch, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open the revert PR: %v", err)
+	}
+	return number, nil
+}
+
+// createRevertBranch creates the branch of a revert PR with a commit that
+// reverts a merge.
+func (c *Controller) createRevertBranch(sp subpool, merge *history.Record, branch, message string) error {
+	base, err := c.ghc.GetSingleCommit(sp.org, sp.repo, merge.BaseSHA)
+	if err != nil {
+		return fmt.Errorf("failed to get the commit before the merge: %v", err)
+	}
+	sha, err := c.ghc.CreateCommit(sp.org, sp.repo, message, base.Commit.Tree.SHA, []string{merge.MergeSHA})
+	if err != nil {
+		return fmt.Errorf("failed to create the revert commit: %v", err)
+	}
+	if err := c.ghc.CreateRef(sp.org, sp.repo, "refs/heads/"+branch, sha); err != nil {
+		return fmt.Errorf("failed to create the revert branch: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tide
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/tide/history"
+)
+
+func postsubmit(job, sha string, state prowapi.ProwJobState, start time.Time) prowapi.ProwJob {
+	return prowapi.ProwJob{
+		Spec: prowapi.ProwJobSpec{
+			Type: prowapi.PostsubmitJob,
+			Job:  job,
+			Refs: &prowapi.Refs{
+				Org:     "o",
+				Repo:    "r",
+				BaseRef: "master",
+				BaseSHA: sha,
+			},
+		},
+		Status: prowapi.ProwJobStatus{
+			State:     state,
+			StartTime: metav1.NewTime(start),
+		},
+	}
+}
+
+func TestBrokenMerge(t *testing.T) {
+	mergeTime := time.Now()
+	before := mergeTime.Add(-time.Hour)
+	after := mergeTime.Add(time.Hour)
+	records := []*history.Record{
+		{Time: mergeTime.Add(time.Minute), Action: Trigger, BaseSHA: "merged"},
+		{Time: mergeTime, Action: Merge, BaseSHA: "base", MergeSHA: "merged"},
+		{Time: before, Action: Merge, BaseSHA: "older", MergeSHA: "base"},
+	}
+	testCases := []struct {
+		name         string
+		verification config.TidePostMergeVerification
+		records      []*history.Record
+		pjs          []prowapi.ProwJob
+		expected     string
+	}{
+		{
+			name:    "no verified merge",
+			records: []*history.Record{{Time: mergeTime, Action: Merge, BaseSHA: "base"}},
+			pjs:     []prowapi.ProwJob{postsubmit("build", "merged", prowapi.FailureState, after)},
+		},
+		{
+			name:    "postsubmits of the merge are pending",
+			records: records,
+			pjs:     []prowapi.ProwJob{postsubmit("build", "merged", prowapi.PendingState, after)},
+		},
+		{
+			name:    "postsubmit of the merge failed",
+			records: records,
+			pjs: []prowapi.ProwJob{
+				postsubmit("build", "merged", prowapi.FailureState, after),
+				postsubmit("test", "merged", prowapi.SuccessState, after),
+			},
+			expected: "merged",
+		},
+		{
+			name:    "failed postsubmit passed on a retry",
+			records: records,
+			pjs: []prowapi.ProwJob{
+				postsubmit("build", "merged", prowapi.FailureState, after),
+				postsubmit("build", "merged", prowapi.SuccessState, after),
+			},
+		},
+		{
+			name:    "aborted postsubmits are ignored",
+			records: records,
+			pjs:     []prowapi.ProwJob{postsubmit("build", "merged", prowapi.AbortedState, after)},
+		},
+		{
+			name:         "failed postsubmit that is not watched",
+			verification: config.TidePostMergeVerification{Jobs: []string{"test"}},
+			records:      records,
+			pjs:          []prowapi.ProwJob{postsubmit("build", "merged", prowapi.FailureState, after)},
+		},
+		{
+			name:    "postsubmits of an older merge failed",
+			records: records,
+			pjs:     []prowapi.ProwJob{postsubmit("build", "base", prowapi.FailureState, before)},
+		},
+		{
+			name:    "later commit fixed the branch",
+			records: records,
+			pjs: []prowapi.ProwJob{
+				postsubmit("build", "merged", prowapi.FailureState, after),
+				postsubmit("build", "fix", prowapi.SuccessState, after),
+			},
+		},
+		{
+			name:    "later commit is still being tested",
+			records: records,
+			pjs: []prowapi.ProwJob{
+				postsubmit("build", "merged", prowapi.FailureState, after),
+				postsubmit("build", "fix", prowapi.PendingState, after),
+			},
+			expected: "merged",
+		},
+		{
+			name:    "commit tested before the merge does not fix the branch",
+			records: records,
+			pjs: []prowapi.ProwJob{
+				postsubmit("build", "merged", prowapi.FailureState, after),
+				postsubmit("build", "base", prowapi.SuccessState, before),
+			},
+			expected: "merged",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var actual string
+			if merge := brokenMerge(&tc.verification, tc.records, tc.pjs); merge != nil {
+				actual = merge.MergeSHA
+			}
+			if actual != tc.expected {
+				t.Errorf("Expected broken merge %q, got %q.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSyncSubpoolVerification(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tide.PostMergeVerification = map[string]config.TidePostMergeVerification{
+		"o/r": {Revert: true},
+	}
+	ca := &config.Agent{}
+	ca.Set(cfg)
+	hist, err := history.New(100, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create history client: %v", err)
+	}
+	ghc := &fgc{
+		refs:  map[string]string{"o/r heads/master": "merged"},
+		trees: map[string]string{"base": "base-tree"},
+	}
+	c := &Controller{
+		logger:  logrus.WithField("component", "tide"),
+		config:  ca.Config,
+		ghc:     ghc,
+		History: hist,
+	}
+	sp := subpool{
+		log:    logrus.WithField("component", "tide"),
+		org:    "o",
+		repo:   "r",
+		branch: "master",
+		sha:    "base",
+		prs:    []PullRequest{testPR("o", "r", "master", 1, githubql.MergeableStateMergeable)},
+		cc:     &config.TideContextPolicy{},
+	}
+
+	pool, err := c.syncSubpool(sp, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error syncing the subpool: %v", err)
+	}
+	if pool.Action != Merge {
+		t.Fatalf("Expected the PR to be merged, got action %v.", pool.Action)
+	}
+	if merge := lastVerifiedMerge(hist.PoolRecords("o/r:master")); merge == nil || merge.MergeSHA != "merged" {
+		t.Fatalf("Expected the merge to be recorded with the SHA of the branch, got %+v.", merge)
+	}
+
+	// The postsubmits of the merge fail, so the merge is reverted once and the
+	// pool stays paused afterwards. A revert that fails is retried with the
+	// branch of the first attempt.
+	sp.sha = "merged"
+	sp.postsubmits = []prowapi.ProwJob{postsubmit("build", "merged", prowapi.FailureState, time.Now().Add(time.Hour))}
+	ghc.createPRErr = errors.New("injected error")
+	pool, err = c.syncSubpool(sp, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error syncing the subpool: %v", err)
+	}
+	if pool.Action != Revert || pool.Error == "" {
+		t.Errorf("Expected the revert to fail, got action %v and error %q.", pool.Action, pool.Error)
+	}
+	if reverted(hist.PoolRecords("o/r:master"), lastVerifiedMerge(hist.PoolRecords("o/r:master"))) {
+		t.Error("Expected the failed revert not to be recorded.")
+	}
+	ghc.createPRErr = nil
+	pool, err = c.syncSubpool(sp, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error syncing the subpool: %v", err)
+	}
+	if pool.Action != Revert || pool.Error != "" {
+		t.Errorf("Expected the merge to be reverted, got action %v and error %q.", pool.Action, pool.Error)
+	}
+	if len(ghc.createdCommits) != 1 {
+		t.Errorf("Expected the revert branch to be reused, got revert commits %v.", ghc.createdCommits)
+	}
+	if actual := prNumbers(pool.Target); !reflect.DeepEqual(actual, []int{1}) {
+		t.Errorf("Expected the merged PR to be the target, got %v.", actual)
+	}
+	if expected := map[string]string{"refs/heads/tide-revert-merged": "base-tree-merged"}; !reflect.DeepEqual(ghc.createdRefs, expected) {
+		t.Errorf("Expected revert branch %v, got %v.", expected, ghc.createdRefs)
+	}
+	if expected := []string{"tide-revert-merged:master"}; !reflect.DeepEqual(ghc.createdPRs, expected) {
+		t.Errorf("Expected revert PR %v, got %v.", expected, ghc.createdPRs)
+	}
+
+	pool, err = c.syncSubpool(sp, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error syncing the subpool: %v", err)
+	}
+	if pool.Action != PoolPaused {
+		t.Errorf("Expected the pool to be paused, got action %v.", pool.Action)
+	}
+	if len(ghc.createdPRs) != 1 {
+		t.Errorf("Expected the merge to be reverted only once, got revert PRs %v.", ghc.createdPRs)
+	}
+
+	// The revert PR is merged despite the pause once it passes, unlike a PR
+	// from a fork that uses the same branch name.
+	fork := testPR("o", "r", "master", 3, githubql.MergeableStateMergeable)
+	fork.HeadRefName = "tide-revert-merged"
+	fork.HeadRefOID = "fork"
+	revertPR := testPR("o", "r", "master", 2, githubql.MergeableStateMergeable)
+	revertPR.HeadRefName = "tide-revert-merged"
+	revertPR.HeadRefOID = "base-tree-merged"
+	sp.prs = []PullRequest{fork}
+	pool, err = c.syncSubpool(sp, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error syncing the subpool: %v", err)
+	}
+	if pool.Action != PoolPaused {
+		t.Errorf("Expected the pool to be paused, got action %v.", pool.Action)
+	}
+	sp.prs = []PullRequest{fork, revertPR}
+	ghc.refs["o/r heads/master"] = "reverted"
+	pool, err = c.syncSubpool(sp, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error syncing the subpool: %v", err)
+	}
+	if pool.Action != Merge || !reflect.DeepEqual(prNumbers(pool.Target), []int{2}) {
+		t.Errorf("Expected the revert PR to be merged, got action %v for %v.", pool.Action, prNumbers(pool.Target))
+	}
+	if merge := lastVerifiedMerge(hist.PoolRecords("o/r:master")); merge == nil || merge.MergeSHA != "reverted" {
+		t.Errorf("Expected the merge of the revert PR to be verified, got %+v.", merge)
+	}
+	sp.prs = []PullRequest{testPR("o", "r", "master", 1, githubql.MergeableStateMergeable)}
+
+	// A later commit passes the postsubmits, so merges resume.
+	sp.sha = "fixed"
+	ghc.refs["o/r heads/master"] = "fixed"
+	sp.postsubmits = append(sp.postsubmits, postsubmit("build", "fixed", prowapi.SuccessState, time.Now().Add(time.Hour)))
+	pool, err = c.syncSubpool(sp, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error syncing the subpool: %v", err)
+	}
+	if pool.Action != Merge {
+		t.Errorf("Expected merges to resume, got action %v.", pool.Action)
+	}
+}
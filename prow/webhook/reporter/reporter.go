@@ -0,0 +1,222 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reporter implements a crier reporter that POSTs the state changes
+// of ProwJobs to HTTP endpoints configured per job, org or repo.
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/errorutil"
+	"k8s.io/test-infra/prow/github"
+)
+
+const (
+	// WebhookReporterName is the name for webhook reporter
+	WebhookReporterName = "webhook-reporter"
+
+	// PayloadVersion is the version of the payloads that are sent. It
+	// changes when the payload changes in incompatible ways.
+	PayloadVersion = "v1"
+
+	// SignatureHeader holds the HMAC signature of the payload, in the
+	// format of the X-Hub-Signature header of GitHub webhooks.
+	SignatureHeader = "X-Prow-Signature"
+
+	// DeliveryHeader holds the delivery ID of the payload.
+	DeliveryHeader = "X-Prow-Delivery"
+
+	requestTimeout = 30 * time.Second
+
+	// deliveryRetention is how long the webhooks that a delivery reached
+	// are remembered, which covers the retries of crier.
+	deliveryRetention = time.Hour
+)
+
+// Payload is POSTed as JSON to the webhooks of a ProwJob.
+type Payload struct {
+	Version string `json:"version"`
+	// DeliveryID identifies the state change of the ProwJob that is
+	// reported. A payload may be delivered more than once, and receivers
+	// can use the ID to ignore the duplicates.
+	DeliveryID string          `json:"delivery_id"`
+	ProwJob    prowapi.ProwJob `json:"prowjob"`
+}
+
+// delivery holds the webhooks that a payload was delivered to.
+type delivery struct {
+	urls    sets.String
+	started time.Time
+}
+
+// Client is a webhook reporter client fed to crier controller
+type Client struct {
+	config     config.Getter
+	hmacSecret func() []byte
+	client     *http.Client
+	dryRun     bool
+
+	lock       sync.Mutex
+	deliveries map[string]*delivery
+}
+
+// NewReporter returns a reporter client that signs the payloads with
+// the given HMAC secret. In dry-run mode it only logs the payloads.
+func NewReporter(cfg config.Getter, hmacSecret func() []byte, dryRun bool) *Client {
+	return &Client{
+		config:     cfg,
+		hmacSecret: hmacSecret,
+		client:     &http.Client{Timeout: requestTimeout},
+		dryRun:     dryRun,
+		deliveries: map[string]*delivery{},
+	}
+}
+
+// GetName returns the name of the reporter
+func (c *Client) GetName() string {
+	return WebhookReporterName
+}
+
+// ShouldReport returns if any webhook of the prowjob reports its state
+func (c *Client) ShouldReport(pj *prowapi.ProwJob) bool {
+	return len(c.webhooks(pj)) > 0
+}
+
+// Report POSTs the prowjob to the webhooks that report its state, once per
+// URL. When crier retries a report that failed, only the webhooks that did
+// not get the payload yet are called again.
+func (c *Client) Report(pj *prowapi.ProwJob) error {
+	id := deliveryID(pj)
+	payload, err := json.Marshal(Payload{Version: PayloadVersion, DeliveryID: id, ProwJob: *pj})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %v", err)
+	}
+	signature := github.PayloadSignature(payload, c.hmacSecret())
+	delivered := c.delivered(id)
+	var errs []error
+	for _, webhook := range c.webhooks(pj) {
+		if delivered.Has(webhook.URL) {
+			continue
+		}
+		if err := c.post(webhook.URL, id, payload, signature); err != nil {
+			errs = append(errs, fmt.Errorf("failed to report to %s: %v", webhook.URL, err))
+			continue
+		}
+		delivered.Insert(webhook.URL)
+		c.markDelivered(id, webhook.URL)
+	}
+	return errorutil.NewAggregate(errs...)
+}
+
+// deliveryID derives the delivery ID of the current state of a prowjob.
+func deliveryID(pj *prowapi.ProwJob) string {
+	return uuid.NewV5(uuid.NamespaceOID, fmt.Sprintf("%s/%s/%s", pj.Namespace, pj.Name, pj.Status.State)).String()
+}
+
+// delivered returns the webhooks that a delivery already reached. It
+// forgets the deliveries that crier no longer retries.
+func (c *Client) delivered(id string) sets.String {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, d := range c.deliveries {
+		if time.Since(d.started) > deliveryRetention {
+			delete(c.deliveries, key)
+		}
+	}
+	d, ok := c.deliveries[id]
+	if !ok {
+		d = &delivery{urls: sets.NewString(), started: time.Now()}
+		c.deliveries[id] = d
+	}
+	return sets.NewString(d.urls.UnsortedList()...)
+}
+
+// markDelivered records that a delivery reached a webhook.
+func (c *Client) markDelivered(id, url string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if d, ok := c.deliveries[id]; ok {
+		d.urls.Insert(url)
+	}
+}
+
+// webhooks returns the webhooks of the prowjob and of its repo that report
+// its current state.
+func (c *Client) webhooks(pj *prowapi.ProwJob) []prowapi.WebhookReporterConfig {
+	var candidates []prowapi.WebhookReporterConfig
+	if pj.Spec.ReporterConfig != nil {
+		candidates = append(candidates, pj.Spec.ReporterConfig.Webhooks...)
+	}
+	if refs := pj.Spec.Refs; refs != nil {
+		candidates = append(candidates, c.config().WebhookReporter.WebhooksFor(refs.Org, refs.Repo)...)
+	}
+	var webhooks []prowapi.WebhookReporterConfig
+	for _, webhook := range candidates {
+		if reportsState(webhook, pj.Status.State) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks
+}
+
+func reportsState(webhook prowapi.WebhookReporterConfig, state prowapi.ProwJobState) bool {
+	if len(webhook.JobStatesToReport) == 0 {
+		return true
+	}
+	for _, s := range webhook.JobStatesToReport {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) post(url, id string, payload []byte, signature string) error {
+	if c.dryRun {
+		logrus.WithFields(logrus.Fields{"url": url, "delivery": id}).Infof("Not POSTing payload in dry-run mode: %s", string(payload))
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signature)
+	req.Header.Set(DeliveryHeader, id)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("response has status %q and body %q", resp.Status, string(body))
+	}
+	return nil
+}
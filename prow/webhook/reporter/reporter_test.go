@@ -0,0 +1,203 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reporter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+)
+
+var hmacSecret = []byte("abcde12345")
+
+func configGetter(webhooks map[string][]prowapi.WebhookReporterConfig) config.Getter {
+	return func() *config.Config {
+		return &config.Config{ProwConfig: config.ProwConfig{
+			WebhookReporter: config.WebhookReporter{Webhooks: webhooks},
+		}}
+	}
+}
+
+func testProwJob(state prowapi.ProwJobState, webhooks ...prowapi.WebhookReporterConfig) *prowapi.ProwJob {
+	pj := &prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "pj"},
+		Spec: prowapi.ProwJobSpec{
+			Type: prowapi.PostsubmitJob,
+			Job:  "post-foo",
+			Refs: &prowapi.Refs{Org: "o", Repo: "r", BaseRef: "master", BaseSHA: "abc"},
+		},
+		Status: prowapi.ProwJobStatus{State: state},
+	}
+	if len(webhooks) > 0 {
+		pj.Spec.ReporterConfig = &prowapi.ReporterConfig{Webhooks: webhooks}
+	}
+	return pj
+}
+
+func TestShouldReport(t *testing.T) {
+	failures := []prowapi.ProwJobState{prowapi.FailureState}
+	testCases := []struct {
+		name     string
+		webhooks map[string][]prowapi.WebhookReporterConfig
+		pj       *prowapi.ProwJob
+		expected bool
+	}{
+		{
+			name: "no webhooks",
+			pj:   testProwJob(prowapi.FailureState),
+		},
+		{
+			name:     "job webhook reports every state by default",
+			pj:       testProwJob(prowapi.PendingState, prowapi.WebhookReporterConfig{URL: "https://job"}),
+			expected: true,
+		},
+		{
+			name: "job webhook for other states",
+			pj:   testProwJob(prowapi.SuccessState, prowapi.WebhookReporterConfig{URL: "https://job", JobStatesToReport: failures}),
+		},
+		{
+			name:     "org webhook",
+			webhooks: map[string][]prowapi.WebhookReporterConfig{"o": {{URL: "https://org", JobStatesToReport: failures}}},
+			pj:       testProwJob(prowapi.FailureState),
+			expected: true,
+		},
+		{
+			name: "repo webhook takes precedence over org webhook",
+			webhooks: map[string][]prowapi.WebhookReporterConfig{
+				"o":   {{URL: "https://org"}},
+				"o/r": {{URL: "https://repo", JobStatesToReport: failures}},
+			},
+			pj: testProwJob(prowapi.SuccessState),
+		},
+		{
+			name:     "webhook of other org",
+			webhooks: map[string][]prowapi.WebhookReporterConfig{"other": {{URL: "https://org"}}},
+			pj:       testProwJob(prowapi.FailureState),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewReporter(configGetter(tc.webhooks), func() []byte { return hmacSecret }, false)
+			if actual := c.ShouldReport(tc.pj); actual != tc.expected {
+				t.Errorf("Expected ShouldReport to return %t, got %t.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	var received []Payload
+	handler := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("Failed to read request body: %v", err)
+			}
+			if !github.ValidatePayload(body, r.Header.Get(SignatureHeader), hmacSecret) {
+				t.Errorf("Invalid signature %q.", r.Header.Get(SignatureHeader))
+			}
+			var payload Payload
+			if err := json.Unmarshal(body, &payload); err != nil {
+				t.Fatalf("Failed to unmarshal payload: %v", err)
+			}
+			if id := r.Header.Get(DeliveryHeader); id != payload.DeliveryID {
+				t.Errorf("Expected delivery header %q, got %q.", payload.DeliveryID, id)
+			}
+			received = append(received, payload)
+			w.WriteHeader(status)
+		}
+	}
+	ok := httptest.NewServer(handler(http.StatusOK))
+	defer ok.Close()
+	broken := httptest.NewServer(handler(http.StatusInternalServerError))
+	defer broken.Close()
+
+	c := NewReporter(configGetter(map[string][]prowapi.WebhookReporterConfig{
+		"o": {{URL: ok.URL}},
+	}), func() []byte { return hmacSecret }, false)
+
+	pj := testProwJob(prowapi.FailureState, prowapi.WebhookReporterConfig{URL: ok.URL, JobStatesToReport: []prowapi.ProwJobState{prowapi.FailureState}})
+	pj.Name = "first"
+	if err := c.Report(pj); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id := deliveryID(pj)
+	if id == "" {
+		t.Fatal("Expected a delivery ID.")
+	}
+	expected := []Payload{{Version: PayloadVersion, DeliveryID: id, ProwJob: *pj}}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Expected the webhook to be called once with payloads %+v, got %+v.", expected, received)
+	}
+
+	received = nil
+	pj = testProwJob(prowapi.FailureState, prowapi.WebhookReporterConfig{URL: broken.URL})
+	pj.Name = "second"
+	if err := c.Report(pj); err == nil {
+		t.Error("Expected an error for the failing webhook, got none.")
+	}
+	if len(received) != 2 {
+		t.Errorf("Expected both webhooks to be called, got %d payloads.", len(received))
+	}
+
+	// Retries only call the webhooks that failed.
+	received = nil
+	if err := c.Report(pj); err == nil {
+		t.Error("Expected an error for the failing webhook, got none.")
+	}
+	if len(received) != 1 {
+		t.Errorf("Expected only the failing webhook to be called, got %d payloads.", len(received))
+	}
+
+	// Other states are new deliveries.
+	received = nil
+	pj.Status.State = prowapi.SuccessState
+	if err := c.Report(pj); err == nil {
+		t.Error("Expected an error for the failing webhook, got none.")
+	}
+	if len(received) != 2 {
+		t.Errorf("Expected both webhooks to be called, got %d payloads.", len(received))
+	}
+	if len(received) > 0 && received[0].DeliveryID == id {
+		t.Errorf("Expected a new delivery ID, got %q again.", id)
+	}
+}
+
+func TestReportDryRun(t *testing.T) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	c := NewReporter(configGetter(nil), func() []byte { return hmacSecret }, true)
+	if err := c.Report(testProwJob(prowapi.FailureState, prowapi.WebhookReporterConfig{URL: server.URL})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if called {
+		t.Error("Expected no webhook to be called in dry-run mode.")
+	}
+}